@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/betterleaks/betterleaks/report"
+	"github.com/spf13/cobra"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func baselineCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "baseline <results.jsonl>...",
+		Short: "Convert results into a .gitleaksbaseline",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   runBaseline,
+	}
+}
+
+func runBaseline(cmd *cobra.Command, args []string) {
+	var results []*proto.Result
+
+	for _, path := range args {
+		pathResults, err := readResults(path)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+
+		results = append(results, pathResults...)
+	}
+
+	out, err := json.MarshalIndent(baselineFindings(results), "", " ")
+	if err != nil {
+		logger.Fatal("could not encode baseline: %v", err)
+	}
+
+	fmt.Println(string(out))
+}
+
+// baselineFindings converts results back into the gitleaks findings they came
+// from. Gitleaks only skips findings in a baseline that match every location,
+// commit and secret field so results need to come from the same kind of scan.
+func baselineFindings(results []*proto.Result) []report.Finding {
+	findings := make([]report.Finding, 0, len(results))
+
+	for _, result := range results {
+		findings = append(findings, report.Finding{
+			RuleID:      result.Rule.ID,
+			Description: result.Rule.Description,
+			StartLine:   result.Location.Start.Line,
+			EndLine:     result.Location.End.Line,
+			StartColumn: result.Location.Start.Column,
+			EndColumn:   result.Location.End.Column,
+			Line:        result.Context,
+			Match:       result.Match,
+			Secret:      result.Secret,
+			File:        result.Location.Path,
+			Commit:      result.Location.Version,
+			Entropy:     result.Entropy,
+			Author:      result.Contact.Name,
+			Email:       result.Contact.Email,
+			Date:        result.Date,
+			Message:     result.Notes["commit_message"],
+			Tags:        result.Rule.Tags,
+			Fingerprint: result.Notes["gitleaks_fingerprint"],
+		})
+	}
+
+	return findings
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+	"github.com/leaktk/leaktk/pkg/scanner/betterleaks"
+)
+
+func TestBaselineFindings(t *testing.T) {
+	cfg, err := betterleaks.ParseConfig(`
+[[rules]]
+id = "secret"
+regex = '''secret=[a-z]+'''
+`)
+	require.NoError(t, err)
+
+	sourcePath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(sourcePath, "config.txt"), []byte("secret=alpha\nsecret=bravo\n"), 0600))
+
+	findings, err := betterleaks.ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), sourcePath, betterleaks.FilesScanOpts{})
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+
+	// Only baseline the first finding
+	finding := findings[0]
+	results := []*proto.Result{{
+		Secret:  finding.Secret,
+		Match:   finding.Match,
+		Context: finding.Line,
+		Entropy: finding.Entropy,
+		Date:    finding.Date,
+		Rule:    proto.Rule{ID: finding.RuleID, Description: finding.Description, Tags: finding.Tags},
+		Contact: proto.Contact{Name: finding.Author, Email: finding.Email},
+		Location: proto.Location{
+			Version: finding.Commit,
+			Path:    finding.File,
+			Start:   proto.Point{Line: finding.StartLine, Column: finding.StartColumn},
+			End:     proto.Point{Line: finding.EndLine, Column: finding.EndColumn},
+		},
+		Notes: map[string]string{"gitleaks_fingerprint": finding.Fingerprint},
+	}}
+
+	data, err := json.Marshal(baselineFindings(results))
+	require.NoError(t, err)
+	baselinePath := filepath.Join(t.TempDir(), ".gitleaksbaseline")
+	require.NoError(t, os.WriteFile(baselinePath, data, 0600))
+
+	// The baseline parses back and skips the finding it came from
+	detector := detect.NewDetectorContext(t.Context(), *cfg)
+	require.NoError(t, detector.AddBaseline(baselinePath, filepath.Dir(baselinePath)))
+
+	remaining, err := betterleaks.ScanFiles(t.Context(), detector, sourcePath, betterleaks.FilesScanOpts{})
+	require.NoError(t, err)
+	require.Len(t, remaining, 1)
+	assert.NotEqual(t, finding.Secret, remaining[0].Secret)
+	assert.Equal(t, finding.Fingerprint, baselineFindings(results)[0].Fingerprint)
+}
@@ -8,17 +8,25 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"net/url"
 	"os"
+	"os/signal"
+	"path"
+	"path/filepath"
 	"regexp"
 	"slices"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
 	"github.com/BurntSushi/toml"
 	"github.com/spf13/cobra"
+	"golang.org/x/term"
 
+	"github.com/leaktk/leaktk/internal/git"
 	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/fs"
 	"github.com/leaktk/leaktk/pkg/hooks"
@@ -44,27 +52,91 @@ func runHelp(cmd *cobra.Command, args []string) {
 	}
 }
 
+// loginServerURL returns the --server flag or the configured pattern server
+func loginServerURL(cmd *cobra.Command) string {
+	if serverURL := mustGetString(cmd.Flags(), "server"); len(serverURL) > 0 {
+		return serverURL
+	}
+
+	return cfg.Scanner.Patterns.Server.URL
+}
+
 func runLogin(cmd *cobra.Command, args []string) {
-	logger.Info("logging in: pattern_server=%q", cfg.Scanner.Patterns.Server.URL)
+	serverURL := loginServerURL(cmd)
+	logger.Info("logging in: pattern_server=%q", serverURL)
 
-	fmt.Printf("Enter %s auth token: ", cfg.Scanner.Patterns.Server.URL)
+	fmt.Printf("Enter %s auth token: ", serverURL)
 
-	var authToken string
-	if _, err := fmt.Scanln(&authToken); err != nil {
+	authToken, err := readAuthToken(os.Stdin)
+	if err != nil {
 		logger.Fatal("could not login: %v", err)
 	}
 
-	if err := config.SavePatternServerAuthToken(authToken); err != nil {
+	if err := config.SavePatternServerAuthToken(serverURL, authToken); err != nil {
 		logger.Fatal("could not login: %v", err)
 	}
 
 	logger.Info("token saved")
 }
 
+// readAuthToken reads the token without echoing it when in is a terminal so
+// it doesn't end up on shared screens. Piped input is read like normal.
+func readAuthToken(in *os.File) (string, error) {
+	fd := int(in.Fd()) // #nosec G115
+	if !term.IsTerminal(fd) {
+		var authToken string
+		_, err := fmt.Fscanln(in, &authToken)
+
+		return authToken, err
+	}
+
+	rawAuthToken, err := term.ReadPassword(fd)
+	// ReadPassword doesn't echo the newline either
+	fmt.Println()
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(rawAuthToken)), nil
+}
+
+func runLoginList(cmd *cobra.Command, args []string) {
+	authTokens, err := config.ListPatternServerAuthTokens()
+	if err != nil {
+		logger.Fatal("could not list logins: %v", err)
+	}
+
+	for _, serverURL := range slices.Sorted(maps.Keys(authTokens)) {
+		fmt.Printf("%s %s\n", serverURL, redactAuthToken(authTokens[serverURL]))
+	}
+}
+
+// redactAuthToken hides all but the end of long tokens so they can be told
+// apart without showing enough of them to be useful
+func redactAuthToken(authToken string) string {
+	if len(authToken) < 16 {
+		return "****"
+	}
+
+	return "****" + authToken[len(authToken)-4:]
+}
+
 func runLogout(cmd *cobra.Command, args []string) {
-	logger.Info("logging out: pattern_server=%q", cfg.Scanner.Patterns.Server.URL)
+	if mustGetBool(cmd.Flags(), "all") {
+		logger.Info("logging out of all pattern servers")
+
+		if err := config.RemoveAllPatternServerAuthTokens(); err != nil {
+			logger.Fatal("could not logout: %v", err)
+		}
+
+		logger.Info("tokens removed")
+		return
+	}
+
+	serverURL := loginServerURL(cmd)
+	logger.Info("logging out: pattern_server=%q", serverURL)
 
-	if err := config.RemovePatternServerAuthToken(); err != nil {
+	if err := config.RemovePatternServerAuthToken(serverURL, cfg.Scanner.Patterns.Server.URL); err != nil {
 		logger.Fatal("could not logout: %v", err)
 	}
 
@@ -72,55 +144,148 @@ func runLogout(cmd *cobra.Command, args []string) {
 }
 
 func loginCommand() *cobra.Command {
-	return &cobra.Command{
+	loginCommand := &cobra.Command{
 		Use:   "login",
 		Short: "Log into a pattern server",
+		Args:  cobra.NoArgs,
 		Run:   runLogin,
 	}
+
+	loginCommand.Flags().String("server", "", "The pattern server to log into (default scanner.patterns.server.url)")
+	loginCommand.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "List the pattern servers with saved tokens",
+		Args:  cobra.NoArgs,
+		Run:   runLoginList,
+	})
+
+	return loginCommand
 }
 
 func logoutCommand() *cobra.Command {
-	return &cobra.Command{
+	logoutCommand := &cobra.Command{
 		Use:   "logout",
 		Short: "Log out of a pattern server",
+		Args:  cobra.NoArgs,
 		Run:   runLogout,
 	}
+
+	flags := logoutCommand.Flags()
+	flags.String("server", "", "The pattern server to log out of (default scanner.patterns.server.url)")
+	flags.Bool("all", false, "Log out of every pattern server")
+
+	return logoutCommand
+}
+
+// gitleaksConfigURLExt returns the extension of the config URL's path or
+// ".toml" if it doesn't have one
+func gitleaksConfigURLExt(configURL string) string {
+	parsedURL, err := url.Parse(configURL)
+	if err != nil {
+		return ".toml"
+	}
+
+	if ext := path.Ext(parsedURL.Path); len(ext) > 0 {
+		return ext
+	}
+
+	return ".toml"
+}
+
+// writeTempGitleaksConfig writes the config to a temp file matching pattern
+// and returns its path. The caller is responsible for removing it.
+func writeTempGitleaksConfig(pattern, rawConfig string) string {
+	tmpFile, err := os.CreateTemp("", pattern)
+	if err != nil {
+		logger.Fatal("could not create a temp config: %v", err)
+	}
+
+	if _, err := tmpFile.WriteString(rawConfig); err != nil {
+		_ = tmpFile.Close()
+		_ = os.Remove(tmpFile.Name())
+		logger.Fatal("could not write temp config: %v", err)
+	}
+	_ = tmpFile.Close()
+
+	return tmpFile.Name()
+}
+
+// openScanOutput creates (or truncates) the file at path for writing scan
+// results to, creating any missing parent dirs along the way
+func openScanOutput(path string) *os.File {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		logger.Fatal("could not create output dir: %v path=%q", err, path)
+	}
+
+	// Results can contain secrets so only the owner can read them
+	output, err := os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		logger.Fatal("could not open output file: %v path=%q", err, path)
+	}
+
+	return output
 }
 
 func runScan(cmd *cobra.Command, args []string) {
+	// Quiet only leaves errors in the logs so stdout and stderr are just the
+	// results and any problems with the scan
+	if mustGetBool(cmd.Flags(), "quiet") {
+		if err := logger.SetLoggerLevel("ERROR"); err != nil {
+			logger.Fatal("could not enable quiet mode: %v", err)
+		}
+	}
+
 	leakExitCode, err := cmd.Flags().GetInt("leak-exit-code")
 	if err != nil {
 		logger.Fatal("invalid leak-exit-code: %v", err)
 	}
 
+	errorExitCode, err := cmd.Flags().GetInt("error-exit-code")
+	if err != nil {
+		logger.Fatal("invalid error-exit-code: %v", err)
+	}
+
+	// From here on errors are also written as a response so the output can
+	// be parsed the same way whether or not the scan could run
+	requestID, _ := cmd.Flags().GetString("id")
+	output := os.Stdout
+	fail := func(format string, args ...any) {
+		exitWithScanError(output, requestID, errorExitCode, fmt.Sprintf(format, args...))
+	}
+
 	grepPattern, err := cmd.Flags().GetString("grep")
 	if err != nil {
-		logger.Fatal("invalid grep: %v", err)
+		fail("invalid grep: %v", err)
 	}
 
 	gitleaksConfig, err := cmd.Flags().GetString("gitleaks-config")
 	if err != nil {
-		logger.Fatal("invalid gitleaks-config: %v", err.Error())
+		fail("invalid gitleaks-config: %v", err)
 	}
 
 	if len(grepPattern) != 0 {
 		if _, err := regexp.Compile(grepPattern); err != nil {
-			logger.Fatal("invalid grep pattern: %v", err)
+			fail("invalid grep pattern: %v", err)
 		}
 
-		tmpFile, err := os.CreateTemp("", "leaktk-grep-*.toml")
+		tmpConfigPath := writeTempGitleaksConfig("leaktk-grep-*.toml", buildGitleaksConfig(grepPattern))
+		defer func() { _ = os.Remove(tmpConfigPath) }()
+
+		gitleaksConfig = tmpConfigPath
+	}
+
+	if strings.HasPrefix(gitleaksConfig, "https://") || strings.HasPrefix(gitleaksConfig, "http://") {
+		logger.Debug("fetching gitleaks config: url=%q", gitleaksConfig)
+		rawConfig, err := scanner.FetchGitleaksConfig(cmd.Context(), cfg, gitleaksConfig)
 		if err != nil {
-			logger.Fatal("could not create a temp config: %v", err)
+			fail("could not fetch gitleaks config: %v url=%q", err, gitleaksConfig)
 		}
-		defer func() { _ = os.Remove(tmpFile.Name()) }()
 
-		if _, err := tmpFile.WriteString(buildGitleaksConfig(grepPattern)); err != nil {
-			_ = tmpFile.Close()
-			logger.Fatal("could not write temp config: %v", err)
-		}
-		_ = tmpFile.Close()
+		// Keep the extension so the config format can still be detected from it
+		tmpConfigPath := writeTempGitleaksConfig("leaktk-gitleaks-*"+gitleaksConfigURLExt(gitleaksConfig), rawConfig)
+		defer func() { _ = os.Remove(tmpConfigPath) }()
 
-		gitleaksConfig = tmpFile.Name()
+		gitleaksConfig = tmpConfigPath
 	}
 
 	// Providing a gitleaks-config via command line arguments takes
@@ -141,26 +306,54 @@ func runScan(cmd *cobra.Command, args []string) {
 
 	request, err := scanCommandToRequest(cmd, args)
 	if err != nil {
-		logger.Fatal("could not generate scan request: %v", err)
+		fail("could not generate scan request: %v", err)
 	}
 
-	formatter, err := NewFormatter(cfg.Formatter)
+	outputPath, err := cmd.Flags().GetString("output")
+	if err != nil {
+		fail("invalid output: %v", err)
+	}
+
+	if len(outputPath) > 0 {
+		output = openScanOutput(outputPath)
+	}
+
+	formatter, err := NewFormatter(cfg.Formatter, output)
 	if err != nil {
 		logger.Fatal("%v", err)
 	}
 
 	var wg sync.WaitGroup
-	leaktkScanner := scanner.NewScanner(cfg)
+	flushTraces := setupTracing()
+	leaktkScanner := newScanner()
 	leaksFound := false
+	scanFailed := false
+
+	// SARIF is one document for the whole scan so the results from each
+	// response are streamed into it instead of formatted on their own
+	var sarif *sarifWriter
+	if formatter.format == SARIF {
+		sarif = newSarifWriter(output)
+	}
 
 	// Prints the output of the scanner as they come
 	go leaktkScanner.Recv(func(response *proto.Response) {
+		// Heartbeats are only for listen clients
+		if response.Kind == proto.HeartbeatResponseKind {
+			return
+		}
 		if !leaksFound && len(response.Results) > 0 {
 			leaksFound = true
 		}
-		fmt.Println(formatter.Format(response))
+		if sarif != nil {
+			sarif.WriteResponse(response)
+		} else if _, err := fmt.Fprintln(output, formatter.Format(response)); err != nil {
+			logger.Error("could not write response: %v", err)
+			scanFailed = true
+		}
 		if response.Error != nil {
-			logger.Fatal("response contains error: %w", response.Error)
+			logger.Error("response contains error: %v", response.Error)
+			scanFailed = true
 		}
 		wg.Done()
 	})
@@ -169,11 +362,72 @@ func runScan(cmd *cobra.Command, args []string) {
 	leaktkScanner.Send(request)
 	wg.Wait()
 
+	if sarif != nil {
+		if err := sarif.Close(); err != nil {
+			logger.Error("could not write response: %v", err)
+			scanFailed = true
+		}
+	}
+
+	// Close explicitly since os.Exit skips deferred calls
+	flushTraces()
+	if output != os.Stdout {
+		if err := output.Close(); err != nil {
+			logger.Error("could not close output file: %v path=%q", err, outputPath)
+			scanFailed = true
+		}
+	}
+
+	// A failed scan takes precedence over leaks since the results may be
+	// incomplete
+	if scanFailed {
+		os.Exit(errorExitCode)
+	}
+
 	if leaksFound {
 		os.Exit(leakExitCode)
 	}
 }
 
+// scanErrorResponse returns a response for an error that kept the scan from
+// running
+func scanErrorResponse(requestID, message string) *proto.Response {
+	return &proto.Response{
+		ID:        id.ID(),
+		Kind:      proto.ScanResultsResponseKind,
+		RequestID: requestID,
+		Error: &proto.Error{
+			Message: message,
+		},
+	}
+}
+
+// exitWithScanError logs the error, writes it to output as a response in the
+// configured format and exits with exitCode. The HUMAN format doesn't show
+// errors so it only gets the log.
+func exitWithScanError(output *os.File, requestID string, exitCode int, message string) {
+	logger.Error("%s", message)
+
+	formatter, err := NewFormatter(cfg.Formatter, output)
+	if err != nil {
+		logger.Fatal("could not write scan error: %v", err)
+	}
+
+	if formatter.format != HUMAN {
+		if _, err := fmt.Fprintln(output, formatter.Format(scanErrorResponse(requestID, message))); err != nil {
+			logger.Error("could not write scan error: %v", err)
+		}
+	}
+
+	if output != os.Stdout {
+		if err := output.Close(); err != nil {
+			logger.Error("could not close output file: %v", err)
+		}
+	}
+
+	os.Exit(exitCode)
+}
+
 func scanCommandToRequest(cmd *cobra.Command, args []string) (*proto.Request, error) {
 	flags := cmd.Flags()
 
@@ -187,6 +441,25 @@ func scanCommandToRequest(cmd *cobra.Command, args []string) (*proto.Request, er
 		return nil, errors.New("missing required field: field=\"kind\"")
 	}
 
+	staged, err := flags.GetBool("staged")
+	if err != nil {
+		return nil, fmt.Errorf("there was an issue with the staged flag: %w", err)
+	}
+
+	unstaged, err := flags.GetBool("unstaged")
+	if err != nil {
+		return nil, fmt.Errorf("there was an issue with the unstaged flag: %w", err)
+	}
+
+	if staged && unstaged {
+		return nil, errors.New("staged and unstaged can not both be set")
+	}
+
+	// Diff scans default to the repo in the current directory
+	if len(args) == 0 && (staged || unstaged) {
+		args = []string{"."}
+	}
+
 	if len(args) == 0 || len(args[0]) == 0 {
 		return nil, errors.New("missing required field: field=\"resource\"")
 	}
@@ -224,6 +497,75 @@ func scanCommandToRequest(cmd *cobra.Command, args []string) (*proto.Request, er
 		}
 	}
 
+	// Options set with their own flags can't also be set in --options
+	if flags.Changed("branch") {
+		if len(opts.Branch) > 0 {
+			return nil, errors.New("branch set in both --branch and --options")
+		}
+		if opts.Branch, err = flags.GetString("branch"); err != nil {
+			return nil, fmt.Errorf("there was an issue with the branch flag: %w", err)
+		}
+	}
+
+	if flags.Changed("ref") {
+		if len(opts.Ref) > 0 {
+			return nil, errors.New("ref set in both --ref and --options")
+		}
+		if opts.Ref, err = flags.GetString("ref"); err != nil {
+			return nil, fmt.Errorf("there was an issue with the ref flag: %w", err)
+		}
+	}
+
+	if flags.Changed("depth") {
+		if opts.Depth != 0 {
+			return nil, errors.New("depth set in both --depth and --options")
+		}
+		if opts.Depth, err = flags.GetInt("depth"); err != nil {
+			return nil, fmt.Errorf("there was an issue with the depth flag: %w", err)
+		}
+	}
+
+	if flags.Changed("since") {
+		if len(opts.Since) > 0 {
+			return nil, errors.New("since set in both --since and --options")
+		}
+		if opts.Since, err = flags.GetString("since"); err != nil {
+			return nil, fmt.Errorf("there was an issue with the since flag: %w", err)
+		}
+	}
+
+	if staged {
+		opts.Staged = true
+	}
+
+	if unstaged {
+		opts.Unstaged = true
+	}
+
+	if flags.Changed("pathspec") {
+		if len(opts.Pathspecs) > 0 {
+			return nil, errors.New("pathspecs set in both --pathspec and --options")
+		}
+		if !opts.Staged && !opts.Unstaged {
+			return nil, errors.New("pathspec needs staged or unstaged to be set")
+		}
+		if opts.Pathspecs, err = flags.GetStringArray("pathspec"); err != nil {
+			return nil, fmt.Errorf("there was an issue with the pathspec flag: %w", err)
+		}
+	}
+
+	if mustGetBool(flags, "incremental") {
+		opts.Incremental = true
+	}
+
+	if mustGetBool(flags, "resume") {
+		opts.Resume = true
+	}
+
+	if mustGetBool(flags, "sort") {
+		opts.Sort = true
+	}
+
 	// automatically set the is local flag
 	if requestKind == proto.GitRepoRequestKind && !opts.Local {
 		opts.Local = fs.PathExists(requestResource)
@@ -248,7 +590,16 @@ func runHook(cmd *cobra.Command, args []string) {
 		logger.Fatal("invalid hookname: hookname=%q", hookname)
 	}
 
-	statusCode, err := hooks.Run(cfg, hook, args[1:])
+	hookargs := args[1:]
+	if mustGetBool(cmd.Flags(), "files") {
+		if hook != hooks.GitPreCommitHook {
+			logger.Fatal("--files is only supported by %s: hookname=%q", hooks.GitPreCommitHook, hookname)
+		}
+
+		hookargs = hooks.GitLiteralPathspecs(hookargs)
+	}
+
+	statusCode, err := hooks.Run(cfg, hook, hookargs)
 	if err != nil {
 		logger.Fatal("error running hook: %v hookname=%q", err, hookname)
 	}
@@ -262,13 +613,18 @@ func hookCommand() *cobra.Command {
 		validArgs[i] = hook.Name()
 	}
 
-	return &cobra.Command{
+	hookCommand := &cobra.Command{
 		Use:       "hook [flags] <hookname> [hookargs]...",
 		Short:     "Hook leaktk into existng workflows",
 		Args:      cobra.MinimumNArgs(1),
 		ValidArgs: validArgs,
 		Run:       runHook,
 	}
+
+	flags := hookCommand.Flags()
+	flags.Bool("files", false, fmt.Sprintf("Treat the hookargs as file paths instead of git pathspecs (e.g. when %s is run by pre-commit.com)", hooks.GitPreCommitHook))
+
+	return hookCommand
 }
 
 func scanCommand() *cobra.Command {
@@ -282,14 +638,30 @@ func scanCommand() *cobra.Command {
 
 	flags := scanCommand.Flags()
 	flags.String("id", id.ID(), "Set the ID request ID that will be displayed in the response and logs")
-	flags.StringP("kind", "k", "GitRepo", "Specify the kind of resource being scanned (ContainerImage, Files, GitRepo, JSONData, Text, URL)")
+	flags.StringP("kind", "k", "GitRepo", "Specify the kind of resource being scanned (ContainerImage, Files, GitRepo, INIData, JSONData, Text, URL, XMLData)")
 	flags.StringP("options", "o", "{}", "Provide scan specific options formatted as JSON")
 	flags.Int("leak-exit-code", 0, "Exit with this code when leaks are detected (default 0)")
-	flags.String("gitleaks-config", "", "Load a custom gitleaks config")
+	flags.Int("error-exit-code", config.ExitCodeBlockingError, "Exit with this code when the scan fails (takes precedence over --leak-exit-code)")
+	flags.String("gitleaks-config", "", "Load a custom gitleaks config from a path or http(s) URL")
 	flags.StringP("grep", "g", "", "Scan using ad-hoc regex instead of the configured patterns")
+	flags.BoolP("quiet", "q", false, "Only log errors so the output is just the scan results")
+	flags.String("output", "", "Write the scan results to this file instead of stdout")
+	flags.IntP("jobs", "j", 0, "Override the number of scan workers (default scanner.scan_workers)")
+	flags.String("branch", "", "Only scan this branch of a GitRepo (same as the branch option)")
+	flags.String("ref", "", "Only scan this branch, tag or commit SHA of a GitRepo (same as the ref option)")
+	flags.Int("depth", 0, "Limit the number of commits or layers scanned (same as the depth option)")
+	flags.String("since", "", "Only scan commits, layers, or files modified since this date formatted yyyy-mm-dd (same as the since option)")
+	flags.Bool("staged", false, "Only scan staged changes in a local GitRepo (resource defaults to \".\")")
+	flags.Bool("unstaged", false, "Only scan unstaged changes in a local GitRepo (resource defaults to \".\")")
+	flags.StringArray("pathspec", nil, "Limit --staged or --unstaged scans to the files matching this git pathspec (can be repeated)")
+	flags.Bool("incremental", false, "Only scan what's new since the last successful incremental scan of the resource (same as the incremental option)")
+	flags.Bool("resume", false, "Checkpoint the scan and skip what an interrupted run of the same scan finished (same as the resume option)")
+	flags.Bool("sort", false, "Sort the results by path, line and rule (same as the sort option)")
 
 	// Ensure incompatible flags can't be combined
 	scanCommand.MarkFlagsMutuallyExclusive("grep", "gitleaks-config")
+	scanCommand.MarkFlagsMutuallyExclusive("staged", "unstaged")
+	scanCommand.MarkFlagsMutuallyExclusive("branch", "ref")
 
 	return scanCommand
 }
@@ -327,59 +699,162 @@ func readLine(reader *bufio.Reader) ([]byte, error) {
 
 func runListen(cmd *cobra.Command, args []string) {
 	var wg sync.WaitGroup
+	var outputMutex sync.Mutex
 
-	stdinReader := bufio.NewReader(os.Stdin)
-	leaktkScanner := scanner.NewScanner(cfg)
-
-	// Prints the output of the scanner as they come
-	go leaktkScanner.Recv(func(response *proto.Response) {
-		fmt.Println(formatJSON(response))
-		wg.Done()
-	})
+	flags := cmd.Flags()
 
-	// Listen for requests
-	for {
-		line, err := readLine(stdinReader)
+	var lines <-chan []byte
+	if inputPath := mustGetString(flags, "input"); len(inputPath) == 0 {
+		lines = readStdin()
+	} else {
+		// The input is reopened whenever its writer closes, so stop on a signal
+		// instead and let the scans already sent finish
+		ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+
+		var err error
+		lines, err = readListenInput(ctx, inputPath)
+		if err != nil {
+			logger.Fatal("could not read input: %v path=%q", err, inputPath)
+		}
+	}
 
+	var output io.Writer = os.Stdout
+	if outputPath := mustGetString(flags, "output"); len(outputPath) > 0 {
+		outputFile, err := newListenOutput(outputPath)
 		if err != nil {
-			if err == io.EOF {
-				break
+			logger.Fatal("could not open output: %v path=%q", err, outputPath)
+		}
+
+		defer func() {
+			if err := outputFile.Close(); err != nil {
+				logger.Error("could not close output: %v path=%q", err, outputPath)
 			}
+		}()
 
-			logger.Error("error reading from stdin: %v", err)
+		output = outputFile
+	}
 
-			continue
+	flushTraces := setupTracing()
+	defer flushTraces()
+	leaktkScanner := newScanner()
+
+	var deduper *resultDeduper
+	if mustGetBool(flags, "dedup") {
+		dedupSize := mustGetInt(flags, "dedup-size")
+		if dedupSize < 1 {
+			logger.Fatal("dedup-size must be greater than 0: dedup_size=%d", dedupSize)
 		}
 
-		var request proto.Request
-		err = json.Unmarshal(line, &request)
+		deduper = newResultDeduper(dedupSize)
+	}
 
-		if err != nil {
-			logger.Error("could not unmarshal request: %v", err)
+	var sequencer *requestSequencer
+	if mustGetBool(flags, "seq") {
+		sequencer = newRequestSequencer()
+	}
+
+	// Invalid requests are answered from the loop below while the scanner's
+	// responses are printed as they come, so only one can print at a time
+	printResponse := func(response *proto.Response) {
+		outputMutex.Lock()
+		defer outputMutex.Unlock()
 
+		if err := writeResponseLine(output, formatJSON(response)); err != nil {
+			logger.Error("could not write response: %v request_id=%q", err, response.RequestID)
+		}
+	}
+
+	go leaktkScanner.Recv(func(response *proto.Response) {
+		if deduper != nil {
+			response.Results = deduper.Filter(response.Results)
+		}
+
+		if sequencer != nil {
+			sequencer.Set(response)
+		}
+
+		printResponse(response)
+
+		// Heartbeats don't finish a request
+		if response.Kind != proto.HeartbeatResponseKind {
+			wg.Done()
+		}
+	})
+
+	// Listen for requests
+	var seq uint64
+	for line := range lines {
+		seq++
+		if len(bytes.TrimSpace(line)) == 0 {
 			continue
 		}
 
-		if len(request.Resource) == 0 {
-			logger.Error("no resource provided: request_id=%q", request.ID)
+		request, errResponse := parseRequest(line)
+		if errResponse != nil {
+			if sequencer != nil {
+				errResponse.RequestSeq = seq
+			}
+
+			printResponse(errResponse)
 
 			continue
 		}
 
+		if sequencer != nil {
+			sequencer.Add(request.ID, seq)
+		}
+
 		wg.Add(1)
-		leaktkScanner.Send(&request)
+		leaktkScanner.Send(request)
 	}
 
 	// Wait for all of the scans to complete and responses to be sent
 	wg.Wait()
 }
 
+// newScanner creates the scanner for the command and exits if it can't be
+// set up
+func newScanner() *scanner.Scanner {
+	leaktkScanner, err := scanner.NewScanner(cfg)
+	if err != nil {
+		logger.Fatal("could not create scanner: %v", err)
+	}
+
+	return leaktkScanner
+}
+
+// setupTracing starts exporting scan spans if tracing is configured and
+// returns a func that flushes them before exiting
+func setupTracing() func() {
+	shutdown, err := scanner.SetupTracing(context.Background(), cfg)
+	if err != nil {
+		logger.Fatal("could not set up tracing: %v", err)
+	}
+
+	return func() {
+		if err := shutdown(context.Background()); err != nil {
+			logger.Error("could not flush traces: %v", err)
+		}
+	}
+}
+
 func listenCommand() *cobra.Command {
-	return &cobra.Command{
+	cmd := &cobra.Command{
 		Use:   "listen",
 		Short: "Listen for scan requests on stdin",
 		Run:   runListen,
 	}
+
+	flags := cmd.Flags()
+	flags.Bool("dedup", false, "Leave out results already sent in an earlier response")
+	flags.Int("dedup-size", 100_000, "The max number of result IDs remembered by --dedup")
+	flags.Bool("seq", false, "Add a request_seq to each response with the line number of the request it's for")
+	flags.String("input", "", "Read requests from this FIFO or Unix socket instead of stdin")
+	flags.String("output", "", "Write responses to this file, FIFO or Unix socket instead of stdout")
+	flags.IntP("jobs", "j", 0, "Override the number of scan workers (default scanner.scan_workers)")
+
+	return cmd
 }
 
 func runVersion(cmd *cobra.Command, args []string) {
@@ -421,7 +896,7 @@ func runRedact(cmd *cobra.Command, args []string) {
 	}
 
 	var wg sync.WaitGroup
-	leaktkScanner := scanner.NewScanner(cfg)
+	leaktkScanner := newScanner()
 	leaktkRedactor := redactor.NewRedactor(cfg)
 
 	// Note: As more kinds are supported this will be refactored
@@ -436,6 +911,9 @@ func runRedact(cmd *cobra.Command, args []string) {
 	headIdx := 0
 
 	go leaktkScanner.Recv(func(response *proto.Response) {
+		if response.Kind == proto.HeartbeatResponseKind {
+			return
+		}
 		redacted, redactErr := leaktkRedactor.RedactText(response.Resource, response)
 		if redactErr != nil {
 			logger.Error("could not redact text: %v, offset=%s, len=%d", redactErr, response.ID, len(response.Resource))
@@ -524,6 +1002,10 @@ func configure(cmd *cobra.Command, args []string) error {
 		if err == nil {
 			err = logger.SetLoggerLevel(cfg.Logger.Level)
 		}
+		if err == nil {
+			// Set it here too since commands like install run git without a scanner
+			err = git.SetPath(cfg.Scanner.GitPath)
+		}
 		if err != nil {
 			return err
 		}
@@ -532,7 +1014,7 @@ func configure(cmd *cobra.Command, args []string) error {
 	// If a format is specified on the command line update the application config.
 	format, err := cmd.Flags().GetString("format")
 	if err == nil && format != "" {
-		cfg.Formatter = config.Formatter{Format: format}
+		cfg.Formatter.Format = format
 	}
 
 	// Check if the OutputFormat is valid
@@ -541,6 +1023,24 @@ func configure(cmd *cobra.Command, args []string) error {
 		logger.Fatal("%v", err)
 	}
 
+	if color, err := cmd.Flags().GetString("color"); err == nil && color != "" {
+		cfg.Formatter.Color = color
+	}
+
+	if _, err := useColor(cfg.Formatter.Color, os.Stdout); err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	// Only some commands have --jobs and it only overrides the config when set
+	if jobsFlag := cmd.Flags().Lookup("jobs"); jobsFlag != nil && jobsFlag.Changed {
+		jobs := mustGetInt(cmd.Flags(), "jobs")
+		if jobs < 1 {
+			logger.Fatal("jobs must be greater than 0: jobs=%d", jobs)
+		}
+
+		cfg.Scanner.ScanWorkers = jobs
+	}
+
 	return err
 }
 
@@ -556,14 +1056,21 @@ func rootCommand() *cobra.Command {
 
 	flags := rootCommand.PersistentFlags()
 	flags.StringP("config", "c", "", "Load a custom leaktk config")
-	flags.StringP("format", "f", "", "Change the output format [json, human, csv, toml, yaml] (default \"json\")")
+	flags.StringP("format", "f", "", "Change the output format [json, human, csv, toml, yaml, github-actions, sarif] (default \"json\")")
+	flags.String("color", "", "Color human formatted output [auto, always, never] (default \"auto\")")
 
 	rootCommand.AddCommand(scanCommand())
+	rootCommand.AddCommand(diffCommand())
+	rootCommand.AddCommand(baselineCommand())
+	rootCommand.AddCommand(mergeCommand())
 	rootCommand.AddCommand(installCommand())
 	rootCommand.AddCommand(loginCommand())
 	rootCommand.AddCommand(logoutCommand())
 	rootCommand.AddCommand(hookCommand())
 	rootCommand.AddCommand(listenCommand())
+	rootCommand.AddCommand(daemonCommand())
+	rootCommand.AddCommand(patternsCommand())
+	rootCommand.AddCommand(doctorCommand())
 	rootCommand.AddCommand(versionCommand())
 	rootCommand.AddCommand(redactCommand())
 
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
 	"os"
 	"testing"
@@ -55,3 +56,140 @@ func TestScanCommandToRequest(t *testing.T) {
 	assert.Nil(t, request)
 	assert.Equal(t, fmt.Sprintf("resource path does not exist: path=%q", dataPath+".invalid"), err.Error())
 }
+
+func TestScanCommandToRequestDiffFlags(t *testing.T) {
+	t.Run("Staged", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("staged", "true"))
+
+		// Resource defaults to the current directory
+		request, err := scanCommandToRequest(cmd, []string{})
+		require.NoError(t, err)
+		assert.Equal(t, ".", request.Resource)
+		assert.True(t, request.Opts.Staged)
+		assert.False(t, request.Opts.Unstaged)
+		assert.True(t, request.Opts.Local)
+	})
+
+	t.Run("Unstaged", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("unstaged", "true"))
+
+		request, err := scanCommandToRequest(cmd, []string{"."})
+		require.NoError(t, err)
+		assert.False(t, request.Opts.Staged)
+		assert.True(t, request.Opts.Unstaged)
+	})
+
+	t.Run("Both", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("staged", "true"))
+		require.NoError(t, cmd.Flags().Set("unstaged", "true"))
+
+		request, err := scanCommandToRequest(cmd, []string{"."})
+		require.Error(t, err)
+		assert.Nil(t, request)
+	})
+
+	t.Run("Pathspec", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("staged", "true"))
+		require.NoError(t, cmd.Flags().Set("pathspec", "src/app.go"))
+		require.NoError(t, cmd.Flags().Set("pathspec", "*.env"))
+
+		request, err := scanCommandToRequest(cmd, []string{})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"src/app.go", "*.env"}, request.Opts.Pathspecs)
+	})
+
+	t.Run("PathspecWithoutDiff", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("pathspec", "src/app.go"))
+
+		request, err := scanCommandToRequest(cmd, []string{"."})
+		require.EqualError(t, err, "pathspec needs staged or unstaged to be set")
+		assert.Nil(t, request)
+	})
+}
+
+func TestScanCommandToRequestOptionFlags(t *testing.T) {
+	args := []string{"https://github.com/leaktk/fake-leaks.git"}
+
+	t.Run("FlagsSetOpts", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("branch", "main"))
+		require.NoError(t, cmd.Flags().Set("depth", "5"))
+		require.NoError(t, cmd.Flags().Set("since", "2020-01-01"))
+
+		request, err := scanCommandToRequest(cmd, args)
+		require.NoError(t, err)
+		assert.Equal(t, "main", request.Opts.Branch)
+		assert.Equal(t, 5, request.Opts.Depth)
+		assert.Equal(t, "2020-01-01", request.Opts.Since)
+	})
+
+	t.Run("RefFlag", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("ref", "v1.2.3"))
+
+		request, err := scanCommandToRequest(cmd, args)
+		require.NoError(t, err)
+		assert.Equal(t, "v1.2.3", request.Opts.Ref)
+		assert.Equal(t, "v1.2.3", request.Opts.GitRef())
+	})
+
+	t.Run("MergedWithOptions", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("branch", "main"))
+		require.NoError(t, cmd.Flags().Set("options", `{"depth": 3}`))
+
+		request, err := scanCommandToRequest(cmd, args)
+		require.NoError(t, err)
+		assert.Equal(t, "main", request.Opts.Branch)
+		assert.Equal(t, 3, request.Opts.Depth)
+	})
+
+	t.Run("ConflictsWithOptions", func(t *testing.T) {
+		cmd := scanCommand()
+		require.NoError(t, cmd.Flags().Set("depth", "5"))
+		require.NoError(t, cmd.Flags().Set("options", `{"depth": 3}`))
+
+		request, err := scanCommandToRequest(cmd, args)
+		require.Error(t, err)
+		assert.Nil(t, request)
+		assert.Equal(t, "depth set in both --depth and --options", err.Error())
+	})
+}
+
+func TestScanErrorResponse(t *testing.T) {
+	response := scanErrorResponse("request-id", "could not generate scan request")
+
+	var decoded proto.Response
+	require.NoError(t, json.Unmarshal([]byte(formatJSON(response)), &decoded))
+	assert.Equal(t, proto.ScanResultsResponseKind, decoded.Kind)
+	assert.Equal(t, "request-id", decoded.RequestID)
+	assert.Empty(t, decoded.Results)
+	require.NotNil(t, decoded.Error)
+	assert.Equal(t, "could not generate scan request", decoded.Error.Message)
+}
+
+func TestReadAuthToken(t *testing.T) {
+	t.Run("PipedInput", func(t *testing.T) {
+		reader, writer, err := os.Pipe()
+		require.NoError(t, err)
+		defer func() { _ = reader.Close() }()
+
+		_, err = writer.WriteString("test-token\n")
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		authToken, err := readAuthToken(reader)
+		require.NoError(t, err)
+		assert.Equal(t, "test-token", authToken)
+	})
+}
+
+func TestRedactAuthToken(t *testing.T) {
+	assert.Equal(t, "****", redactAuthToken("short"))
+	assert.Equal(t, "****7890", redactAuthToken("abcdefghij1234567890"))
+}
@@ -0,0 +1,248 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/adrg/xdg"
+	"github.com/spf13/cobra"
+
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/proto"
+	"github.com/leaktk/leaktk/pkg/scanner"
+)
+
+// daemonReadTimeout is how long a client has to send its request after
+// connecting so idle connections don't hold up a shutdown
+const daemonReadTimeout = time.Minute
+
+// daemonResponseBuffer is how many responses can be waiting on a client
+// before heartbeats for it start being dropped
+const daemonResponseBuffer = 16
+
+func daemonCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "daemon",
+		Short: "Listen for scan requests on a Unix socket",
+		Run:   runDaemon,
+	}
+
+	flags := cmd.Flags()
+	flags.String("socket", "", "The path of the socket to listen on (default $XDG_RUNTIME_DIR/leaktk/daemon.sock)")
+	flags.IntP("jobs", "j", 0, "Override the number of scan workers (default scanner.scan_workers)")
+
+	return cmd
+}
+
+func runDaemon(cmd *cobra.Command, args []string) {
+	socketPath := mustGetString(cmd.Flags(), "socket")
+	if len(socketPath) == 0 {
+		socketPath = filepath.Join(xdg.RuntimeDir, "leaktk", "daemon.sock")
+	}
+
+	listener, err := listenUnixSocket(socketPath)
+	if err != nil {
+		logger.Fatal("could not listen on socket: %v path=%q", err, socketPath)
+	}
+
+	flushTraces := setupTracing()
+	defer flushTraces()
+
+	ctx, stop := signal.NotifyContext(cmd.Context(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Info("listening for requests: path=%q", socketPath)
+	newDaemon(newScanner()).Serve(ctx, listener)
+	logger.Info("daemon stopped: path=%q", socketPath)
+}
+
+// listenUnixSocket listens on path, replacing a socket left behind by a daemon
+// that didn't shut down cleanly. Only the owner can connect since requests can
+// scan local files.
+func listenUnixSocket(path string) (net.Listener, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("could not create socket dir: %w", err)
+	}
+
+	if _, err := os.Stat(path); err == nil {
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, errors.New("another daemon is already listening")
+		}
+
+		logger.Warning("removing stale socket: path=%q", path)
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("could not remove stale socket: %w", err)
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0600); err != nil {
+		_ = listener.Close()
+		return nil, fmt.Errorf("could not set socket permissions: %w", err)
+	}
+
+	return listener, nil
+}
+
+// daemon passes the requests from each connection to one scanner and sends
+// the responses back on the connection the request came from
+type daemon struct {
+	mutex   sync.Mutex
+	pending map[string]chan *proto.Response
+	scanner *scanner.Scanner
+	wg      sync.WaitGroup
+}
+
+func newDaemon(leaktkScanner *scanner.Scanner) *daemon {
+	d := &daemon{
+		pending: make(map[string]chan *proto.Response),
+		scanner: leaktkScanner,
+	}
+
+	go leaktkScanner.Recv(d.route)
+
+	return d
+}
+
+// Serve handles connections until ctx is done and then waits for the requests
+// already sent to finish
+func (d *daemon) Serve(ctx context.Context, listener net.Listener) {
+	go func() {
+		<-ctx.Done()
+		if err := listener.Close(); err != nil {
+			logger.Debug("could not close listener: %v", err)
+		}
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			if ctx.Err() == nil {
+				logger.Error("could not accept connection: %v", err)
+			}
+
+			break
+		}
+
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			d.handle(conn)
+		}()
+	}
+
+	d.wg.Wait()
+}
+
+// route sends a response to the connection waiting on it
+func (d *daemon) route(response *proto.Response) {
+	d.mutex.Lock()
+	responses, ok := d.pending[response.RequestID]
+	d.mutex.Unlock()
+
+	if !ok {
+		logger.Debug("dropping response without a connection: request_id=%q", response.RequestID)
+		return
+	}
+
+	// A heartbeat isn't worth holding up the other connections' responses
+	if response.Kind == proto.HeartbeatResponseKind {
+		select {
+		case responses <- response:
+		default:
+			logger.Debug("dropping heartbeat for a slow connection: request_id=%q", response.RequestID)
+		}
+
+		return
+	}
+
+	responses <- response
+}
+
+// handle reads one request from conn and writes its responses back to it.
+// The connection is closed once the scan results are sent.
+func (d *daemon) handle(conn net.Conn) {
+	defer func() {
+		if err := conn.Close(); err != nil {
+			logger.Debug("could not close connection: %v", err)
+		}
+	}()
+
+	if err := conn.SetReadDeadline(time.Now().Add(daemonReadTimeout)); err != nil {
+		logger.Debug("could not set read deadline: %v", err)
+	}
+
+	line, err := readLine(bufio.NewReader(conn))
+	if err != nil && len(line) == 0 {
+		logger.Error("could not read request: %v", err)
+		return
+	}
+
+	request, errResponse := parseRequest(line)
+	if errResponse != nil {
+		writeDaemonResponse(conn, errResponse)
+		return
+	}
+
+	// Responses are matched to connections by their request IDs
+	if len(request.ID) == 0 {
+		request.ID = id.ID()
+	}
+
+	responses := make(chan *proto.Response, daemonResponseBuffer)
+	d.mutex.Lock()
+	if _, ok := d.pending[request.ID]; ok {
+		d.mutex.Unlock()
+		writeDaemonResponse(conn, requestErrorResponse(request.ID, "request id is already in progress"))
+		return
+	}
+	d.pending[request.ID] = responses
+	d.mutex.Unlock()
+
+	defer func() {
+		d.mutex.Lock()
+		delete(d.pending, request.ID)
+		d.mutex.Unlock()
+	}()
+
+	d.scanner.Send(request)
+
+	connected := true
+	for response := range responses {
+		// Keep reading after the client leaves so the scanner isn't left
+		// waiting to send the results
+		if connected && !writeDaemonResponse(conn, response) {
+			connected = false
+		}
+
+		if response.Kind != proto.HeartbeatResponseKind {
+			return
+		}
+	}
+}
+
+// writeDaemonResponse writes the response as a line of JSON and reports
+// whether it worked
+func writeDaemonResponse(conn net.Conn, response *proto.Response) bool {
+	if _, err := fmt.Fprintln(conn, formatJSON(response)); err != nil {
+		logger.Warning("could not send response: %v request_id=%q", err, response.RequestID)
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/proto"
+	"github.com/leaktk/leaktk/pkg/scanner"
+)
+
+func TestDaemon(t *testing.T) {
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Workdir = tempDir
+	cfg.Scanner.HeartbeatInterval = 0
+	cfg.Scanner.Patterns.Autofetch = false
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(tempDir, "gitleaks.toml")
+	require.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte(`
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue[0-9]+'''
+`), 0600))
+
+	socketPath := filepath.Join(tempDir, "daemon.sock")
+	listener, err := listenUnixSocket(socketPath)
+	require.NoError(t, err)
+
+	info, err := os.Stat(socketPath)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	leaktkScanner, err := scanner.NewScanner(cfg)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	served := make(chan struct{})
+	go func() {
+		newDaemon(leaktkScanner).Serve(ctx, listener)
+		close(served)
+	}()
+
+	send := func(line string) *proto.Response {
+		conn, err := net.Dial("unix", socketPath)
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		_, err = fmt.Fprintln(conn, line)
+		require.NoError(t, err)
+
+		var response proto.Response
+		reader := bufio.NewReader(conn)
+		rawResponse, err := reader.ReadBytes('\n')
+		require.NoError(t, err)
+		require.NoError(t, json.Unmarshal(rawResponse, &response))
+
+		// The daemon closes the connection after the response
+		_, err = reader.ReadByte()
+		require.Error(t, err)
+
+		return &response
+	}
+
+	t.Run("Scan", func(t *testing.T) {
+		for i := range 2 {
+			response := send(fmt.Sprintf(`{"id":"test-%d","kind":"Text","resource":"token = secretvalue%d"}`, i, i))
+			require.Nil(t, response.Error)
+			assert.Equal(t, fmt.Sprintf("test-%d", i), response.RequestID)
+			require.Len(t, response.Results, 1)
+			assert.Equal(t, fmt.Sprintf("secretvalue%d", i), response.Results[0].Secret)
+		}
+	})
+
+	t.Run("MissingID", func(t *testing.T) {
+		response := send(`{"kind":"Text","resource":"token = secretvalue1"}`)
+		require.Nil(t, response.Error)
+		assert.NotEmpty(t, response.RequestID)
+		assert.Len(t, response.Results, 1)
+	})
+
+	t.Run("InvalidRequests", func(t *testing.T) {
+		response := send(`{"id":`)
+		require.NotNil(t, response.Error)
+		assert.Equal(t, requestErrorCode, response.Error.Code)
+		assert.Contains(t, response.Error.Message, "could not unmarshal request")
+
+		response = send(`{"id":"test-empty","kind":"Text"}`)
+		require.NotNil(t, response.Error)
+		assert.Equal(t, "test-empty", response.RequestID)
+		assert.Equal(t, "no resource provided", response.Error.Message)
+	})
+
+	t.Run("AlreadyListening", func(t *testing.T) {
+		_, err := listenUnixSocket(socketPath)
+		require.ErrorContains(t, err, "another daemon is already listening")
+	})
+
+	cancel()
+	<-served
+
+	t.Run("StaleSocket", func(t *testing.T) {
+		stalePath := filepath.Join(t.TempDir(), "daemon.sock")
+		require.NoError(t, os.WriteFile(stalePath, nil, 0600))
+
+		listener, err := listenUnixSocket(stalePath)
+		require.NoError(t, err)
+		require.NoError(t, listener.Close())
+	})
+}
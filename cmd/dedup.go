@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// resultDeduper drops results that were already seen. It remembers at most
+// size result IDs and forgets the oldest ones first to cap memory usage.
+type resultDeduper struct {
+	ids  []string
+	next int
+	seen map[string]struct{}
+}
+
+func newResultDeduper(size int) *resultDeduper {
+	return &resultDeduper{
+		ids:  make([]string, 0, size),
+		seen: make(map[string]struct{}, size),
+	}
+}
+
+// Filter returns the results whose IDs haven't been seen before
+func (d *resultDeduper) Filter(results []*proto.Result) []*proto.Result {
+	filtered := make([]*proto.Result, 0, len(results))
+
+	for _, result := range results {
+		if _, ok := d.seen[result.ID]; ok {
+			continue
+		}
+
+		d.add(result.ID)
+		filtered = append(filtered, result)
+	}
+
+	return filtered
+}
+
+func (d *resultDeduper) add(id string) {
+	if len(d.ids) < cap(d.ids) {
+		d.ids = append(d.ids, id)
+	} else {
+		delete(d.seen, d.ids[d.next])
+		d.ids[d.next] = id
+		d.next = (d.next + 1) % len(d.ids)
+	}
+
+	d.seen[id] = struct{}{}
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestResultDeduper(t *testing.T) {
+	results := func(ids ...string) []*proto.Result {
+		items := make([]*proto.Result, len(ids))
+		for i, id := range ids {
+			items[i] = &proto.Result{ID: id}
+		}
+		return items
+	}
+
+	ids := func(results []*proto.Result) []string {
+		items := make([]string, len(results))
+		for i, result := range results {
+			items[i] = result.ID
+		}
+		return items
+	}
+
+	t.Run("DropsSeenResults", func(t *testing.T) {
+		deduper := newResultDeduper(10)
+		assert.Equal(t, []string{"a", "b"}, ids(deduper.Filter(results("a", "b", "a"))))
+		assert.Equal(t, []string{"c"}, ids(deduper.Filter(results("b", "c", "a"))))
+		assert.Empty(t, deduper.Filter(results("a", "b", "c")))
+	})
+
+	t.Run("ForgetsOldestResults", func(t *testing.T) {
+		deduper := newResultDeduper(2)
+		assert.Equal(t, []string{"a", "b", "c"}, ids(deduper.Filter(results("a", "b", "c"))))
+		assert.Len(t, deduper.seen, 2)
+		// "a" was forgotten to make room for "c"
+		assert.Equal(t, []string{"a"}, ids(deduper.Filter(results("a", "c"))))
+		// "b" was forgotten to make room for "a"
+		assert.Equal(t, []string{"b"}, ids(deduper.Filter(results("b", "a"))))
+	})
+}
@@ -0,0 +1,200 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/spf13/cobra"
+
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func diffCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "diff <old.jsonl> <new.jsonl>",
+		Short: "Show the results in a new run that weren't in an old one",
+		Args:  cobra.ExactArgs(2),
+		Run:   runDiff,
+	}
+
+	flags := cmd.Flags()
+	flags.Bool("fixed", false, "Also show the results in the old run that aren't in the new one")
+	flags.Int("leak-exit-code", 0, "Exit with this code when there are new results (default 0)")
+
+	return cmd
+}
+
+func runDiff(cmd *cobra.Command, args []string) {
+	oldResults, err := readResults(args[0])
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	newResults, err := readResults(args[1])
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	flags := cmd.Flags()
+	showFixed := mustGetBool(flags, "fixed")
+	added, fixed := diffResults(oldResults, newResults)
+
+	response := &proto.Response{
+		ID:      id.ID(),
+		Kind:    proto.ScanResultsResponseKind,
+		Results: make([]*proto.Result, 0, len(added)+len(fixed)),
+		Notes:   map[string]string{"added": strconv.Itoa(len(added))},
+	}
+
+	for _, result := range added {
+		response.Results = append(response.Results, withDiffNote(result, "added"))
+	}
+
+	if showFixed {
+		response.Notes["fixed"] = strconv.Itoa(len(fixed))
+
+		for _, result := range fixed {
+			response.Results = append(response.Results, withDiffNote(result, "fixed"))
+		}
+	}
+
+	formatter, err := NewFormatter(cfg.Formatter, os.Stdout)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	fmt.Println(formatter.Format(response))
+
+	if len(added) > 0 {
+		os.Exit(mustGetInt(flags, "leak-exit-code"))
+	}
+}
+
+// diffResults returns the new results whose IDs aren't in the old ones and
+// the old results whose IDs aren't in the new ones
+func diffResults(oldResults, newResults []*proto.Result) (added, fixed []*proto.Result) {
+	oldIDs := resultIDs(oldResults)
+	newIDs := resultIDs(newResults)
+
+	for _, result := range newResults {
+		if _, ok := oldIDs[result.ID]; !ok {
+			added = append(added, result)
+		}
+	}
+
+	for _, result := range oldResults {
+		if _, ok := newIDs[result.ID]; !ok {
+			fixed = append(fixed, result)
+		}
+	}
+
+	return added, fixed
+}
+
+func resultIDs(results []*proto.Result) map[string]struct{} {
+	ids := make(map[string]struct{}, len(results))
+	for _, result := range results {
+		ids[result.ID] = struct{}{}
+	}
+
+	return ids
+}
+
+// withDiffNote returns a copy of the result with a diff note set to status
+func withDiffNote(result *proto.Result, status string) *proto.Result {
+	noted := *result
+	noted.Notes = make(map[string]string, len(result.Notes)+1)
+	maps.Copy(noted.Notes, result.Notes)
+	noted.Notes["diff"] = status
+
+	return &noted
+}
+
+// readResults reads the unique results from a JSONL file. Each line can be a
+// response (e.g. from listen or scan --format json), an audit log entry or a
+// single result.
+func readResults(path string) ([]*proto.Result, error) {
+	file, err := os.Open(filepath.Clean(path))
+	if err != nil {
+		return nil, fmt.Errorf("could not open results file: %w path=%q", err, path)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Debug("error closing results file: %v path=%q", err, path)
+		}
+	}()
+
+	var results []*proto.Result
+	seen := make(map[string]struct{})
+	reader := bufio.NewReader(file)
+
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := readLine(reader)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("could not read results file: %w path=%q", err, path)
+		}
+
+		if len(line) > 0 {
+			lineResults, parseErr := parseResultsLine(line)
+			if parseErr != nil {
+				return nil, fmt.Errorf("could not parse results file: %w path=%q line=%d", parseErr, path, lineNumber)
+			}
+
+			for _, result := range lineResults {
+				if _, ok := seen[result.ID]; !ok {
+					seen[result.ID] = struct{}{}
+					results = append(results, result)
+				}
+			}
+		}
+
+		if err != nil {
+			return results, nil
+		}
+	}
+}
+
+func parseResultsLine(line []byte) ([]*proto.Result, error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(line, &fields); err != nil {
+		return nil, err
+	}
+
+	if _, ok := fields["results"]; ok {
+		var response proto.Response
+		if err := json.Unmarshal(line, &response); err != nil {
+			return nil, err
+		}
+
+		return response.Results, nil
+	}
+
+	if rawResult, ok := fields["result"]; ok {
+		var result proto.Result
+		if err := json.Unmarshal(rawResult, &result); err != nil {
+			return nil, err
+		}
+
+		return []*proto.Result{&result}, nil
+	}
+
+	var result proto.Result
+	if err := json.Unmarshal(line, &result); err != nil {
+		return nil, err
+	}
+
+	if len(result.ID) == 0 {
+		return nil, errors.New("result has no id")
+	}
+
+	return []*proto.Result{&result}, nil
+}
@@ -0,0 +1,79 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestDiffResults(t *testing.T) {
+	results := func(ids ...string) []*proto.Result {
+		items := make([]*proto.Result, len(ids))
+		for i, id := range ids {
+			items[i] = &proto.Result{ID: id}
+		}
+		return items
+	}
+
+	ids := func(results []*proto.Result) []string {
+		items := make([]string, len(results))
+		for i, result := range results {
+			items[i] = result.ID
+		}
+		return items
+	}
+
+	added, fixed := diffResults(results("a", "b", "c"), results("b", "d", "c", "e"))
+	assert.Equal(t, []string{"d", "e"}, ids(added))
+	assert.Equal(t, []string{"a"}, ids(fixed))
+
+	added, fixed = diffResults(nil, results("a"))
+	assert.Equal(t, []string{"a"}, ids(added))
+	assert.Empty(t, fixed)
+}
+
+func TestWithDiffNote(t *testing.T) {
+	result := &proto.Result{ID: "a", Notes: map[string]string{"commit_message": "oops"}}
+	noted := withDiffNote(result, "added")
+
+	assert.Equal(t, map[string]string{"commit_message": "oops", "diff": "added"}, noted.Notes)
+	// The original result isn't changed
+	assert.Equal(t, map[string]string{"commit_message": "oops"}, result.Notes)
+}
+
+func TestReadResults(t *testing.T) {
+	t.Run("Formats", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.jsonl")
+		require.NoError(t, os.WriteFile(path, []byte(`{"id":"resp-1","kind":"ScanResults","request_id":"req-1","results":[{"id":"a"},{"id":"b"}]}
+{"request_id":"req-2","time":"2026-01-01T00:00:00Z","result":{"id":"c"}}
+
+{"id":"d","secret":"hunter2"}
+{"id":"resp-2","kind":"ScanResults","request_id":"req-3","results":[{"id":"a"}]}`), 0600))
+
+		results, err := readResults(path)
+		require.NoError(t, err)
+
+		var ids []string
+		for _, result := range results {
+			ids = append(ids, result.ID)
+		}
+		assert.Equal(t, []string{"a", "b", "c", "d"}, ids)
+		assert.Equal(t, "hunter2", results[3].Secret)
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "results.jsonl")
+		require.NoError(t, os.WriteFile(path, []byte("{\"id\":\"a\"}\n{\"secret\":\"no id\"}\n"), 0600))
+
+		_, err := readResults(path)
+		assert.ErrorContains(t, err, "line=2")
+
+		_, err = readResults(filepath.Join(t.TempDir(), "missing.jsonl"))
+		assert.ErrorContains(t, err, "could not open results file")
+	})
+}
@@ -0,0 +1,155 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/leaktk/leaktk/internal/git"
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/scanner"
+)
+
+const doctorCheckTimeout = 30 * time.Second
+
+const (
+	doctorPass = "PASS"
+	doctorWarn = "WARN"
+	doctorFail = "FAIL"
+	doctorSkip = "SKIP"
+)
+
+// doctorResult is the outcome of a doctor check. Only FAIL results are
+// critical. WARN is for problems scans can work around for now.
+type doctorResult struct {
+	status string
+	detail string
+}
+
+type doctorCheck struct {
+	name string
+	run  func(ctx context.Context, cfg *config.Config) doctorResult
+}
+
+var doctorChecks = []doctorCheck{
+	{"config", checkDoctorConfig},
+	{"git", checkDoctorGit},
+	{"workdir", checkDoctorWorkdir},
+	{"pattern_server", checkDoctorPatternServer},
+}
+
+func doctorCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "doctor",
+		Short: "Check that the environment is set up for scanning",
+		Args:  cobra.NoArgs,
+		// The config is loaded by the checks so problems with it get reported
+		// with the rest instead of stopping the command
+		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			return logger.SetLoggerFormat(logger.HUMAN)
+		},
+		Run: runDoctor,
+	}
+}
+
+func runDoctor(cmd *cobra.Command, args []string) {
+	doctorCfg, err := config.LocateAndLoadUnvalidatedConfig(mustGetString(cmd.Flags(), "config"))
+	if err != nil {
+		printDoctorResult(os.Stdout, "config", doctorResult{doctorFail, fmt.Sprintf("could not load config: %v", err)})
+		os.Exit(config.ExitCodeBlockingError)
+	}
+
+	if err := logger.SetLoggerLevel(doctorCfg.Logger.Level); err != nil {
+		logger.Warning("could not set log level: %v level=%q", err, doctorCfg.Logger.Level)
+	}
+
+	if !runDoctorChecks(cmd.Context(), doctorCfg, doctorChecks, os.Stdout) {
+		os.Exit(config.ExitCodeBlockingError)
+	}
+}
+
+// runDoctorChecks prints the result of each check and returns false if any of
+// them failed
+func runDoctorChecks(ctx context.Context, cfg *config.Config, checks []doctorCheck, out io.Writer) bool {
+	ok := true
+
+	for _, check := range checks {
+		checkCtx, cancel := context.WithTimeout(ctx, doctorCheckTimeout)
+		result := check.run(checkCtx, cfg)
+		cancel()
+
+		printDoctorResult(out, check.name, result)
+		ok = ok && result.status != doctorFail
+	}
+
+	return ok
+}
+
+func printDoctorResult(out io.Writer, name string, result doctorResult) {
+	// Joined errors are one per line so keep each result on its own line
+	detail := strings.ReplaceAll(result.detail, "\n", "; ")
+
+	if _, err := fmt.Fprintf(out, "%-6s%-16s%s\n", result.status, name+":", detail); err != nil {
+		logger.Error("could not write doctor result: %v check=%q", err, name)
+	}
+}
+
+func checkDoctorConfig(ctx context.Context, cfg *config.Config) doctorResult {
+	if err := cfg.Validate(); err != nil {
+		return doctorResult{doctorFail, err.Error()}
+	}
+
+	return doctorResult{doctorPass, "valid"}
+}
+
+func checkDoctorGit(ctx context.Context, cfg *config.Config) doctorResult {
+	if err := git.SetPath(cfg.Scanner.GitPath); err != nil {
+		return doctorResult{doctorFail, err.Error()}
+	}
+
+	out, err := git.CommandContext(ctx, "--version").Output()
+	if err != nil {
+		return doctorResult{doctorFail, fmt.Sprintf("could not run git: %v git_path=%q", err, git.Path())}
+	}
+
+	return doctorResult{doctorPass, strings.TrimSpace(string(out))}
+}
+
+func checkDoctorWorkdir(ctx context.Context, cfg *config.Config) doctorResult {
+	if err := config.ValidateWritableDir(cfg.Scanner.Workdir); err != nil {
+		return doctorResult{doctorFail, fmt.Sprintf("not writable: %v workdir=%q", err, cfg.Scanner.Workdir)}
+	}
+
+	return doctorResult{doctorPass, cfg.Scanner.Workdir}
+}
+
+func checkDoctorPatternServer(ctx context.Context, cfg *config.Config) doctorResult {
+	serverURL := cfg.Scanner.Patterns.Server.URL
+	if !cfg.Scanner.Patterns.Autofetch {
+		return doctorResult{doctorSkip, "autofetch is disabled"}
+	}
+
+	patterns, err := scanner.NewPatternsFromConfig(cfg)
+	if err != nil {
+		return doctorResult{doctorFail, err.Error()}
+	}
+
+	if err := patterns.CheckServer(ctx); err != nil {
+		detail := fmt.Sprintf("could not fetch patterns: %v pattern_server=%q", err, serverURL)
+
+		// Scans keep using the cached patterns until they expire
+		if status, statusErr := patterns.GitleaksStatus(); statusErr == nil && !status.Expired {
+			return doctorResult{doctorWarn, detail + " (using cached patterns)"}
+		}
+
+		return doctorResult{doctorFail, detail}
+	}
+
+	return doctorResult{doctorPass, serverURL}
+}
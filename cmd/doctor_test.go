@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/internal/git"
+	"github.com/leaktk/leaktk/pkg/config"
+)
+
+func TestDoctorChecks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		_, _ = w.Write([]byte("[[rules]]\nid = \"test-rule\"\nregex = '''secretvalue[0-9]+'''\n"))
+	}))
+	defer ts.Close()
+
+	newConfig := func(t *testing.T) *config.Config {
+		tempDir := t.TempDir()
+		cfg := config.DefaultConfig()
+		cfg.Scanner.Workdir = filepath.Join(tempDir, "workdir")
+		cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(tempDir, "gitleaks.toml")
+		cfg.Scanner.Patterns.Server.URL = ts.URL
+		cfg.Scanner.Patterns.Server.AuthToken = "test-token"
+
+		return cfg
+	}
+
+	t.Run("Pass", func(t *testing.T) {
+		cfg := newConfig(t)
+		var out bytes.Buffer
+
+		assert.True(t, runDoctorChecks(context.Background(), cfg, doctorChecks, &out))
+		assert.Contains(t, out.String(), "PASS  config:         valid\n")
+		assert.Contains(t, out.String(), "PASS  git:            git version ")
+		assert.Contains(t, out.String(), "PASS  workdir:        "+cfg.Scanner.Workdir+"\n")
+		assert.Contains(t, out.String(), "PASS  pattern_server: "+ts.URL+"\n")
+
+		// The fetched patterns aren't saved
+		assert.NoFileExists(t, cfg.Scanner.Patterns.Gitleaks.ConfigPath)
+	})
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.Scanner.ScanWorkers = 0
+
+		result := checkDoctorConfig(context.Background(), cfg)
+		assert.Equal(t, doctorFail, result.status)
+		assert.Contains(t, result.detail, "scan_workers")
+	})
+
+	t.Run("MissingGit", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.Scanner.GitPath = filepath.Join(t.TempDir(), "git")
+
+		// Setting the git path also updates PATH
+		path := os.Getenv("PATH")
+		defer func() {
+			require.NoError(t, os.Setenv("PATH", path))
+			require.NoError(t, git.SetPath(""))
+		}()
+
+		result := checkDoctorGit(context.Background(), cfg)
+		assert.Equal(t, doctorFail, result.status)
+		assert.Contains(t, result.detail, "could not run git")
+	})
+
+	t.Run("UnwritableWorkdir", func(t *testing.T) {
+		cfg := newConfig(t)
+		require.NoError(t, os.WriteFile(cfg.Scanner.Workdir, []byte(""), 0600))
+
+		result := checkDoctorWorkdir(context.Background(), cfg)
+		assert.Equal(t, doctorFail, result.status)
+		assert.Contains(t, result.detail, "not a dir")
+	})
+
+	t.Run("BadAuthToken", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.Scanner.Patterns.Server.AuthToken = "wrong-token"
+		var out bytes.Buffer
+
+		assert.False(t, runDoctorChecks(context.Background(), cfg, doctorChecks, &out))
+		assert.Contains(t, out.String(), "FAIL  pattern_server: could not fetch patterns: unexpected status code: status_code=401")
+	})
+
+	t.Run("CachedPatterns", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.Scanner.Patterns.Server.AuthToken = "wrong-token"
+		require.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte(""), 0600))
+
+		result := checkDoctorPatternServer(context.Background(), cfg)
+		assert.Equal(t, doctorWarn, result.status)
+		assert.Contains(t, result.detail, "(using cached patterns)")
+	})
+
+	t.Run("AutofetchDisabled", func(t *testing.T) {
+		cfg := newConfig(t)
+		cfg.Scanner.Patterns.Autofetch = false
+
+		assert.Equal(t, doctorResult{doctorSkip, "autofetch is disabled"}, checkDoctorPatternServer(context.Background(), cfg))
+	})
+}
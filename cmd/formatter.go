@@ -5,6 +5,8 @@ import (
 	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
 
 	"github.com/BurntSushi/toml"
@@ -29,21 +31,59 @@ const (
 	YAML
 	// CSV displays the output in CSV format
 	CSV
+	// GITHUB displays the output as GitHub Actions workflow commands so
+	// results show up as annotations
+	GITHUB
+	// SARIF displays the output as a SARIF 2.1.0 log
+	SARIF
+)
+
+const (
+	ansiBold  = "\033[1m"
+	ansiRed   = "\033[31m"
+	ansiReset = "\033[0m"
 )
 
 // Formatter handles the output format for the response
 type Formatter struct {
 	format OutputFormat
+	color  bool
 }
 
-// NewFormatter creates new formatter
-func NewFormatter(cfg config.Formatter) (*Formatter, error) {
+// NewFormatter creates new formatter for output written to out
+func NewFormatter(cfg config.Formatter, out *os.File) (*Formatter, error) {
 	format, err := getOutputFormat(cfg.Format)
 	if err != nil {
 		return nil, err
 	}
 
-	return &Formatter{format: format}, nil
+	color, err := useColor(cfg.Color, out)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the HUMAN format is colored so the others stay machine readable
+	return &Formatter{format: format, color: color && format == HUMAN}, nil
+}
+
+// useColor decides if output to the file should be colored. "auto" colors
+// terminals unless NO_COLOR is set (see https://no-color.org/)
+func useColor(color string, out *os.File) (bool, error) {
+	switch strings.ToLower(color) {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto", "":
+		if len(os.Getenv("NO_COLOR")) > 0 {
+			return false, nil
+		}
+
+		info, err := out.Stat()
+		return err == nil && info.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("invalid color option: color=%q", color)
+	}
 }
 
 func getOutputFormat(format string) (OutputFormat, error) {
@@ -59,6 +99,10 @@ func getOutputFormat(format string) (OutputFormat, error) {
 		return YAML, nil
 	case "CSV":
 		return CSV, nil
+	case "GITHUB-ACTIONS":
+		return GITHUB, nil
+	case "SARIF":
+		return SARIF, nil
 	default:
 		return JSON, fmt.Errorf("invalid output format option: format=%q", format)
 	}
@@ -70,13 +114,17 @@ func (f *Formatter) Format(r *proto.Response) string {
 	case JSON:
 		return formatJSON(r)
 	case HUMAN:
-		return formatHuman(r)
+		return formatHuman(r, f.color)
 	case TOML:
 		return formatToml(r)
 	case YAML:
 		return formatYaml(r)
 	case CSV:
 		return formatCsv(r)
+	case GITHUB:
+		return formatGitHubActions(r)
+	case SARIF:
+		return formatSarif(r)
 	default:
 		return formatJSON(r)
 	}
@@ -91,8 +139,10 @@ func formatJSON(r *proto.Response) string {
 	return string(out)
 }
 
-func formatHuman(r *proto.Response) string {
-	headers, responses := flattenedResponse(r)
+// formatHuman renders the results grouped by path. If color is set, ANSI
+// escape codes are used to highlight the group headers and rule IDs.
+func formatHuman(r *proto.Response, color bool) string {
+	headers := flattenedHeaders()
 
 	for i, header := range headers {
 		// Append a : to each label. Do it once here instead of every loop
@@ -100,17 +150,81 @@ func formatHuman(r *proto.Response) string {
 	}
 
 	var out []string
-	for _, response := range responses {
-		for i, entry := range response {
-			// Specifies width of 26 characters for labels
-			out = append(out, fmt.Sprintf("%-26s%s", headers[i], entry))
+	for _, group := range groupResultsByPath(r.Results) {
+		groupHeader := fmt.Sprintf("%s (%d %s)", group.path, len(group.results), pluralize(len(group.results), "result", "results"))
+		groupUnderline := strings.Repeat("=", len(groupHeader))
+		if color {
+			groupHeader = ansiBold + groupHeader + ansiReset
+		}
+		out = append(out, groupHeader, groupUnderline, "")
+
+		for _, result := range group.results {
+			for i, entry := range flattenedResult(r, result) {
+				if color && i == ruleIDField {
+					entry = ansiBold + ansiRed + entry + ansiReset
+				}
+
+				// Specifies width of 26 characters for labels
+				out = append(out, fmt.Sprintf("%-26s%s", headers[i], entry))
+			}
+			if len(result.Rule.Remediation) > 0 {
+				out = append(out, fmt.Sprintf("%-26s%s", "RESULT.RULE.REMEDIATION:", result.Rule.Remediation))
+			}
+			out = append(out, "\n")
 		}
-		out = append(out, "\n")
 	}
 
 	return strings.Join(out, "\n")
 }
 
+type resultGroup struct {
+	path    string
+	results []*proto.Result
+}
+
+// groupResultsByPath groups the results by their location path, sorted by
+// path, with the results in each group sorted by their start line
+func groupResultsByPath(results []*proto.Result) []resultGroup {
+	var groups []resultGroup
+	groupIndexes := make(map[string]int)
+
+	for _, result := range results {
+		path := result.Location.Path
+		if len(path) == 0 {
+			path = "<no path>"
+		}
+
+		i, ok := groupIndexes[path]
+		if !ok {
+			i = len(groups)
+			groupIndexes[path] = i
+			groups = append(groups, resultGroup{path: path})
+		}
+
+		groups[i].results = append(groups[i].results, result)
+	}
+
+	slices.SortFunc(groups, func(a, b resultGroup) int {
+		return strings.Compare(a.path, b.path)
+	})
+
+	for _, group := range groups {
+		slices.SortStableFunc(group.results, func(a, b *proto.Result) int {
+			return a.Location.Start.Line - b.Location.Start.Line
+		})
+	}
+
+	return groups
+}
+
+func pluralize(count int, singular, plural string) string {
+	if count == 1 {
+		return singular
+	}
+
+	return plural
+}
+
 func formatToml(r *proto.Response) string {
 	var buf bytes.Buffer
 
@@ -149,34 +263,129 @@ func formatCsv(r *proto.Response) string {
 	return buf.String()
 }
 
+// formatSarif renders the response as a complete SARIF log. Use a sarifWriter
+// directly to stream results from multiple responses into one log.
+func formatSarif(r *proto.Response) string {
+	var out strings.Builder
+
+	writer := newSarifWriter(&out)
+	writer.WriteResponse(r)
+	if err := writer.Close(); err != nil {
+		logger.Error("could not format SARIF: %v", err)
+	}
+
+	return strings.TrimSuffix(out.String(), "\n")
+}
+
+// formatGitHubActions renders an error workflow command for each result and
+// the response's error if there is one. The secret is left out since workflow
+// command messages show up in the logs and on the PR.
+// See https://docs.github.com/en/actions/reference/workflow-commands-for-github-actions
+func formatGitHubActions(r *proto.Response) string {
+	var out []string
+
+	if r.Error != nil {
+		out = append(out, "::error::"+escapeWorkflowData(r.Error.Message))
+	}
+
+	for _, result := range r.Results {
+		var properties []string
+
+		if len(result.Location.Path) > 0 {
+			properties = append(properties, "file="+escapeWorkflowProperty(result.Location.Path))
+		}
+
+		if start := result.Location.Start; start.Line > 0 {
+			end := result.Location.End
+			properties = append(properties,
+				fmt.Sprintf("line=%d", start.Line),
+				fmt.Sprintf("endLine=%d", max(end.Line, start.Line)),
+			)
+
+			// Columns are only allowed for annotations on a single line
+			if start.Column > 0 && end.Line == start.Line {
+				properties = append(properties,
+					fmt.Sprintf("col=%d", start.Column),
+					fmt.Sprintf("endColumn=%d", end.Column),
+				)
+			}
+		}
+
+		properties = append(properties, "title="+escapeWorkflowProperty("leaktk: "+result.Rule.ID))
+
+		message := result.Rule.Description
+		if len(message) == 0 {
+			message = "potential secret found: rule=" + result.Rule.ID
+		}
+
+		if len(result.Location.Version) > 0 {
+			message += "\ncommit: " + result.Location.Version
+		}
+
+		if len(result.Rule.Remediation) > 0 {
+			message += "\nremediation: " + result.Rule.Remediation
+		}
+
+		out = append(out, fmt.Sprintf("::error %s::%s", strings.Join(properties, ","), escapeWorkflowData(message)))
+	}
+
+	return strings.Join(out, "\n")
+}
+
+var (
+	workflowDataEscaper     = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+	workflowPropertyEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+)
+
+func escapeWorkflowData(data string) string {
+	return workflowDataEscaper.Replace(data)
+}
+
+func escapeWorkflowProperty(property string) string {
+	return workflowPropertyEscaper.Replace(property)
+}
+
 // flattenedResponse takes the response and returns the responsefields and a 2d list of responses
 func flattenedResponse(response *proto.Response) ([]string, [][]string) {
 	var flattened [][]string
 
 	for _, result := range response.Results {
-		flattened = append(flattened, []string{
-			response.ID,
-			response.RequestID,
-			result.ID,
-			result.Kind,
-			result.Rule.ID,
-			result.Rule.Description,
-			flattenContact(result.Contact),
-			result.Secret,
-			result.Match,
-			fmt.Sprintf("%f", result.Entropy),
-			result.Date,
-			result.Location.Version,
-			result.Location.Path,
-			fmt.Sprintf("L%dC%d-L%dC%d", result.Location.Start.Line,
-				result.Location.Start.Column, result.Location.End.Line, result.Location.End.Column),
-			strings.Join(result.Rule.Tags, ", "),
-		})
+		flattened = append(flattened, flattenedResult(response, result))
 	}
 
+	return flattenedHeaders(), flattened
+}
+
+// ruleIDField is the index of RESULT.RULE.ID in the flattened fields
+const ruleIDField = 4
+
+// flattenedHeaders returns the labels for the fields from flattenedResult
+func flattenedHeaders() []string {
 	return []string{"ID", "REQUEST.ID", "RESULT.ID", "RESULT.KIND", "RESULT.RULE.ID", "RESULT.RULE.DESCRIPTION",
 		"RESULT.CONTACT", "RESULT.SECRET", "RESULT.MATCH", "RESULT.ENTROPY", "RESULT.DATE", "RESULT.LOCATION.VERSION",
-		"RESULT.LOCATION.PATH", "RESULT.LOCATION.RANGE", "RESULT.RULE.TAGS"}, flattened
+		"RESULT.LOCATION.PATH", "RESULT.LOCATION.RANGE", "RESULT.RULE.TAGS"}
+}
+
+// flattenedResult returns the fields for a single result in the response
+func flattenedResult(response *proto.Response, result *proto.Result) []string {
+	return []string{
+		response.ID,
+		response.RequestID,
+		result.ID,
+		result.Kind,
+		result.Rule.ID,
+		result.Rule.Description,
+		flattenContact(result.Contact),
+		result.Secret,
+		result.Match,
+		fmt.Sprintf("%f", result.Entropy),
+		result.Date,
+		result.Location.Version,
+		result.Location.Path,
+		fmt.Sprintf("L%dC%d-L%dC%d", result.Location.Start.Line,
+			result.Location.Start.Column, result.Location.End.Line, result.Location.End.Column),
+		strings.Join(result.Rule.Tags, ", "),
+	}
 }
 
 // flattenContact creates a single string with Contact information as "Name <Email>"
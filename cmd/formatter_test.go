@@ -0,0 +1,154 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestFormatHuman(t *testing.T) {
+	result := func(id, path string, line int) *proto.Result {
+		return &proto.Result{
+			ID: id,
+			Location: proto.Location{
+				Path:  path,
+				Start: proto.Point{Line: line},
+			},
+		}
+	}
+
+	response := &proto.Response{
+		ID: "response-id",
+		Results: []*proto.Result{
+			result("b-10", "b.txt", 10),
+			result("a-7", "a.txt", 7),
+			result("b-2", "b.txt", 2),
+			result("a-1", "a.txt", 1),
+			result("a-3", "a.txt", 3),
+		},
+	}
+
+	out := formatHuman(response, false)
+
+	var headers, resultIDs []string
+	for _, line := range strings.Split(out, "\n") {
+		if strings.HasSuffix(line, ")") {
+			headers = append(headers, line)
+		}
+		if resultID, ok := strings.CutPrefix(line, "RESULT.ID:"); ok {
+			resultIDs = append(resultIDs, strings.TrimSpace(resultID))
+		}
+	}
+
+	require.Equal(t, []string{"a.txt (3 results)", "b.txt (2 results)"}, headers)
+	assert.Equal(t, []string{"a-1", "a-3", "a-7", "b-2", "b-10"}, resultIDs)
+
+	t.Run("SingleResult", func(t *testing.T) {
+		out := formatHuman(&proto.Response{Results: []*proto.Result{result("x", "", 1)}}, false)
+		assert.True(t, strings.HasPrefix(out, "<no path> (1 result)\n===================="))
+	})
+
+	t.Run("Remediation", func(t *testing.T) {
+		assert.NotContains(t, out, "RESULT.RULE.REMEDIATION:")
+
+		withRemediation := result("x", "a.txt", 1)
+		withRemediation.Rule.Remediation = "Revoke the key"
+		out := formatHuman(&proto.Response{Results: []*proto.Result{withRemediation}}, false)
+		assert.Contains(t, out, "\nRESULT.RULE.REMEDIATION:  Revoke the key\n")
+	})
+}
+
+func TestFormatGitHubActions(t *testing.T) {
+	response := &proto.Response{
+		Error: &proto.Error{Message: "scan error:\n100% broken"},
+		Results: []*proto.Result{
+			{
+				Secret: "hunter2",
+				Rule:   proto.Rule{ID: "generic", Description: "Generic secret"},
+				Location: proto.Location{
+					Version: "abc123",
+					Path:    "dir/a,b:c.txt",
+					Start:   proto.Point{Line: 3, Column: 5},
+					End:     proto.Point{Line: 3, Column: 12},
+				},
+			},
+			{
+				Rule: proto.Rule{ID: "multiline", Remediation: "Revoke the key"},
+				Location: proto.Location{
+					Path:  "key.pem",
+					Start: proto.Point{Line: 1, Column: 1},
+					End:   proto.Point{Line: 4, Column: 20},
+				},
+			},
+			{Rule: proto.Rule{ID: "text"}},
+		},
+	}
+
+	assert.Equal(t, []string{
+		"::error::scan error:%0A100%25 broken",
+		"::error file=dir/a%2Cb%3Ac.txt,line=3,endLine=3,col=5,endColumn=12,title=leaktk%3A generic::Generic secret%0Acommit: abc123",
+		"::error file=key.pem,line=1,endLine=4,title=leaktk%3A multiline::potential secret found: rule=multiline%0Aremediation: Revoke the key",
+		"::error title=leaktk%3A text::potential secret found: rule=text",
+	}, strings.Split(formatGitHubActions(response), "\n"))
+
+	// The secret shouldn't end up in the logs
+	assert.NotContains(t, formatGitHubActions(response), "hunter2")
+
+	format, err := getOutputFormat("github-actions")
+	require.NoError(t, err)
+	assert.Equal(t, GITHUB, format)
+}
+
+func TestUseColor(t *testing.T) {
+	out, err := os.CreateTemp(t.TempDir(), "out")
+	require.NoError(t, err)
+	defer func() { _ = out.Close() }()
+
+	color, err := useColor("always", out)
+	require.NoError(t, err)
+	assert.True(t, color)
+
+	color, err = useColor("never", out)
+	require.NoError(t, err)
+	assert.False(t, color)
+
+	// Files aren't terminals
+	color, err = useColor("auto", out)
+	require.NoError(t, err)
+	assert.False(t, color)
+
+	_, err = useColor("sometimes", out)
+	require.Error(t, err)
+
+	t.Run("NoColor", func(t *testing.T) {
+		t.Setenv("NO_COLOR", "1")
+		tty, err := os.Open("/dev/tty")
+		if err != nil {
+			t.Skip("no tty available")
+		}
+		defer func() { _ = tty.Close() }()
+
+		color, err := useColor("auto", tty)
+		require.NoError(t, err)
+		assert.False(t, color)
+	})
+}
+
+func TestFormatterColor(t *testing.T) {
+	response := &proto.Response{Results: []*proto.Result{{Rule: proto.Rule{ID: "test-rule"}}}}
+
+	formatter, err := NewFormatter(config.Formatter{Format: "HUMAN", Color: "always"}, os.Stdout)
+	require.NoError(t, err)
+	assert.Contains(t, formatter.Format(response), ansiRed+"test-rule"+ansiReset)
+
+	// Other formats are never colored
+	formatter, err = NewFormatter(config.Formatter{Format: "JSON", Color: "always"}, os.Stdout)
+	require.NoError(t, err)
+	assert.NotContains(t, formatter.Format(response), ansiReset)
+}
@@ -1,7 +1,9 @@
 package cmd
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 
 	"github.com/spf13/cobra"
 
@@ -51,6 +53,14 @@ func gitHookInstallCommand(hook hooks.Hook) *cobra.Command {
 	flags.Bool("no-recursive", false, fmt.Sprintf("Install the %s hook only at the repository at the selected path", hookname))
 	flags.Bool("force", false, fmt.Sprintf("Replace any existing %s hooks instead of skipping them", hookname))
 	flags.Bool("stdout", false, fmt.Sprintf("Print the %s hook script to stdout (useful for certain custom installs)", hookname))
+	flags.String("chain", "", fmt.Sprintf("Keep existing %s hooks not installed by leaktk and run them along with it (existing-first or leaktk-first)", hookname))
+	flags.Lookup("chain").NoOptDefVal = string(installer.ExistingFirstChainOrder)
+	flags.Bool("json", false, "Print a JSON summary of where the hook was installed, skipped or failed to stdout")
+	cmd.MarkFlagsMutuallyExclusive("stdout", "json")
+	if hook == hooks.GitPreCommitHook {
+		flags.Bool("pre-commit-config", false, "Print a .pre-commit-config.yaml entry that runs the hook from pre-commit.com")
+		cmd.MarkFlagsMutuallyExclusive("pre-commit-config", "stdout", "json")
+	}
 	return cmd
 }
 
@@ -64,13 +74,38 @@ func runGitHookInstall(cmd *cobra.Command, args []string) {
 		Recursive:         !mustGetBool(flags, "no-recursive"),
 		Force:             mustGetBool(flags, "force"),
 		Stdout:            mustGetBool(flags, "stdout"),
+		Chain:             installer.ChainOrder(mustGetString(flags, "chain")),
+	}
+	if flags.Lookup("pre-commit-config") != nil {
+		opts.PreCommitConfig = mustGetBool(flags, "pre-commit-config")
+	}
+
+	switch opts.Chain {
+	case "", installer.ExistingFirstChainOrder, installer.LeaktkFirstChainOrder:
+	default:
+		logger.Fatal("invalid chain order: chain=%q expected one of: %s, %s", opts.Chain, installer.ExistingFirstChainOrder, installer.LeaktkFirstChainOrder)
 	}
 
-	if len(opts.Path) == 0 && !opts.UserTemplateDir && !opts.SystemTemplateDir && !opts.Stdout {
-		logger.Fatal("install requires at least one of: --path, --user-template-dir, --system-template-dir, --stdout")
+	if len(opts.Path) == 0 && !opts.UserTemplateDir && !opts.SystemTemplateDir && !opts.Stdout && !opts.PreCommitConfig {
+		logger.Fatal("install requires at least one of: --path, --user-template-dir, --system-template-dir, --stdout, --pre-commit-config")
+	}
+
+	summary, err := installer.GitHookInstall(cmd.Context(), cfg, opts)
+	if mustGetBool(flags, "json") {
+		if encodeErr := json.NewEncoder(os.Stdout).Encode(summary); encodeErr != nil {
+			logger.Fatal("could not write install summary: %v", encodeErr)
+		}
+	} else if len(summary.Targets) > 0 {
+		logger.Info(
+			"install summary: installed=%d skipped=%d failed=%d hookname=%q",
+			summary.Count(installer.InstalledInstallStatus),
+			summary.Count(installer.SkippedInstallStatus),
+			summary.Count(installer.FailedInstallStatus),
+			opts.Hook.Name(),
+		)
 	}
 
-	if err := installer.GitHookInstall(cmd.Context(), cfg, opts); err != nil {
+	if err != nil {
 		logger.Fatal("could not install git hook: %v hookname=%q", err, opts.Hook.Name())
 	}
 }
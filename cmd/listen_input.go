@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// listenInputRetryInterval is how long to wait before trying to open an input
+// again after it couldn't be opened
+const listenInputRetryInterval = time.Second
+
+// openListenInput returns a func that opens the FIFO or Unix socket at path
+// for reading requests from
+func openListenInput(ctx context.Context, path string) (func() (io.ReadCloser, error), error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch mode := info.Mode(); {
+	case mode&os.ModeNamedPipe != 0:
+		return func() (io.ReadCloser, error) {
+			// Opening a FIFO blocks until there's a writer so opening the write
+			// side here is what lets it return once ctx is done
+			stop := context.AfterFunc(ctx, func() {
+				if writer, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0); err == nil {
+					_ = writer.Close()
+				}
+			})
+			defer stop()
+
+			return os.Open(path) // #nosec G304
+		}, nil
+	case mode&os.ModeSocket != 0:
+		return func() (io.ReadCloser, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		}, nil
+	default:
+		return nil, fmt.Errorf("not a FIFO or Unix socket: mode=%q", mode)
+	}
+}
+
+// readListenInput sends the lines read from the FIFO or Unix socket at path
+// until ctx is done. When the writer closes its side, the input is opened
+// again for the next one, so producers can come and go while leaktk runs.
+func readListenInput(ctx context.Context, path string) (<-chan []byte, error) {
+	open, err := openListenInput(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+
+		for ctx.Err() == nil {
+			input, err := open()
+			if err != nil {
+				if ctx.Err() != nil {
+					return
+				}
+
+				logger.Warning("could not open input: %v path=%q", err, path)
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(listenInputRetryInterval):
+				}
+
+				continue
+			}
+
+			stop := context.AfterFunc(ctx, func() { _ = input.Close() })
+			err = sendLines(ctx, bufio.NewReader(input), lines)
+			stop()
+
+			if err := input.Close(); err != nil && !errors.Is(err, os.ErrClosed) {
+				logger.Debug("could not close input: %v path=%q", err, path)
+			}
+
+			if ctx.Err() != nil {
+				return
+			}
+
+			if err != nil {
+				logger.Error("error reading from input: %v path=%q", err, path)
+			} else {
+				logger.Debug("input closed by the writer: path=%q", path)
+			}
+		}
+	}()
+
+	return lines, nil
+}
+
+// readStdin sends the lines read from stdin until it's closed
+func readStdin() <-chan []byte {
+	lines := make(chan []byte)
+	go func() {
+		defer close(lines)
+
+		stdinReader := bufio.NewReader(os.Stdin)
+		for {
+			line, err := readLine(stdinReader)
+
+			if err != nil {
+				if err == io.EOF {
+					return
+				}
+
+				logger.Error("error reading from stdin: %v", err)
+
+				continue
+			}
+
+			lines <- line
+		}
+	}()
+
+	return lines
+}
+
+// sendLines sends the reader's lines until it hits EOF, which is returned as
+// nil. A last line without a newline is still sent since the writer may have
+// closed without one.
+func sendLines(ctx context.Context, reader *bufio.Reader, lines chan<- []byte) error {
+	for {
+		line, err := readLine(reader)
+
+		if len(line) > 0 || err == nil {
+			select {
+			case lines <- line:
+			case <-ctx.Done():
+				return nil
+			}
+		}
+
+		if err != nil {
+			if err == io.EOF {
+				return nil
+			}
+
+			return err
+		}
+	}
+}
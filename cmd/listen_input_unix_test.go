@@ -0,0 +1,77 @@
+//go:build darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd
+
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadListenInput(t *testing.T) {
+	t.Run("FIFO", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "requests.fifo")
+		require.NoError(t, syscall.Mkfifo(path, 0600))
+
+		ctx, cancel := context.WithCancel(t.Context())
+		lines, err := readListenInput(ctx, path)
+		require.NoError(t, err)
+
+		// Each writer closing its side shouldn't end the input
+		for i := range 2 {
+			writer, err := os.OpenFile(path, os.O_WRONLY, 0)
+			require.NoError(t, err)
+			_, err = fmt.Fprintf(writer, "request-%d\nno-newline-%d", i, i)
+			require.NoError(t, err)
+			require.NoError(t, writer.Close())
+
+			assert.Equal(t, fmt.Sprintf("request-%d", i), string(<-lines))
+			assert.Equal(t, fmt.Sprintf("no-newline-%d", i), string(<-lines))
+		}
+
+		// The reader is waiting on the next writer when it's cancelled
+		cancel()
+		_, ok := <-lines
+		assert.False(t, ok)
+	})
+
+	t.Run("Socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "requests.sock")
+		listener, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		defer func() { _ = listener.Close() }()
+
+		ctx, cancel := context.WithCancel(t.Context())
+		lines, err := readListenInput(ctx, path)
+		require.NoError(t, err)
+
+		for i := range 2 {
+			conn, err := listener.Accept()
+			require.NoError(t, err)
+			_, err = fmt.Fprintf(conn, "request-%d\n", i)
+			require.NoError(t, err)
+			require.NoError(t, conn.Close())
+
+			assert.Equal(t, fmt.Sprintf("request-%d", i), string(<-lines))
+		}
+
+		cancel()
+		for range lines {
+		}
+	})
+
+	t.Run("RegularFile", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "requests.jsonl")
+		require.NoError(t, os.WriteFile(path, nil, 0600))
+
+		_, err := readListenInput(t.Context(), path)
+		require.ErrorContains(t, err, "not a FIFO or Unix socket")
+	})
+}
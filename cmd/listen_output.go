@@ -0,0 +1,108 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// openListenOutput opens the file, FIFO or Unix socket at path for writing
+// responses to. Files are appended to so restarting listen doesn't lose the
+// responses it already wrote.
+func openListenOutput(path string) (io.WriteCloser, error) {
+	info, err := os.Stat(path)
+	if err == nil && info.Mode()&os.ModeSocket != 0 {
+		return net.Dial("unix", path)
+	}
+
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("could not create output dir: %w", err)
+	}
+
+	// Responses can contain secrets so only the owner can read them. Opening a
+	// FIFO waits until something opens it to read.
+	return os.OpenFile(filepath.Clean(path), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+}
+
+// listenOutput writes to the output at path and opens it again when a write
+// fails, so a consumer reading from a FIFO or socket can go away and come back
+// without the responses after it failing to write
+type listenOutput struct {
+	path   string
+	open   func() (io.WriteCloser, error)
+	output io.WriteCloser
+}
+
+// newListenOutput opens the output at path
+func newListenOutput(path string) (*listenOutput, error) {
+	output, err := openListenOutput(path)
+	if err != nil {
+		return nil, err
+	}
+
+	o := &listenOutput{path: path, output: output}
+	if _, ok := output.(net.Conn); ok {
+		// The socket's file goes away with its listener, which shouldn't
+		// leave a regular file in its place
+		o.open = func() (io.WriteCloser, error) { return net.Dial("unix", path) }
+	} else {
+		o.open = func() (io.WriteCloser, error) { return openListenOutput(path) }
+	}
+
+	return o, nil
+}
+
+// Write writes p to the output. If that fails, the output is opened again and
+// p is written to it once more. Reopening a FIFO waits for the next reader.
+func (o *listenOutput) Write(p []byte) (int, error) {
+	if o.output != nil {
+		n, err := o.output.Write(p)
+		if err == nil {
+			return n, nil
+		}
+
+		logger.Warning("could not write to output, reopening it: %v path=%q", err, o.path)
+
+		if err := o.output.Close(); err != nil {
+			logger.Debug("could not close output: %v path=%q", err, o.path)
+		}
+
+		o.output = nil
+	}
+
+	output, err := o.open()
+	if err != nil {
+		return 0, fmt.Errorf("could not reopen output: %w", err)
+	}
+
+	o.output = output
+
+	return o.output.Write(p)
+}
+
+// Close closes the output if it's open
+func (o *listenOutput) Close() error {
+	if o.output == nil {
+		return nil
+	}
+
+	err := o.output.Close()
+	o.output = nil
+
+	return err
+}
+
+// writeResponseLine writes the response line in a single write so it isn't
+// left sitting in a buffer or split up between other writes
+func writeResponseLine(output io.Writer, line string) error {
+	_, err := io.WriteString(output, line+"\n")
+	return err
+}
@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenListenOutput(t *testing.T) {
+	t.Run("File", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "responses", "responses.jsonl")
+
+		// Reopening the output keeps what was already written
+		for _, line := range []string{`{"id":"1"}`, `{"id":"2"}`} {
+			output, err := openListenOutput(path)
+			require.NoError(t, err)
+			require.NoError(t, writeResponseLine(output, line))
+			require.NoError(t, output.Close())
+		}
+
+		data, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":\"1\"}\n{\"id\":\"2\"}\n", string(data))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("Socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "responses.sock")
+		listener, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		defer func() { _ = listener.Close() }()
+
+		output, err := openListenOutput(path)
+		require.NoError(t, err)
+		defer func() { _ = output.Close() }()
+
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		defer func() { _ = conn.Close() }()
+
+		require.NoError(t, writeResponseLine(output, `{"id":"1"}`))
+		line, err := bufio.NewReader(conn).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":\"1\"}\n", line)
+	})
+}
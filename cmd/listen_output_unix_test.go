@@ -0,0 +1,111 @@
+//go:build darwin || dragonfly || freebsd || illumos || linux || netbsd || openbsd
+
+package cmd
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestListenOutputReopens(t *testing.T) {
+	t.Run("FIFO", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "responses.fifo")
+		require.NoError(t, syscall.Mkfifo(path, 0600))
+
+		// Opening the read side without blocking lets the output open
+		reader, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+		require.NoError(t, err)
+
+		output, err := newListenOutput(path)
+		require.NoError(t, err)
+		defer func() { _ = output.Close() }()
+
+		require.NoError(t, writeResponseLine(output, `{"id":"1"}`))
+		line, err := bufio.NewReader(reader).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":\"1\"}\n", line)
+		require.NoError(t, reader.Close())
+
+		// The next write fails without a reader and waits for a new one
+		reopening := make(chan struct{})
+		open := output.open
+		output.open = func() (io.WriteCloser, error) {
+			close(reopening)
+			return open()
+		}
+
+		written := make(chan error, 1)
+		go func() {
+			written <- writeResponseLine(output, `{"id":"2"}`)
+		}()
+
+		select {
+		case <-reopening:
+		case err := <-written:
+			require.FailNow(t, "output wasn't reopened", "err=%v", err)
+		case <-time.After(10 * time.Second):
+			require.FailNow(t, "output wasn't reopened")
+		}
+
+		reader, err = os.Open(path) // #nosec G304
+		require.NoError(t, err)
+		defer func() { _ = reader.Close() }()
+
+		require.NoError(t, <-written)
+		line, err = bufio.NewReader(reader).ReadString('\n')
+		require.NoError(t, err)
+		assert.Equal(t, "{\"id\":\"2\"}\n", line)
+	})
+
+	t.Run("Socket", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "responses.sock")
+		listener, err := net.Listen("unix", path)
+		require.NoError(t, err)
+		defer func() { _ = listener.Close() }()
+
+		output, err := newListenOutput(path)
+		require.NoError(t, err)
+		defer func() { _ = output.Close() }()
+
+		for _, want := range []string{`{"id":"1"}`, `{"id":"2"}`} {
+			require.NoError(t, writeResponseLine(output, want))
+
+			conn, err := listener.Accept()
+			require.NoError(t, err)
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			require.NoError(t, err)
+			assert.Equal(t, want+"\n", line)
+
+			// The next write has to connect again
+			require.NoError(t, conn.Close())
+		}
+	})
+
+	t.Run("SocketGone", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "responses.sock")
+		listener, err := net.Listen("unix", path)
+		require.NoError(t, err)
+
+		output, err := newListenOutput(path)
+		require.NoError(t, err)
+		defer func() { _ = output.Close() }()
+
+		conn, err := listener.Accept()
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+		require.NoError(t, listener.Close())
+
+		// Nothing is listening so the write fails instead of creating a file
+		assert.Error(t, writeResponseLine(output, `{"id":"1"}`))
+		assert.NoFileExists(t, path)
+	})
+}
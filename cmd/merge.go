@@ -0,0 +1,76 @@
+package cmd
+
+import (
+	"cmp"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/spf13/cobra"
+
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func mergeCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "merge <results.jsonl>...",
+		Short: "Combine the results from several runs (e.g. sharded scans) into one response",
+		Args:  cobra.MinimumNArgs(1),
+		Run:   runMerge,
+	}
+}
+
+func runMerge(cmd *cobra.Command, args []string) {
+	resultSets := make([][]*proto.Result, 0, len(args))
+
+	for _, path := range args {
+		results, err := readResults(path)
+		if err != nil {
+			logger.Fatal("%v", err)
+		}
+
+		resultSets = append(resultSets, results)
+	}
+
+	response := &proto.Response{
+		ID:      id.ID(),
+		Kind:    proto.ScanResultsResponseKind,
+		Results: mergeResults(resultSets...),
+	}
+
+	formatter, err := NewFormatter(cfg.Formatter, os.Stdout)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	fmt.Println(formatter.Format(response))
+}
+
+// mergeResults returns the unique results by ID sorted by path, location and
+// then ID so the output is the same no matter how the inputs were split up
+func mergeResults(resultSets ...[]*proto.Result) []*proto.Result {
+	merged := make([]*proto.Result, 0)
+	seen := make(map[string]struct{})
+
+	for _, results := range resultSets {
+		for _, result := range results {
+			if _, ok := seen[result.ID]; !ok {
+				seen[result.ID] = struct{}{}
+				merged = append(merged, result)
+			}
+		}
+	}
+
+	slices.SortFunc(merged, func(a, b *proto.Result) int {
+		return cmp.Or(
+			cmp.Compare(a.Location.Path, b.Location.Path),
+			cmp.Compare(a.Location.Start.Line, b.Location.Start.Line),
+			cmp.Compare(a.Location.Start.Column, b.Location.Start.Column),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+
+	return merged
+}
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestMergeResults(t *testing.T) {
+	result := func(id, path string, line int) *proto.Result {
+		return &proto.Result{ID: id, Location: proto.Location{Path: path, Start: proto.Point{Line: line}}}
+	}
+
+	ids := func(results []*proto.Result) []string {
+		items := make([]string, len(results))
+		for i, result := range results {
+			items[i] = result.ID
+		}
+		return items
+	}
+
+	merged := mergeResults(
+		[]*proto.Result{result("b-10", "b.txt", 10), result("a-7", "a.txt", 7)},
+		[]*proto.Result{result("a-7", "a.txt", 7), result("b-2", "b.txt", 2), result("a-1", "a.txt", 1)},
+		nil,
+	)
+	assert.Equal(t, []string{"a-1", "a-7", "b-2", "b-10"}, ids(merged))
+	assert.Empty(t, mergeResults())
+
+	t.Run("Files", func(t *testing.T) {
+		dir := t.TempDir()
+		shard1 := filepath.Join(dir, "shard-1.jsonl")
+		shard2 := filepath.Join(dir, "shard-2.jsonl")
+		require.NoError(t, os.WriteFile(shard1, []byte(`{"id":"resp-1","kind":"ScanResults","request_id":"req-1","results":[{"id":"b","location":{"path":"b.txt"}}]}`), 0600))
+		require.NoError(t, os.WriteFile(shard2, []byte(`{"id":"a","location":{"path":"a.txt"}}
+{"id":"b","location":{"path":"b.txt"}}`), 0600))
+
+		results1, err := readResults(shard1)
+		require.NoError(t, err)
+		results2, err := readResults(shard2)
+		require.NoError(t, err)
+
+		assert.Equal(t, []string{"a", "b"}, ids(mergeResults(results1, results2)))
+	})
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/scanner"
+)
+
+func patternsCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "patterns",
+		Short: "Manage the scanner patterns",
+		Run:   runHelp,
+	}
+	cmd.AddCommand(patternsStatusCommand())
+	cmd.AddCommand(patternsUpdateCommand())
+	return cmd
+}
+
+func patternsStatusCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "status",
+		Short: "Show the state of the locally cached patterns without fetching them",
+		Run:   runPatternsStatus,
+	}
+
+	flags := cmd.Flags()
+	flags.Bool("json", false, "Output the status as JSON")
+
+	return cmd
+}
+
+func patternsUpdateCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "update",
+		Short: "Fetch the latest patterns now so later scans don't have to",
+		Run:   runPatternsUpdate,
+	}
+}
+
+func runPatternsUpdate(cmd *cobra.Command, args []string) {
+	logger.Info("updating patterns: pattern_server=%q", cfg.Scanner.Patterns.Server.URL)
+	patterns, err := scanner.NewPatternsFromConfig(cfg)
+	if err != nil {
+		logger.Fatal("%v", err)
+	}
+
+	if err := patterns.Update(cmd.Context()); err != nil {
+		logger.Fatal("could not update patterns: %v", err)
+	}
+
+	fmt.Printf("gitleaks: %s\n", patterns.GitleaksConfigHash())
+}
+
+func runPatternsStatus(cmd *cobra.Command, args []string) {
+	status, err := scanner.NewPatterns(&cfg.Scanner.Patterns, nil).GitleaksStatus()
+	if err != nil {
+		logger.Fatal("could not get pattern status: %v", err)
+	}
+
+	if mustGetBool(cmd.Flags(), "json") {
+		out, err := json.Marshal(map[string]*scanner.PatternStatus{"gitleaks": status})
+		if err != nil {
+			logger.Fatal("could not marshal pattern status: %v", err)
+		}
+
+		fmt.Println(string(out))
+		return
+	}
+
+	fmt.Println(formatPatternStatus("gitleaks", status))
+}
+
+func formatPatternStatus(name string, status *scanner.PatternStatus) string {
+	modTime, age := "-", "-"
+	if status.Exists {
+		modTime = status.ModTime.UTC().Format(time.RFC3339)
+		age = (time.Duration(status.Age) * time.Second).String()
+	}
+
+	hash := status.Hash
+	if len(hash) == 0 {
+		hash = "-"
+	}
+
+	lines := [][2]string{
+		{"PATTERNS", name},
+		{"CONFIG.PATH", status.ConfigPath},
+		{"CONFIG.EXISTS", strconv.FormatBool(status.Exists)},
+		{"CONFIG.MODIFIED", modTime},
+		{"CONFIG.AGE", age},
+		{"CONFIG.HASH", hash},
+		{"AUTOFETCH", strconv.FormatBool(status.Autofetch)},
+		{"REFRESH_AFTER", (time.Duration(status.RefreshAfter) * time.Second).String()},
+		{"EXPIRED_AFTER", (time.Duration(status.ExpiredAfter) * time.Second).String()},
+		{"REFRESH_DUE", strconv.FormatBool(status.RefreshDue)},
+		{"EXPIRED", strconv.FormatBool(status.Expired)},
+	}
+
+	out := make([]string, len(lines))
+	for i, line := range lines {
+		// Match the label width used by the HUMAN formatter
+		out[i] = fmt.Sprintf("%-26s%s", line[0]+":", line[1])
+	}
+
+	return strings.Join(out, "\n")
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/leaktk/leaktk/pkg/id"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// requestErrorCode is the error code for requests that couldn't be passed to
+// the scanner. It's well past the scanner's codes so the two can't be mixed up.
+const requestErrorCode = 100
+
+// requestIDPattern finds the id in a request that isn't valid JSON
+var requestIDPattern = regexp.MustCompile(`"id"\s*:\s*("(?:[^"\\]|\\.)*")`)
+
+// parseRequest parses a line of JSON into a request. If it isn't a request
+// that can be scanned, an error response is returned instead so clients aren't
+// left waiting on it.
+func parseRequest(line []byte) (*proto.Request, *proto.Response) {
+	var request proto.Request
+	if err := json.Unmarshal(line, &request); err != nil {
+		return nil, requestErrorResponse(bestEffortRequestID(line, request.ID), fmt.Sprintf("could not unmarshal request: %v", err))
+	}
+
+	if len(request.Resource) == 0 {
+		return nil, requestErrorResponse(request.ID, "no resource provided")
+	}
+
+	return &request, nil
+}
+
+// bestEffortRequestID returns the id from a request that couldn't be parsed.
+// It's empty if the request doesn't seem to have one.
+func bestEffortRequestID(line []byte, parsedID string) string {
+	// Unmarshal may have gotten to the id before it hit the error
+	if len(parsedID) > 0 {
+		return parsedID
+	}
+
+	match := requestIDPattern.FindSubmatch(line)
+	if match == nil {
+		return ""
+	}
+
+	var requestID string
+	if err := json.Unmarshal(match[1], &requestID); err != nil {
+		return ""
+	}
+
+	return requestID
+}
+
+func requestErrorResponse(requestID, message string) *proto.Response {
+	logger.Error("invalid request: %s request_id=%q", message, requestID)
+
+	return &proto.Response{
+		ID:        id.ID(),
+		Kind:      proto.ScanResultsResponseKind,
+		RequestID: requestID,
+		Error: &proto.Error{
+			Code:    requestErrorCode,
+			Message: message,
+		},
+	}
+}
+
+// requestSequencer remembers the line each request in a listen session came
+// from so clients can tell which requests never got a response
+type requestSequencer struct {
+	mutex sync.Mutex
+	seqs  map[string][]uint64
+}
+
+func newRequestSequencer() *requestSequencer {
+	return &requestSequencer{seqs: make(map[string][]uint64)}
+}
+
+// Add records that the request with the ID was on line seq
+func (s *requestSequencer) Add(requestID string, seq uint64) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.seqs[requestID] = append(s.seqs[requestID], seq)
+}
+
+// Set sets the response's RequestSeq. There's no telling which request a
+// response is for if a client reuses an ID while the first request is still
+// running, so the oldest one is used. Its seq is forgotten once the final
+// response for it is sent.
+func (s *requestSequencer) Set(response *proto.Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	seqs := s.seqs[response.RequestID]
+	if len(seqs) == 0 {
+		return
+	}
+
+	response.RequestSeq = seqs[0]
+	if response.Kind == proto.HeartbeatResponseKind {
+		return
+	}
+
+	if len(seqs) == 1 {
+		delete(s.seqs, response.RequestID)
+	} else {
+		s.seqs[response.RequestID] = seqs[1:]
+	}
+}
@@ -0,0 +1,66 @@
+package cmd
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestParseRequest(t *testing.T) {
+	t.Run("Valid", func(t *testing.T) {
+		request, errResponse := parseRequest([]byte(`{"id":"1","kind":"Text","resource":"hello"}`))
+		require.Nil(t, errResponse)
+		assert.Equal(t, "1", request.ID)
+		assert.Equal(t, proto.TextRequestKind, request.Kind)
+	})
+
+	tests := []struct {
+		name      string
+		line      string
+		requestID string
+		message   string
+	}{
+		{"Truncated", `{"id":"abc\"123","kind":"Te`, `abc"123`, "could not unmarshal request"},
+		{"BadKind", `{"id":"abc","kind":"Bogus","resource":"hello"}`, "abc", "could not unmarshal request"},
+		{"NoID", `not json`, "", "could not unmarshal request"},
+		{"NoResource", `{"id":"abc","kind":"Text"}`, "abc", "no resource provided"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			request, errResponse := parseRequest([]byte(tt.line))
+			assert.Nil(t, request)
+			require.NotNil(t, errResponse)
+			assert.Equal(t, tt.requestID, errResponse.RequestID)
+			assert.Equal(t, proto.ScanResultsResponseKind, errResponse.Kind)
+			require.NotNil(t, errResponse.Error)
+			assert.Equal(t, requestErrorCode, errResponse.Error.Code)
+			assert.Contains(t, errResponse.Error.Message, tt.message)
+		})
+	}
+}
+
+func TestRequestSequencer(t *testing.T) {
+	sequencer := newRequestSequencer()
+	sequencer.Add("a", 1)
+	sequencer.Add("b", 2)
+	sequencer.Add("a", 3)
+
+	heartbeat := &proto.Response{Kind: proto.HeartbeatResponseKind, RequestID: "a"}
+	sequencer.Set(heartbeat)
+	assert.Equal(t, uint64(1), heartbeat.RequestSeq)
+
+	for _, expected := range []struct {
+		requestID string
+		seq       uint64
+	}{{"b", 2}, {"a", 1}, {"a", 3}, {"a", 0}} {
+		response := &proto.Response{Kind: proto.ScanResultsResponseKind, RequestID: expected.requestID}
+		sequencer.Set(response)
+		assert.Equal(t, expected.seq, response.RequestSeq)
+	}
+
+	assert.Empty(t, sequencer.seqs)
+}
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+	"github.com/leaktk/leaktk/pkg/version"
+)
+
+// sarifHeader opens a SARIF log with a single run up to its results array.
+// The tool version is filled in when the header is written.
+const sarifHeader = `{"$schema":"https://json.schemastore.org/sarif-2.1.0.json","version":"2.1.0","runs":[{"tool":{"driver":{"name":"leaktk","informationUri":"https://github.com/leaktk/leaktk","version":%s}},"results":[`
+
+// sarifWriter writes results to a SARIF log as they come in so the whole log
+// never has to be held in memory. Close must be called to finish the log; the
+// errors from any responses are added to the run's invocation then.
+type sarifWriter struct {
+	out           io.Writer
+	wroteResult   bool
+	notifications []sarifNotification
+	err           error
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifNotification struct {
+	Level   string       `json:"level"`
+	Message sarifMessage `json:"message"`
+}
+
+type sarifInvocation struct {
+	ExecutionSuccessful        bool                `json:"executionSuccessful"`
+	ToolExecutionNotifications []sarifNotification `json:"toolExecutionNotifications,omitempty"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn,omitempty"`
+	EndLine     int `json:"endLine,omitempty"`
+	EndColumn   int `json:"endColumn,omitempty"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           *sarifRegion          `json:"region,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifResult struct {
+	RuleID              string            `json:"ruleId"`
+	Level               string            `json:"level"`
+	Message             sarifMessage      `json:"message"`
+	Locations           []sarifLocation   `json:"locations,omitempty"`
+	PartialFingerprints map[string]string `json:"partialFingerprints"`
+	Properties          map[string]string `json:"properties,omitempty"`
+}
+
+// newSarifWriter starts a SARIF log on out
+func newSarifWriter(out io.Writer) *sarifWriter {
+	w := &sarifWriter{out: out}
+
+	toolVersion, _ := json.Marshal(cmp.Or(version.Version, "unknown"))
+	w.write(fmt.Sprintf(sarifHeader, toolVersion))
+
+	return w
+}
+
+// WriteResponse adds the response's results to the log and keeps its error
+// for the invocation
+func (w *sarifWriter) WriteResponse(r *proto.Response) {
+	if r.Error != nil {
+		w.notifications = append(w.notifications, sarifNotification{
+			Level:   "error",
+			Message: sarifMessage{Text: r.Error.Message},
+		})
+	}
+
+	for _, result := range r.Results {
+		data, err := json.Marshal(toSarifResult(result))
+		if err != nil {
+			w.err = cmp.Or(w.err, fmt.Errorf("could not encode SARIF result: %w id=%q", err, result.ID))
+			continue
+		}
+
+		if w.wroteResult {
+			w.write(",")
+		}
+		w.write(string(data))
+		w.wroteResult = true
+	}
+}
+
+// Close finishes the log and returns the first error from writing it
+func (w *sarifWriter) Close() error {
+	invocation, err := json.Marshal(sarifInvocation{
+		ExecutionSuccessful:        len(w.notifications) == 0,
+		ToolExecutionNotifications: w.notifications,
+	})
+	if err != nil {
+		w.err = cmp.Or(w.err, fmt.Errorf("could not encode SARIF invocation: %w", err))
+		invocation = []byte(`{"executionSuccessful":false}`)
+	}
+
+	w.write(`],"invocations":[` + string(invocation) + "]}]}\n")
+
+	return w.err
+}
+
+func (w *sarifWriter) write(data string) {
+	if w.err != nil {
+		return
+	}
+
+	if _, err := io.WriteString(w.out, data); err != nil {
+		w.err = fmt.Errorf("could not write SARIF log: %w", err)
+	}
+}
+
+// toSarifResult converts a result to a SARIF one. Like the GitHub Actions
+// format, the secret is left out since SARIF logs are usually uploaded for
+// others to view.
+func toSarifResult(result *proto.Result) sarifResult {
+	message := result.Rule.Description
+	if len(message) == 0 {
+		message = "potential secret found: rule=" + result.Rule.ID
+	}
+
+	if len(result.Rule.Remediation) > 0 {
+		message += "\nremediation: " + result.Rule.Remediation
+	}
+
+	sarif := sarifResult{
+		RuleID:              result.Rule.ID,
+		Level:               "error",
+		Message:             sarifMessage{Text: message},
+		PartialFingerprints: map[string]string{"leaktkResultId/v1": result.ID},
+	}
+
+	if len(result.Location.Path) > 0 {
+		location := sarifLocation{
+			PhysicalLocation: sarifPhysicalLocation{
+				ArtifactLocation: sarifArtifactLocation{URI: result.Location.Path},
+			},
+		}
+
+		// SARIF lines and columns start at 1 so unknown ones are left out
+		if start := result.Location.Start; start.Line > 0 {
+			end := result.Location.End
+			location.PhysicalLocation.Region = &sarifRegion{
+				StartLine:   start.Line,
+				StartColumn: start.Column,
+				EndLine:     max(end.Line, start.Line),
+				EndColumn:   end.Column,
+			}
+		}
+
+		sarif.Locations = []sarifLocation{location}
+	}
+
+	if len(result.Location.Version) > 0 {
+		sarif.Properties = map[string]string{"commit": result.Location.Version}
+	}
+
+	return sarif
+}
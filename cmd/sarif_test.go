@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+type testSarifLog struct {
+	Version string `json:"version"`
+	Runs    []struct {
+		Tool struct {
+			Driver struct {
+				Name string `json:"name"`
+			} `json:"driver"`
+		} `json:"tool"`
+		Results     []sarifResult     `json:"results"`
+		Invocations []sarifInvocation `json:"invocations"`
+	} `json:"runs"`
+}
+
+func TestSarifWriter(t *testing.T) {
+	var out strings.Builder
+
+	writer := newSarifWriter(&out)
+	writer.WriteResponse(&proto.Response{
+		Results: []*proto.Result{
+			{
+				ID:     "result-1",
+				Secret: "hunter2",
+				Rule:   proto.Rule{ID: "generic", Description: "Generic secret"},
+				Location: proto.Location{
+					Version: "abc123",
+					Path:    "dir/a.txt",
+					Start:   proto.Point{Line: 3, Column: 5},
+					End:     proto.Point{Line: 3, Column: 12},
+				},
+			},
+		},
+	})
+	writer.WriteResponse(&proto.Response{Results: []*proto.Result{}})
+	writer.WriteResponse(&proto.Response{
+		Results: []*proto.Result{
+			{ID: "result-2", Rule: proto.Rule{ID: "text"}},
+		},
+	})
+	require.NoError(t, writer.Close())
+
+	var log testSarifLog
+	require.NoError(t, json.Unmarshal([]byte(out.String()), &log))
+	require.Len(t, log.Runs, 1)
+
+	run := log.Runs[0]
+	assert.Equal(t, "2.1.0", log.Version)
+	assert.Equal(t, "leaktk", run.Tool.Driver.Name)
+	assert.Equal(t, []sarifInvocation{{ExecutionSuccessful: true}}, run.Invocations)
+	require.Len(t, run.Results, 2)
+
+	assert.Equal(t, sarifResult{
+		RuleID:  "generic",
+		Level:   "error",
+		Message: sarifMessage{Text: "Generic secret"},
+		Locations: []sarifLocation{
+			{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: "dir/a.txt"},
+					Region:           &sarifRegion{StartLine: 3, StartColumn: 5, EndLine: 3, EndColumn: 12},
+				},
+			},
+		},
+		PartialFingerprints: map[string]string{"leaktkResultId/v1": "result-1"},
+		Properties:          map[string]string{"commit": "abc123"},
+	}, run.Results[0])
+
+	// Results without a path or line can't have a location
+	assert.Empty(t, run.Results[1].Locations)
+	assert.Equal(t, "potential secret found: rule=text", run.Results[1].Message.Text)
+
+	// The secret shouldn't end up in the log
+	assert.NotContains(t, out.String(), "hunter2")
+
+	t.Run("Errors", func(t *testing.T) {
+		var out strings.Builder
+
+		writer := newSarifWriter(&out)
+		writer.WriteResponse(&proto.Response{
+			Error:   &proto.Error{Message: "clone failed"},
+			Results: []*proto.Result{{ID: "result-1", Rule: proto.Rule{ID: "text"}}},
+		})
+		require.NoError(t, writer.Close())
+
+		// The log is still complete with what was found before the error
+		var log testSarifLog
+		require.NoError(t, json.Unmarshal([]byte(out.String()), &log))
+		require.Len(t, log.Runs, 1)
+		assert.Len(t, log.Runs[0].Results, 1)
+		assert.Equal(t, []sarifInvocation{
+			{
+				ExecutionSuccessful: false,
+				ToolExecutionNotifications: []sarifNotification{
+					{Level: "error", Message: sarifMessage{Text: "clone failed"}},
+				},
+			},
+		}, log.Runs[0].Invocations)
+	})
+
+	t.Run("Format", func(t *testing.T) {
+		format, err := getOutputFormat("sarif")
+		require.NoError(t, err)
+		assert.Equal(t, SARIF, format)
+
+		var log testSarifLog
+		require.NoError(t, json.Unmarshal([]byte(formatSarif(&proto.Response{})), &log))
+		require.Len(t, log.Runs, 1)
+		assert.Empty(t, log.Runs[0].Results)
+	})
+}
@@ -5,13 +5,65 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/logger"
 )
 
+var (
+	gitPath      = "git"
+	gitPathMutex sync.RWMutex
+)
+
+// Path returns the git binary that commands run
+func Path() string {
+	gitPathMutex.RLock()
+	defer gitPathMutex.RUnlock()
+
+	return gitPath
+}
+
+// SetPath sets the git binary that commands run. An empty path looks up git
+// on PATH. Since betterleaks runs git from PATH, the binary's dir is also
+// added to the start of PATH when the binary is named git.
+func SetPath(path string) error {
+	if len(path) == 0 {
+		path = "git"
+	} else {
+		path = filepath.Clean(path)
+
+		if name := strings.TrimSuffix(filepath.Base(path), ".exe"); name == "git" && filepath.IsAbs(path) {
+			dir := filepath.Dir(path)
+			envPath := os.Getenv("PATH")
+
+			if first, _, _ := strings.Cut(envPath, string(os.PathListSeparator)); first != dir {
+				if err := os.Setenv("PATH", dir+string(os.PathListSeparator)+envPath); err != nil {
+					return fmt.Errorf("could not add git dir to PATH: %w path=%q", err, path)
+				}
+			}
+		} else {
+			logger.Warning("git_path isn't an absolute path to a binary named git so git log and diff scans will use git from PATH: git_path=%q", path)
+		}
+	}
+
+	gitPathMutex.Lock()
+	defer gitPathMutex.Unlock()
+
+	gitPath = path
+
+	return nil
+}
+
 // GitRepoInfo is a collection of facts about a repo being scanned.
 // See `man 7 gitglossary` for more information about the terms.
 type RepoInfo struct {
@@ -19,12 +71,16 @@ type RepoInfo struct {
 	IsBare bool
 	// The path to the actual GIT_DIR folder
 	GitDir string
-	// The working tree for the repo (a temp one is created for bare repos)
+	// The working tree for the repo. Local bare repos don't have one and a
+	// temp one is created for clones.
 	WorkingTreePath string
+	// The commit the branch pointed to when it was cloned (only set for
+	// clones of a specific branch)
+	HeadCommit string
 }
 
 func GetRepoInfo(ctx context.Context, path string) (RepoInfo, error) {
-	info := RepoInfo{WorkingTreePath: path}
+	var info RepoInfo
 	cmd := CommandContext(
 		ctx,
 		"-C",
@@ -52,6 +108,8 @@ func GetRepoInfo(ctx context.Context, path string) (RepoInfo, error) {
 
 	// Resolve the working tree to the toplevel path
 	if !info.IsBare {
+		info.WorkingTreePath = path
+
 		// Running this separate since it's more prone to error out
 		cmd := CommandContext(
 			ctx,
@@ -73,15 +131,455 @@ func GetRepoInfo(ctx context.Context, path string) (RepoInfo, error) {
 	return info, nil
 }
 
+// RevParse resolves a revision (e.g. HEAD) in the repo to its commit SHA
+func RevParse(ctx context.Context, gitDir, rev string) (string, error) {
+	cmd := CommandContext(ctx, "-C", gitDir, "rev-parse", "--verify", rev+"^{commit}") // #nosec G204
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("could not resolve revision: %w rev=%q", err, rev)
+	}
+
+	return strings.TrimSpace(string(output)), nil
+}
+
+// CountCommits returns how many commits git rev-list selects with the args
+func CountCommits(ctx context.Context, gitDir string, args []string) (int, error) {
+	cmd := CommandContext(ctx, append([]string{"--git-dir", gitDir, "rev-list", "--count"}, args...)...) // #nosec G204
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("could not count commits: %w", err)
+	}
+
+	count, err := strconv.Atoi(strings.TrimSpace(string(output)))
+	if err != nil {
+		return 0, fmt.Errorf("could not parse commit count: %w output=%q", err, output)
+	}
+
+	return count, nil
+}
+
+// ListCommits returns the SHAs of the commits git rev-list selects with the
+// args
+func ListCommits(ctx context.Context, gitDir string, args []string) ([]string, error) {
+	cmd := CommandContext(ctx, append([]string{"--git-dir", gitDir, "rev-list"}, args...)...) // #nosec G204
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list commits: %w", err)
+	}
+
+	return strings.Fields(string(output)), nil
+}
+
+// ShallowCommits returns the commits at the edge of a shallow clone's history
+// or nil if the repo isn't shallow
+func ShallowCommits(gitDir string) []string {
+	var shallowCommits []string
+
+	data, err := os.ReadFile(filepath.Join(gitDir, "shallow")) // #nosec G304
+	if err != nil {
+		return shallowCommits
+	}
+
+	for _, shallowCommit := range strings.Split(string(data), "\n") {
+		if len(shallowCommit) > 0 {
+			shallowCommits = append(shallowCommits, shallowCommit)
+		}
+	}
+
+	return shallowCommits
+}
+
+// ShallowBoundaryDate returns the newest committer date of the shallow commits
+// in the repo. Older history may be missing on at least one line of history.
+// The bool is false if the repo isn't shallow.
+func ShallowBoundaryDate(ctx context.Context, gitDir string) (time.Time, bool, error) {
+	shallowCommits := ShallowCommits(gitDir)
+	if len(shallowCommits) == 0 {
+		return time.Time{}, false, nil
+	}
+
+	args := append([]string{"-C", gitDir, "log", "--no-walk", "--format=%cI"}, shallowCommits...)
+	cmd := CommandContext(ctx, args...) // #nosec G204
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return time.Time{}, true, fmt.Errorf("could not get shallow commit dates: %w", err)
+	}
+
+	var boundaryDate time.Time
+	for _, rawDate := range strings.Fields(string(output)) {
+		date, err := time.Parse(time.RFC3339, rawDate)
+		if err != nil {
+			return time.Time{}, true, fmt.Errorf("could not parse commit date: %w date=%q", err, rawDate)
+		}
+
+		if date.After(boundaryDate) {
+			boundaryDate = date
+		}
+	}
+
+	return boundaryDate, true, nil
+}
+
+// Author is who wrote a commit
+type Author struct {
+	Name  string
+	Email string
+}
+
+// IntroducedBy returns the author of the oldest commit reachable from rev that
+// added text to path, following renames. The bool is false if no commit added
+// it (e.g. the text isn't in the file as is).
+func IntroducedBy(ctx context.Context, gitDir, rev, path, text string) (Author, bool, error) {
+	cmd := CommandContext( // #nosec G204
+		ctx,
+		"-C", gitDir,
+		"log",
+		"--reverse",
+		"--follow",
+		"--format=%an%x00%ae",
+		"-S", text,
+		rev,
+		"--",
+		path,
+	)
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return Author{}, false, fmt.Errorf("could not search history: %w rev=%q path=%q", err, rev, path)
+	}
+
+	firstLine, _, _ := strings.Cut(string(output), "\n")
+	parts := strings.Split(firstLine, "\x00")
+	if len(parts) != 2 {
+		return Author{}, false, nil
+	}
+
+	return Author{Name: parts[0], Email: parts[1]}, true, nil
+}
+
+// Hunk is one section of a diff along with its context lines
+type Hunk struct {
+	// The path of the file after the change
+	Path string
+	// The range of lines in the file after the change
+	NewStart int
+	NewLines int
+	// The hunk as it appears in the diff, starting with its @@ header
+	Text string
+}
+
+// Contains reports whether the line (in the file after the change) falls
+// within the hunk
+func (h Hunk) Contains(line int) bool {
+	return h.NewStart <= line && line < h.NewStart+max(h.NewLines, 1)
+}
+
+var hunkHeaderPattern = regexp.MustCompile(`^@@ -\d+(?:,(\d+))? \+(\d+)(?:,(\d+))? @@`)
+
+// DiffHunks returns the hunks for the staged changes in the working tree, or
+// the unstaged ones if staged is false, with a few lines of context around them
+func DiffHunks(ctx context.Context, workingTree string, staged bool) ([]Hunk, error) {
+	args := []string{"-C", workingTree, "diff", "--no-color", "--no-ext-diff", "--unified=3"}
+	if staged {
+		args = append(args, "--staged")
+	}
+
+	cmd := CommandContext(ctx, append(args, ".")...) // #nosec G204
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not diff changes: %w staged=%t", err, staged)
+	}
+
+	return parseDiffHunks(string(output)), nil
+}
+
+// DiffPaths returns the paths of the files with staged changes in the working
+// tree, or unstaged ones if staged is false, that match the git pathspecs
+func DiffPaths(ctx context.Context, workingTree string, staged bool, pathspecs []string) ([]string, error) {
+	args := []string{"-C", workingTree, "diff", "--name-only", "-z", "--no-ext-diff"}
+	if staged {
+		args = append(args, "--staged")
+	}
+
+	cmd := CommandContext(ctx, append(append(args, "--"), pathspecs...)...) // #nosec G204
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("could not list changed paths: %w staged=%t", err, staged)
+	}
+
+	var paths []string
+	for path := range strings.SplitSeq(string(output), "\x00") {
+		if len(path) > 0 {
+			paths = append(paths, path)
+		}
+	}
+
+	return paths, nil
+}
+
+func parseDiffHunks(diff string) []Hunk {
+	var hunks []Hunk
+	var path string
+	var hunk *Hunk
+	var text strings.Builder
+	var oldLeft, newLeft int
+
+	for line := range strings.Lines(diff) {
+		// Count the lines left in the hunk since removed lines can look like
+		// headers (e.g. "--- " for a removed line starting with "-- ")
+		if hunk != nil && (oldLeft > 0 || newLeft > 0 || strings.HasPrefix(line, `\`)) {
+			text.WriteString(line)
+			switch line[0] {
+			case '+':
+				newLeft--
+			case '-':
+				oldLeft--
+			case ' ':
+				oldLeft--
+				newLeft--
+			}
+			continue
+		}
+
+		if hunk != nil {
+			hunk.Text = text.String()
+			hunks = append(hunks, *hunk)
+			hunk = nil
+			text.Reset()
+		}
+
+		if newPath, ok := strings.CutPrefix(line, "+++ "); ok {
+			path = strings.TrimPrefix(strings.TrimRight(newPath, "\r\n"), "b/")
+			continue
+		}
+
+		match := hunkHeaderPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+
+		// Counts are left out of the header when they're 1
+		oldLeft, newLeft = 1, 1
+		if len(match[1]) > 0 {
+			oldLeft, _ = strconv.Atoi(match[1])
+		}
+		if len(match[3]) > 0 {
+			newLeft, _ = strconv.Atoi(match[3])
+		}
+		newStart, _ := strconv.Atoi(match[2])
+
+		hunk = &Hunk{Path: path, NewStart: newStart, NewLines: newLeft}
+		text.WriteString(line)
+	}
+
+	if hunk != nil {
+		hunk.Text = text.String()
+		hunks = append(hunks, *hunk)
+	}
+
+	return hunks
+}
+
 func RunContext(ctx context.Context, args ...string) error {
 	cmd := CommandContext(ctx, args...)
 	logger.Debug("executing: %s", cmd)
 	return cmd.Run()
 }
 
-// RemoteRefExists checks if the provided ref exists on the remote repo
-func RemoteRefExists(ctx context.Context, repository, ref string) bool {
-	return RunContext(ctx, "ls-remote", "--exit-code", "--quiet", repository, ref) == nil
+// Submodule is an entry in a repo's .gitmodules
+type Submodule struct {
+	Name string
+	Path string
+	URL  string
+}
+
+// ShowFile returns the contents of the file at path in rev and whether it
+// exists there
+func ShowFile(ctx context.Context, gitDir, rev, path string) ([]byte, bool, error) {
+	blob := rev + ":" + path
+	if RunContext(ctx, "--git-dir", gitDir, "cat-file", "-e", blob) != nil {
+		return nil, false, nil
+	}
+
+	cmd := CommandContext(ctx, "--git-dir", gitDir, "show", blob) // #nosec G204
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, true, fmt.Errorf("could not show file: %w rev=%q path=%q", err, rev, path)
+	}
+
+	return output, true, nil
+}
+
+// Submodules returns the submodules listed in the .gitmodules at rev sorted
+// by path. Repos without a .gitmodules have none.
+func Submodules(ctx context.Context, gitDir, rev string) ([]Submodule, error) {
+	blob := rev + ":.gitmodules"
+	if RunContext(ctx, "--git-dir", gitDir, "cat-file", "-e", blob) != nil {
+		return nil, nil
+	}
+
+	cmd := CommandContext(ctx, "--git-dir", gitDir, "config", "--blob", blob, "--get-regexp", `^submodule\..*\.(path|url)$`) // #nosec G204
+	logger.Debug("executing: %s", cmd)
+	output, err := cmd.Output()
+	if err != nil {
+		// git config exits with 1 when nothing matches
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("could not read .gitmodules: %w rev=%q", err, rev)
+	}
+
+	submodules := make(map[string]*Submodule)
+	for line := range strings.Lines(string(output)) {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), " ")
+		if !ok {
+			continue
+		}
+
+		// Names can contain dots so the field is after the last one
+		key = strings.TrimPrefix(key, "submodule.")
+		i := strings.LastIndex(key, ".")
+		name, field := key[:i], key[i+1:]
+
+		submodule, ok := submodules[name]
+		if !ok {
+			submodule = &Submodule{Name: name}
+			submodules[name] = submodule
+		}
+
+		if field == "path" {
+			submodule.Path = value
+		} else {
+			submodule.URL = value
+		}
+	}
+
+	var result []Submodule
+	for _, submodule := range submodules {
+		if len(submodule.Path) == 0 || len(submodule.URL) == 0 {
+			logger.Warning("skipping incomplete submodule: name=%q", submodule.Name)
+			continue
+		}
+
+		result = append(result, *submodule)
+	}
+
+	slices.SortFunc(result, func(a, b Submodule) int {
+		return strings.Compare(a.Path, b.Path)
+	})
+
+	return result, nil
+}
+
+// LFSInstalled reports whether the git lfs extension is available
+func LFSInstalled(ctx context.Context) bool {
+	return RunContext(ctx, "lfs", "version") == nil
+}
+
+// LFSSmudge downloads the object a Git LFS pointer refers to using the repo's
+// LFS settings and credentials and passes its content to fn
+func LFSSmudge(ctx context.Context, gitDir, path, pointer string, fn func(io.Reader) error) error {
+	var stderr bytes.Buffer
+
+	cmd := CommandContext(ctx, "--git-dir", gitDir, "lfs", "smudge", "--", path) // #nosec G204
+	cmd.Stdin = strings.NewReader(pointer)
+	cmd.Stderr = &stderr
+
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("could not open git lfs smudge output: %w path=%q", err, path)
+	}
+
+	logger.Debug("executing: %s", cmd)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("could not start git lfs smudge: %w path=%q", err, path)
+	}
+
+	fnErr := fn(stdout)
+	// Drain anything fn didn't read so the command can exit
+	_, _ = io.Copy(io.Discard, stdout)
+
+	if err := cmd.Wait(); err != nil {
+		return fmt.Errorf("git lfs smudge failed: %w path=%q output=%q", err, path, stderr.String())
+	}
+
+	return fnErr
+}
+
+// maxRemoteRefOutput limits how much of ls-remote's output is kept so a
+// misbehaving remote can't fill up memory
+const maxRemoteRefOutput = 64 * 1024
+
+// ErrRemoteUnreachable is returned when the remote couldn't be checked for a
+// ref (e.g. it timed out or refused the connection)
+var ErrRemoteUnreachable = errors.New("remote unreachable")
+
+// RemoteRefs returns the names of the refs on the remote repo matching ref
+// (e.g. refs/heads/main and refs/tags/main for main). It returns no refs
+// without an error when nothing matches and ErrRemoteUnreachable when the
+// remote can't be reached within timeout.
+func RemoteRefs(ctx context.Context, repository, ref string, timeout time.Duration) ([]string, error) {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	stdout := &limitedBuffer{limit: maxRemoteRefOutput}
+	stderr := &limitedBuffer{limit: maxRemoteRefOutput}
+	cmd := CommandContext(ctx, "ls-remote", "--exit-code", repository, ref) // #nosec G204
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	logger.Debug("executing: %s", cmd)
+	if err := cmd.Run(); err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, fmt.Errorf("%w: %w timeout=%q", ErrRemoteUnreachable, ctxErr, timeout)
+		}
+
+		// ls-remote --exit-code exits with 2 when no matching refs are found
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && exitErr.ExitCode() == 2 {
+			return nil, nil
+		}
+
+		return nil, fmt.Errorf("%w: %w output=%q", ErrRemoteUnreachable, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var refs []string
+	for line := range strings.Lines(stdout.String()) {
+		// Lines are formatted as "<oid>\t<ref>" and annotated tags are also
+		// listed with a ^{} suffix for the commit they point to
+		if _, name, ok := strings.Cut(strings.TrimSpace(line), "\t"); ok && !strings.HasSuffix(name, "^{}") {
+			refs = append(refs, name)
+		}
+	}
+
+	return refs, nil
+}
+
+// limitedBuffer keeps the first limit bytes written to it and discards the
+// rest without failing the write
+type limitedBuffer struct {
+	bytes.Buffer
+	limit int
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if remaining := b.limit - b.Len(); remaining > 0 {
+		b.Buffer.Write(p[:min(len(p), remaining)])
+	}
+
+	return len(p), nil
 }
 
 // GetGlobalConfigPath gets a value from the global config and applies a --type=path flag
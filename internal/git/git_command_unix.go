@@ -12,7 +12,7 @@ import (
 // and cancel function to ensure the command doesn't hang
 // when in weird states
 func CommandContext(ctx context.Context, args ...string) *exec.Cmd {
-	cmd := exec.CommandContext(ctx, "git", args...) // #nosec G204
+	cmd := exec.CommandContext(ctx, Path(), args...) // #nosec G204
 	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
 	cmd.Cancel = func() error {
 		// kill the negative pid to kill the whole process group
@@ -10,5 +10,5 @@ import (
 // CommandContext for windows exists for compatibility with
 // the unix version that does some extra pgroup managment
 func CommandContext(ctx context.Context, args ...string) *exec.Cmd {
-	return exec.CommandContext(ctx, "git", args...)
+	return exec.CommandContext(ctx, Path(), args...) // #nosec G204
 }
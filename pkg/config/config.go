@@ -1,13 +1,17 @@
 package config
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/adrg/xdg"
+	"gopkg.in/yaml.v3"
 
 	"github.com/leaktk/leaktk/pkg/fs"
 	"github.com/leaktk/leaktk/pkg/logger"
@@ -60,65 +64,132 @@ type (
 	// for the toolchain. This may be abstracted out to a common library in
 	// the future as more components are added to the toolchain.
 	Config struct {
-		Logger    Logger    `toml:"logger"`
-		Scanner   Scanner   `toml:"scanner"`
-		Formatter Formatter `toml:"formatter"`
-		Redactor  Redactor  `toml:"Redactor"`
+		Logger    Logger    `json:"logger" toml:"logger" yaml:"logger"`
+		Scanner   Scanner   `json:"scanner" toml:"scanner" yaml:"scanner"`
+		Formatter Formatter `json:"formatter" toml:"formatter" yaml:"formatter"`
+		Hooks     Hooks     `json:"hooks" toml:"hooks" yaml:"hooks"`
+		Redactor  Redactor  `json:"Redactor" toml:"Redactor" yaml:"Redactor"`
+		TLS       TLS       `json:"tls" toml:"tls" yaml:"tls"`
+		HTTP      HTTP      `json:"http" toml:"http" yaml:"http"`
+		Tracing   Tracing   `json:"tracing" toml:"tracing" yaml:"tracing"`
 	}
 
 	// Formatter provides a general output format config
 	Formatter struct {
-		Format string `toml:"format"`
+		Format string `json:"format" toml:"format" yaml:"format"`
+		// Color can be "auto", "always" or "never" and only applies to HUMAN
+		Color string `json:"color" toml:"color" yaml:"color"`
+	}
+
+	// Hooks provides settings for the hooks
+	Hooks struct {
+		PreCommit PreCommitHook `json:"pre_commit" toml:"pre_commit" yaml:"pre_commit"`
+	}
+
+	// PreCommitHook provides settings for the git pre-commit hook
+	PreCommitHook struct {
+		// BypassLogPath is where bypasses with LEAKTK_ALLOW are recorded.
+		// Bypassing is disabled when it's empty.
+		BypassLogPath string `json:"bypass_log_path" toml:"bypass_log_path" yaml:"bypass_log_path"`
+		// Mode is "block" to fail commits with findings or "warn" to only
+		// show them
+		Mode string `json:"mode" toml:"mode" yaml:"mode"`
+		// Template is a text/template for the message shown when a commit has
+		// findings. The built-in message is used when it's empty.
+		Template string `json:"template" toml:"template" yaml:"template"`
 	}
 
 	// Logger provides general logger config
 	Logger struct {
-		Level string `toml:"level"`
+		Level string `json:"level" toml:"level" yaml:"level"`
+	}
+
+	// HTTP provides timeout and connection pool settings for outbound HTTP
+	// requests. Timeouts are in seconds and 0 keeps the net/http defaults.
+	HTTP struct {
+		Timeout             int `json:"timeout" toml:"timeout" yaml:"timeout"`
+		DialTimeout         int `json:"dial_timeout" toml:"dial_timeout" yaml:"dial_timeout"`
+		MaxIdleConns        int `json:"max_idle_conns" toml:"max_idle_conns" yaml:"max_idle_conns"`
+		MaxIdleConnsPerHost int `json:"max_idle_conns_per_host" toml:"max_idle_conns_per_host" yaml:"max_idle_conns_per_host"`
+	}
+
+	// TLS provides settings applied to all outbound TLS connections
+	TLS struct {
+		CACertFile string `json:"ca_cert_file" toml:"ca_cert_file" yaml:"ca_cert_file"`
+	}
+
+	// Tracing configures exporting OpenTelemetry spans for scans. Nothing is
+	// exported unless OTLPEndpoint is set.
+	Tracing struct {
+		OTLPEndpoint string `json:"otlp_endpoint" toml:"otlp_endpoint" yaml:"otlp_endpoint"`
 	}
 
 	Redactor struct {
-		RedactionMark string `toml:"redaction_mark"`
-		RedactionWord string `toml:"redaction_word"`
+		RedactionMark string `json:"redaction_mark" toml:"redaction_mark" yaml:"redaction_mark"`
+		RedactionWord string `json:"redaction_word" toml:"redaction_word" yaml:"redaction_word"`
 	}
 
 	// Scanner provides scanner specific config
 	Scanner struct {
-		AllowLocal           bool     `toml:"allow_local"`
-		ScanTimeout          int      `toml:"scan_timeout"`
-		MaxArchiveDepth      int      `toml:"max_archive_depth"`
-		MaxDecodeDepth       int      `toml:"max_decode_depth"`
-		MaxScanDepth         int      `toml:"max_scan_depth"`
-		MaxScanQueueSize     int      `toml:"max_scan_queue_size"`
-		MaxResponseQueueSize int      `toml:"max_response_queue_size"`
-		Patterns             Patterns `toml:"patterns"`
-		ScanWorkers          int      `toml:"scan_workers"`
-		Workdir              string   `toml:"workdir"`
+		AllowLocal             bool              `json:"allow_local" toml:"allow_local" yaml:"allow_local"`
+		AllowedImageTransports []string          `json:"allowed_image_transports" toml:"allowed_image_transports" yaml:"allowed_image_transports"`
+		AllowedSecrets         []string          `json:"allowed_secrets" toml:"allowed_secrets" yaml:"allowed_secrets"`
+		AuditLogPath           string            `json:"audit_log_path" toml:"audit_log_path" yaml:"audit_log_path"`
+		AuditLogMaxMB          int               `json:"audit_log_max_mb" toml:"audit_log_max_mb" yaml:"audit_log_max_mb"`
+		CaseInsensitivePaths   bool              `json:"case_insensitive_paths" toml:"case_insensitive_paths" yaml:"case_insensitive_paths"`
+		DefaultPriorities      map[string]int    `json:"default_priorities" toml:"default_priorities" yaml:"default_priorities"`
+		FilesConcurrency       int               `json:"files_concurrency" toml:"files_concurrency" yaml:"files_concurrency"`
+		GitPath                string            `json:"git_path" toml:"git_path" yaml:"git_path"`
+		HeartbeatInterval      int               `json:"heartbeat_interval" toml:"heartbeat_interval" yaml:"heartbeat_interval"`
+		ScanTimeout            int               `json:"scan_timeout" toml:"scan_timeout" yaml:"scan_timeout"`
+		MaxArchiveDepth        int               `json:"max_archive_depth" toml:"max_archive_depth" yaml:"max_archive_depth"`
+		MaxConcurrentClones    int               `json:"max_concurrent_clones" toml:"max_concurrent_clones" yaml:"max_concurrent_clones"`
+		MaxArchiveDepthLimit   int               `json:"max_archive_depth_limit" toml:"max_archive_depth_limit" yaml:"max_archive_depth_limit"`
+		MaxDecodeDepth         int               `json:"max_decode_depth" toml:"max_decode_depth" yaml:"max_decode_depth"`
+		MaxDecompressedBytes   int64             `json:"max_decompressed_bytes" toml:"max_decompressed_bytes" yaml:"max_decompressed_bytes"`
+		MaxDecompressionRatio  int64             `json:"max_decompression_ratio" toml:"max_decompression_ratio" yaml:"max_decompression_ratio"`
+		MaxLineBytes           int               `json:"max_line_bytes" toml:"max_line_bytes" yaml:"max_line_bytes"`
+		MaxScanDepth           int               `json:"max_scan_depth" toml:"max_scan_depth" yaml:"max_scan_depth"`
+		MaxScanQueueSize       int               `json:"max_scan_queue_size" toml:"max_scan_queue_size" yaml:"max_scan_queue_size"`
+		MaxResponseQueueSize   int               `json:"max_response_queue_size" toml:"max_response_queue_size" yaml:"max_response_queue_size"`
+		Patterns               Patterns          `json:"patterns" toml:"patterns" yaml:"patterns"`
+		PriorityAgingRate      float64           `json:"priority_aging_rate" toml:"priority_aging_rate" yaml:"priority_aging_rate"`
+		Remediations           map[string]string `json:"remediations" toml:"remediations" yaml:"remediations"`
+		ResultIDStrategy       string            `json:"result_id_strategy" toml:"result_id_strategy" yaml:"result_id_strategy"`
+		ScanWorkers            int               `json:"scan_workers" toml:"scan_workers" yaml:"scan_workers"`
+		SourceConfigStrategy   string            `json:"source_config_strategy" toml:"source_config_strategy" yaml:"source_config_strategy"`
+		Workdir                string            `json:"workdir" toml:"workdir" yaml:"workdir"`
 	}
 
 	// Patterns provides configuration for managing pattern updates
 	Patterns struct {
-		Autofetch    bool          `toml:"autofetch"`
-		ExpiredAfter int           `toml:"expired_after"`
-		Gitleaks     Gitleaks      `toml:"gitleaks"`
-		RefreshAfter int           `toml:"refresh_after"`
-		Server       PatternServer `toml:"server"`
+		Autofetch    bool          `json:"autofetch" toml:"autofetch" yaml:"autofetch"`
+		ExpiredAfter int           `json:"expired_after" toml:"expired_after" yaml:"expired_after"`
+		Gitleaks     Gitleaks      `json:"gitleaks" toml:"gitleaks" yaml:"gitleaks"`
+		RefreshAfter int           `json:"refresh_after" toml:"refresh_after" yaml:"refresh_after"`
+		Server       PatternServer `json:"server" toml:"server" yaml:"server"`
 	}
 
 	// Gitleaks holds version and config information for the Betterleaks scanner
 	Gitleaks struct {
-		Version    string `toml:"version"`
-		ConfigPath string `toml:"config_path"`
+		Version    string `json:"version" toml:"version" yaml:"version"`
+		ConfigPath string `json:"config_path" toml:"config_path" yaml:"config_path"`
 	}
 
 	// PatternServer provides pattern server configuration settings for the scanner
 	PatternServer struct {
-		AuthToken string `toml:"auth_token"` // #nosec G117
-		URL       string `toml:"url"`
+		AuthToken           string   `json:"auth_token" toml:"auth_token" yaml:"auth_token"` // #nosec G117
+		AuthTokenCommand    []string `json:"auth_token_command" toml:"auth_token_command" yaml:"auth_token_command"`
+		AuthTokenCommandTTL int      `json:"auth_token_command_ttl" toml:"auth_token_command_ttl" yaml:"auth_token_command_ttl"`
+		CACert              string   `json:"ca_cert" toml:"ca_cert" yaml:"ca_cert"`
+		ClientCert          string   `json:"client_cert" toml:"client_cert" yaml:"client_cert"`
+		ClientKey           string   `json:"client_key" toml:"client_key" yaml:"client_key"`
+		URL                 string   `json:"url" toml:"url" yaml:"url"`
 	}
 )
 
 // Make sure that any config returned to the code goes through this function
-func setMissingValues(cfg *Config) *Config {
+func setMissingValues(cfg *Config) (*Config, error) {
 	envLoggerLevel := os.Getenv("LEAKTK_LOGGER_LEVEL")
 	if len(envLoggerLevel) > 0 {
 		cfg.Logger.Level = envLoggerLevel
@@ -138,7 +209,11 @@ func setMissingValues(cfg *Config) *Config {
 	// easier to write via the login command and to minimize secrets in the
 	// config file. But it's still supported in the config file in case it's
 	// desirable to generate one big config file for server based deployments.
-	if authToken := loadPatternServerAuthToken(); len(authToken) != 0 {
+	authToken, err := loadPatternServerAuthToken(cfg.Scanner.Patterns.Server.URL)
+	if err != nil {
+		return nil, err
+	}
+	if len(authToken) != 0 {
 		cfg.Scanner.Patterns.Server.AuthToken = authToken
 	}
 
@@ -149,34 +224,58 @@ func setMissingValues(cfg *Config) *Config {
 		)
 	}
 
-	return cfg
+	return cfg, nil
 }
 
-func loadPatternServerAuthTokenFromFile(path string) string {
+func loadPatternServerAuthTokenFromFile(path string) (string, error) {
 	path = filepath.Clean(path)
 	logger.Debug("loading pattern-server-auth-token: path=%q", path)
 	authTokenBytes, err := os.ReadFile(path)
 
 	if err != nil {
-		logger.Fatal("could not load pattern server auth token: error=%q", err)
+		return "", fmt.Errorf("could not load pattern server auth token: %w", err)
 	}
 
-	return strings.TrimSpace(string(authTokenBytes))
+	return strings.TrimSpace(string(authTokenBytes)), nil
 }
 
 func patternServerAuthTokenPath(configDir string) string {
 	return filepath.Join(configDir, "pattern-server-auth-token")
 }
 
-func loadPatternServerAuthToken() string {
+// patternServerAuthTokensPath is where the tokens for specific pattern
+// servers are stored by the login command
+func patternServerAuthTokensPath(configDir string) string {
+	return filepath.Join(configDir, "pattern-server-auth-tokens.json")
+}
+
+// normalizeServerURL makes sure the same server is always stored under the
+// same key
+func normalizeServerURL(serverURL string) string {
+	return strings.TrimRight(strings.TrimSpace(serverURL), "/")
+}
+
+func loadPatternServerAuthToken(serverURL string) (string, error) {
 	authTokenFromEnvVar := os.Getenv("LEAKTK_PATTERN_SERVER_AUTH_TOKEN")
 
 	if len(authTokenFromEnvVar) > 0 {
 		logger.Debug("loading pattern-server-auth-token from env var")
 
-		return authTokenFromEnvVar
+		return authTokenFromEnvVar, nil
+	}
+
+	authTokens, err := ListPatternServerAuthTokens()
+	if err != nil {
+		return "", fmt.Errorf("could not load pattern server auth tokens: %w", err)
+	}
+
+	if authToken, ok := authTokens[normalizeServerURL(serverURL)]; ok {
+		logger.Debug("loading pattern-server-auth-token for server: url=%q", serverURL)
+
+		return authToken, nil
 	}
 
+	// Fall back on the token file that isn't tied to a specific server
 	path := patternServerAuthTokenPath(localConfigDir)
 	if fs.FileExists(path) {
 		return loadPatternServerAuthTokenFromFile(path)
@@ -187,7 +286,7 @@ func loadPatternServerAuthToken() string {
 		return loadPatternServerAuthTokenFromFile(path)
 	}
 
-	return ""
+	return "", nil
 }
 
 func stringToBool(value string, defaultValue bool) bool {
@@ -208,6 +307,13 @@ func DefaultConfig() *Config {
 	return &Config{
 		Formatter: Formatter{
 			Format: "JSON",
+			Color:  "auto",
+		},
+		Hooks: Hooks{
+			PreCommit: PreCommitHook{
+				BypassLogPath: filepath.Join(xdg.StateHome, "leaktk", "hook-bypasses.jsonl"),
+				Mode:          "block",
+			},
 		},
 		Logger: Logger{
 			Level: "INFO",
@@ -216,13 +322,18 @@ func DefaultConfig() *Config {
 			RedactionMark: "*",
 		},
 		Scanner: Scanner{
-			AllowLocal:      true,
-			ScanTimeout:     0,
-			MaxScanDepth:    0,
-			ScanWorkers:     1,
-			Workdir:         filepath.Join(xdg.CacheHome, "leaktk", "scanner"),
-			MaxArchiveDepth: 8,
-			MaxDecodeDepth:  8,
+			AllowLocal:            true,
+			FilesConcurrency:      40,
+			ScanTimeout:           0,
+			MaxScanDepth:          0,
+			ScanWorkers:           1,
+			Workdir:               filepath.Join(xdg.CacheHome, "leaktk", "scanner"),
+			MaxArchiveDepth:       8,
+			MaxArchiveDepthLimit:  16,
+			MaxDecodeDepth:        8,
+			MaxDecompressionRatio: 1000,
+			ResultIDStrategy:      "location",
+			SourceConfigStrategy:  "checkout",
 			Patterns: Patterns{
 				Autofetch:    true,
 				ExpiredAfter: 60 * 60 * 12 * 14, // 7 days
@@ -231,31 +342,95 @@ func DefaultConfig() *Config {
 					Version: "8.27.0",
 				},
 				Server: PatternServer{
-					URL: "https://raw.githubusercontent.com/leaktk/patterns/main/target",
+					AuthTokenCommandTTL: 300,
+					URL:                 "https://raw.githubusercontent.com/leaktk/patterns/main/target",
 				},
 			},
 		},
 	}
 }
 
+// configFileNames are the config files looked for in each config dir in order
+// of preference
+var configFileNames = []string{"config.toml", "config.yaml", "config.yml", "config.json"}
+
 // LoadConfigFromFile provides a config object with default values set plus any
-// custom values pulled in from the config file
+// custom values pulled in from the config file. Files ending in .json, .yaml
+// or .yml are decoded as such and anything else is decoded as TOML.
 func LoadConfigFromFile(path string) (*Config, error) {
 	path = filepath.Clean(path)
 	logger.Debug("loading config: path=%q", path)
 	cfg := DefaultConfig()
-	_, err := toml.DecodeFile(path, cfg)
 
-	if err != nil {
+	if err := decodeConfigFile(path, cfg); err != nil {
 		return nil, err
 	}
 
-	return setMissingValues(cfg), err
+	return setMissingValues(cfg)
+}
+
+func decodeConfigFile(path string, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if err := json.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("could not parse json config: %w path=%q", err, path)
+		}
+	case ".yaml", ".yml":
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if err := yaml.Unmarshal(data, cfg); err != nil {
+			return fmt.Errorf("could not parse yaml config: %w path=%q", err, path)
+		}
+	default:
+		if _, err := toml.DecodeFile(path, cfg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// locateConfigFile returns the first config file found in dir
+func locateConfigFile(dir string) (string, bool) {
+	for _, name := range configFileNames {
+		if path := filepath.Join(dir, name); fs.FileExists(path) {
+			return path, true
+		}
+	}
+
+	return "", false
 }
 
 // LocateAndLoadConfig looks through the possible places for the config
-// favoring the provided path if it is set
+// favoring the provided path if it is set and makes sure it's valid
 func LocateAndLoadConfig(path string) (*Config, error) {
+	cfg, err := locateAndLoadConfig(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// LocateAndLoadUnvalidatedConfig is LocateAndLoadConfig without the Validate
+// check for callers that report the config's problems themselves
+func LocateAndLoadUnvalidatedConfig(path string) (*Config, error) {
+	return locateAndLoadConfig(path)
+}
+
+func locateAndLoadConfig(path string) (*Config, error) {
 	if len(path) > 0 {
 		return LoadConfigFromFile(path)
 	}
@@ -270,39 +445,176 @@ func LocateAndLoadConfig(path string) (*Config, error) {
 		logger.Debug("using default config")
 	}
 
-	path = filepath.Join(localConfigDir, "config.toml")
-	if fs.FileExists(path) {
+	if path, ok := locateConfigFile(localConfigDir); ok {
 		return LoadConfigFromFile(path)
 	}
 
-	path = filepath.Join(nixGlobalConfigDir, "config.toml")
-	if fs.FileExists(path) {
+	if path, ok := locateConfigFile(nixGlobalConfigDir); ok {
 		return LoadConfigFromFile(path)
 	}
 
-	return setMissingValues(DefaultConfig()), nil
+	return setMissingValues(DefaultConfig())
 }
 
-// SavePatternServerAuthToken saves the token in the path where it should go
-func SavePatternServerAuthToken(authToken string) error {
+// Validate checks for config values that would keep the scanner from working
+// (e.g. no scan workers means scans are queued but never run) and returns an
+// error for each of them
+func (c *Config) Validate() error {
+	var errs []error
+
+	if c.Scanner.ScanWorkers < 1 {
+		errs = append(errs, fmt.Errorf("scanner.scan_workers must be at least 1 or scans will never run: scan_workers=%d", c.Scanner.ScanWorkers))
+	}
+
+	for _, option := range []struct {
+		name  string
+		value int
+	}{
+		{"scan_timeout", c.Scanner.ScanTimeout},
+		{"heartbeat_interval", c.Scanner.HeartbeatInterval},
+		{"files_concurrency", c.Scanner.FilesConcurrency},
+		{"max_archive_depth", c.Scanner.MaxArchiveDepth},
+		{"max_concurrent_clones", c.Scanner.MaxConcurrentClones},
+		{"max_decode_depth", c.Scanner.MaxDecodeDepth},
+		{"max_line_bytes", c.Scanner.MaxLineBytes},
+		{"max_scan_depth", c.Scanner.MaxScanDepth},
+		{"max_scan_queue_size", c.Scanner.MaxScanQueueSize},
+		{"max_response_queue_size", c.Scanner.MaxResponseQueueSize},
+	} {
+		if option.value < 0 {
+			errs = append(errs, fmt.Errorf("scanner.%s can't be negative: %s=%d", option.name, option.name, option.value))
+		}
+	}
+
+	if serverURL := c.Scanner.Patterns.Server.URL; len(serverURL) > 0 {
+		parsedURL, err := url.Parse(serverURL)
+		if err == nil && ((parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || len(parsedURL.Host) == 0) {
+			err = errors.New("expected an http or https URL")
+		}
+
+		if err != nil {
+			errs = append(errs, fmt.Errorf("scanner.patterns.server.url is invalid: %w url=%q", err, serverURL))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateWritableDir checks that path is a writable dir or, if it doesn't
+// exist yet, that the closest existing parent is one so it can be created
+func ValidateWritableDir(path string) error {
+	if len(path) == 0 {
+		return errors.New("path is empty")
+	}
+
+	path = filepath.Clean(path)
+	for !fs.PathExists(path) {
+		parent := filepath.Dir(path)
+		if parent == path {
+			break
+		}
+		path = parent
+	}
+
+	if !fs.DirExists(path) {
+		return fmt.Errorf("not a dir: path=%q", path)
+	}
+
+	file, err := os.CreateTemp(path, ".leaktk-write-check-*")
+	if err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		logger.Debug("could not close write check file: %v path=%q", err, file.Name())
+	}
+
+	return os.Remove(file.Name())
+}
+
+// ListPatternServerAuthTokens returns the auth tokens saved by the login
+// command keyed by pattern server URL
+func ListPatternServerAuthTokens() (map[string]string, error) {
+	authTokens := make(map[string]string)
+
+	path := patternServerAuthTokensPath(localConfigDir)
+	data, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return authTokens, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &authTokens); err != nil {
+		return nil, fmt.Errorf("could not parse auth tokens: %w path=%q", err, path)
+	}
+
+	return authTokens, nil
+}
+
+func savePatternServerAuthTokens(authTokens map[string]string) error {
 	if !fs.PathExists(localConfigDir) {
 		if err := os.MkdirAll(localConfigDir, 0700); err != nil {
 			return fmt.Errorf("could not create dir: path=%q", localConfigDir)
 		}
 	}
 
-	path := patternServerAuthTokenPath(localConfigDir)
-	if err := os.WriteFile(path, []byte(strings.TrimSpace(authToken)), 0600); err != nil {
+	data, err := json.MarshalIndent(authTokens, "", "  ")
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return os.WriteFile(patternServerAuthTokensPath(localConfigDir), data, 0600)
 }
 
-// RemovePatternServerAuthToken deletes the auth token
-func RemovePatternServerAuthToken() error {
-	path := patternServerAuthTokenPath(localConfigDir)
+// SavePatternServerAuthToken saves the token for the pattern server
+func SavePatternServerAuthToken(serverURL, authToken string) error {
+	authTokens, err := ListPatternServerAuthTokens()
+	if err != nil {
+		return err
+	}
+
+	authTokens[normalizeServerURL(serverURL)] = strings.TrimSpace(authToken)
+
+	return savePatternServerAuthTokens(authTokens)
+}
+
+// RemovePatternServerAuthToken deletes the auth token for the pattern server.
+// The token that isn't tied to a server was saved for the configured server
+// so it's only removed when logging out of that one.
+func RemovePatternServerAuthToken(serverURL, configuredServerURL string) error {
+	authTokens, err := ListPatternServerAuthTokens()
+	if err != nil {
+		return err
+	}
+
+	if _, ok := authTokens[normalizeServerURL(serverURL)]; ok {
+		delete(authTokens, normalizeServerURL(serverURL))
+		if err := savePatternServerAuthTokens(authTokens); err != nil {
+			return err
+		}
+	}
+
+	if normalizeServerURL(serverURL) != normalizeServerURL(configuredServerURL) {
+		return nil
+	}
+
+	return removeFileIfExists(patternServerAuthTokenPath(localConfigDir))
+}
+
+// RemoveAllPatternServerAuthTokens deletes every auth token saved by the
+// login command
+func RemoveAllPatternServerAuthTokens() error {
+	if err := removeFileIfExists(patternServerAuthTokensPath(localConfigDir)); err != nil {
+		return err
+	}
+
+	return removeFileIfExists(patternServerAuthTokenPath(localConfigDir))
+}
 
+func removeFileIfExists(path string) error {
 	if fs.FileExists(path) {
 		if err := os.Remove(path); err != nil {
 			return err
@@ -2,6 +2,7 @@ package config
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -11,13 +12,25 @@ import (
 func TestPartialLoadConfigFromFile(t *testing.T) {
 	require.NoError(t, os.Setenv("LEAKTK_PATTERN_SERVER_AUTH_TOKEN", "x"))
 	require.NoError(t, os.Unsetenv("LEAKTK_PATTERN_SERVER_URL"))
-	cfg, err := LoadConfigFromFile("../../testdata/partial-config.toml")
+	for _, path := range []string{
+		"../../testdata/partial-config.toml",
+		"../../testdata/partial-config.yaml",
+		"../../testdata/partial-config.json",
+	} {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			cfg, err := LoadConfigFromFile(path)
 
-	if err != nil {
-		// If there are config issues fail fast
-		assert.FailNowf(t, "Failed to load config file", "Load returned an error %s", err)
+			if err != nil {
+				// If there are config issues fail fast
+				assert.FailNowf(t, "Failed to load config file", "Load returned an error %s", err)
+			}
+
+			assertPartialConfig(t, cfg)
+		})
 	}
+}
 
+func assertPartialConfig(t *testing.T, cfg *Config) {
 	// Check values
 	tests := []struct {
 		expected any
@@ -83,4 +96,114 @@ func TestLocateAndLoadConfig(t *testing.T) {
 		assert.Equal(t, "test-3", cfg.Scanner.Patterns.Gitleaks.Version)
 	})
 
+	t.Run("FallBackOnDefaultYAML", func(t *testing.T) {
+		localConfigDir = "../../testdata/locator-test/yaml"
+		defer func() { localConfigDir = "../../testdata/locator-test/leaktk" }()
+
+		cfg, err := LocateAndLoadConfig("")
+		require.NoError(t, err)
+		assert.Equal(t, "test-yaml", cfg.Scanner.Patterns.Gitleaks.Version)
+	})
+
+}
+
+func TestPatternServerAuthTokens(t *testing.T) {
+	assertAuthToken := func(t *testing.T, expected, serverURL string) {
+		authToken, err := loadPatternServerAuthToken(serverURL)
+		require.NoError(t, err)
+		assert.Equal(t, expected, authToken)
+	}
+
+	originalLocalConfigDir := localConfigDir
+	localConfigDir = t.TempDir()
+	defer func() { localConfigDir = originalLocalConfigDir }()
+	t.Setenv("LEAKTK_PATTERN_SERVER_AUTH_TOKEN", "")
+
+	t.Run("SaveAndList", func(t *testing.T) {
+		require.NoError(t, SavePatternServerAuthToken("https://a.example.com/", " token-a\n"))
+		require.NoError(t, SavePatternServerAuthToken("https://b.example.com", "token-b"))
+
+		authTokens, err := ListPatternServerAuthTokens()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"https://a.example.com": "token-a",
+			"https://b.example.com": "token-b",
+		}, authTokens)
+
+		assertAuthToken(t, "token-a", "https://a.example.com")
+		assertAuthToken(t, "token-b", "https://b.example.com/")
+		assertAuthToken(t, "", "https://c.example.com")
+	})
+
+	t.Run("FallBackOnUnkeyedToken", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(patternServerAuthTokenPath(localConfigDir), []byte("token-any"), 0600))
+
+		assertAuthToken(t, "token-a", "https://a.example.com")
+		assertAuthToken(t, "token-any", "https://c.example.com")
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		// The unkeyed token belongs to the configured server
+		require.NoError(t, RemovePatternServerAuthToken("https://a.example.com", "https://c.example.com"))
+
+		authTokens, err := ListPatternServerAuthTokens()
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{"https://b.example.com": "token-b"}, authTokens)
+		assertAuthToken(t, "token-any", "https://a.example.com")
+
+		require.NoError(t, RemovePatternServerAuthToken("https://c.example.com/", "https://c.example.com"))
+		assertAuthToken(t, "", "https://a.example.com")
+		assertAuthToken(t, "token-b", "https://b.example.com")
+	})
+
+	t.Run("InvalidTokens", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(patternServerAuthTokensPath(localConfigDir), []byte("not json"), 0600))
+		defer func() { require.NoError(t, os.Remove(patternServerAuthTokensPath(localConfigDir))) }()
+
+		_, err := loadPatternServerAuthToken("https://b.example.com")
+		assert.ErrorContains(t, err, "could not load pattern server auth tokens")
+	})
+
+	t.Run("RemoveAll", func(t *testing.T) {
+		require.NoError(t, RemoveAllPatternServerAuthTokens())
+
+		authTokens, err := ListPatternServerAuthTokens()
+		require.NoError(t, err)
+		assert.Empty(t, authTokens)
+	})
+}
+
+func TestValidate(t *testing.T) {
+	t.Run("Default", func(t *testing.T) {
+		assert.NoError(t, DefaultConfig().Validate())
+	})
+
+	t.Run("NoScanWorkers", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Scanner.ScanWorkers = 0
+		assert.ErrorContains(t, cfg.Validate(), "scanner.scan_workers must be at least 1")
+	})
+
+	t.Run("Negative", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Scanner.MaxScanQueueSize = -1
+		assert.ErrorContains(t, cfg.Validate(), "scanner.max_scan_queue_size can't be negative")
+	})
+
+	t.Run("InvalidServerURL", func(t *testing.T) {
+		cfg := DefaultConfig()
+		for _, serverURL := range []string{"example.com/patterns", "ftp://example.com", "https://"} {
+			cfg.Scanner.Patterns.Server.URL = serverURL
+			assert.ErrorContains(t, cfg.Validate(), "scanner.patterns.server.url is invalid")
+		}
+	})
+
+	t.Run("ReportsEveryError", func(t *testing.T) {
+		cfg := DefaultConfig()
+		cfg.Scanner.ScanWorkers = 0
+		cfg.Scanner.Patterns.Server.URL = "not a url"
+		err := cfg.Validate()
+		assert.ErrorContains(t, err, "scan_workers")
+		assert.ErrorContains(t, err, "server.url")
+	})
 }
@@ -0,0 +1,77 @@
+package hooks
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// bypassEnvVar holds the reason for letting a commit with findings through.
+// Unlike `git commit --no-verify`, the hook still scans and records what it
+// would have blocked.
+const bypassEnvVar = "LEAKTK_ALLOW"
+
+// bypassLogEntry is a line in the bypass log
+type bypassLogEntry struct {
+	Time    time.Time       `json:"time"`
+	Hook    string          `json:"hook"`
+	Reason  string          `json:"reason"`
+	Workdir string          `json:"workdir"`
+	Results []*proto.Result `json:"results"`
+}
+
+// writeBypassLog appends an entry for the bypass to the JSONL file at path.
+// Secrets are left out of the results so the log is safe to collect.
+func writeBypassLog(path string, hook Hook, reason string, results []*proto.Result) error {
+	workdir, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("could not get working directory: %w", err)
+	}
+
+	redacted := make([]*proto.Result, len(results))
+	for i, result := range results {
+		copied := *result
+		copied.Secret = ""
+		copied.Match = ""
+		copied.Context = ""
+
+		// The diff hunk has the lines around the secret
+		copied.Notes = maps.Clone(result.Notes)
+		delete(copied.Notes, "diff_hunk")
+
+		redacted[i] = &copied
+	}
+
+	data, err := json.Marshal(bypassLogEntry{
+		Time:    time.Now().UTC(),
+		Hook:    hook.Name(),
+		Reason:  reason,
+		Workdir: workdir,
+		Results: redacted,
+	})
+	if err != nil {
+		return fmt.Errorf("could not encode bypass log entry: %w", err)
+	}
+
+	path = filepath.Clean(path)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return fmt.Errorf("could not create bypass log dir: %w path=%q", err, path)
+	}
+
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open bypass log: %w path=%q", err, path)
+	}
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not write bypass log: %w path=%q", err, path)
+	}
+
+	return file.Close()
+}
@@ -1,12 +1,18 @@
 package hooks
 
 import (
+	"bytes"
 	"fmt"
 	"os"
 	"strings"
+	"sync"
+	"text/template"
 
+	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/docs"
+	"github.com/leaktk/leaktk/pkg/logger"
 	"github.com/leaktk/leaktk/pkg/proto"
+	"github.com/leaktk/leaktk/pkg/scanner"
 )
 
 const gitHookResultsWarningHeader = `
@@ -23,9 +29,9 @@ const gitHookResultWarningTemplate = `
 
 const gitHookResultsWarningFooter = `
 ==============================================================================
-COMMIT BLOCKED: POTENTIAL SECRETS DETECTED
+%s
 ------------------------------------------------------------------------------
-Please remove any sensitive information listed above and try again.
+%s
 
 For excluding non-sensitive findings:
 %s
@@ -35,27 +41,108 @@ For more information on interpreting these results:
 ==============================================================================
 `
 
-func gitHookResultEncodings(result *proto.Result) string {
-	var encodings strings.Builder
+// gitHookScan scans each request send passes to scan and returns all of the
+// results. Errors from send or the scans are returned instead of exiting so
+// the hook can decide on the status code.
+func gitHookScan(cfg *config.Config, send func(scan func(*proto.Request)) error) ([]*proto.Result, error) {
+	var mutex sync.Mutex
+	var results []*proto.Result
+	var scanErr error
+	var wg sync.WaitGroup
 
-	encodingPrefix := "decoded:"
-	encodingPrefixLen := len(encodingPrefix)
-	tags := result.Rule.Tags
+	leaktkScanner, err := scanner.NewScanner(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("could not create scanner: %w", err)
+	}
 
-	for _, tag := range tags {
-		if strings.HasPrefix(tag, encodingPrefix) {
-			if encodings.Len() > 0 {
-				encodings.WriteString(", ")
-			}
+	go leaktkScanner.Recv(func(response *proto.Response) {
+		if response.Kind == proto.HeartbeatResponseKind {
+			return
+		}
 
-			encodings.WriteString(tag[encodingPrefixLen:])
+		mutex.Lock()
+		if response.Error != nil && scanErr == nil {
+			scanErr = fmt.Errorf("scan response contains error: %v", response.Error)
 		}
+		results = append(results, response.Results...)
+		mutex.Unlock()
+
+		wg.Done()
+	})
+
+	// Wait on the scans already sent even if send fails
+	err = send(func(request *proto.Request) {
+		wg.Add(1)
+		leaktkScanner.Send(request)
+	})
+	wg.Wait()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return results, scanErr
+}
+
+// gitHookReportResults displays any results with the message template (or the
+// built-in message if it's empty) and returns the hook's status code. Blocking
+// only changes the message since hooks that don't block decide that for
+// themselves.
+func gitHookReportResults(results []*proto.Result, blocking bool, messageTemplate string) int {
+	if len(results) == 0 {
+		logger.Info("no secrets detected")
+		return 0
+	}
+
+	gitHookDisplayResults(results, blocking, messageTemplate)
+
+	return 1
+}
+
+// gitHookTemplateData is what message templates are rendered with
+type gitHookTemplateData struct {
+	Blocked           bool
+	Results           []*proto.Result
+	FalsePositivesURL string
+	FindingsURL       string
+}
+
+var gitHookTemplateFuncs = template.FuncMap{
+	"join": strings.Join,
+}
+
+func renderGitHookTemplate(messageTemplate string, results []*proto.Result, blocking bool) (string, error) {
+	tmpl, err := template.New("message").Funcs(gitHookTemplateFuncs).Parse(messageTemplate)
+	if err != nil {
+		return "", fmt.Errorf("could not parse template: %w", err)
+	}
+
+	// Render everything first so a failed render doesn't leave half a message
+	var message bytes.Buffer
+	err = tmpl.Execute(&message, gitHookTemplateData{
+		Blocked:           blocking,
+		Results:           results,
+		FalsePositivesURL: docs.DocURL(docs.FalsePositivesTopic),
+		FindingsURL:       docs.DocURL(docs.FindingsTopic),
+	})
+	if err != nil {
+		return "", fmt.Errorf("could not render template: %w", err)
 	}
 
-	return encodings.String()
+	return message.String(), nil
 }
 
-func gitHookDisplayResults(results []*proto.Result) {
+func gitHookDisplayResults(results []*proto.Result, blocking bool, messageTemplate string) {
+	if len(messageTemplate) > 0 {
+		message, err := renderGitHookTemplate(messageTemplate, results, blocking)
+		if err == nil {
+			fmt.Fprint(os.Stderr, message)
+			return
+		}
+
+		logger.Warning("using the built-in hook message: %v", err)
+	}
+
 	fmt.Fprint(os.Stderr, gitHookResultsWarningHeader)
 	for _, result := range results {
 		fmt.Fprintf(
@@ -65,13 +152,29 @@ func gitHookDisplayResults(results []*proto.Result) {
 			result.Location.Version,
 			result.Location.Path,
 			result.Location.Start.Line,
-			gitHookResultEncodings(result),
+			strings.Join(result.Encodings, ", "),
 		)
+
+		if hunk, ok := result.Notes["diff_hunk"]; ok {
+			fmt.Fprint(os.Stderr, "  Diff Hunk    :\n")
+			for line := range strings.Lines(hunk) {
+				fmt.Fprint(os.Stderr, "    "+line)
+			}
+		}
+	}
+
+	title := "COMMIT BLOCKED: POTENTIAL SECRETS DETECTED"
+	instructions := "Please remove any sensitive information listed above and try again."
+	if !blocking {
+		title = "COMMIT ALLOWED: POTENTIAL SECRETS DETECTED"
+		instructions = "Please remove any sensitive information listed above before pushing."
 	}
 
 	fmt.Fprintf(
 		os.Stderr,
 		gitHookResultsWarningFooter,
+		title,
+		instructions,
 		docs.DocURL(docs.FalsePositivesTopic),
 		docs.DocURL(docs.FindingsTopic),
 	)
@@ -0,0 +1,47 @@
+package hooks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/docs"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestRenderGitHookTemplate(t *testing.T) {
+	results := []*proto.Result{
+		{
+			Rule:      proto.Rule{Description: "Test Secret"},
+			Location:  proto.Location{Path: "config.env", Start: proto.Point{Line: 3}},
+			Encodings: []string{"base64", "hex"},
+		},
+	}
+
+	t.Run("Rendered", func(t *testing.T) {
+		message, err := renderGitHookTemplate(
+			"{{range .Results}}{{.Rule.Description}} in {{.Location.Path}}:{{.Location.Start.Line}} ({{join .Encodings \", \"}})\n{{end}}See {{.FindingsURL}}\n",
+			results,
+			true,
+		)
+		require.NoError(t, err)
+		assert.Equal(t, "Test Secret in config.env:3 (base64, hex)\nSee "+docs.DocURL(docs.FindingsTopic)+"\n", message)
+	})
+
+	t.Run("Blocked", func(t *testing.T) {
+		message, err := renderGitHookTemplate("{{if .Blocked}}blocked{{else}}warning{{end}}", results, false)
+		require.NoError(t, err)
+		assert.Equal(t, "warning", message)
+	})
+
+	t.Run("ParseError", func(t *testing.T) {
+		_, err := renderGitHookTemplate("{{range .Results}}", results, true)
+		require.ErrorContains(t, err, "could not parse template")
+	})
+
+	t.Run("RenderError", func(t *testing.T) {
+		_, err := renderGitHookTemplate("{{.Missing}}", results, true)
+		require.ErrorContains(t, err, "could not render template")
+	})
+}
@@ -2,54 +2,94 @@ package hooks
 
 import (
 	"fmt"
-	"sync"
+	"os"
+	"strings"
 
 	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/id"
 	"github.com/leaktk/leaktk/pkg/logger"
 	"github.com/leaktk/leaktk/pkg/proto"
-	"github.com/leaktk/leaktk/pkg/scanner"
 )
 
-func gitPreCommitRun(cfg *config.Config, hook Hook, _ []string) (int, error) {
-	var resultsMutex sync.Mutex
-	var results []*proto.Result
-	var wg sync.WaitGroup
+const (
+	// blockPreCommitMode fails commits with findings
+	blockPreCommitMode = "block"
+	// warnPreCommitMode shows the findings but lets the commit through (e.g.
+	// while rolling the hook out)
+	warnPreCommitMode = "warn"
+)
+
+// gitPreCommitRun scans the staged changes. Any args are git pathspecs that
+// limit the scan to the staged files they match.
+func gitPreCommitRun(cfg *config.Config, hook Hook, args []string) (int, error) {
+	results, err := gitHookScan(cfg, func(scan func(*proto.Request)) error {
+		scan(&proto.Request{
+			ID:       fmt.Sprintf("leaktk.%s.%s", hook.Name(), id.ID()),
+			Kind:     proto.GitRepoRequestKind,
+			Resource: ".",
+			Opts: proto.Opts{
+				Local:     true,
+				Pathspecs: args,
+				Staged:    true,
+			},
+		})
 
-	leaktkScanner := scanner.NewScanner(cfg)
+		return nil
+	})
+	if err != nil {
+		return config.ExitCodeBlockingError, err
+	}
 
-	// Prints the output of the scanner as they come
-	go leaktkScanner.Recv(func(response *proto.Response) {
-		if response.Error != nil {
-			logger.Fatal("scan response contains error: %v", response.Error)
+	mode := preCommitMode(cfg.Hooks.PreCommit.Mode)
+	blocking := mode == blockPreCommitMode
+
+	// Record the bypass before allowing it so there's always a trail
+	bypassReason := strings.TrimSpace(os.Getenv(bypassEnvVar))
+	bypassLogPath := cfg.Hooks.PreCommit.BypassLogPath
+	if len(results) > 0 && len(bypassReason) > 0 {
+		if len(bypassLogPath) == 0 {
+			logger.Warning("ignoring %s since hooks.pre_commit.bypass_log_path is empty", bypassEnvVar)
+		} else if err := writeBypassLog(bypassLogPath, hook, bypassReason, results); err != nil {
+			return config.ExitCodeBlockingError, fmt.Errorf("could not record bypass: %w", err)
+		} else {
+			logger.Warning("bypassing hook: reason=%q bypass_log_path=%q", bypassReason, bypassLogPath)
+			blocking = false
 		}
+	}
 
-		if len(response.Results) > 0 {
-			resultsMutex.Lock()
-			results = append(results, response.Results...)
-			resultsMutex.Unlock()
+	statusCode := gitHookReportResults(results, blocking, cfg.Hooks.PreCommit.Template)
+	if !blocking && statusCode != 0 {
+		if mode == warnPreCommitMode {
+			logger.Warning("allowing commit with potential secrets: mode=%q", mode)
 		}
-		wg.Done()
-	})
 
-	wg.Add(1)
-	leaktkScanner.Send(&proto.Request{
-		ID:       fmt.Sprintf("leaktk.%s.%s", hook.Name(), id.ID()),
-		Kind:     proto.GitRepoRequestKind,
-		Resource: ".",
-		Opts: proto.Opts{
-			Local:  true,
-			Staged: true,
-		},
-	})
+		return 0, nil
+	}
+
+	return statusCode, nil
+}
 
-	wg.Wait()
-	if len(results) > 0 {
-		gitHookDisplayResults(results)
-		return 1, nil
-	} else {
-		logger.Info("no secrets detected")
+// GitLiteralPathspecs turns file paths (e.g. the ones the pre-commit.com
+// framework passes to hooks) into pathspecs that only match those files, even
+// if their names contain characters git would treat as wildcards
+func GitLiteralPathspecs(paths []string) []string {
+	pathspecs := make([]string, len(paths))
+	for i, path := range paths {
+		pathspecs[i] = ":(literal)" + path
 	}
 
-	return 0, nil
+	return pathspecs
+}
+
+// preCommitMode returns the mode or the default one if it isn't known
+func preCommitMode(mode string) string {
+	switch mode {
+	case blockPreCommitMode, warnPreCommitMode:
+		return mode
+	case "":
+		return blockPreCommitMode
+	default:
+		logger.Warning("unknown pre-commit mode, using the default: mode=%q default=%q", mode, blockPreCommitMode)
+		return blockPreCommitMode
+	}
 }
@@ -1,6 +1,7 @@
 package hooks
 
 import (
+	"encoding/json"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -76,4 +77,66 @@ func TestGitPreCommit(t *testing.T) {
 	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", []string{})
 	require.NoError(t, err)
 	assert.Equal(t, 1, statusCode)
+
+	// Run a scan limited to the non-secret file (should not have findings)
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", []string{"some-file"})
+	require.NoError(t, err)
+	assert.Equal(t, 0, statusCode)
+
+	// Run a scan limited with a glob matching the secret file (should have findings)
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", []string{"secret-*"})
+	require.NoError(t, err)
+	assert.Equal(t, 1, statusCode)
+
+	// Files passed by pre-commit.com aren't treated as globs
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", GitLiteralPathspecs([]string{"secret-*"}))
+	require.NoError(t, err)
+	assert.Equal(t, 0, statusCode)
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", GitLiteralPathspecs([]string{"some-file", "secret-file"}))
+	require.NoError(t, err)
+	assert.Equal(t, 1, statusCode)
+
+	// Bypass the hook with a reason (should have findings but not block)
+	cfg.Hooks.PreCommit.BypassLogPath = filepath.Join(tempDir, ".git", "bypasses.jsonl")
+	t.Setenv("LEAKTK_ALLOW", "test fixture")
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", []string{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, statusCode)
+
+	// The bypass is recorded without the secret
+	rawBypassLog, err := os.ReadFile(filepath.Join(tempDir, ".git", "bypasses.jsonl"))
+	require.NoError(t, err)
+	var entry bypassLogEntry
+	require.NoError(t, json.Unmarshal(rawBypassLog, &entry))
+	assert.Equal(t, "git.pre-commit", entry.Hook)
+	assert.Equal(t, "test fixture", entry.Reason)
+	require.Len(t, entry.Results, 1)
+	assert.Equal(t, "secret-file", entry.Results[0].Location.Path)
+	assert.Empty(t, entry.Results[0].Secret)
+	assert.NotContains(t, string(rawBypassLog), "secretvalue")
+
+	// Bypassing is disabled without a bypass log
+	cfg.Hooks.PreCommit.BypassLogPath = ""
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", []string{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, statusCode)
+	t.Setenv("LEAKTK_ALLOW", "")
+
+	// Run a scan in warn mode (should have findings but not block)
+	cfg.Hooks.PreCommit.Mode = "warn"
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", []string{})
+	require.NoError(t, err)
+	assert.Equal(t, 0, statusCode)
+
+	// Unknown modes block
+	cfg.Hooks.PreCommit.Mode = "unknown"
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", []string{})
+	require.NoError(t, err)
+	assert.Equal(t, 1, statusCode)
+
+	// Run a scan outside of a git repo (should return the error instead of exiting)
+	require.NoError(t, os.Chdir(t.TempDir()))
+	statusCode, err = gitPreCommitRun(cfg, "git.pre-commit", []string{})
+	require.ErrorContains(t, err, "scan response contains error")
+	assert.Equal(t, config.ExitCodeBlockingError, statusCode)
 }
@@ -118,4 +118,15 @@ func TestGitPreReceive(t *testing.T) {
 	statusCode, err = gitPreReceiveRun(cfg, "git.pre-receive", []string{})
 	require.NoError(t, err)
 	assert.Equal(t, 1, statusCode)
+
+	// Setup an invalid line for pre-receive to handle
+	require.NoError(t, mockStdin.Truncate(0))
+	_, _ = mockStdin.WriteString("not-an-oid refs/heads/main\n")
+	_, err = mockStdin.Seek(0, 0)
+	require.NoError(t, err)
+
+	// Run a scan (should return the error instead of exiting)
+	statusCode, err = gitPreReceiveRun(cfg, "git.pre-receive", []string{})
+	require.ErrorContains(t, err, "expected line to start with")
+	assert.Equal(t, config.ExitCodeBlockingError, statusCode)
 }
@@ -1,26 +1,142 @@
 package http
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
+	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/version"
 )
 
-var once sync.Once
-var client *http.Client
+// ClientOpts configures the clients created by NewClient. Zero values keep
+// the net/http defaults.
+type ClientOpts struct {
+	// Timeout limits the whole request including reading the body
+	Timeout time.Duration
+	// DialTimeout limits how long it can take to connect
+	DialTimeout time.Duration
+	// MaxIdleConns limits the idle connections kept across all hosts
+	MaxIdleConns int
+	// MaxIdleConnsPerHost limits the idle connections kept for each host
+	MaxIdleConnsPerHost int
+	// CACertFiles are PEM encoded CA bundles trusted in addition to the
+	// system cert pool
+	CACertFiles []string
+	// ClientCert and ClientKey are the paths to a client cert to send
+	ClientCert string
+	ClientKey  string
+}
+
+// ClientOptsFromConfig returns the opts from the config's tls and http
+// settings
+func ClientOptsFromConfig(cfg *config.Config) ClientOpts {
+	opts := ClientOpts{
+		Timeout:             time.Duration(cfg.HTTP.Timeout) * time.Second,
+		DialTimeout:         time.Duration(cfg.HTTP.DialTimeout) * time.Second,
+		MaxIdleConns:        cfg.HTTP.MaxIdleConns,
+		MaxIdleConnsPerHost: cfg.HTTP.MaxIdleConnsPerHost,
+	}
+
+	if len(cfg.TLS.CACertFile) > 0 {
+		opts.CACertFiles = []string{cfg.TLS.CACertFile}
+	}
+
+	return opts
+}
+
+// defaultClient is shared by everything that isn't given a client
+var defaultClient = sync.OnceValue(func() *http.Client {
+	return &http.Client{
+		Transport: &customRoundTripper{
+			rt: http.DefaultTransport,
+		},
+	}
+})
+
+// DefaultClient returns a shared http client with preferred configuration
+// and none of the ClientOpts set
+func DefaultClient() *http.Client {
+	return defaultClient()
+}
+
+// NewClient creates an http client with preferred configuration and the opts
+// applied. Clients should be created once and reused so their connections
+// are too.
+func NewClient(opts ClientOpts) (*http.Client, error) {
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if len(opts.ClientCert) > 0 || len(opts.ClientKey) > 0 {
+		cert, err := tls.LoadX509KeyPair(filepath.Clean(opts.ClientCert), filepath.Clean(opts.ClientKey))
+		if err != nil {
+			return nil, fmt.Errorf("could not load client cert: %w cert_path=%q key_path=%q", err, opts.ClientCert, opts.ClientKey)
+		}
+
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
 
-// NewClient creates an http client with preferred configuration
-func NewClient() *http.Client {
-	once.Do(func() {
-		client = &http.Client{
-			Transport: &customRoundTripper{
-				rt: http.DefaultTransport,
-			},
+	if len(opts.CACertFiles) > 0 {
+		tlsConfig.RootCAs = systemCertPool()
+
+		for _, path := range opts.CACertFiles {
+			caCert, err := os.ReadFile(filepath.Clean(path))
+			if err != nil {
+				return nil, fmt.Errorf("could not read ca cert file: %w path=%q", err, path)
+			}
+
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(caCert) {
+				return nil, fmt.Errorf("no certs found in ca cert file: path=%q", path)
+			}
 		}
-	})
+	}
+
+	return &http.Client{
+		Timeout: opts.Timeout,
+		Transport: &customRoundTripper{
+			rt: newTransport(tlsConfig, opts),
+		},
+	}, nil
+}
+
+// newTransport clones the default transport with the provided TLS config and
+// opts applied
+func newTransport(tlsConfig *tls.Config, opts ClientOpts) *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+
+	if opts.DialTimeout > 0 {
+		transport.DialContext = (&net.Dialer{
+			Timeout:   opts.DialTimeout,
+			KeepAlive: 30 * time.Second,
+		}).DialContext
+	}
 
-	return client
+	if opts.MaxIdleConns > 0 {
+		transport.MaxIdleConns = opts.MaxIdleConns
+	}
+
+	if opts.MaxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = opts.MaxIdleConnsPerHost
+	}
+
+	return transport
+}
+
+func systemCertPool() *x509.CertPool {
+	certPool, err := x509.SystemCertPool()
+	if err != nil {
+		return x509.NewCertPool()
+	}
+
+	return certPool
 }
 
 type customRoundTripper struct {
@@ -29,7 +145,12 @@ type customRoundTripper struct {
 
 func (rt *customRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
 	req = req.Clone(req.Context())
-	req.Header.Set("User-Agent", version.GlobalUserAgent)
+
+	// Keep the User-Agent if one was set for the request (e.g. from a scan's
+	// user_agent option)
+	if len(req.Header.Get("User-Agent")) == 0 {
+		req.Header.Set("User-Agent", version.GlobalUserAgent)
+	}
 
 	return rt.rt.RoundTrip(req)
 }
@@ -0,0 +1,173 @@
+package http
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/config"
+)
+
+// writeTestCert generates a self-signed cert and returns the cert and key paths
+func writeTestCert(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	certDER, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certDER}), 0600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600))
+
+	return certPath, keyPath
+}
+
+func TestNewClient(t *testing.T) {
+	tempDir := t.TempDir()
+	clientCertPath, clientKeyPath := writeTestCert(t, tempDir, "client")
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	ts.TLS = &tls.Config{ClientAuth: tls.RequestClientCert, MinVersion: tls.VersionTLS12}
+	ts.StartTLS()
+	defer ts.Close()
+
+	mtlsServer := httptest.NewUnstartedServer(ts.Config.Handler)
+	mtlsServer.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert, MinVersion: tls.VersionTLS12}
+	mtlsServer.StartTLS()
+	defer mtlsServer.Close()
+
+	caCertPath := filepath.Join(tempDir, "ca.crt")
+	caCert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw})
+	require.NoError(t, os.WriteFile(caCertPath, caCert, 0600))
+
+	mtlsCACertPath := filepath.Join(tempDir, "mtls-ca.crt")
+	mtlsCACert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: mtlsServer.Certificate().Raw})
+	require.NoError(t, os.WriteFile(mtlsCACertPath, mtlsCACert, 0600))
+
+	get := func(client *http.Client, url string) error {
+		req, err := http.NewRequestWithContext(t.Context(), "GET", url, nil)
+		require.NoError(t, err)
+		resp, err := client.Do(req)
+		if err == nil {
+			_ = resp.Body.Close()
+		}
+		return err
+	}
+
+	t.Run("UntrustedByDefault", func(t *testing.T) {
+		require.Error(t, get(DefaultClient(), ts.URL))
+
+		client, err := NewClient(ClientOpts{})
+		require.NoError(t, err)
+		require.Error(t, get(client, ts.URL))
+	})
+
+	t.Run("CACertFiles", func(t *testing.T) {
+		client, err := NewClient(ClientOpts{CACertFiles: []string{caCertPath}})
+		require.NoError(t, err)
+		require.NoError(t, get(client, ts.URL))
+		require.Error(t, get(client, mtlsServer.URL))
+	})
+
+	t.Run("ClientCertAndCACerts", func(t *testing.T) {
+		client, err := NewClient(ClientOpts{
+			CACertFiles: []string{caCertPath, mtlsCACertPath},
+			ClientCert:  clientCertPath,
+			ClientKey:   clientKeyPath,
+		})
+		require.NoError(t, err)
+		require.NoError(t, get(client, ts.URL))
+		require.NoError(t, get(client, mtlsServer.URL))
+	})
+
+	t.Run("MissingClientCert", func(t *testing.T) {
+		client, err := NewClient(ClientOpts{CACertFiles: []string{mtlsCACertPath}})
+		require.NoError(t, err)
+		require.Error(t, get(client, mtlsServer.URL))
+	})
+
+	t.Run("InvalidCACert", func(t *testing.T) {
+		_, err := NewClient(ClientOpts{CACertFiles: []string{clientKeyPath}})
+		require.Error(t, err)
+
+		_, err = NewClient(ClientOpts{CACertFiles: []string{filepath.Join(tempDir, "missing.crt")}})
+		require.Error(t, err)
+	})
+
+	t.Run("InvalidClientCert", func(t *testing.T) {
+		_, err := NewClient(ClientOpts{ClientCert: clientCertPath})
+		require.Error(t, err)
+	})
+
+	t.Run("SharedDefaultClient", func(t *testing.T) {
+		assert.Same(t, DefaultClient(), DefaultClient())
+	})
+
+	t.Run("OptsApplied", func(t *testing.T) {
+		client, err := NewClient(ClientOpts{
+			Timeout:             5 * time.Second,
+			DialTimeout:         time.Second,
+			MaxIdleConns:        10,
+			MaxIdleConnsPerHost: 3,
+		})
+		require.NoError(t, err)
+		assert.Equal(t, 5*time.Second, client.Timeout)
+
+		transport := client.Transport.(*customRoundTripper).rt.(*http.Transport)
+		assert.Equal(t, 10, transport.MaxIdleConns)
+		assert.Equal(t, 3, transport.MaxIdleConnsPerHost)
+	})
+
+	t.Run("Timeout", func(t *testing.T) {
+		slowServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(200 * time.Millisecond)
+			w.WriteHeader(http.StatusOK)
+		}))
+		defer slowServer.Close()
+
+		client, err := NewClient(ClientOpts{Timeout: 50 * time.Millisecond})
+		require.NoError(t, err)
+		require.Error(t, get(client, slowServer.URL))
+	})
+}
+
+func TestClientOptsFromConfig(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.HTTP.Timeout = 30
+	cfg.HTTP.MaxIdleConnsPerHost = 4
+	assert.Empty(t, ClientOptsFromConfig(cfg).CACertFiles)
+
+	cfg.TLS.CACertFile = "/etc/leaktk/ca.crt"
+	opts := ClientOptsFromConfig(cfg)
+	assert.Equal(t, 30*time.Second, opts.Timeout)
+	assert.Equal(t, 4, opts.MaxIdleConnsPerHost)
+	assert.Equal(t, []string{"/etc/leaktk/ca.crt"}, opts.CACertFiles)
+}
@@ -44,6 +44,62 @@ type GitHookOpts struct {
 	// cases where you need to manually generate and install the hook
 	// somewhere
 	Stdout bool
+	// PreCommitConfig prints a .pre-commit-config.yaml entry that runs the
+	// hook from pre-commit.com with the installed leaktk command
+	PreCommitConfig bool
+	// Chain keeps an existing hook that wasn't installed by leaktk and runs
+	// it along with leaktk's in this order instead of skipping or replacing it
+	Chain ChainOrder
+}
+
+// ChainOrder says which hook runs first when an existing hook is chained
+type ChainOrder string
+
+const (
+	// ExistingFirstChainOrder runs the existing hook and then leaktk's
+	ExistingFirstChainOrder ChainOrder = "existing-first"
+	// LeaktkFirstChainOrder runs leaktk's hook and then the existing one
+	LeaktkFirstChainOrder ChainOrder = "leaktk-first"
+)
+
+// chainedHookSuffix is added to the name of an existing hook when it's moved
+// aside so leaktk's hook can call it
+const chainedHookSuffix = ".leaktk-chained"
+
+// What happened when installing a hook into a target
+const (
+	InstalledInstallStatus = "installed"
+	SkippedInstallStatus   = "skipped"
+	FailedInstallStatus    = "failed"
+)
+
+// Kinds of places a hook can be installed into
+const (
+	RepoInstallKind              = "repo"
+	UserTemplateDirInstallKind   = "user_template_dir"
+	SystemTemplateDirInstallKind = "system_template_dir"
+)
+
+// InstallTarget is a place the installer tried to install a hook into
+type InstallTarget struct {
+	// Kind is one of the *InstallKind values
+	Kind string `json:"kind"`
+	// Path is the hook's path, or what was being searched for repos if none
+	// were found
+	Path string `json:"path"`
+	// Status is one of the *InstallStatus values
+	Status string `json:"status"`
+	// Reason says why the target was skipped or failed
+	Reason string `json:"reason,omitempty"`
+	// ChainedHook is where the existing hook was moved if it was chained
+	ChainedHook string `json:"chained_hook,omitempty"`
+}
+
+// InstallSummary lists what happened with each target of an install so tools
+// wrapping the installer can check the result
+type InstallSummary struct {
+	Hook    string          `json:"hook"`
+	Targets []InstallTarget `json:"targets"`
 }
 
 // gitPreCommitHookTemplate is the shell script written to .git/hooks/pre-commit.
@@ -63,6 +119,62 @@ else
 fi
 `
 
+// preCommitConfigTemplate is a .pre-commit-config.yaml entry for the hook.
+// pre-commit.com passes the files it's checking as args. Serial runs keep it
+// from splitting them across leaktk processes that would share the workdir.
+const preCommitConfigTemplate = `repos:
+  - repo: local
+    hooks:
+      - id: leaktk.%s
+        name: LeakTK %s
+        entry: leaktk hook %s --files --
+        language: system
+        stages: ['%s']
+        require_serial: true
+`
+
+// gitChainedHookTemplate is written in place of an existing hook when it's
+// chained. It runs the existing hook (moved to ChainedHook) and leaktk's hook
+// in ChainOrder and stops at the first one that fails. Stdin is saved first
+// so both hooks get it (e.g. the refs for pre-receive).
+const gitChainedHookTemplate = `#!/bin/sh
+# TemplateID: 3c0c0c6d-5d06-421c-a1a6-3eeab9d07f2c
+# CreatedBy: %s
+# CreatedOn: %s
+# ChainedHook: %s
+# ChainOrder: %s
+chained_hook="$(dirname "$0")/%s"
+stdin_file="$(mktemp)" || exit 1
+trap 'rm -f "${stdin_file}"' EXIT
+if [ ! -t 0 ]
+then
+    cat > "${stdin_file}"
+fi
+
+run_existing() {
+    "${chained_hook}" "$@" < "${stdin_file}"
+}
+
+run_leaktk() {
+    if command -v leaktk > /dev/null 2>&1
+    then
+        leaktk hook %s < "${stdin_file}"
+    else
+        echo 'leaktk command not found' >&2
+        echo 'See: %s' >&2
+        return 1
+    fi
+}
+
+run_%s "$@" && run_%s "$@"
+`
+
+// The TemplateID lines that mark a hook as one leaktk installed
+const (
+	gitPreCommitHookMarker = "# TemplateID: f2998aee-4684-4c46-b724-7c8e37e6020c\n"
+	gitChainedHookMarker   = "# TemplateID: 3c0c0c6d-5d06-421c-a1a6-3eeab9d07f2c\n"
+)
+
 // findGitDirs returns the absolute git directory path for every git repository
 // found at or under the root path
 func findGitDirs(ctx context.Context, root string) ([]string, error) {
@@ -132,46 +244,180 @@ func gitHookScript(hook hooks.Hook) string {
 	)
 }
 
-// gitHookInstall installs a git hook script into installDir (the .git directory).
-func gitHookInstall(hook hooks.Hook, installDir string, force bool, perm os.FileMode) error {
+// gitChainedHookScript returns the script that runs leaktk's hook along with
+// the existing hook at chainedHookName
+func gitChainedHookScript(hook hooks.Hook, chainedHookName string, order ChainOrder) string {
+	createdBy := "leaktk-" + version.Version
+	createdOn := time.Now().UTC().Format(time.RFC3339)
+	first, second := "existing", "leaktk"
+	if order == LeaktkFirstChainOrder {
+		first, second = second, first
+	}
+
+	return fmt.Sprintf(
+		gitChainedHookTemplate,
+		createdBy,
+		createdOn,
+		chainedHookName,
+		order,
+		chainedHookName,
+		hook.Name(),
+		docs.DocURL(docs.CommandNotFoundTopic),
+		first,
+		second,
+	)
+}
+
+// gitHookMarker returns the leaktk TemplateID line in the hook at path or an
+// empty string if it's missing (i.e. the hook wasn't installed by leaktk)
+func gitHookMarker(path string) string {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err != nil {
+		return ""
+	}
+
+	for _, marker := range []string{gitPreCommitHookMarker, gitChainedHookMarker} {
+		if strings.Contains(string(content), marker) {
+			return marker
+		}
+	}
+
+	return ""
+}
+
+// gitHookChainOrder returns the order of an existing chained hook so it's kept
+// when the hook is reinstalled
+func gitHookChainOrder(path string) ChainOrder {
+	content, err := os.ReadFile(filepath.Clean(path))
+	if err == nil && strings.Contains(string(content), "\n# ChainOrder: "+string(LeaktkFirstChainOrder)+"\n") {
+		return LeaktkFirstChainOrder
+	}
+
+	return ExistingFirstChainOrder
+}
+
+// gitHookInstall installs a git hook script into installDir (the .git
+// directory) and returns whether it was installed or skipped. When opts.Chain
+// is set an existing hook that leaktk didn't install is moved aside and run by
+// leaktk's hook instead of being replaced.
+func gitHookInstall(opts GitHookOpts, installDir string, perm os.FileMode) (InstallTarget, error) {
+	hook := opts.Hook
 	hooksDir := filepath.Join(installDir, "hooks")
 	hookPath := filepath.Join(hooksDir, hook.Event())
+	chainedHookName := hook.Event() + chainedHookSuffix
+	chainedHookPath := filepath.Join(hooksDir, chainedHookName)
+	target := InstallTarget{Path: hookPath}
+	script := gitHookScript(hook)
 
-	if gitHookExists(hookPath) && !force {
-		logger.Info("skipping existing hook: force install not enabled: path=%q force_install=%v", hookPath, force)
-		return nil
+	if gitHookExists(hookPath) {
+		switch marker := gitHookMarker(hookPath); {
+		case marker == gitChainedHookMarker && opts.Force:
+			// Rewrite the chain rather than dropping the hook it calls
+			order := opts.Chain
+			if len(order) == 0 {
+				order = gitHookChainOrder(hookPath)
+			}
+			script = gitChainedHookScript(hook, chainedHookName, order)
+			target.ChainedHook = chainedHookPath
+		case len(marker) > 0 && len(opts.Chain) > 0 && !opts.Force:
+			logger.Info("skipping existing hook: already installed by leaktk: path=%q", hookPath)
+			target.Status = SkippedInstallStatus
+			target.Reason = "leaktk hook is already installed"
+			return target, nil
+		case len(marker) == 0 && len(opts.Chain) > 0:
+			if fs.PathExists(chainedHookPath) {
+				return target, fmt.Errorf("chained hook already exists: path=%q", chainedHookPath)
+			}
+			if err := os.Rename(hookPath, chainedHookPath); err != nil {
+				return target, fmt.Errorf("could not move existing hook: %w path=%q", err, hookPath)
+			}
+			logger.Info("chaining existing hook: chain_order=%q path=%q", opts.Chain, chainedHookPath)
+			script = gitChainedHookScript(hook, chainedHookName, opts.Chain)
+			target.ChainedHook = chainedHookPath
+		case !opts.Force:
+			logger.Info("skipping existing hook: force install not enabled: path=%q force_install=%v", hookPath, opts.Force)
+			target.Status = SkippedInstallStatus
+			target.Reason = "hook already exists and force is not enabled"
+			return target, nil
+		}
 	}
 
 	if err := os.MkdirAll(hooksDir, perm); err != nil {
-		return fmt.Errorf("could not create hooks dir: %w path=%q", err, hooksDir)
+		return target, fmt.Errorf("could not create hooks dir: %w path=%q", err, hooksDir)
 	}
 
-	if err := os.WriteFile(hookPath, []byte(gitHookScript(hook)), perm); err != nil {
-		return fmt.Errorf("could not write hook: %w path=%q", err, hookPath)
+	if err := os.WriteFile(hookPath, []byte(script), perm); err != nil {
+		if len(target.ChainedHook) > 0 && !fs.PathExists(hookPath) {
+			// Put the existing hook back so it isn't lost
+			if err := os.Rename(chainedHookPath, hookPath); err != nil {
+				logger.Error("could not restore existing hook: %v path=%q", err, chainedHookPath)
+			}
+		}
+		return target, fmt.Errorf("could not write hook: %w path=%q", err, hookPath)
 	}
 	logger.Info("installed hook: hook=%q path=%q", hook.Name(), hookPath)
-	return nil
+	target.Status = InstalledInstallStatus
+	return target, nil
+}
+
+// add installs the hook into installDir and adds the outcome to the summary
+func (s *InstallSummary) add(opts GitHookOpts, kind, installDir string, perm os.FileMode) {
+	target, err := gitHookInstall(opts, installDir, perm)
+	target.Kind = kind
+	if err != nil {
+		logger.Info("could not install hook: %v hookname=%q kind=%q path=%q", err, opts.Hook.Name(), kind, installDir)
+		target.Status = FailedInstallStatus
+		target.Reason = err.Error()
+	}
+
+	s.Targets = append(s.Targets, target)
+}
+
+// fail adds a target the hook couldn't be installed in to the summary
+func (s *InstallSummary) fail(kind, path string, err error) {
+	s.Targets = append(s.Targets, InstallTarget{
+		Kind:   kind,
+		Path:   path,
+		Status: FailedInstallStatus,
+		Reason: err.Error(),
+	})
+}
+
+// Count returns how many of the targets have the status
+func (s *InstallSummary) Count(status string) int {
+	var count int
+	for _, target := range s.Targets {
+		if target.Status == status {
+			count++
+		}
+	}
+
+	return count
 }
 
 // GitHookInstall installs git hooks according to opts.
 // It installs in all git repos found under opts.Path, and optionally in the
-// user's git init.templateDir and/or the system git template directory.
-func GitHookInstall(ctx context.Context, cfg *config.Config, opts GitHookOpts) error {
+// user's git init.templateDir and/or the system git template directory. The
+// summary lists what happened with each place it tried to install the hook,
+// and an error is returned if any of them failed.
+func GitHookInstall(ctx context.Context, cfg *config.Config, opts GitHookOpts) (*InstallSummary, error) {
 	var err error
 	var gitDirs []string
 
 	hookname := opts.Hook.Name()
-	hadErrors := false
+	summary := &InstallSummary{Hook: hookname, Targets: []InstallTarget{}}
 
 	if opts.Path != "" {
 		if !fs.PathExists(opts.Path) {
-			return fmt.Errorf("path does not exist: path=%q", opts.Path)
+			summary.fail(RepoInstallKind, opts.Path, errors.New("path does not exist"))
+			return summary, fmt.Errorf("path does not exist: path=%q", opts.Path)
 		}
 
 		if !opts.Recursive {
 			repoInfo, err := git.GetRepoInfo(ctx, opts.Path)
 			if err != nil {
-				return fmt.Errorf("could not find git repo: %w hookname=%q path=%q", err, hookname, opts.Path)
+				summary.fail(RepoInstallKind, opts.Path, err)
+				return summary, fmt.Errorf("could not find git repo: %w hookname=%q path=%q", err, hookname, opts.Path)
 			}
 			if len(repoInfo.GitDir) > 0 {
 				gitDirs = append(gitDirs, repoInfo.GitDir)
@@ -179,19 +425,23 @@ func GitHookInstall(ctx context.Context, cfg *config.Config, opts GitHookOpts) e
 		} else {
 			gitDirs, err = findGitDirs(ctx, opts.Path)
 			if err != nil {
-				return fmt.Errorf("could not find git repos: %w hookname=%q path=%q", err, hookname, opts.Path)
+				summary.fail(RepoInstallKind, opts.Path, err)
+				return summary, fmt.Errorf("could not find git repos: %w hookname=%q path=%q", err, hookname, opts.Path)
 			}
 		}
 
 		if len(gitDirs) == 0 {
 			logger.Warning("no git repositories found: hookname=%q path=%q", hookname, opts.Path)
+			summary.Targets = append(summary.Targets, InstallTarget{
+				Kind:   RepoInstallKind,
+				Path:   opts.Path,
+				Status: SkippedInstallStatus,
+				Reason: "no git repositories found",
+			})
 		}
 
 		for _, gitDir := range gitDirs {
-			if err := gitHookInstall(opts.Hook, gitDir, opts.Force, 0750); err != nil {
-				logger.Info("could not install hook: %v hookname=%q path=%q", err, hookname, gitDir)
-				hadErrors = true
-			}
+			summary.add(opts, RepoInstallKind, gitDir, 0750)
 		}
 	}
 
@@ -199,34 +449,26 @@ func GitHookInstall(ctx context.Context, cfg *config.Config, opts GitHookOpts) e
 		userGitTemplateDir, err := gitUserTemplateDir(ctx)
 		if err != nil {
 			logger.Error("could not resolve user template dir: %v hookname=%s", err, hookname)
-			hadErrors = true
+			summary.fail(UserTemplateDirInstallKind, "", err)
 		} else {
-			if err := gitHookInstall(opts.Hook, userGitTemplateDir, opts.Force, 0750); err != nil {
-				logger.Info(
-					"could not install hook in user git template dir: %v hookname=%q path=%q",
-					err, hookname, userGitTemplateDir,
-				)
-				hadErrors = true
-			}
+			summary.add(opts, UserTemplateDirInstallKind, userGitTemplateDir, 0750)
 		}
 	}
 
 	if opts.SystemTemplateDir {
-		if err := gitHookInstall(opts.Hook, systemGitTemplateDir, opts.Force, 0755); err != nil {
-			logger.Info(
-				"could not install hook in system git template dir: %v hookname=%q path=%q",
-				err, hookname, systemGitTemplateDir,
-			)
-			hadErrors = true
-		}
+		summary.add(opts, SystemTemplateDirInstallKind, systemGitTemplateDir, 0755)
 	}
 
 	if opts.Stdout {
 		fmt.Print(gitHookScript(opts.Hook))
 	}
 
-	if hadErrors {
-		return errors.New("errors detected during install")
+	if opts.PreCommitConfig {
+		fmt.Printf(preCommitConfigTemplate, hookname, hookname, hookname, opts.Hook.Event())
+	}
+
+	if summary.Count(FailedInstallStatus) > 0 {
+		return summary, errors.New("errors detected during install")
 	}
-	return nil
+	return summary, nil
 }
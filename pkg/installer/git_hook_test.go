@@ -2,6 +2,7 @@ package installer
 
 import (
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -44,7 +45,9 @@ func TestGitInstallHook(t *testing.T) {
 
 		// Test installing a hook
 		hook := hooks.GitPreCommitHook
-		require.NoError(t, gitHookInstall(hook, tempDir, false, 0750))
+		target, err := gitHookInstall(GitHookOpts{Hook: hook}, tempDir, 0750)
+		require.NoError(t, err)
+		assert.Equal(t, InstalledInstallStatus, target.Status)
 
 		// Verify the hook was created
 		hookPath := filepath.Join(tempDir, "hooks", "pre-commit")
@@ -119,7 +122,7 @@ func TestGitInstallHook(t *testing.T) {
 		setupGitRepo(t, tempDir, false)
 
 		cfg := &config.Config{}
-		err := GitHookInstall(t.Context(), cfg, GitHookOpts{
+		summary, err := GitHookInstall(t.Context(), cfg, GitHookOpts{
 			Hook:  hooks.GitPreCommitHook,
 			Path:  tempDir,
 			Force: false,
@@ -127,6 +130,14 @@ func TestGitInstallHook(t *testing.T) {
 		require.NoError(t, err)
 		hookPath := filepath.Join(tempDir, ".git", "hooks", "pre-commit")
 		assert.True(t, gitHookExists(hookPath))
+		assert.Equal(t, &InstallSummary{
+			Hook: "git.pre-commit",
+			Targets: []InstallTarget{{
+				Kind:   RepoInstallKind,
+				Path:   filepath.Join(cleanPath(t, tempDir), ".git", "hooks", "pre-commit"),
+				Status: InstalledInstallStatus,
+			}},
+		}, summary)
 	})
 
 	t.Run("installs in all repos under path when recursive is set", func(t *testing.T) {
@@ -138,13 +149,14 @@ func TestGitInstallHook(t *testing.T) {
 		setupGitRepo(t, repo2Dir, false)
 
 		cfg := &config.Config{}
-		err := GitHookInstall(t.Context(), cfg, GitHookOpts{
+		summary, err := GitHookInstall(t.Context(), cfg, GitHookOpts{
 			Hook:      hooks.GitPreCommitHook,
 			Force:     true,
 			Path:      tempDir,
 			Recursive: true,
 		})
 		require.NoError(t, err)
+		assert.Equal(t, 2, summary.Count(InstalledInstallStatus))
 		hook1 := filepath.Join(repo1Dir, ".git", "hooks", "pre-commit")
 		hook2 := filepath.Join(repo2Dir, ".git", "hooks", "pre-commit")
 		assert.True(t, gitHookExists(hook1))
@@ -159,13 +171,18 @@ func TestGitInstallHook(t *testing.T) {
 		opts := GitHookOpts{Hook: hooks.GitPreCommitHook, Path: tempDir, Force: false}
 
 		// First install should add the hook
-		require.NoError(t, GitHookInstall(t.Context(), cfg, opts))
+		_, err := GitHookInstall(t.Context(), cfg, opts)
+		require.NoError(t, err)
 		info, err := os.Stat(filepath.Join(tempDir, ".git", "hooks", "pre-commit"))
 		require.NoError(t, err)
 		originalMtime := info.ModTime()
 
 		// Second install should not update the hook because force is not enabled
-		require.NoError(t, GitHookInstall(t.Context(), cfg, opts))
+		summary, err := GitHookInstall(t.Context(), cfg, opts)
+		require.NoError(t, err)
+		require.Len(t, summary.Targets, 1)
+		assert.Equal(t, SkippedInstallStatus, summary.Targets[0].Status)
+		assert.Equal(t, "hook already exists and force is not enabled", summary.Targets[0].Reason)
 		info2, err := os.Stat(filepath.Join(tempDir, ".git", "hooks", "pre-commit"))
 		require.NoError(t, err)
 		assert.Equal(t, originalMtime, info2.ModTime(), "file should not have been overwritten")
@@ -177,12 +194,14 @@ func TestGitInstallHook(t *testing.T) {
 
 		cfg := &config.Config{}
 		opts := GitHookOpts{Hook: hooks.GitPreCommitHook, Path: tempDir, Force: true}
-		require.NoError(t, GitHookInstall(t.Context(), cfg, opts))
+		_, err := GitHookInstall(t.Context(), cfg, opts)
+		require.NoError(t, err)
 		info, err := os.Stat(filepath.Join(tempDir, ".git", "hooks", "pre-commit"))
 		require.NoError(t, err)
 		originalMtime := info.ModTime()
 		time.Sleep(10 * time.Millisecond)
-		require.NoError(t, GitHookInstall(t.Context(), cfg, opts))
+		_, err = GitHookInstall(t.Context(), cfg, opts)
+		require.NoError(t, err)
 		info2, err := os.Stat(filepath.Join(tempDir, ".git", "hooks", "pre-commit"))
 		require.NoError(t, err)
 		assert.NotEqual(t, originalMtime, info2.ModTime(), "file should have been overwritten")
@@ -190,10 +209,137 @@ func TestGitInstallHook(t *testing.T) {
 
 	t.Run("returns error for nonexistent path", func(t *testing.T) {
 		cfg := &config.Config{}
-		err := GitHookInstall(t.Context(), cfg, GitHookOpts{
+		path := filepath.Join(t.TempDir(), "nonexistent")
+		summary, err := GitHookInstall(t.Context(), cfg, GitHookOpts{
 			Hook: hooks.GitPreCommitHook,
-			Path: filepath.Join(t.TempDir(), "nonexistent"),
+			Path: path,
 		})
 		require.Error(t, err)
+		assert.Equal(t, []InstallTarget{{
+			Kind:   RepoInstallKind,
+			Path:   path,
+			Status: FailedInstallStatus,
+			Reason: "path does not exist",
+		}}, summary.Targets)
+	})
+
+	t.Run("reports paths without repos as skipped", func(t *testing.T) {
+		tempDir := t.TempDir()
+
+		summary, err := GitHookInstall(t.Context(), &config.Config{}, GitHookOpts{
+			Hook:      hooks.GitPreCommitHook,
+			Path:      tempDir,
+			Recursive: true,
+		})
+		require.NoError(t, err)
+		require.Len(t, summary.Targets, 1)
+		assert.Equal(t, SkippedInstallStatus, summary.Targets[0].Status)
+		assert.Equal(t, "no git repositories found", summary.Targets[0].Reason)
+	})
+
+	t.Run("reports failed installs", func(t *testing.T) {
+		tempDir := t.TempDir()
+		setupGitRepo(t, tempDir, false)
+
+		// A file where the hooks dir should be keeps it from being created
+		hooksDir := filepath.Join(tempDir, ".git", "hooks")
+		require.NoError(t, os.RemoveAll(hooksDir))
+		require.NoError(t, os.WriteFile(hooksDir, []byte{}, 0600))
+
+		summary, err := GitHookInstall(t.Context(), &config.Config{}, GitHookOpts{
+			Hook: hooks.GitPreCommitHook,
+			Path: tempDir,
+		})
+		require.Error(t, err)
+		require.Len(t, summary.Targets, 1)
+		assert.Equal(t, FailedInstallStatus, summary.Targets[0].Status)
+		assert.Contains(t, summary.Targets[0].Reason, "could not create hooks dir")
+		assert.Equal(t, 1, summary.Count(FailedInstallStatus))
+	})
+
+	t.Run("chains existing hooks", func(t *testing.T) {
+		tempDir := t.TempDir()
+		setupGitRepo(t, tempDir, false)
+
+		// Stand-ins for leaktk and an existing hook that log what they got
+		binDir := t.TempDir()
+		logPath := filepath.Join(t.TempDir(), "hooks.log")
+		t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		t.Setenv("HOOK_LOG", logPath)
+		require.NoError(t, os.WriteFile(filepath.Join(binDir, "leaktk"), []byte("#!/bin/sh\nread line\necho \"leaktk $* $line\" >> \"$HOOK_LOG\"\n"), 0700)) // #nosec G306
+		existingScript := "#!/bin/sh\nread line\necho \"existing $line\" >> \"$HOOK_LOG\"\n"
+		hookPath := filepath.Join(tempDir, ".git", "hooks", "pre-commit")
+		chainedHookPath := hookPath + chainedHookSuffix
+		require.NoError(t, os.MkdirAll(filepath.Dir(hookPath), 0750))
+		require.NoError(t, os.WriteFile(hookPath, []byte(existingScript), 0700)) // #nosec G306
+
+		runHook := func() string {
+			require.NoError(t, os.RemoveAll(logPath))
+			cmd := exec.Command(hookPath) // #nosec G204
+			cmd.Stdin = strings.NewReader("input\n")
+			output, err := cmd.CombinedOutput()
+			require.NoError(t, err, string(output))
+			content, err := os.ReadFile(logPath) // #nosec G304 -- test code reading test file
+			require.NoError(t, err)
+			return string(content)
+		}
+
+		cfg := &config.Config{}
+		opts := GitHookOpts{Hook: hooks.GitPreCommitHook, Path: tempDir, Chain: ExistingFirstChainOrder}
+		summary, err := GitHookInstall(t.Context(), cfg, opts)
+		require.NoError(t, err)
+		require.Len(t, summary.Targets, 1)
+		assert.Equal(t, InstalledInstallStatus, summary.Targets[0].Status)
+		assert.Equal(t, filepath.Join(cleanPath(t, tempDir), ".git", "hooks", "pre-commit"+chainedHookSuffix), summary.Targets[0].ChainedHook)
+		assert.Equal(t, "existing input\nleaktk hook git.pre-commit input\n", runHook())
+
+		// Installing again doesn't chain leaktk's own hook
+		summary, err = GitHookInstall(t.Context(), cfg, opts)
+		require.NoError(t, err)
+		assert.Equal(t, SkippedInstallStatus, summary.Targets[0].Status)
+		assert.Equal(t, "leaktk hook is already installed", summary.Targets[0].Reason)
+
+		// Forcing rewrites the chain with the new order
+		opts.Force = true
+		opts.Chain = LeaktkFirstChainOrder
+		_, err = GitHookInstall(t.Context(), cfg, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "leaktk hook git.pre-commit input\nexisting input\n", runHook())
+
+		// The order is kept when forcing without chain
+		opts.Chain = ""
+		_, err = GitHookInstall(t.Context(), cfg, opts)
+		require.NoError(t, err)
+		assert.Equal(t, "leaktk hook git.pre-commit input\nexisting input\n", runHook())
+
+		content, err := os.ReadFile(chainedHookPath) // #nosec G304 -- test code reading test file
+		require.NoError(t, err)
+		assert.Equal(t, existingScript, string(content))
+	})
+
+	t.Run("stops the chain when a hook fails", func(t *testing.T) {
+		tempDir := t.TempDir()
+		setupGitRepo(t, tempDir, false)
+
+		hookPath := filepath.Join(tempDir, ".git", "hooks", "pre-commit")
+		require.NoError(t, os.MkdirAll(filepath.Dir(hookPath), 0750))
+		require.NoError(t, os.WriteFile(hookPath, []byte("#!/bin/sh\nexit 3\n"), 0700)) // #nosec G306
+
+		binDir := t.TempDir()
+		t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		require.NoError(t, os.WriteFile(filepath.Join(binDir, "leaktk"), []byte("#!/bin/sh\necho leaktk ran\n"), 0700)) // #nosec G306
+
+		_, err := GitHookInstall(t.Context(), &config.Config{}, GitHookOpts{
+			Hook:  hooks.GitPreCommitHook,
+			Path:  tempDir,
+			Chain: ExistingFirstChainOrder,
+		})
+		require.NoError(t, err)
+
+		output, err := exec.Command(hookPath).CombinedOutput() // #nosec G204
+		var exitErr *exec.ExitError
+		require.ErrorAs(t, err, &exitErr)
+		assert.Equal(t, 3, exitErr.ExitCode())
+		assert.NotContains(t, string(output), "leaktk ran")
 	})
 }
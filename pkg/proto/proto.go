@@ -10,6 +10,7 @@ import (
 
 const (
 	ScanResultsResponseKind = "ScanResults"
+	HeartbeatResponseKind   = "Heartbeat"
 )
 
 // RequestKind provides an enum for setting Kind on request
@@ -22,6 +23,8 @@ const (
 	JSONDataRequestKind
 	TextRequestKind
 	URLRequestKind
+	INIDataRequestKind
+	XMLDataRequestKind
 )
 
 var requestKindNames = []string{
@@ -31,6 +34,8 @@ var requestKindNames = []string{
 	"JSONData",
 	"Text",
 	"URL",
+	"INIData",
+	"XMLData",
 }
 
 func (k RequestKind) String() string {
@@ -48,6 +53,8 @@ var requestKindNameMap = map[string]RequestKind{
 	"JSONData":       JSONDataRequestKind,
 	"Text":           TextRequestKind,
 	"URL":            URLRequestKind,
+	"INIData":        INIDataRequestKind,
+	"XMLData":        XMLDataRequestKind,
 }
 
 // GetRequestKind converts a string to RequestKind enum
@@ -110,27 +117,77 @@ func (e *Error) Error() string {
 
 // Response from the scanner with the scan result
 type Response struct {
-	ID        string    `json:"id"              toml:"id"              yaml:"id"`
-	Kind      string    `json:"kind"            toml:"kind"            yaml:"kind"`
-	RequestID string    `json:"request_id"      toml:"request_id"      yaml:"request_id"`
-	Results   []*Result `json:"results"         toml:"results"         yaml:"results"`
-	Error     *Error    `json:"error,omitempty" toml:"error,omitempty" yaml:"error,omitempty"`
-	Resource  string    `json:"-"               toml:"-"               yaml:"-"`
+	ID        string            `json:"id"              toml:"id"              yaml:"id"`
+	Kind      string            `json:"kind"            toml:"kind"            yaml:"kind"`
+	RequestID string            `json:"request_id"      toml:"request_id"      yaml:"request_id"`
+	Results   []*Result         `json:"results"         toml:"results"         yaml:"results"`
+	Notes     map[string]string `json:"notes,omitempty" toml:"notes,omitempty" yaml:"notes,omitempty"`
+	Error     *Error            `json:"error,omitempty" toml:"error,omitempty" yaml:"error,omitempty"`
+	Resource  string            `json:"-"               toml:"-"               yaml:"-"`
+	// Allowlisted has the results an allowlist suppressed when the request
+	// sets report_allowlisted
+	Allowlisted []*Result `json:"allowlisted,omitempty" toml:"allowlisted,omitempty" yaml:"allowlisted,omitempty"`
+	// Metadata is the request's metadata option passed through as is
+	Metadata map[string]string `json:"metadata,omitempty" toml:"metadata,omitempty" yaml:"metadata,omitempty"`
+	// RequestSeq is the line number of the request in listen's input when
+	// listen is run with --seq
+	RequestSeq uint64 `json:"request_seq,omitempty" toml:"request_seq,omitempty" yaml:"request_seq,omitempty"`
 }
 
 // Opts for the different scan types; not all apply to each scan type
 type Opts struct {
-	Arch       string   `json:"arch"`
-	Branch     string   `json:"branch"`
-	Depth      int      `json:"depth"`
-	Exclusions []string `json:"exclusions"`
-	FetchURLs  string   `json:"fetch_urls"`
-	Local      bool     `json:"local"`
-	Priority   int      `json:"priority"`
-	Proxy      string   `json:"proxy"`
-	Since      string   `json:"since"`
-	Staged     bool     `json:"staged"`
-	Unstaged   bool     `json:"unstaged"`
+	AllowedSecrets       []string           `json:"allowed_secrets"`
+	Arch                 string             `json:"arch"`
+	ArchiveFetch         bool               `json:"archive_fetch"`
+	Baseline             json.RawMessage    `json:"baseline"`
+	BlameContact         bool               `json:"blame_contact"`
+	Branch               string             `json:"branch"`
+	Depth                int                `json:"depth"`
+	DiffRefs             *GitDiffRefs       `json:"diff_refs"`
+	Exclusions           []string           `json:"exclusions"`
+	FetchLFS             bool               `json:"fetch_lfs"`
+	FetchURLs            string             `json:"fetch_urls"`
+	FollowSymlinks       bool               `json:"follow_symlinks"`
+	Incremental          bool               `json:"incremental"`
+	LayerRange           string             `json:"layer_range"`
+	Local                bool               `json:"local"`
+	MaxArchiveDepth      int                `json:"max_archive_depth"`
+	Metadata             map[string]string  `json:"metadata"`
+	NoDecode             bool               `json:"no_decode"`
+	Pathspecs            []string           `json:"pathspecs"`
+	Priority             int                `json:"priority"`
+	ProfileRules         int                `json:"profile_rules"`
+	Proxy                string             `json:"proxy"`
+	Ref                  string             `json:"ref"`
+	ReportAllowlisted    bool               `json:"report_allowlisted"`
+	Resources            []string           `json:"resources"`
+	Resume               bool               `json:"resume"`
+	RuleEntropyOverrides map[string]float64 `json:"rule_entropy_overrides"`
+	Since                string             `json:"since"`
+	SkipBinary           bool               `json:"skip_binary"`
+	Sort                 bool               `json:"sort"`
+	Staged               bool               `json:"staged"`
+	StopOnFirst          bool               `json:"stop_on_first"`
+	Submodules           bool               `json:"submodules"`
+	Unstaged             bool               `json:"unstaged"`
+	UserAgent            string             `json:"user_agent"`
+}
+
+// GitDiffRefs limits a git scan to the commits in Head that aren't in Base
+// (i.e. git log Base..Head)
+type GitDiffRefs struct {
+	Base string `json:"base"`
+	Head string `json:"head"`
+}
+
+// GitRef returns the branch, tag or commit to scan. Branch is an alias for
+// Ref that's only used when Ref isn't set.
+func (o Opts) GitRef() string {
+	if len(o.Ref) > 0 {
+		return o.Ref
+	}
+
+	return o.Branch
 }
 
 // In the future we might have things like GitCommitMessage
@@ -144,17 +201,21 @@ const (
 
 // Result of a scan
 type Result struct {
-	ID       string            `json:"id"       toml:"id"       yaml:"id"`
-	Kind     string            `json:"kind"     toml:"kind"     yaml:"kind"`
-	Secret   string            `json:"secret"   toml:"secret"   yaml:"secret"` // #nosec G117
-	Match    string            `json:"match"    toml:"match"    yaml:"match"`
-	Context  string            `json:"context"  toml:"context"  yaml:"context"`
-	Entropy  float32           `json:"entropy"  toml:"entropy"  yaml:"entropy"`
-	Date     string            `json:"date"     toml:"date"     yaml:"date"`
-	Rule     Rule              `json:"rule"     toml:"rule"     yaml:"rule"`
-	Contact  Contact           `json:"contact"  toml:"contact"  yaml:"contact"`
-	Location Location          `json:"location" toml:"location" yaml:"location"`
-	Notes    map[string]string `json:"notes"    toml:"notes"    yaml:"notes"`
+	ID        string            `json:"id"        toml:"id"        yaml:"id"`
+	Kind      string            `json:"kind"      toml:"kind"      yaml:"kind"`
+	Secret    string            `json:"secret"    toml:"secret"    yaml:"secret"` // #nosec G117
+	Match     string            `json:"match"     toml:"match"     yaml:"match"`
+	Context   string            `json:"context"   toml:"context"   yaml:"context"`
+	Entropy   float32           `json:"entropy"   toml:"entropy"   yaml:"entropy"`
+	Date      string            `json:"date"      toml:"date"      yaml:"date"`
+	Encodings []string          `json:"encodings" toml:"encodings" yaml:"encodings"`
+	Rule      Rule              `json:"rule"      toml:"rule"      yaml:"rule"`
+	Contact   Contact           `json:"contact"   toml:"contact"   yaml:"contact"`
+	Location  Location          `json:"location"  toml:"location"  yaml:"location"`
+	Notes     map[string]string `json:"notes"     toml:"notes"     yaml:"notes"`
+	// ParentID is the ID of the result for the encoded text this result's
+	// secret was decoded from, if there was one
+	ParentID string `json:"parent_id,omitempty" toml:"parent_id,omitempty" yaml:"parent_id,omitempty"`
 }
 
 // Rule that triggered the result
@@ -162,6 +223,9 @@ type Rule struct {
 	ID          string   `json:"id" toml:"id" yaml:"id"`
 	Description string   `json:"description" toml:"description" yaml:"description"`
 	Tags        []string `json:"tags" toml:"tags" yaml:"tags"`
+	// Remediation says how to fix or rotate the secret when the config has
+	// guidance for the rule
+	Remediation string `json:"remediation,omitempty" toml:"remediation,omitempty" yaml:"remediation,omitempty"`
 }
 
 // Contact for some resource when available
@@ -47,3 +47,11 @@ func TestGitRepoRequest(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+func TestOptsGitRef(t *testing.T) {
+	assert.Empty(t, Opts{}.GitRef())
+	assert.Equal(t, "main", Opts{Branch: "main"}.GitRef())
+	assert.Equal(t, "v1.2.3", Opts{Ref: "v1.2.3"}.GitRef())
+	// Ref takes precedence over its Branch alias
+	assert.Equal(t, "v1.2.3", Opts{Branch: "main", Ref: "v1.2.3"}.GitRef())
+}
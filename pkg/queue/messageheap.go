@@ -1,14 +1,20 @@
 package queue
 
+import "time"
+
 // Message encapsulates a value with its priority
 type Message[T any] struct {
 	Priority int
 	Value    T
+	// sentAt is when the message was put on the queue and is used for aging
+	sentAt time.Time
 }
 
 // MessageHeap implements the container/heap interface to hold messages
 type MessageHeap[T any] struct {
 	data []*Message[T]
+	// agingRate is how much priority a message gains per minute it waits
+	agingRate float64
 }
 
 // NewMessageHeap returns an initialized MessageHeap of the specified capacity
@@ -25,7 +31,17 @@ func (h *MessageHeap[T]) Len() int {
 
 // Less returns which item in the heap is smaller than the other
 func (h *MessageHeap[T]) Less(i, j int) bool {
-	return h.data[i].Priority > h.data[j].Priority
+	if h.agingRate == 0 {
+		return h.data[i].Priority > h.data[j].Priority
+	}
+
+	// Every message ages at the same rate so comparing priority plus the
+	// rate times how long it's waited comes down to the difference in when
+	// they were sent. That keeps the order stable while they wait.
+	priorityDiff := float64(h.data[i].Priority - h.data[j].Priority)
+	agingDiff := h.agingRate * h.data[i].sentAt.Sub(h.data[j].sentAt).Minutes()
+
+	return priorityDiff > agingDiff
 }
 
 // Swap two items in the heap
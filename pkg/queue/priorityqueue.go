@@ -3,6 +3,7 @@ package queue
 import (
 	"container/heap"
 	"sync"
+	"time"
 )
 
 // PriorityQueue is like a channel but with dynamic buffering and returns items
@@ -72,11 +73,23 @@ func (pq *PriorityQueue[T]) Send(msg *Message[T]) {
 	}
 
 	pq.heapMutex.Lock()
+	msg.sentAt = time.Now()
 	heap.Push(pq.heap, msg)
 	pq.heapMutex.Unlock()
 	pq.signalMessageRecieved()
 }
 
+// SetAgingRate makes messages gain this much priority per minute they wait so
+// low priority messages can't be starved by a steady stream of higher
+// priority ones. The default of 0 keeps the order strictly by priority.
+func (pq *PriorityQueue[T]) SetAgingRate(rate float64) {
+	pq.heapMutex.Lock()
+	pq.heap.agingRate = rate
+	// The order may have changed for messages already on the heap
+	heap.Init(pq.heap)
+	pq.heapMutex.Unlock()
+}
+
 // Recv takes a function that can receive messages sent to the queue
 func (pq *PriorityQueue[T]) Recv(fn func(*Message[T])) {
 	for msg := range pq.out {
@@ -1,6 +1,7 @@
 package queue
 
 import (
+	"container/heap"
 	"sync"
 	"testing"
 	"time"
@@ -93,3 +94,43 @@ func TestPriorityQueueMaxSize(t *testing.T) {
 		assert.Equal(t, expected, actual)
 	})
 }
+
+func TestPriorityQueueAging(t *testing.T) {
+	now := time.Now()
+	newHeap := func(agingRate float64) *MessageHeap[string] {
+		h := NewMessageHeap[string](2)
+		h.agingRate = agingRate
+		// An old low priority message and a fresh high priority one
+		h.Push(&Message[string]{Priority: 0, Value: "old", sentAt: now.Add(-10 * time.Minute)})
+		h.Push(&Message[string]{Priority: 5, Value: "fresh", sentAt: now})
+		heap.Init(h)
+
+		return h
+	}
+
+	t.Run("StrictPriorityByDefault", func(t *testing.T) {
+		h := newHeap(0)
+		assert.Equal(t, "fresh", heap.Pop(h).(*Message[string]).Value)
+	})
+
+	t.Run("OldMessageDequeuesFirst", func(t *testing.T) {
+		// 10 minutes at 1 per minute puts old at 10 vs fresh at 5
+		h := newHeap(1)
+		assert.Equal(t, "old", heap.Pop(h).(*Message[string]).Value)
+	})
+
+	t.Run("NotOldEnoughYet", func(t *testing.T) {
+		// 10 minutes at 0.1 per minute puts old at 1 vs fresh at 5
+		h := newHeap(0.1)
+		assert.Equal(t, "fresh", heap.Pop(h).(*Message[string]).Value)
+	})
+
+	t.Run("SetAgingRate", func(t *testing.T) {
+		pq := NewPriorityQueue[string](2, 0)
+		pq.SetAgingRate(1)
+
+		pq.heapMutex.Lock()
+		assert.InDelta(t, 1, pq.heap.agingRate, 0)
+		pq.heapMutex.Unlock()
+	})
+}
@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// sha256SecretPrefix marks an allowed secret as the hex SHA-256 of the secret
+// so lists of known fake secrets don't have to contain the secrets themselves
+const sha256SecretPrefix = "sha256:"
+
+// allowedSecrets is a set of secret values that shouldn't be reported
+type allowedSecrets map[string]struct{}
+
+func newAllowedSecrets(lists ...[]string) allowedSecrets {
+	allowed := make(allowedSecrets)
+
+	for _, list := range lists {
+		for _, secret := range list {
+			if hash, ok := strings.CutPrefix(secret, sha256SecretPrefix); ok {
+				secret = sha256SecretPrefix + strings.ToLower(strings.TrimSpace(hash))
+			}
+
+			allowed[secret] = struct{}{}
+		}
+	}
+
+	return allowed
+}
+
+// Allows checks if the secret or its hash is in the set
+func (a allowedSecrets) Allows(secret string) bool {
+	if len(a) == 0 {
+		return false
+	}
+
+	if _, ok := a[secret]; ok {
+		return true
+	}
+
+	hash := sha256.Sum256([]byte(secret))
+	_, ok := a[sha256SecretPrefix+hex.EncodeToString(hash[:])]
+
+	return ok
+}
+
+// Filter removes the results with allowed secrets and returns the remaining
+// results and how many were removed. Parent IDs pointing at removed results
+// are cleared.
+func (a allowedSecrets) Filter(results []*proto.Result) ([]*proto.Result, int) {
+	if len(a) == 0 {
+		return results, 0
+	}
+
+	kept := make([]*proto.Result, 0, len(results))
+	keptIDs := make(map[string]struct{}, len(results))
+
+	for _, result := range results {
+		if !a.Allows(result.Secret) {
+			kept = append(kept, result)
+			keptIDs[result.ID] = struct{}{}
+		}
+	}
+
+	for _, result := range kept {
+		if _, ok := keptIDs[result.ParentID]; !ok {
+			result.ParentID = ""
+		}
+	}
+
+	return kept, len(results) - len(kept)
+}
@@ -0,0 +1,45 @@
+package scanner
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestAllowedSecrets(t *testing.T) {
+	hash := sha256.Sum256([]byte("fakesecret2"))
+	fakeSecret2Hash := hex.EncodeToString(hash[:])
+	allowed := newAllowedSecrets([]string{"fakesecret1"}, []string{"sha256:" + fakeSecret2Hash})
+
+	t.Run("Allows", func(t *testing.T) {
+		assert.True(t, allowed.Allows("fakesecret1"))
+		assert.False(t, allowed.Allows("realsecret"))
+		assert.False(t, newAllowedSecrets().Allows("fakesecret1"))
+	})
+
+	t.Run("Hashed", func(t *testing.T) {
+		assert.True(t, allowed.Allows("fakesecret2"))
+		assert.True(t, newAllowedSecrets([]string{"sha256:" + strings.ToUpper(fakeSecret2Hash)}).Allows("fakesecret2"))
+		assert.False(t, allowed.Allows("fakesecret3"))
+	})
+
+	t.Run("Filter", func(t *testing.T) {
+		results := []*proto.Result{
+			{ID: "a", Secret: "fakesecret1"},
+			{ID: "b", Secret: "realsecret", ParentID: "a"},
+			{ID: "c", Secret: "realsecret2", ParentID: "b"},
+		}
+
+		kept, removed := allowed.Filter(results)
+		assert.Equal(t, 1, removed)
+		assert.Len(t, kept, 2)
+		// The parent was removed so the link is cleared
+		assert.Empty(t, kept[0].ParentID)
+		assert.Equal(t, "b", kept[1].ParentID)
+	})
+}
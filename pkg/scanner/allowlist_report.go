@@ -0,0 +1,126 @@
+package scanner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/report"
+
+	betterleaksconfig "github.com/betterleaks/betterleaks/config"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// allowlistReport holds the allowlists taken out of a detector so the findings
+// they would have suppressed can be reported along with why
+type allowlistReport struct {
+	global []*betterleaksconfig.Allowlist
+	rules  map[string][]*betterleaksconfig.Allowlist
+}
+
+func newAllowlistReport() *allowlistReport {
+	return &allowlistReport{rules: make(map[string][]*betterleaksconfig.Allowlist)}
+}
+
+// Disable moves the detector's allowlists into the report. Call it again after
+// loading more config into the detector (loadSourceConfig does).
+func (r *allowlistReport) Disable(detector *detect.Detector) {
+	r.global = append(r.global, detector.Config.Allowlists...)
+	detector.Config.Allowlists = nil
+
+	rules := cloneRules(&detector.Config)
+	for ruleID, rule := range rules {
+		if len(rule.Allowlists) > 0 {
+			r.rules[ruleID] = append(r.rules[ruleID], rule.Allowlists...)
+			rule.Allowlists = nil
+			rules[ruleID] = rule
+		}
+	}
+
+	detector.Config.Rules = rules
+}
+
+// Split separates the results into the ones no allowlist matches and the ones
+// one does, with an allowlisted_by note on each saying which one. Results must
+// be in the same order as the findings.
+func (r *allowlistReport) Split(results []*proto.Result, findings []report.Finding) (kept, allowlisted []*proto.Result) {
+	kept = make([]*proto.Result, 0, len(results))
+
+	for i, finding := range findings {
+		if reason, ok := r.allowlistedBy(&finding); ok {
+			results[i].Notes["allowlisted_by"] = reason
+			allowlisted = append(allowlisted, results[i])
+		} else {
+			kept = append(kept, results[i])
+		}
+	}
+
+	return kept, allowlisted
+}
+
+// allowlistedBy returns a description of the first allowlist that matches the
+// finding the same way the detector would have checked it
+func (r *allowlistReport) allowlistedBy(finding *report.Finding) (string, bool) {
+	for _, allowlist := range r.global {
+		if matched := allowlistMatches(allowlist, finding); len(matched) > 0 {
+			return describeAllowlist("global", allowlist, matched), true
+		}
+	}
+
+	for _, allowlist := range r.rules[finding.RuleID] {
+		if matched := allowlistMatches(allowlist, finding); len(matched) > 0 {
+			return describeAllowlist("rule", allowlist, matched), true
+		}
+	}
+
+	return "", false
+}
+
+// allowlistMatches returns the parts of the allowlist that matched if, based
+// on its match condition, it allows the finding
+func allowlistMatches(allowlist *betterleaksconfig.Allowlist, finding *report.Finding) []string {
+	target := finding.Secret
+	switch allowlist.RegexTarget {
+	case "match":
+		target = finding.Match
+	case "line":
+		target = finding.Line
+	}
+
+	commitAllowed, _ := allowlist.CommitAllowed(finding.Commit)
+	pathAllowed := allowlist.PathAllowed(finding.File)
+	regexAllowed := allowlist.RegexAllowed(target)
+	stopwordAllowed, stopword := allowlist.ContainsStopWord(finding.Secret)
+
+	checks := []struct {
+		configured bool
+		allowed    bool
+		name       string
+	}{
+		{len(allowlist.Commits) > 0, commitAllowed, "commit"},
+		{len(allowlist.Paths) > 0, pathAllowed, "path"},
+		{len(allowlist.Regexes) > 0, regexAllowed, "regex"},
+		{len(allowlist.StopWords) > 0, stopwordAllowed, fmt.Sprintf("stopword=%q", stopword)},
+	}
+
+	var matched []string
+	for _, check := range checks {
+		if check.configured && check.allowed {
+			matched = append(matched, check.name)
+		} else if check.configured && allowlist.MatchCondition == betterleaksconfig.AllowlistMatchAnd {
+			return nil
+		}
+	}
+
+	return matched
+}
+
+func describeAllowlist(kind string, allowlist *betterleaksconfig.Allowlist, matched []string) string {
+	description := kind + " allowlist"
+	if len(allowlist.Description) > 0 {
+		description += fmt.Sprintf(" %q", allowlist.Description)
+	}
+
+	return description + ": " + strings.Join(matched, ", ")
+}
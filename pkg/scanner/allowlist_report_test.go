@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestReportAllowlisted(t *testing.T) {
+	scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+		require.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte(`
+[[allowlists]]
+description = "known fakes"
+regexes = ['''secretvalue9''']
+
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue[0-9]+[a-z]*'''
+
+[[rules.allowlists]]
+stopwords = ["fake"]
+`), 0600))
+	})
+
+	request := func(reportAllowlisted bool) *proto.Response {
+		scanner.Send(&proto.Request{
+			ID:       "test-allowlisted",
+			Kind:     proto.TextRequestKind,
+			Resource: "token = secretvalue1\ntoken = secretvalue9\ntoken = secretvalue5fake\n",
+			Opts:     proto.Opts{ReportAllowlisted: reportAllowlisted},
+		})
+
+		return <-responses
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		response := request(false)
+		require.Len(t, response.Results, 1)
+		assert.Equal(t, "secretvalue1", response.Results[0].Secret)
+		assert.Empty(t, response.Allowlisted)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		response := request(true)
+		require.Len(t, response.Results, 1)
+		assert.Equal(t, "secretvalue1", response.Results[0].Secret)
+		assert.NotContains(t, response.Results[0].Notes, "allowlisted_by")
+
+		reasons := make(map[string]string)
+		for _, result := range response.Allowlisted {
+			reasons[result.Secret] = result.Notes["allowlisted_by"]
+		}
+
+		assert.Equal(t, map[string]string{
+			"secretvalue9":     `global allowlist "known fakes": regex`,
+			"secretvalue5fake": `rule allowlist: stopword="fake"`,
+		}, reasons)
+
+		// The shared config keeps its allowlists
+		assert.Len(t, request(false).Results, 1)
+	})
+}
@@ -0,0 +1,156 @@
+package scanner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/fs"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// auditLogEntry is a line in the audit log
+type auditLogEntry struct {
+	RequestID string        `json:"request_id"`
+	Time      time.Time     `json:"time"`
+	Result    *proto.Result `json:"result"`
+}
+
+// auditLog appends every result the scanner produces to a JSONL file
+type auditLog struct {
+	mutex    sync.Mutex
+	path     string
+	maxBytes int64
+}
+
+// newAuditLog returns an audit log for path or nil if path is empty. When
+// maxMB is greater than 0, the log is rotated before it grows past that size.
+func newAuditLog(path string, maxMB int) *auditLog {
+	if len(path) == 0 {
+		return nil
+	}
+
+	return &auditLog{
+		path:     filepath.Clean(path),
+		maxBytes: int64(maxMB) * 1_000_000,
+	}
+}
+
+// Write appends the results to the audit log
+func (a *auditLog) Write(requestID string, results []*proto.Result) error {
+	if len(results) == 0 {
+		return nil
+	}
+
+	var data bytes.Buffer
+	now := time.Now().UTC()
+	encoder := json.NewEncoder(&data)
+	for _, result := range results {
+		if err := encoder.Encode(auditLogEntry{RequestID: requestID, Time: now, Result: result}); err != nil {
+			return fmt.Errorf("could not encode audit log entry: %w", err)
+		}
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(a.path), 0700); err != nil {
+		return fmt.Errorf("could not create audit log dir: %w path=%q", err, a.path)
+	}
+
+	file, err := a.open(int64(data.Len()))
+	if err != nil {
+		return err
+	}
+
+	if _, err := file.Write(data.Bytes()); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not write audit log: %w path=%q", err, a.path)
+	}
+
+	return file.Close()
+}
+
+// open returns the current log locked for appending size more bytes, rotating
+// it first if needed. The lock keeps other scanners sharing the log from
+// rotating it while it's written to. The caller must hold the mutex.
+func (a *auditLog) open(size int64) (*os.File, error) {
+	for {
+		file, err := os.OpenFile(a.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, fmt.Errorf("could not open audit log: %w path=%q", err, a.path)
+		}
+
+		if fs.FileLockSupported {
+			// Closing the file releases the lock
+			if err := fs.LockFile(file); err != nil {
+				_ = file.Close()
+				return nil, fmt.Errorf("could not establish a file lock: %w path=%q", err, a.path)
+			}
+		}
+
+		// Another scanner may have rotated the log while this one waited on
+		// the lock, so the file has to be opened again
+		info, err := file.Stat()
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("could not stat audit log: %w path=%q", err, a.path)
+		}
+
+		if current, err := os.Stat(a.path); err != nil || !os.SameFile(info, current) {
+			_ = file.Close()
+			continue
+		}
+
+		if a.maxBytes <= 0 || info.Size() == 0 || info.Size()+size <= a.maxBytes {
+			return file, nil
+		}
+
+		// Without a lock to hold there's no reason to keep the file open, and
+		// Windows can't move a file that's open
+		if !fs.FileLockSupported {
+			_ = file.Close()
+		}
+
+		err = a.rotate()
+		_ = file.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// rotate moves the current log to path + ".<UTC time>", adding a counter if an
+// earlier rotation already has that name. The caller must hold the log's lock.
+func (a *auditLog) rotate() error {
+	basePath := a.path + "." + time.Now().UTC().Format("20060102T150405Z")
+	rotatedPath := basePath
+	for i := 1; fs.PathExists(rotatedPath); i++ {
+		rotatedPath = fmt.Sprintf("%s.%d", basePath, i)
+	}
+
+	// Linking fails instead of replacing a rotation made since the check above
+	// (e.g. where file locks aren't supported), so it's preferred to renaming
+	// when the filesystem has hard links
+	err := os.Link(a.path, rotatedPath)
+	switch {
+	case err == nil:
+		err = os.Remove(a.path)
+	case os.IsExist(err):
+		// Try again with the next name
+		return nil
+	case !os.IsNotExist(err):
+		err = os.Rename(a.path, rotatedPath)
+	}
+
+	// A log that's already gone was rotated by another scanner
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("could not rotate audit log: %w path=%q", err, a.path)
+	}
+
+	return nil
+}
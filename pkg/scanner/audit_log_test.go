@@ -0,0 +1,140 @@
+package scanner
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func readAuditLog(t *testing.T, path string) []auditLogEntry {
+	file, err := os.Open(path) // #nosec G304
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+
+	var entries []auditLogEntry
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 2_000_000)
+	for scanner.Scan() {
+		var entry auditLogEntry
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+	require.NoError(t, scanner.Err())
+
+	return entries
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Run("Disabled", func(t *testing.T) {
+		assert.Nil(t, newAuditLog("", 10))
+	})
+
+	t.Run("Appends", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "logs", "audit.jsonl")
+		auditLog := newAuditLog(path, 0)
+
+		require.NoError(t, auditLog.Write("req-1", []*proto.Result{{ID: "a"}, {ID: "b"}}))
+		require.NoError(t, auditLog.Write("req-2", nil))
+		// A new instance (e.g. a later run) keeps appending
+		require.NoError(t, newAuditLog(path, 0).Write("req-3", []*proto.Result{{ID: "c"}}))
+
+		entries := readAuditLog(t, path)
+		require.Len(t, entries, 3)
+		assert.Equal(t, "req-1", entries[0].RequestID)
+		assert.Equal(t, "a", entries[0].Result.ID)
+		assert.Equal(t, "b", entries[1].Result.ID)
+		assert.Equal(t, "req-3", entries[2].RequestID)
+		assert.False(t, entries[2].Time.IsZero())
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+	})
+
+	t.Run("Rotates", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		auditLog := newAuditLog(path, 1)
+		secret := strings.Repeat("x", 600_000)
+
+		// Rotating more than once (even in the same second) keeps every record
+		for _, resultID := range []string{"a", "b", "c"} {
+			require.NoError(t, auditLog.Write("req-"+resultID, []*proto.Result{{ID: resultID, Secret: secret}}))
+		}
+
+		rotatedPaths, err := filepath.Glob(path + ".*")
+		require.NoError(t, err)
+		require.Len(t, rotatedPaths, 2)
+
+		var resultIDs []string
+		for _, logPath := range append(rotatedPaths, path) {
+			for _, entry := range readAuditLog(t, logPath) {
+				resultIDs = append(resultIDs, entry.Result.ID)
+			}
+		}
+		assert.ElementsMatch(t, []string{"a", "b", "c"}, resultIDs)
+
+		current := readAuditLog(t, path)
+		require.Len(t, current, 1)
+		assert.Equal(t, "c", current[0].Result.ID)
+	})
+	t.Run("SharedPath", func(t *testing.T) {
+		// Scanners sharing a log can rotate it at the same time without
+		// dropping or repeating records
+		path := filepath.Join(t.TempDir(), "audit.jsonl")
+		auditLogs := make([]*auditLog, 4)
+		for i := range auditLogs {
+			auditLogs[i] = newAuditLog(path, 1)
+		}
+		secret := strings.Repeat("x", 100_000)
+
+		var wg sync.WaitGroup
+		var wantIDs []string
+		errs := make(chan error, 200)
+		for i, auditLog := range auditLogs {
+			resultIDs := make([]string, 50)
+			for j := range resultIDs {
+				resultIDs[j] = fmt.Sprintf("%d-%d", i, j)
+			}
+			wantIDs = append(wantIDs, resultIDs...)
+
+			wg.Go(func() {
+				for _, resultID := range resultIDs {
+					errs <- auditLog.Write("req-"+resultID, []*proto.Result{{ID: resultID, Secret: secret}})
+				}
+			})
+		}
+		wg.Wait()
+		close(errs)
+
+		for err := range errs {
+			require.NoError(t, err)
+		}
+
+		logPaths, err := filepath.Glob(path + "*")
+		require.NoError(t, err)
+
+		var resultIDs []string
+		for _, logPath := range logPaths {
+			for _, entry := range readAuditLog(t, logPath) {
+				resultIDs = append(resultIDs, entry.Result.ID)
+			}
+		}
+		assert.ElementsMatch(t, wantIDs, resultIDs)
+	})
+
+	t.Run("AlreadyRotated", func(t *testing.T) {
+		// Another scanner rotating the log first isn't an error
+		auditLog := newAuditLog(filepath.Join(t.TempDir(), "audit.jsonl"), 1)
+		assert.NoError(t, auditLog.rotate())
+	})
+}
@@ -0,0 +1,76 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// authTokenSource provides the pattern server's bearer token. It runs the
+// auth token command when one is configured and falls back on the static
+// auth token.
+type authTokenSource struct {
+	cfg       *config.PatternServer
+	expiresAt time.Time
+	mutex     sync.Mutex
+	token     string
+}
+
+func newAuthTokenSource(cfg *config.PatternServer) *authTokenSource {
+	return &authTokenSource{cfg: cfg}
+}
+
+// Token returns the auth token, re-running the auth token command if the
+// last token it returned has expired
+func (a *authTokenSource) Token(ctx context.Context) (string, error) {
+	if len(a.cfg.AuthTokenCommand) == 0 {
+		return a.cfg.AuthToken, nil
+	}
+
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	if len(a.token) > 0 && time.Now().Before(a.expiresAt) {
+		return a.token, nil
+	}
+
+	token, err := runAuthTokenCommand(ctx, a.cfg.AuthTokenCommand)
+	if err != nil {
+		return "", err
+	}
+
+	a.token = token
+	a.expiresAt = time.Now().Add(time.Duration(a.cfg.AuthTokenCommandTTL) * time.Second)
+
+	return a.token, nil
+}
+
+// runAuthTokenCommand runs the command and returns its trimmed stdout
+func runAuthTokenCommand(ctx context.Context, command []string) (string, error) {
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.CommandContext(ctx, command[0], command[1:]...) // #nosec G204
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	// Only log the command name since the arguments could contain secrets
+	logger.Debug("running auth token command: command=%q", command[0])
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("auth token command failed: %w command=%q stderr=%q", err, command[0], strings.TrimSpace(stderr.String()))
+	}
+
+	token := strings.TrimSpace(stdout.String())
+	if len(token) == 0 {
+		return "", errors.New("auth token command returned an empty token")
+	}
+
+	return token, nil
+}
@@ -0,0 +1,67 @@
+package scanner
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/config"
+)
+
+func TestAuthTokenSource(t *testing.T) {
+	// Each run of this command returns a new token: token-1, token-2, etc
+	countPath := filepath.Join(t.TempDir(), "count")
+	command := []string{"sh", "-c", `echo >> "$0"; echo "token-$(wc -l < "$0" | tr -d ' ')"`, countPath}
+
+	t.Run("StaticToken", func(t *testing.T) {
+		token, err := newAuthTokenSource(&config.PatternServer{AuthToken: "static"}).Token(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "static", token)
+	})
+
+	t.Run("CommandTakesPriority", func(t *testing.T) {
+		authToken := newAuthTokenSource(&config.PatternServer{
+			AuthToken:           "static",
+			AuthTokenCommand:    command,
+			AuthTokenCommandTTL: 300,
+		})
+
+		token, err := authToken.Token(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+
+		// The token is reused until it expires
+		token, err = authToken.Token(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "token-1", token)
+	})
+
+	t.Run("ExpiredToken", func(t *testing.T) {
+		authToken := newAuthTokenSource(&config.PatternServer{
+			AuthTokenCommand:    command,
+			AuthTokenCommandTTL: 0,
+		})
+
+		token, err := authToken.Token(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "token-2", token)
+
+		token, err = authToken.Token(t.Context())
+		require.NoError(t, err)
+		assert.Equal(t, "token-3", token)
+	})
+
+	t.Run("CommandErrors", func(t *testing.T) {
+		_, err := newAuthTokenSource(&config.PatternServer{
+			AuthTokenCommand: []string{"sh", "-c", "echo oops >&2; exit 1"},
+		}).Token(t.Context())
+		require.ErrorContains(t, err, "oops")
+
+		_, err = newAuthTokenSource(&config.PatternServer{
+			AuthTokenCommand: []string{"true"},
+		}).Token(t.Context())
+		require.Error(t, err)
+	})
+}
@@ -0,0 +1,98 @@
+package betterleaks
+
+import (
+	"bytes"
+	"context"
+	"sync"
+
+	"github.com/betterleaks/betterleaks/sources"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// binarySniffSize is how much of the start of a file is checked for null
+// bytes (the same amount git checks)
+const binarySniffSize = 8000
+
+// BinaryFilter wraps sources and drops the fragments of any file that looks
+// binary. Skipped counts the files across every source it wraps. Files are
+// tracked by commit (e.g. image layer) and path since the same path can be
+// binary in one and text in another.
+type BinaryFilter struct {
+	mutex   sync.Mutex
+	skipped map[string]struct{}
+}
+
+// NewBinaryFilter returns an initialized BinaryFilter
+func NewBinaryFilter() *BinaryFilter {
+	return &BinaryFilter{
+		skipped: make(map[string]struct{}),
+	}
+}
+
+// Skipped returns how many files were skipped
+func (f *BinaryFilter) Skipped() int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	return len(f.skipped)
+}
+
+// Wrap returns a source that yields the source's fragments minus the ones
+// from binary files
+func (f *BinaryFilter) Wrap(source sources.Source) sources.Source {
+	return &binaryFilterSource{filter: f, source: source}
+}
+
+// skip reports whether the fragment belongs to a binary file. Files are
+// checked by their first fragment and the rest follow that decision.
+func (f *BinaryFilter) skip(fragment sources.Fragment) bool {
+	if len(fragment.FilePath) == 0 {
+		return false
+	}
+
+	key := fragment.CommitSHA + ":" + fragment.FilePath
+
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	if _, ok := f.skipped[key]; ok {
+		return true
+	}
+
+	if fragment.StartLine != 1 {
+		return false
+	}
+
+	sniff := fragment.Bytes
+	if len(sniff) == 0 {
+		sniff = []byte(fragment.Raw)
+	}
+	if len(sniff) > binarySniffSize {
+		sniff = sniff[:binarySniffSize]
+	}
+
+	if bytes.IndexByte(sniff, 0) == -1 {
+		return false
+	}
+
+	logger.Debug("skipping binary file: commit=%q path=%q", fragment.CommitSHA, fragment.FilePath)
+	f.skipped[key] = struct{}{}
+
+	return true
+}
+
+type binaryFilterSource struct {
+	filter *BinaryFilter
+	source sources.Source
+}
+
+func (s *binaryFilterSource) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	return s.source.Fragments(ctx, func(fragment sources.Fragment, err error) error {
+		if err == nil && s.filter.skip(fragment) {
+			return nil
+		}
+
+		return yield(fragment, err)
+	})
+}
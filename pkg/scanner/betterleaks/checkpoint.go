@@ -0,0 +1,135 @@
+package betterleaks
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/report"
+	"github.com/betterleaks/betterleaks/sources"
+
+	"github.com/leaktk/leaktk/internal/git"
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// gitCheckpointBatchSize is how many commits are scanned between checkpoints
+const gitCheckpointBatchSize = 500
+
+// Checkpoint keeps track of the units of a scan (container image layer
+// digests or git commit SHAs) that are done so an interrupted scan can skip
+// them when it's run again
+type Checkpoint interface {
+	// Scanned reports whether an earlier run finished scanning the unit
+	Scanned(unit string) bool
+	// Findings returns the findings from the units earlier runs finished
+	Findings() []report.Finding
+	// Record saves that the units are done along with their findings
+	Record(units []string, findings []report.Finding) error
+}
+
+// resumedSource adds the findings from the units an earlier run finished to
+// the detector before scanning the rest so they go through the same filters
+type resumedSource struct {
+	checkpoint Checkpoint
+	detector   *detect.Detector
+	source     sources.Source
+}
+
+func (s *resumedSource) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	for _, finding := range s.checkpoint.Findings() {
+		s.detector.AddFinding(finding)
+	}
+
+	if s.source == nil {
+		return nil
+	}
+
+	return s.source.Fragments(ctx, yield)
+}
+
+// layerCheckpointSource runs the detector on each fragment itself so it knows
+// which findings came from a layer by the time the layer is done
+type layerCheckpointSource struct {
+	checkpoint Checkpoint
+	detector   *detect.Detector
+	findings   map[string][]report.Finding
+	mutex      sync.Mutex
+	source     sources.Source
+}
+
+func (s *layerCheckpointSource) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	return s.source.Fragments(ctx, func(fragment sources.Fragment, err error) error {
+		if err != nil {
+			return yield(fragment, err)
+		}
+
+		findings := s.detector.DetectContext(ctx, fragment)
+		if len(findings) > 0 {
+			s.mutex.Lock()
+			s.findings[fragment.CommitSHA] = append(s.findings[fragment.CommitSHA], findings...)
+			s.mutex.Unlock()
+		}
+
+		for _, finding := range findings {
+			s.detector.AddFinding(finding)
+		}
+
+		// Only pass on the commit so the detector still counts it without
+		// detecting the fragment again
+		return yield(sources.Fragment{CommitSHA: fragment.CommitSHA}, nil)
+	})
+}
+
+// layerScanned records the layer and the findings from it in the checkpoint
+func (s *layerCheckpointSource) layerScanned(digest string) error {
+	s.mutex.Lock()
+	findings := s.findings[digest]
+	delete(s.findings, digest)
+	s.mutex.Unlock()
+
+	return s.checkpoint.Record([]string{digest}, findings)
+}
+
+// scanGitCheckpointed scans the commits an earlier run didn't finish in
+// batches and records each batch in the checkpoint once it's done
+func scanGitCheckpointed(ctx context.Context, detector *detect.Detector, gitDir string, opts GitScanOpts) ([]report.Finding, error) {
+	commits, err := git.ListCommits(ctx, gitDir, gitLogArgs(gitDir, opts))
+	if err != nil {
+		return nil, err
+	}
+
+	commits = slices.DeleteFunc(commits, opts.Checkpoint.Scanned)
+	logger.Debug("scanning commits left from checkpoint: commits=%d", len(commits))
+
+	findings, err := detectSource(ctx, detector, &resumedSource{
+		checkpoint: opts.Checkpoint,
+		detector:   detector,
+	})
+	if err != nil {
+		return findings, err
+	}
+
+	for batch := range slices.Chunk(commits, gitCheckpointBatchSize) {
+		batchOpts := opts
+		batchOpts.Commits = batch
+
+		source, err := gitSource(ctx, detector, gitDir, batchOpts)
+		if err != nil {
+			return findings, err
+		}
+
+		// The detector's findings cover every batch so far
+		batchStart := len(findings)
+		if findings, err = detectSource(ctx, detector, source); err != nil {
+			return findings, err
+		}
+
+		if err := opts.Checkpoint.Record(batch, findings[batchStart:]); err != nil {
+			return findings, fmt.Errorf("could not record checkpoint: %w", err)
+		}
+	}
+
+	return findings, nil
+}
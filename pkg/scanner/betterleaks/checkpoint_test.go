@@ -0,0 +1,175 @@
+package betterleaks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCheckpoint is a Checkpoint that's only kept in memory
+type memoryCheckpoint struct {
+	mutex    sync.Mutex
+	scanned  map[string]struct{}
+	findings []report.Finding
+	records  [][]string
+}
+
+func newMemoryCheckpoint() *memoryCheckpoint {
+	return &memoryCheckpoint{scanned: make(map[string]struct{})}
+}
+
+func (c *memoryCheckpoint) Scanned(unit string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, ok := c.scanned[unit]
+	return ok
+}
+
+func (c *memoryCheckpoint) Findings() []report.Finding {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return slices.Clone(c.findings)
+}
+
+func (c *memoryCheckpoint) Record(units []string, findings []report.Finding) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	for _, unit := range units {
+		c.scanned[unit] = struct{}{}
+	}
+	c.findings = append(c.findings, findings...)
+	c.records = append(c.records, units)
+
+	return nil
+}
+
+func findingSecrets(findings []report.Finding) []string {
+	secrets := make([]string, len(findings))
+	for i, finding := range findings {
+		secrets[i] = finding.Secret
+	}
+	slices.Sort(secrets)
+
+	return secrets
+}
+
+func TestGitCheckpoint(t *testing.T) {
+	cfg, err := ParseConfig(`
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue[0-9]+'''
+`)
+	require.NoError(t, err)
+
+	repoDir := t.TempDir()
+	require.NoError(t, exec.Command("git", "-C", repoDir, "init", "--initial-branch", "main").Run()) // #nosec:G204
+
+	for i := range 3 {
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, fmt.Sprintf("config%d.txt", i)), []byte(fmt.Sprintf("token = secretvalue%d\n", i)), 0600))
+		require.NoError(t, exec.Command("git", "-C", repoDir, "add", "-A").Run()) // #nosec:G204
+		require.NoError(t, exec.Command(
+			"git",
+			"-C", repoDir,
+			"-c", "user.name=Test",
+			"-c", "user.email=test@example.com",
+			"commit", "-m", "Add config", "--no-verify").Run()) // #nosec:G204
+	}
+
+	gitDir := filepath.Join(repoDir, ".git")
+	output, err := exec.Command("git", "-C", repoDir, "rev-list", "main").Output() // #nosec:G204
+	require.NoError(t, err)
+	commits := strings.Fields(string(output))
+	require.Len(t, commits, 3)
+
+	t.Run("RecordsCommits", func(t *testing.T) {
+		checkpoint := newMemoryCheckpoint()
+		findings, err := ScanGit(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), gitDir, GitScanOpts{
+			Checkpoint:    checkpoint,
+			RevisionRange: "main",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"secretvalue0", "secretvalue1", "secretvalue2"}, findingSecrets(findings))
+		assert.Equal(t, [][]string{commits}, checkpoint.records)
+		assert.Equal(t, findingSecrets(findings), findingSecrets(checkpoint.findings))
+	})
+
+	t.Run("Resume", func(t *testing.T) {
+		// Pretend an earlier run finished the newest commit
+		checkpoint := newMemoryCheckpoint()
+		require.NoError(t, checkpoint.Record(commits[:1], []report.Finding{{
+			RuleID: "test-rule",
+			Secret: "secretvalue2",
+			File:   "config2.txt",
+			Commit: commits[0],
+		}}))
+
+		findings, err := ScanGit(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), gitDir, GitScanOpts{
+			Checkpoint:    checkpoint,
+			RevisionRange: "main",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"secretvalue0", "secretvalue1", "secretvalue2"}, findingSecrets(findings))
+		assert.Equal(t, [][]string{commits[:1], commits[1:]}, checkpoint.records)
+	})
+
+	t.Run("NothingLeft", func(t *testing.T) {
+		checkpoint := newMemoryCheckpoint()
+		require.NoError(t, checkpoint.Record(commits, nil))
+
+		findings, err := ScanGit(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), gitDir, GitScanOpts{
+			Checkpoint:    checkpoint,
+			RevisionRange: "main",
+		})
+		require.NoError(t, err)
+		assert.Empty(t, findings)
+		assert.Len(t, checkpoint.records, 1)
+	})
+}
+
+func TestContainerImageCheckpoint(t *testing.T) {
+	layoutPath, err := filepath.Abs("../../../testdata/oci-layout")
+	require.NoError(t, err)
+
+	cfg, err := ParseConfig(`
+[[rules]]
+id = "test-rule"
+regex = '''arch=amd64'''
+`)
+	require.NoError(t, err)
+
+	checkpoint := newMemoryCheckpoint()
+	rawImageRef := "oci:" + layoutPath + ":single"
+
+	findings, err := ScanContainerImage(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), rawImageRef, ContainerImageScanOpts{
+		Checkpoint: checkpoint,
+	})
+	require.NoError(t, err)
+	require.Len(t, findings, 1)
+	require.Len(t, checkpoint.records, 1)
+	assert.Equal(t, []string{findings[0].Commit}, checkpoint.records[0])
+	assert.Equal(t, findingSecrets(findings), findingSecrets(checkpoint.findings))
+
+	t.Run("Resume", func(t *testing.T) {
+		findings, err := ScanContainerImage(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), rawImageRef, ContainerImageScanOpts{
+			Checkpoint: checkpoint,
+		})
+		require.NoError(t, err)
+
+		// The layer is skipped but its finding is still returned
+		assert.Equal(t, []string{"arch=amd64"}, findingSecrets(findings))
+		assert.Len(t, checkpoint.records, 1)
+	})
+}
@@ -1,14 +1,81 @@
 package betterleaks
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
 
 	"github.com/BurntSushi/toml"
 	"github.com/betterleaks/betterleaks/config"
+	"gopkg.in/yaml.v3"
 )
 
-func ParseConfig(rawConfig string) (cfg *config.Config, err error) {
+// ConfigFormat is the format a raw gitleaks config is written in
+type ConfigFormat int
+
+const (
+	// TOMLConfigFormat is the default gitleaks config format
+	TOMLConfigFormat ConfigFormat = iota
+	// JSONConfigFormat is a gitleaks config written in JSON
+	JSONConfigFormat
+	// YAMLConfigFormat is a gitleaks config written in YAML
+	YAMLConfigFormat
+)
+
+// yamlKeyLine matches lines like "rules:" or "title: ..." that start a YAML
+// mapping but wouldn't be valid TOML
+var yamlKeyLine = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_-]*:(\s|$)`)
+
+// ConfigFormatForPath determines the config format from the file extension,
+// falling back on SniffConfigFormat for unknown extensions
+func ConfigFormatForPath(path, rawConfig string) ConfigFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		return TOMLConfigFormat
+	case ".json":
+		return JSONConfigFormat
+	case ".yaml", ".yml":
+		return YAMLConfigFormat
+	default:
+		return SniffConfigFormat(rawConfig)
+	}
+}
+
+// SniffConfigFormat determines the config format from its content. Ambiguous
+// content is treated as TOML.
+func SniffConfigFormat(rawConfig string) ConfigFormat {
+	for _, line := range strings.Split(rawConfig, "\n") {
+		line = strings.TrimSpace(line)
+
+		// Comments look the same in TOML and YAML
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		switch {
+		case strings.HasPrefix(line, "{"):
+			return JSONConfigFormat
+		case line == "---" || yamlKeyLine.MatchString(line):
+			return YAMLConfigFormat
+		default:
+			return TOMLConfigFormat
+		}
+	}
+
+	return TOMLConfigFormat
+}
+
+// ParseConfig parses a gitleaks config after detecting its format with
+// SniffConfigFormat
+func ParseConfig(rawConfig string) (*config.Config, error) {
+	return ParseConfigFormat(rawConfig, SniffConfigFormat(rawConfig))
+}
+
+// ParseConfigFormat parses a gitleaks config written in the provided format
+func ParseConfigFormat(rawConfig string, format ConfigFormat) (cfg *config.Config, err error) {
 	var vc config.ViperConfig
 
 	defer func() {
@@ -17,7 +84,14 @@ func ParseConfig(rawConfig string) (cfg *config.Config, err error) {
 		}
 	}()
 
-	_, err = toml.Decode(rawConfig, &vc)
+	switch format {
+	case JSONConfigFormat:
+		err = json.Unmarshal([]byte(rawConfig), &vc)
+	case YAMLConfigFormat:
+		err = decodeYAMLConfig(rawConfig, &vc)
+	default:
+		_, err = toml.Decode(rawConfig, &vc)
+	}
 	if err != nil {
 		return
 	}
@@ -37,6 +111,22 @@ func ParseConfig(rawConfig string) (cfg *config.Config, err error) {
 	return
 }
 
+// decodeYAMLConfig decodes the YAML through JSON since the config's fields
+// don't have yaml tags and JSON matches the keys case insensitively like TOML
+func decodeYAMLConfig(rawConfig string, vc *config.ViperConfig) error {
+	var data any
+	if err := yaml.Unmarshal([]byte(rawConfig), &data); err != nil {
+		return err
+	}
+
+	rawJSON, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("could not convert yaml config: %w", err)
+	}
+
+	return json.Unmarshal(rawJSON, vc)
+}
+
 func validate(cfg *config.Config) error {
 	if len(cfg.Rules) == 0 && len(cfg.Allowlists) == 0 {
 		return errors.New("no rules or allowlists")
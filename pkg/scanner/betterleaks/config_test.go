@@ -49,3 +49,80 @@ func TestParseConfig(t *testing.T) {
 		assert.Error(t, err)
 	})
 }
+
+const mockJSONConfig = `{
+  "allowlist": {"paths": ["testdata"]},
+  "rules": [
+    {"id": "test-rule", "description": "test-rule", "regex": "test-(rule)", "secretGroup": 1}
+  ]
+}`
+
+const mockYAMLConfig = `
+# A comment before the first key
+allowlist:
+  paths:
+    - testdata
+rules:
+  - id: test-rule
+    description: test-rule
+    regex: test-(rule)
+    secretGroup: 1
+    allowlists:
+      - regexTarget: line
+        regexes:
+          - notsecret
+`
+
+func TestParseConfigFormat(t *testing.T) {
+	t.Run("JSONConfig", func(t *testing.T) {
+		cfg, err := ParseConfigFormat(mockJSONConfig, JSONConfigFormat)
+		require.NoError(t, err)
+		assert.Equal(t, "testdata", cfg.Allowlists[0].Paths[0].String())
+		assert.Equal(t, 1, cfg.Rules["test-rule"].SecretGroup)
+	})
+
+	t.Run("YAMLConfig", func(t *testing.T) {
+		cfg, err := ParseConfigFormat(mockYAMLConfig, YAMLConfigFormat)
+		require.NoError(t, err)
+		assert.Equal(t, "testdata", cfg.Allowlists[0].Paths[0].String())
+		assert.Equal(t, 1, cfg.Rules["test-rule"].SecretGroup)
+		assert.Equal(t, "line", cfg.Rules["test-rule"].Allowlists[0].RegexTarget)
+	})
+
+	t.Run("SniffedFormats", func(t *testing.T) {
+		for _, rawConfig := range []string{mockConfig, mockJSONConfig, mockYAMLConfig} {
+			cfg, err := ParseConfig(rawConfig)
+			require.NoError(t, err)
+			assert.Equal(t, "testdata", cfg.Allowlists[0].Paths[0].String())
+		}
+	})
+
+	t.Run("InvalidJSONConfig", func(t *testing.T) {
+		_, err := ParseConfigFormat(`{"rules": [`, JSONConfigFormat)
+		require.Error(t, err)
+	})
+
+	t.Run("InvalidYAMLConfig", func(t *testing.T) {
+		_, err := ParseConfigFormat("rules: [\n", YAMLConfigFormat)
+		require.Error(t, err)
+	})
+}
+
+func TestConfigFormat(t *testing.T) {
+	t.Run("SniffConfigFormat", func(t *testing.T) {
+		assert.Equal(t, TOMLConfigFormat, SniffConfigFormat(mockConfig))
+		assert.Equal(t, TOMLConfigFormat, SniffConfigFormat("title = 'test'\n"))
+		assert.Equal(t, TOMLConfigFormat, SniffConfigFormat(""))
+		assert.Equal(t, JSONConfigFormat, SniffConfigFormat(mockJSONConfig))
+		assert.Equal(t, YAMLConfigFormat, SniffConfigFormat(mockYAMLConfig))
+		assert.Equal(t, YAMLConfigFormat, SniffConfigFormat("---\nrules: []\n"))
+	})
+
+	t.Run("ConfigFormatForPath", func(t *testing.T) {
+		assert.Equal(t, TOMLConfigFormat, ConfigFormatForPath("gitleaks.toml", mockYAMLConfig))
+		assert.Equal(t, JSONConfigFormat, ConfigFormatForPath("gitleaks.json", mockConfig))
+		assert.Equal(t, YAMLConfigFormat, ConfigFormatForPath("gitleaks.yaml", mockConfig))
+		assert.Equal(t, YAMLConfigFormat, ConfigFormatForPath("GITLEAKS.YML", mockConfig))
+		assert.Equal(t, YAMLConfigFormat, ConfigFormatForPath("gitleaks", mockYAMLConfig))
+	})
+}
@@ -1,6 +1,7 @@
 package betterleaks
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -20,29 +21,59 @@ import (
 
 	"github.com/betterleaks/betterleaks/config"
 	"github.com/betterleaks/betterleaks/sources"
+	"go.podman.io/image/v5/docker/reference"
+	podmanimage "go.podman.io/image/v5/image"
 	"go.podman.io/image/v5/manifest"
 	"go.podman.io/image/v5/pkg/blobinfocache"
 	"go.podman.io/image/v5/transports/alltransports"
 	"go.podman.io/image/v5/types"
 
+	"github.com/opencontainers/go-digest"
 	imagespecv1 "github.com/opencontainers/image-spec/specs-go/v1"
 )
 
 type ContainerImage struct {
-	Arch            string
-	Config          *config.Config
-	Depth           int
-	Exclusions      []string
-	MaxArchiveDepth int
-	RawImageRef     string
-	Sema            *semgroup.Group
-	Since           *time.Time
-	Remote          *sources.RemoteInfo
-	path            string
+	// AllowedTransports limits which transports (e.g. docker or oci) image
+	// refs can use. Empty means any transport is allowed.
+	AllowedTransports []string
+	Arch              string
+	// CACert is trusted for registry connections along with the registry's
+	// own certs. The cert dirs for it are created under CertsDir.
+	CACert   []byte
+	CertsDir string
+	// Checkpoint skips the layers an earlier run finished
+	Checkpoint          Checkpoint
+	Config              *config.Config
+	DecompressionLimits DecompressionLimits
+	Depth               int
+	Exclusions          []string
+	LayerRange          *LayerRange
+	MaxArchiveDepth     int
+	RawImageRef         string
+	Sema                *semgroup.Group
+	Since               *time.Time
+	Remote              *sources.RemoteInfo
+	// UserAgent replaces the default User-Agent for registry requests
+	UserAgent string
+	// layerScanned is called once all of a layer's fragments are yielded
+	layerScanned func(digest string) error
+	path         string
 }
 
 var authorRe = regexp.MustCompile(`^(.+?)\s+<([^>]+)`)
 
+// imageTransportAllowed reports whether the transport is in allowed, which can
+// list transports by name (docker) or prefix (docker:// or oci:)
+func imageTransportAllowed(allowed []string, transport string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	return slices.ContainsFunc(allowed, func(name string) bool {
+		return strings.TrimSuffix(strings.TrimSuffix(name, "//"), ":") == transport
+	})
+}
+
 type seekReaderAt interface {
 	io.ReaderAt
 	io.Seeker
@@ -50,16 +81,31 @@ type seekReaderAt interface {
 
 func (s *ContainerImage) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
 	sysCtx := &types.SystemContext{
-		DockerRegistryUserAgent: version.GlobalUserAgent,
+		DockerRegistryUserAgent: cmp.Or(s.UserAgent, version.GlobalUserAgent),
 	}
 
-	imageRef, err := alltransports.ParseImageName(s.RawImageRef)
+	imageRef, err := parseImageRef(s.RawImageRef)
 	if err != nil {
-		logger.Debug("error parsing image reference %q: %v adding transport and trying again", s.RawImageRef, err)
-		imageRef, err = alltransports.ParseImageName("docker://" + s.RawImageRef)
+		return fmt.Errorf("could not parse image reference: %v image=%q", err, s.RawImageRef)
+	}
+
+	if transport := imageRef.Transport().Name(); !imageTransportAllowed(s.AllowedTransports, transport) {
+		return fmt.Errorf("image transport not allowed: transport=%q image=%q", transport, s.RawImageRef)
+	}
+
+	if dockerRef := imageRef.DockerReference(); dockerRef != nil && len(s.CACert) > 0 {
+		certDir, err := newRegistryCertDir(s.CertsDir, reference.Domain(dockerRef), s.CACert)
 		if err != nil {
-			return fmt.Errorf("could not parse image reference: %v image=%q", err, s.RawImageRef)
+			return err
 		}
+
+		defer func() {
+			if err := os.RemoveAll(certDir); err != nil {
+				logger.Debug("could not remove registry cert dir: %v path=%q", err, certDir)
+			}
+		}()
+
+		sysCtx.DockerPerHostCertDirPath = certDir
 	}
 
 	imageSource, err := imageRef.NewImageSource(ctx, sysCtx)
@@ -73,8 +119,31 @@ func (s *ContainerImage) Fragments(ctx context.Context, yield sources.FragmentsF
 		}
 	})()
 
+	return s.instanceFragments(ctx, sysCtx, imageSource, nil, yield)
+}
+
+// parseImageRef parses a ref with a transport (e.g. docker:// or oci:) and
+// treats refs without one as docker:// refs
+func parseImageRef(rawImageRef string) (types.ImageReference, error) {
+	if alltransports.TransportFromImageName(rawImageRef) != nil {
+		return alltransports.ParseImageName(rawImageRef)
+	}
+
+	logger.Debug("image reference has no known transport, using docker://: image=%q", rawImageRef)
+
+	return alltransports.ParseImageName("docker://" + rawImageRef)
+}
+
+// instanceFragments yields the fragments of the image or image index with the
+// digest in the source, or the source's own manifest if the digest is nil
+func (s *ContainerImage) instanceFragments(ctx context.Context, sysCtx *types.SystemContext, imageSource types.ImageSource, instanceDigest *digest.Digest, yield sources.FragmentsFunc) error {
 	logger.Debug("fetching manifest: image=%q", s.RawImageRef)
-	rawManifest, manifestMIMEType, err := imageSource.GetManifest(ctx, nil)
+	var rawManifest []byte
+	var manifestMIMEType string
+	err := withRegistryRetries(ctx, "manifest fetch", func() (err error) {
+		rawManifest, manifestMIMEType, err = imageSource.GetManifest(ctx, instanceDigest)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("could not fetch manifest: %v", err)
 	}
@@ -103,47 +172,42 @@ func (s *ContainerImage) Fragments(ctx context.Context, yield sources.FragmentsF
 
 	if indexManifest != nil && len(indexManifest.Manifests) > 0 {
 		for _, m := range indexManifest.Manifests {
-			digest := m.Digest.String()
-			var rawImageRef string
-			if len(s.Arch) > 0 {
-				if m.Platform.Architecture == s.Arch {
-					rawImageRef = imageSource.Reference().DockerReference().Name() + "@" + digest
-				}
-			} else {
-				rawImageRef = imageSource.Reference().DockerReference().Name() + "@" + digest
+			if len(s.Arch) > 0 && m.Platform.Architecture != s.Arch {
+				continue
 			}
 
-			if len(rawImageRef) > 0 {
-				containerImage := *s
-				containerImage.RawImageRef = imageSource.Reference().Transport().Name() + "://" + rawImageRef
-				containerImage.path = filepath.Join(s.path, "manifests", digest)
+			// Instances are read from the same source so this works the same
+			// for every transport
+			containerImage := *s
+			containerImage.path = filepath.Join(s.path, "manifests", m.Digest.String())
 
-				if err := containerImage.Fragments(ctx, yield); err != nil {
-					return err
-				}
+			if err := containerImage.instanceFragments(ctx, sysCtx, imageSource, &m.Digest, yield); err != nil {
+				return err
 			}
 		}
 
 		return nil
 	}
 
-	image, err := imageRef.NewImage(ctx, sysCtx)
+	var image types.Image
+	err = withRegistryRetries(ctx, "image fetch", func() (err error) {
+		image, err = podmanimage.FromUnparsedImage(ctx, sysCtx, podmanimage.UnparsedInstance(imageSource, instanceDigest))
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("could not load image to retrieve labels: %v", err)
 	}
 
-	defer (func() {
-		if err := image.Close(); err != nil {
-			logger.Debug("error closing image: %v image=%q", err, s.RawImageRef)
-		}
-	})()
-
 	imageManifest, err := manifest.FromBlob(rawManifest, manifestMIMEType)
 	if err != nil {
 		return fmt.Errorf("could not parse manifest: %v image=%q", err, s.RawImageRef)
 	}
 
-	ociConfig, err := image.OCIConfig(ctx)
+	var ociConfig *imagespecv1.Image
+	err = withRegistryRetries(ctx, "config fetch", func() (err error) {
+		ociConfig, err = image.OCIConfig(ctx)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("could not get OCI config: %v image=%q", err, s.RawImageRef)
 	}
@@ -176,6 +240,13 @@ func (s *ContainerImage) Fragments(ctx context.Context, yield sources.FragmentsF
 	layerInfos := imageManifest.LayerInfos()
 	checkSince := s.Since != nil && len(layerInfos) == len(configHistories)
 
+	var layerCount int
+	for _, layerInfo := range layerInfos {
+		if !layerInfo.EmptyLayer {
+			layerCount++
+		}
+	}
+
 	for i, layerInfo := range layerInfos {
 		layerCommitInfo := commitInfo
 		layerCommitInfo.SHA = layerInfo.Digest.String()
@@ -190,6 +261,11 @@ func (s *ContainerImage) Fragments(ctx context.Context, yield sources.FragmentsF
 			break
 		}
 
+		if !s.LayerRange.Contains(currentDepth, layerCount) {
+			logger.Debug("skipping layer outside of layer range: digest=%q position=%d layers=%d", layerInfo.Digest, currentDepth, layerCount)
+			continue
+		}
+
 		if checkSince {
 			if history := configHistories[i]; history.Created != nil && history.Created.Before(*s.Since) {
 				logger.Debug("skipping layer older than provided date: digest=%q create=%q", layerInfo.Digest, history.Created.Format("2006-01-02"))
@@ -205,46 +281,79 @@ func (s *ContainerImage) Fragments(ctx context.Context, yield sources.FragmentsF
 		enrichedYield := yieldWithCommitInfo(layerCommitInfo, yield)
 		digest := layerInfo.Digest.String()
 
+		if s.Checkpoint != nil && s.Checkpoint.Scanned(digest) {
+			logger.Debug("skipping layer scanned in an earlier run: digest=%q", digest)
+			continue
+		}
+
 		logger.Debug("downloading container layer blob: digest=%q", digest)
-		blobReader, blobSize, err := imageSource.GetBlob(ctx, layerInfo.BlobInfo, cache)
+		var blobReader io.ReadCloser
+		var blobSize int64
+		err = withRegistryRetries(ctx, "layer blob fetch", func() (err error) {
+			blobReader, blobSize, err = imageSource.GetBlob(ctx, layerInfo.BlobInfo, cache)
+			return err
+		})
 		logger.Debug("container layer blob size: digest=%q size=%d", digest, blobSize)
 		if err != nil {
 			logger.Error("could not download layer blob: %v", err)
 			return err
 		}
 
-		format, stream, err := archives.Identify(ctx, "", blobReader)
-		if err == nil && format != nil {
-			if extractor, ok := format.(archives.Extractor); ok {
-				s.extractorFragments(ctx, extractor, digest, stream, enrichedYield)
-				continue
-			} else if decompressor, ok := format.(archives.Decompressor); ok {
-				s.decompressorFragments(ctx, decompressor, digest, stream, enrichedYield)
-				continue
-			}
-		}
+		err = s.blobFragments(ctx, digest, blobReader, enrichedYield)
+		closeBlob(blobReader, digest)
 
-		file := &sources.File{
-			Content:         stream,
-			MaxArchiveDepth: s.MaxArchiveDepth - 1,
-			Path:            filepath.Join(s.path, "layers", digest),
+		if err != nil {
+			return err
 		}
 
-		err = file.Fragments(ctx, enrichedYield)
-
-		if closeErr := blobReader.Close(); closeErr != nil {
-			logger.Debug("error closing blob reader: %v digest=%q", closeErr, digest)
+		// A canceled scan can stop partway through a layer without an error
+		if err := ctx.Err(); err != nil {
+			return err
 		}
 
-		if err != nil {
-			return err
+		if s.layerScanned != nil {
+			if err := s.layerScanned(digest); err != nil {
+				return fmt.Errorf("could not record checkpoint: %w digest=%q", err, digest)
+			}
 		}
 	}
 
 	return nil
 }
 
-func (s *ContainerImage) extractorFragments(ctx context.Context, extractor archives.Extractor, digest string, reader io.Reader, yield sources.FragmentsFunc) {
+// blobFragments yields the fragments of a layer blob based on its format
+func (s *ContainerImage) blobFragments(ctx context.Context, digest string, blobReader io.Reader, yield sources.FragmentsFunc) error {
+	limiter := newDecompressionLimiter(s.DecompressionLimits)
+	format, stream, err := archives.Identify(ctx, "", limiter.compressedReader(blobReader))
+	if err == nil && format != nil {
+		if extractor, ok := format.(archives.Extractor); ok {
+			s.extractorFragments(ctx, extractor, limiter, digest, stream, yield)
+			return nil
+		} else if decompressor, ok := format.(archives.Decompressor); ok {
+			s.decompressorFragments(ctx, decompressor, limiter, digest, stream, yield)
+			return nil
+		}
+	}
+
+	file := &sources.File{
+		Content:         stream,
+		MaxArchiveDepth: s.MaxArchiveDepth - 1,
+		Path:            filepath.Join(s.path, "layers", digest),
+	}
+
+	return file.Fragments(ctx, yield)
+}
+
+// closeBlob closes the blob so its connection can go back to the image
+// source's HTTP client for the next blob. The manifest and every blob use the
+// same client, so a blob left open means a new TLS handshake for the next one.
+func closeBlob(blobReader io.ReadCloser, digest string) {
+	if err := blobReader.Close(); err != nil {
+		logger.Debug("error closing blob reader: %v digest=%q", err, digest)
+	}
+}
+
+func (s *ContainerImage) extractorFragments(ctx context.Context, extractor archives.Extractor, limiter *decompressionLimiter, digest string, reader io.Reader, yield sources.FragmentsFunc) {
 	if _, isSeekReaderAt := reader.(seekReaderAt); !isSeekReaderAt {
 		switch extractor.(type) {
 		case archives.SevenZip, archives.Zip:
@@ -287,7 +396,7 @@ func (s *ContainerImage) extractorFragments(ctx context.Context, extractor archi
 		}
 
 		file := &sources.File{
-			Content:         innerReader,
+			Content:         limiter.decompressedReader(innerReader, path, digest),
 			Path:            filepath.Join(s.path, "layers", digest) + sources.InnerPathSeparator + path,
 			MaxArchiveDepth: s.MaxArchiveDepth - 1,
 		}
@@ -307,17 +416,18 @@ func (s *ContainerImage) extractorFragments(ctx context.Context, extractor archi
 	}
 }
 
-func (s *ContainerImage) decompressorFragments(ctx context.Context, decompressor archives.Decompressor, digest string, reader io.Reader, yield sources.FragmentsFunc) {
+func (s *ContainerImage) decompressorFragments(ctx context.Context, decompressor archives.Decompressor, limiter *decompressionLimiter, digest string, reader io.Reader, yield sources.FragmentsFunc) {
 	innerReader, err := decompressor.OpenReader(reader)
 	if err != nil {
 		logger.Error("could not read compressed container layer blob: %v digest=%q", err, digest)
 		return
 	}
 
+	path := filepath.Join(s.path, "layers", digest)
 	file := &sources.File{
-		Content:         innerReader,
+		Content:         limiter.decompressedReader(innerReader, path, digest),
 		MaxArchiveDepth: s.MaxArchiveDepth - 1,
-		Path:            filepath.Join(s.path, "layers", digest),
+		Path:            path,
 	}
 
 	if err := file.Fragments(ctx, yield); err != nil {
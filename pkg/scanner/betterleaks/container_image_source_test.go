@@ -3,7 +3,14 @@ package betterleaks
 import (
 	"context"
 	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -73,3 +80,154 @@ func TestContainerImage(t *testing.T) {
 		assert.GreaterOrEqual(t, len(fragments), 2, "should collect at least two fragments if available")
 	})
 }
+
+func TestImageTransports(t *testing.T) {
+	t.Run("Allowed", func(t *testing.T) {
+		assert.True(t, imageTransportAllowed(nil, "docker-daemon"))
+		assert.True(t, imageTransportAllowed([]string{"docker"}, "docker"))
+		assert.True(t, imageTransportAllowed([]string{"docker://", "oci:"}, "docker"))
+		assert.True(t, imageTransportAllowed([]string{"docker://", "oci:"}, "oci"))
+		assert.False(t, imageTransportAllowed([]string{"docker://", "oci:"}, "docker-daemon"))
+		assert.False(t, imageTransportAllowed([]string{"oci"}, "oci-archive"))
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		containerImage := &ContainerImage{
+			AllowedTransports: []string{"docker://"},
+			RawImageRef:       "oci:" + t.TempDir() + ":latest",
+			Sema:              semgroup.NewGroup(context.Background(), 1),
+		}
+
+		err := containerImage.Fragments(context.Background(), func(fragment sources.Fragment, err error) error {
+			return nil
+		})
+
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), `image transport not allowed: transport="oci"`)
+	})
+}
+
+func TestOCILayout(t *testing.T) {
+	layoutPath, err := filepath.Abs("../../../testdata/oci-layout")
+	require.NoError(t, err)
+
+	fragments := func(t *testing.T, containerImage *ContainerImage) map[string]sources.Fragment {
+		containerImage.Sema = semgroup.NewGroup(context.Background(), 1)
+
+		var mu sync.Mutex
+		fragments := make(map[string]sources.Fragment)
+		err := containerImage.Fragments(context.Background(), func(fragment sources.Fragment, err error) error {
+			mu.Lock()
+			defer mu.Unlock()
+
+			fragments[fragment.FilePath] = fragment
+			return nil
+		})
+
+		require.NoError(t, err)
+		return fragments
+	}
+
+	// layerFiles returns the files found in the image layers by path
+	layerFiles := func(found map[string]sources.Fragment) map[string]string {
+		files := make(map[string]string)
+		for path, fragment := range found {
+			if layer, file, ok := strings.Cut(path, "!"); ok && strings.Contains(layer, "layers/sha256:") {
+				files[file] = fragment.Raw
+				// Layer files have the layer's digest as their commit
+				assert.Equal(t, filepath.Base(layer), fragment.CommitInfo.SHA)
+			}
+		}
+
+		return files
+	}
+
+	t.Run("Image", func(t *testing.T) {
+		found := fragments(t, &ContainerImage{RawImageRef: "oci:" + layoutPath + ":single"})
+
+		require.Contains(t, found, "manifest!/mediaType")
+		assert.Equal(t, map[string]string{"etc/app/amd64.conf": "arch=amd64\n"}, layerFiles(found))
+	})
+
+	t.Run("IndexWithArch", func(t *testing.T) {
+		found := fragments(t, &ContainerImage{Arch: "arm64", RawImageRef: "oci:" + layoutPath + ":v1"})
+
+		for path := range found {
+			assert.True(t, strings.HasPrefix(path, "manifests/sha256:"), path)
+		}
+		assert.Equal(t, map[string]string{"etc/app/arm64.conf": "arch=arm64\n"}, layerFiles(found))
+	})
+
+	t.Run("Index", func(t *testing.T) {
+		found := fragments(t, &ContainerImage{RawImageRef: "oci:" + layoutPath + ":v1"})
+
+		assert.Equal(t, map[string]string{
+			"etc/app/amd64.conf": "arch=amd64\n",
+			"etc/app/arm64.conf": "arch=arm64\n",
+		}, layerFiles(found))
+	})
+
+	t.Run("LayerRange", func(t *testing.T) {
+		found := fragments(t, &ContainerImage{LayerRange: &LayerRange{Start: -1}, RawImageRef: "oci:" + layoutPath + ":single"})
+		assert.Len(t, layerFiles(found), 1)
+
+		found = fragments(t, &ContainerImage{LayerRange: &LayerRange{Start: 2}, RawImageRef: "oci:" + layoutPath + ":single"})
+		assert.Empty(t, layerFiles(found))
+		assert.Contains(t, found, "manifest!/mediaType")
+	})
+
+	t.Run("MissingTag", func(t *testing.T) {
+		containerImage := &ContainerImage{
+			RawImageRef: "oci:" + layoutPath + ":missing",
+			Sema:        semgroup.NewGroup(context.Background(), 1),
+		}
+
+		err := containerImage.Fragments(context.Background(), func(sources.Fragment, error) error { return nil })
+		require.Error(t, err)
+		assert.NotContains(t, err.Error(), "docker")
+	})
+}
+
+func TestParseImageRef(t *testing.T) {
+	tests := map[string]string{
+		"quay.io/leaktk/fake-leaks:v2":          "docker",
+		"localhost:5000/fake-leaks:v2":          "docker",
+		"docker://quay.io/leaktk/fake-leaks:v2": "docker",
+		"oci:/tmp/layout:v2":                    "oci",
+		"oci-archive:/tmp/image.tar":            "oci-archive",
+	}
+
+	for rawImageRef, transport := range tests {
+		imageRef, err := parseImageRef(rawImageRef)
+		require.NoError(t, err, rawImageRef)
+		assert.Equal(t, transport, imageRef.Transport().Name(), rawImageRef)
+	}
+}
+
+func TestCloseBlob(t *testing.T) {
+	var connections atomic.Int32
+	blob := strings.Repeat("x", 200*1024)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, blob)
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client := server.Client()
+	for range 3 {
+		response, err := client.Get(server.URL)
+		require.NoError(t, err)
+
+		// Only read part of the blob like an extractor stopping at the end marker
+		_, err = io.ReadFull(response.Body, make([]byte, 10))
+		require.NoError(t, err)
+		closeBlob(response.Body, "sha256:test")
+	}
+
+	assert.Equal(t, int32(1), connections.Load())
+}
@@ -0,0 +1,104 @@
+package betterleaks
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// minRatioCheckBytes keeps small files from tripping MaxRatio since the first
+// reads from a compressed stream can expand a lot before it settles
+const minRatioCheckBytes = 1 << 20
+
+// ErrDecompressionLimit is returned when reading data expanded from a
+// compressed stream would go over the DecompressionLimits
+var ErrDecompressionLimit = errors.New("decompression limit exceeded")
+
+// DecompressionLimits bounds how much data can be expanded from compressed
+// container image layers. Zero values mean no limit.
+type DecompressionLimits struct {
+	// MaxBytes limits the decompressed size of each file in a layer
+	MaxBytes int64
+	// MaxRatio limits the decompressed size of a layer relative to how much
+	// of its compressed blob has been read
+	MaxRatio int64
+}
+
+// decompressionLimiter tracks the compressed and decompressed bytes read from
+// a single layer. Layers are read sequentially so it isn't safe to share.
+type decompressionLimiter struct {
+	limits       DecompressionLimits
+	compressed   int64
+	decompressed int64
+}
+
+func newDecompressionLimiter(limits DecompressionLimits) *decompressionLimiter {
+	return &decompressionLimiter{limits: limits}
+}
+
+// compressedReader counts the bytes read from the compressed blob
+func (l *decompressionLimiter) compressedReader(reader io.Reader) io.Reader {
+	return &countingReader{count: &l.compressed, reader: reader}
+}
+
+// decompressedReader returns a reader for a file expanded from the blob that
+// fails with ErrDecompressionLimit once a limit is exceeded
+func (l *decompressionLimiter) decompressedReader(reader io.Reader, path, digest string) io.Reader {
+	return &limitedReader{digest: digest, limiter: l, path: path, reader: reader}
+}
+
+func (l *decompressionLimiter) check(fileSize int64) error {
+	if l.limits.MaxBytes > 0 && fileSize > l.limits.MaxBytes {
+		return fmt.Errorf("%w: size=%d max_decompressed_bytes=%d", ErrDecompressionLimit, fileSize, l.limits.MaxBytes)
+	}
+
+	if l.limits.MaxRatio > 0 && l.decompressed > minRatioCheckBytes && l.compressed > 0 {
+		if ratio := l.decompressed / l.compressed; ratio > l.limits.MaxRatio {
+			return fmt.Errorf("%w: ratio=%d max_decompression_ratio=%d", ErrDecompressionLimit, ratio, l.limits.MaxRatio)
+		}
+	}
+
+	return nil
+}
+
+type countingReader struct {
+	count  *int64
+	reader io.Reader
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	*r.count += int64(n)
+
+	return n, err
+}
+
+type limitedReader struct {
+	digest  string
+	err     error
+	limiter *decompressionLimiter
+	path    string
+	read    int64
+	reader  io.Reader
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if r.err != nil {
+		return 0, r.err
+	}
+
+	n, err := r.reader.Read(p)
+	r.read += int64(n)
+	r.limiter.decompressed += int64(n)
+
+	if limitErr := r.limiter.check(r.read); limitErr != nil {
+		logger.Warning("aborting file extraction: %v path=%q digest=%q", limitErr, r.path, r.digest)
+		r.err = limitErr
+
+		return 0, r.err
+	}
+
+	return n, err
+}
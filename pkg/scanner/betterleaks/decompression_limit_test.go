@@ -0,0 +1,53 @@
+package betterleaks
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecompressionLimiter(t *testing.T) {
+	t.Run("MaxBytes", func(t *testing.T) {
+		limiter := newDecompressionLimiter(DecompressionLimits{MaxBytes: 10})
+
+		data, err := io.ReadAll(limiter.decompressedReader(strings.NewReader("0123456789"), "small", "sha256:test"))
+		require.NoError(t, err)
+		assert.Equal(t, "0123456789", string(data))
+
+		// The limit applies to each file
+		_, err = io.ReadAll(limiter.decompressedReader(strings.NewReader("0123456789A"), "large", "sha256:test"))
+		assert.ErrorIs(t, err, ErrDecompressionLimit)
+		assert.ErrorContains(t, err, "max_decompressed_bytes=10")
+	})
+
+	t.Run("MaxRatio", func(t *testing.T) {
+		var compressed bytes.Buffer
+		writer := gzip.NewWriter(&compressed)
+		_, err := writer.Write(make([]byte, 8*minRatioCheckBytes))
+		require.NoError(t, err)
+		require.NoError(t, writer.Close())
+
+		read := func(limits DecompressionLimits) (int, error) {
+			limiter := newDecompressionLimiter(limits)
+			gzipReader, err := gzip.NewReader(limiter.compressedReader(bytes.NewReader(compressed.Bytes())))
+			require.NoError(t, err)
+
+			data, err := io.ReadAll(limiter.decompressedReader(gzipReader, "zeros", "sha256:test"))
+
+			return len(data), err
+		}
+
+		_, err = read(DecompressionLimits{MaxRatio: 100})
+		assert.ErrorIs(t, err, ErrDecompressionLimit)
+		assert.ErrorContains(t, err, "max_decompression_ratio=100")
+
+		size, err := read(DecompressionLimits{})
+		require.NoError(t, err)
+		assert.Equal(t, 8*minRatioCheckBytes, size)
+	})
+}
@@ -0,0 +1,45 @@
+package betterleaks
+
+import (
+	"context"
+	"strings"
+
+	"github.com/betterleaks/betterleaks/sources"
+)
+
+// diffPathsSource drops the fragments of files that aren't in paths. The git
+// diff source always diffs the whole working tree so this is how staged and
+// unstaged scans get limited to a pathspec.
+type diffPathsSource struct {
+	paths  map[string]struct{}
+	source sources.Source
+}
+
+func newDiffPathsSource(source sources.Source, paths []string) *diffPathsSource {
+	s := &diffPathsSource{
+		paths:  make(map[string]struct{}, len(paths)),
+		source: source,
+	}
+
+	for _, path := range paths {
+		s.paths[path] = struct{}{}
+	}
+
+	return s
+}
+
+func (s *diffPathsSource) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	return s.source.Fragments(ctx, func(fragment sources.Fragment, err error) error {
+		if err != nil {
+			return yield(fragment, err)
+		}
+
+		// Files inside of archives are kept if the archive is
+		path, _, _ := strings.Cut(fragment.FilePath, sources.InnerPathSeparator)
+		if _, ok := s.paths[path]; !ok {
+			return nil
+		}
+
+		return yield(fragment, err)
+	})
+}
@@ -0,0 +1,165 @@
+package betterleaks
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/betterleaks/betterleaks/config"
+	"github.com/betterleaks/betterleaks/sources"
+	"github.com/fatih/semgroup"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// defaultFilesConcurrency matches the size of the detector's Sema
+const defaultFilesConcurrency = 40
+
+// Files is like sources.Files but can skip files that haven't been modified
+// since a certain time and reports its progress
+type Files struct {
+	Config          *config.Config
+	Concurrency     int
+	FollowSymlinks  bool
+	MaxArchiveDepth int
+	Path            string
+	Progress        *FilesProgress
+	Sema            *semgroup.Group
+	Since           *time.Time
+}
+
+// FilesProgress counts the files a Files source has found and finished
+// scanning. It's safe to read while the scan is running.
+type FilesProgress struct {
+	scanned atomic.Int64
+	found   atomic.Int64
+	walked  atomic.Bool
+}
+
+// Scanned returns how many files have been scanned so far
+func (p *FilesProgress) Scanned() int64 {
+	return p.scanned.Load()
+}
+
+// Total returns how many files there are to scan and false if the source is
+// still walking the tree and more could be found
+func (p *FilesProgress) Total() (int64, bool) {
+	// Check walked first so the count can't be from before the walk finished
+	walked := p.walked.Load()
+	return p.found.Load(), walked
+}
+
+func (s *Files) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	progress := s.Progress
+	if progress == nil {
+		progress = &FilesProgress{}
+	}
+
+	concurrency := s.Concurrency
+	if concurrency < 1 {
+		concurrency = defaultFilesConcurrency
+	}
+
+	// Limits how many files are open at once. It's separate from s.Sema
+	// since sources.Files uses that for each file and would block on it.
+	slots := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var scanErr error
+
+	err := filepath.WalkDir(s.Path, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			logger.Warning("skipping path: %v path=%q", err, path)
+			return nil
+		}
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if d.IsDir() {
+			if path != s.Path && allowedPath(s.Config, path) {
+				logger.Debug("skipping directory: global allowlist path=%q", path)
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		// os.Stat is used so symlinks are filtered by their target's mod time
+		if s.Since != nil {
+			if info, err := os.Stat(path); err == nil && info.ModTime().Before(*s.Since) {
+				logger.Debug("skipping file: not modified since since=%q path=%q", s.Since.Format(time.DateOnly), path)
+				return nil
+			}
+		}
+
+		progress.found.Add(1)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case slots <- struct{}{}:
+		}
+
+		wg.Add(1)
+		go func() {
+			defer func() {
+				progress.scanned.Add(1)
+				<-slots
+				wg.Done()
+			}()
+
+			if err := s.files(path).Fragments(ctx, yield); err != nil {
+				mutex.Lock()
+				if scanErr == nil {
+					scanErr = err
+				}
+				mutex.Unlock()
+			}
+		}()
+
+		return nil
+	})
+
+	progress.walked.Store(err == nil)
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+
+	return scanErr
+}
+
+// files returns a sources.Files for path with the rest of the settings from s
+func (s *Files) files(path string) *sources.Files {
+	return &sources.Files{
+		Config:          s.Config,
+		FollowSymlinks:  s.FollowSymlinks,
+		MaxArchiveDepth: s.MaxArchiveDepth,
+		Path:            path,
+		Sema:            s.Sema,
+	}
+}
+
+// allowedPath reports whether any of the global allowlists allow path, the
+// same way sources.Files checks the directories it walks
+func allowedPath(cfg *config.Config, path string) bool {
+	if cfg == nil {
+		return false
+	}
+
+	for _, allowlist := range cfg.Allowlists {
+		if allowlist.PathAllowed(path) || allowlist.PathAllowed(filepath.ToSlash(path)) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,151 @@
+package betterleaks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScanFiles(t *testing.T) {
+	cfg, err := ParseConfig(`
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue'''
+`)
+	require.NoError(t, err)
+
+	sourcePath := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(sourcePath, "dir"), 0700))
+	oldPath := filepath.Join(sourcePath, "dir", "old.txt")
+	newPath := filepath.Join(sourcePath, "new.txt")
+	require.NoError(t, os.WriteFile(oldPath, []byte("secretvalue\n"), 0600))
+	require.NoError(t, os.WriteFile(newPath, []byte("secretvalue\n"), 0600))
+
+	oldTime := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, os.Chtimes(oldPath, oldTime, oldTime))
+
+	t.Run("AllFiles", func(t *testing.T) {
+		findings, err := ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), sourcePath, FilesScanOpts{})
+		require.NoError(t, err)
+		assert.Len(t, findings, 2)
+	})
+
+	t.Run("Since", func(t *testing.T) {
+		findings, err := ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), sourcePath, FilesScanOpts{
+			Since: "2021-01-01",
+		})
+		require.NoError(t, err)
+		require.Len(t, findings, 1)
+		assert.Equal(t, newPath, findings[0].File)
+	})
+
+	t.Run("Progress", func(t *testing.T) {
+		progress := &FilesProgress{}
+		findings, err := ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), sourcePath, FilesScanOpts{
+			Concurrency: 1,
+			Progress:    progress,
+		})
+		require.NoError(t, err)
+		assert.Len(t, findings, 2)
+		assert.Equal(t, int64(2), progress.Scanned())
+
+		total, walked := progress.Total()
+		assert.True(t, walked)
+		assert.Equal(t, int64(2), total)
+	})
+
+	t.Run("ProgressSince", func(t *testing.T) {
+		progress := &FilesProgress{}
+		_, err := ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), sourcePath, FilesScanOpts{
+			Progress: progress,
+			Since:    "2021-01-01",
+		})
+		require.NoError(t, err)
+
+		// Files skipped for being too old aren't counted
+		total, _ := progress.Total()
+		assert.Equal(t, int64(1), total)
+		assert.Equal(t, int64(1), progress.Scanned())
+	})
+
+	t.Run("AllowlistedDir", func(t *testing.T) {
+		allowlistCfg, err := ParseConfig(`
+[[allowlists]]
+paths = ['''/dir$''']
+
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue'''
+`)
+		require.NoError(t, err)
+
+		progress := &FilesProgress{}
+		findings, err := ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *allowlistCfg), sourcePath, FilesScanOpts{
+			Progress: progress,
+		})
+		require.NoError(t, err)
+		require.Len(t, findings, 1)
+		assert.Equal(t, newPath, findings[0].File)
+		assert.Equal(t, int64(1), progress.Scanned())
+	})
+
+	t.Run("InvalidSince", func(t *testing.T) {
+		_, err := ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), sourcePath, FilesScanOpts{
+			Since: "yesterday",
+		})
+		require.Error(t, err)
+	})
+}
+
+func TestBinaryFilter(t *testing.T) {
+	cfg, err := ParseConfig(`
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue'''
+`)
+	require.NoError(t, err)
+
+	sourcePath := t.TempDir()
+	textPath := filepath.Join(sourcePath, "text.txt")
+	require.NoError(t, os.WriteFile(textPath, []byte("secretvalue\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(sourcePath, "data.bin"), []byte("\x00\x01secretvalue\n"), 0600))
+
+	t.Run("Disabled", func(t *testing.T) {
+		findings, err := ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), sourcePath, FilesScanOpts{})
+		require.NoError(t, err)
+		assert.Len(t, findings, 2)
+	})
+
+	t.Run("SkipsBinaryFiles", func(t *testing.T) {
+		binaryFilter := NewBinaryFilter()
+		findings, err := ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), sourcePath, FilesScanOpts{
+			BinaryFilter: binaryFilter,
+		})
+		require.NoError(t, err)
+		require.Len(t, findings, 1)
+		assert.Equal(t, textPath, findings[0].File)
+		assert.Equal(t, 1, binaryFilter.Skipped())
+	})
+
+	t.Run("SamePathInDifferentCommits", func(t *testing.T) {
+		binaryFilter := NewBinaryFilter()
+		source := binaryFilter.Wrap(&fragmentsSource{fragments: []sources.Fragment{
+			{Raw: "\x00\x01secretvalue\n", FilePath: "data", CommitSHA: "layer1", StartLine: 1},
+			{Raw: "secretvalue\n", FilePath: "data", CommitSHA: "layer2", StartLine: 1},
+		}})
+
+		var commits []string
+		require.NoError(t, source.Fragments(t.Context(), func(fragment sources.Fragment, err error) error {
+			commits = append(commits, fragment.CommitSHA)
+			return err
+		}))
+		assert.Equal(t, []string{"layer2"}, commits)
+		assert.Equal(t, 1, binaryFilter.Skipped())
+	})
+}
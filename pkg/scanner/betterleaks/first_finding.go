@@ -0,0 +1,86 @@
+package betterleaks
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/report"
+	"github.com/betterleaks/betterleaks/sources"
+)
+
+// errFirstFinding is why a scan's context is canceled when it stops at its
+// first finding so it can be told apart from a timeout
+var errFirstFinding = errors.New("stopped at the first finding")
+
+type firstFindingKey struct{}
+
+// FirstFinding stops the scans run with its context as soon as the rules
+// report a finding that would be kept. The findings from the fragment that
+// matched are kept.
+type FirstFinding struct {
+	keep    func(report.Finding) bool
+	stopped atomic.Bool
+}
+
+// NewFirstFinding returns an initialized FirstFinding. keep reports whether a
+// finding would still be reported after everything that filters findings
+// (e.g. baselines and ignores) so the scan doesn't stop at one that won't be.
+// A nil keep stops at any finding.
+func NewFirstFinding(keep func(report.Finding) bool) *FirstFinding {
+	return &FirstFinding{keep: keep}
+}
+
+// Context returns a copy of ctx that the scan functions stop at the first
+// finding with
+func (f *FirstFinding) Context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, firstFindingKey{}, f)
+}
+
+// Stopped reports whether a scan stopped before it was done
+func (f *FirstFinding) Stopped() bool {
+	return f.stopped.Load()
+}
+
+// firstFindingFrom returns the FirstFinding set on the context, if any
+func firstFindingFrom(ctx context.Context) (*FirstFinding, bool) {
+	firstFinding, ok := ctx.Value(firstFindingKey{}).(*FirstFinding)
+	return firstFinding, ok
+}
+
+// firstFindingSource runs the detector on each fragment itself so it knows
+// when there's a finding to keep, then cancels the scan
+type firstFindingSource struct {
+	detector *detect.Detector
+	source   sources.Source
+	keep     func(report.Finding) bool
+	stop     func()
+}
+
+func (s *firstFindingSource) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	return s.source.Fragments(ctx, func(fragment sources.Fragment, err error) error {
+		// Drop anything the source yields after the scan stops
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if err != nil {
+			return yield(fragment, err)
+		}
+
+		var kept bool
+		for _, finding := range s.detector.DetectContext(ctx, fragment) {
+			s.detector.AddFinding(finding)
+			kept = kept || s.keep == nil || s.keep(finding)
+		}
+
+		if kept {
+			s.stop()
+		}
+
+		// Only pass on the commit so the detector still counts it without
+		// detecting the fragment again
+		return yield(sources.Fragment{CommitSHA: fragment.CommitSHA}, nil)
+	})
+}
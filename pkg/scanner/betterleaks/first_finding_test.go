@@ -0,0 +1,106 @@
+package betterleaks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/report"
+	"github.com/betterleaks/betterleaks/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fragmentsSource yields its fragments in order and counts how many it did
+type fragmentsSource struct {
+	fragments []sources.Fragment
+	yielded   int
+}
+
+func (s *fragmentsSource) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	for _, fragment := range s.fragments {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		s.yielded++
+		if err := yield(fragment, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestFirstFinding(t *testing.T) {
+	cfg, err := ParseConfig(`
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue[0-9]+'''
+`)
+	require.NoError(t, err)
+
+	newSource := func() *fragmentsSource {
+		return &fragmentsSource{fragments: []sources.Fragment{
+			{Raw: "nothing here", FilePath: "a.txt"},
+			{Raw: "token = secretvalue1", FilePath: "b.txt"},
+			{Raw: "still nothing", FilePath: "c.txt"},
+			{Raw: "token = secretvalue2", FilePath: "d.txt"},
+		}}
+	}
+
+	t.Run("StopsAtFirstFinding", func(t *testing.T) {
+		firstFinding := NewFirstFinding(nil)
+		source := newSource()
+
+		findings, err := detectSource(firstFinding.Context(t.Context()), detect.NewDetectorContext(t.Context(), *cfg), source)
+		require.NoError(t, err)
+		require.Len(t, findings, 1)
+		assert.Equal(t, "secretvalue1", findings[0].Secret)
+		assert.Equal(t, 2, source.yielded)
+		assert.True(t, firstFinding.Stopped())
+	})
+
+	t.Run("StopsAtFirstKeptFinding", func(t *testing.T) {
+		firstFinding := NewFirstFinding(func(finding report.Finding) bool {
+			return finding.Secret != "secretvalue1"
+		})
+		source := newSource()
+
+		findings, err := detectSource(firstFinding.Context(t.Context()), detect.NewDetectorContext(t.Context(), *cfg), source)
+		require.NoError(t, err)
+		require.Len(t, findings, 2)
+		assert.Equal(t, "secretvalue2", findings[1].Secret)
+		assert.Equal(t, 4, source.yielded)
+		assert.True(t, firstFinding.Stopped())
+	})
+
+	t.Run("NoFindings", func(t *testing.T) {
+		firstFinding := NewFirstFinding(nil)
+		source := &fragmentsSource{fragments: newSource().fragments[:1]}
+
+		findings, err := detectSource(firstFinding.Context(t.Context()), detect.NewDetectorContext(t.Context(), *cfg), source)
+		require.NoError(t, err)
+		assert.Empty(t, findings)
+		assert.False(t, firstFinding.Stopped())
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		source := newSource()
+
+		findings, err := detectSource(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), source)
+		require.NoError(t, err)
+		assert.Len(t, findings, 2)
+		assert.Equal(t, 4, source.yielded)
+	})
+
+	t.Run("TimeoutIsStillAnError", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		firstFinding := NewFirstFinding(nil)
+
+		_, err := detectSource(firstFinding.Context(ctx), detect.NewDetectorContext(t.Context(), *cfg), newSource())
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.False(t, firstFinding.Stopped())
+	})
+}
@@ -0,0 +1,85 @@
+package betterleaks
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/betterleaks/betterleaks/config"
+	"github.com/betterleaks/betterleaks/sources"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// gitArchiveName is what the tarball is called while it's being extracted so
+// its format can be identified from the name
+const gitArchiveName = "archive.tar.gz"
+
+// GitArchive scans the tree in a tarball of a git ref (e.g. from a forge's
+// archive endpoint) without its history. Paths are relative to the repo root.
+type GitArchive struct {
+	// Client is used for the request and defaults to the shared client
+	Client          *http.Client
+	Config          *config.Config
+	MaxArchiveDepth int
+	RawURL          string
+	// UserAgent replaces the default User-Agent for the request
+	UserAgent string
+}
+
+func (s *GitArchive) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.RawURL, nil)
+	if err != nil {
+		return fmt.Errorf("error creating HTTP GET request: %w", err)
+	}
+	if len(s.UserAgent) > 0 {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+	resp, err := httpClient(s.Client).Do(req) // #nosec G704
+	if err != nil {
+		return fmt.Errorf("HTTP GET error: %w", err)
+	}
+
+	defer (func() {
+		if err := resp.Body.Close(); err != nil {
+			logger.Debug("error closing git archive response body: %v url=%q", err, s.RawURL)
+		}
+	})()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status code: status_code=%d", resp.StatusCode)
+	}
+
+	file := &sources.File{
+		Config:  s.Config,
+		Content: resp.Body,
+		// The tarball itself shouldn't count against the archive depth
+		MaxArchiveDepth: s.MaxArchiveDepth + 1,
+		Path:            gitArchiveName,
+	}
+
+	return file.Fragments(ctx, func(fragment sources.Fragment, err error) error {
+		fragment.FilePath = gitArchivePath(fragment.FilePath)
+		if len(fragment.WindowsFilePath) > 0 {
+			fragment.WindowsFilePath = gitArchivePath(fragment.WindowsFilePath)
+		}
+
+		return yield(fragment, err)
+	})
+}
+
+// gitArchivePath removes the tarball's name and the top level directory
+// forges put the tree in (e.g. "repo-main/") from a path in the tarball
+func gitArchivePath(path string) string {
+	innerPath, ok := strings.CutPrefix(path, gitArchiveName+sources.InnerPathSeparator)
+	if !ok {
+		return path
+	}
+
+	if _, repoPath, ok := strings.Cut(innerPath, "/"); ok {
+		return repoPath
+	}
+
+	return innerPath
+}
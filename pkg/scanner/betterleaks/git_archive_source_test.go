@@ -0,0 +1,79 @@
+package betterleaks
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGitArchive(t *testing.T) {
+	var tarball bytes.Buffer
+	gzipWriter := gzip.NewWriter(&tarball)
+	tarWriter := tar.NewWriter(gzipWriter)
+
+	// Forges put the tree in a top level directory named after the repo and ref
+	files := []struct {
+		name    string
+		content string
+	}{
+		{"fake-leaks-main/config.txt", "token = secretvalue1"},
+		{"fake-leaks-main/nested/keys.txt", "token = secretvalue2"},
+	}
+	for _, file := range files {
+		require.NoError(t, tarWriter.WriteHeader(&tar.Header{Name: file.name, Mode: 0600, Size: int64(len(file.content))}))
+		_, err := tarWriter.Write([]byte(file.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tarWriter.Close())
+	require.NoError(t, gzipWriter.Close())
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/leaktk/fake-leaks/tar.gz/main" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/x-gzip")
+		_, err := w.Write(tarball.Bytes())
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	t.Run("TreeFiles", func(t *testing.T) {
+		source := GitArchive{RawURL: ts.URL + "/leaktk/fake-leaks/tar.gz/main"}
+
+		fragments := make(map[string]string)
+		err := source.Fragments(context.Background(), func(fragment sources.Fragment, err error) error {
+			fragments[fragment.FilePath] += fragment.Raw
+
+			return err
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"config.txt":      "token = secretvalue1",
+			"nested/keys.txt": "token = secretvalue2",
+		}, fragments)
+	})
+
+	t.Run("MissingRef", func(t *testing.T) {
+		source := GitArchive{RawURL: ts.URL + "/leaktk/fake-leaks/tar.gz/missing"}
+
+		err := source.Fragments(context.Background(), func(sources.Fragment, error) error { return nil })
+		assert.ErrorContains(t, err, "status_code=404")
+	})
+}
+
+func TestGitArchivePath(t *testing.T) {
+	assert.Equal(t, "a/b.txt", gitArchivePath("archive.tar.gz!repo-main/a/b.txt"))
+	assert.Equal(t, "c.zip!d.txt", gitArchivePath("archive.tar.gz!repo-main/c.zip!d.txt"))
+	assert.Equal(t, "other.txt", gitArchivePath("other.txt"))
+}
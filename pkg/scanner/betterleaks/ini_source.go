@@ -0,0 +1,64 @@
+package betterleaks
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/betterleaks/betterleaks/config"
+	"github.com/betterleaks/betterleaks/sources"
+	"gopkg.in/ini.v1"
+)
+
+// INI is a source for yielding fragments from the values in ini data. Each
+// fragment's path is the section and key escaped like a JSON pointer (e.g.
+// /section/key) and keys before the first section are at the root (e.g. /key).
+type INI struct {
+	Config          *config.Config
+	MaxArchiveDepth int
+	RawData         []byte
+}
+
+// Fragments yields the fragments contained in this resource
+func (s *INI) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	data, err := ini.LoadSources(ini.LoadOptions{
+		AllowBooleanKeys: true,
+		AllowShadows:     true,
+		// Keep values like p#ssword intact while still removing comments
+		SpaceBeforeInlineComment: true,
+		SkipUnrecognizableLines:  true,
+	}, s.RawData)
+	if err != nil {
+		return fmt.Errorf("could not parse ini data: %w", err)
+	}
+
+	for _, section := range data.Sections() {
+		var sectionPath string
+		if section.Name() != ini.DefaultSection {
+			sectionPath = "/" + jsonPointerEscaper.Replace(section.Name())
+		}
+
+		for _, key := range section.Keys() {
+			path := sectionPath + "/" + jsonPointerEscaper.Replace(key.Name())
+
+			for _, value := range key.ValueWithShadows() {
+				if err := ctx.Err(); err != nil {
+					return err
+				}
+
+				file := &sources.File{
+					Config:          s.Config,
+					Content:         strings.NewReader(value),
+					MaxArchiveDepth: s.MaxArchiveDepth,
+					Path:            path,
+				}
+
+				if err := file.Fragments(ctx, yield); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
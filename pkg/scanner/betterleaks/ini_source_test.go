@@ -0,0 +1,38 @@
+package betterleaks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestINI(t *testing.T) {
+	iniData := &INI{
+		RawData: []byte(`top = level
+[database]
+password = p#ssword ; the inline comment is removed
+user = admin
+[a/b]
+token = first
+token = second
+`),
+	}
+
+	fragments := map[string][]string{}
+	err := iniData.Fragments(context.Background(), func(fragment sources.Fragment, err error) error {
+		fragments[fragment.FilePath] = append(fragments[fragment.FilePath], fragment.Raw)
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string][]string{
+		"/top":               {"level"},
+		"/database/password": {"p#ssword"},
+		"/database/user":     {"admin"},
+		"/a~1b/token":        {"first", "second"},
+	}, fragments)
+}
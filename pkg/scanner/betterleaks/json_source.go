@@ -6,7 +6,6 @@ import (
 	"fmt"
 	"io"
 	"net/http"
-	"path/filepath"
 	"regexp"
 	"strconv"
 	"strings"
@@ -15,7 +14,6 @@ import (
 	"github.com/betterleaks/betterleaks/sources"
 
 	"github.com/leaktk/leaktk/pkg/fs"
-	httpclient "github.com/leaktk/leaktk/pkg/http"
 	"github.com/leaktk/leaktk/pkg/logger"
 )
 
@@ -24,17 +22,25 @@ var urlRegexp = regexp.MustCompile(`^https?:\/\/\S+$`)
 // JSON is a source for yielding fragments from strings in json data
 // and from URLs contained in the data that match FetchURLPatterns
 type JSON struct {
+	// Client is used for fetching URLs and defaults to the shared client
+	Client           *http.Client
 	Config           *config.Config
 	FetchURLPatterns []string
 	MaxArchiveDepth  int
 	Path             string
 	RawMessage       json.RawMessage
-	data             any
+	// UserAgent replaces the default User-Agent for fetching URLs
+	UserAgent string
+	data      any
 }
 
+// jsonPointerEscaper escapes reference tokens as described in RFC 6901
+var jsonPointerEscaper = strings.NewReplacer("~", "~0", "/", "~1")
+
 type jsonNode struct {
-	path  string
-	value any
+	// pointer is the RFC 6901 JSON pointer to the value (e.g. /foo/0/bar)
+	pointer string
+	value   any
 }
 
 // Fragments yields the fragments contained in this resource
@@ -45,7 +51,7 @@ func (s *JSON) Fragments(ctx context.Context, yield sources.FragmentsFunc) error
 		}
 	}
 
-	return s.walkAndYield(ctx, jsonNode{path: s.Path, value: s.data}, yield)
+	return s.walkAndYield(ctx, jsonNode{value: s.data}, yield)
 }
 
 func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sources.FragmentsFunc) error {
@@ -53,8 +59,8 @@ func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sou
 	case map[string]any:
 		for key, value := range obj {
 			childNode := jsonNode{
-				path:  s.JoinPath(currentNode.path, key),
-				value: value,
+				pointer: currentNode.pointer + "/" + jsonPointerEscaper.Replace(key),
+				value:   value,
 			}
 			if err := s.walkAndYield(ctx, childNode, yield); err != nil {
 				return err
@@ -65,8 +71,8 @@ func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sou
 	case []any:
 		for i, value := range obj {
 			childNode := jsonNode{
-				path:  s.JoinPath(currentNode.path, strconv.Itoa(i)),
-				value: value,
+				pointer: currentNode.pointer + "/" + strconv.Itoa(i),
+				value:   value,
 			}
 			if err := s.walkAndYield(ctx, childNode, yield); err != nil {
 				return err
@@ -75,17 +81,21 @@ func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sou
 
 		return nil
 	case string:
-		if s.shouldFetchURL(currentNode.path) && urlRegexp.MatchString(obj) {
-			client := httpclient.NewClient()
+		path := s.FilePath(currentNode.pointer)
+
+		if s.shouldFetchURL(currentNode.pointer) && urlRegexp.MatchString(obj) {
 			req, err := http.NewRequestWithContext(ctx, "GET", obj, nil)
 			if err != nil {
-				logger.Error("json fetch url failed: %v path=%q", err, currentNode.path)
+				logger.Error("json fetch url failed: %v path=%q", err, path)
 
 				return nil
 			}
-			resp, err := client.Do(req) // #nosec G704
+			if len(s.UserAgent) > 0 {
+				req.Header.Set("User-Agent", s.UserAgent)
+			}
+			resp, err := httpClient(s.Client).Do(req) // #nosec G704
 			if err != nil {
-				logger.Error("json fetch url failed: %v path=%q", err, currentNode.path)
+				logger.Error("json fetch url failed: %v path=%q", err, path)
 
 				return nil
 			}
@@ -93,13 +103,13 @@ func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sou
 				logger.Error(
 					"json fetch url failed with an unexpected status code: status_code=%d path=%q",
 					resp.StatusCode,
-					currentNode.path,
+					path,
 				)
 				file := &sources.File{
 					Config:          s.Config,
 					Content:         strings.NewReader(obj),
 					MaxArchiveDepth: s.MaxArchiveDepth,
-					Path:            currentNode.path,
+					Path:            path,
 				}
 
 				return file.Fragments(ctx, yield)
@@ -114,15 +124,16 @@ func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sou
 			if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
 				data, err := io.ReadAll(resp.Body)
 				if err != nil {
-					logger.Error("could not read fetched json response body: %s path=%q", err, currentNode.path)
+					logger.Error("could not read fetched json response body: %s path=%q", err, path)
 
 					return nil
 				}
 
 				jsonData := &JSON{
+					Client:          s.Client,
 					Config:          s.Config,
 					MaxArchiveDepth: s.MaxArchiveDepth,
-					Path:            currentNode.path,
+					Path:            path,
 					RawMessage:      data,
 				}
 
@@ -130,7 +141,7 @@ func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sou
 			}
 
 			file := &sources.File{
-				Path:    currentNode.path,
+				Path:    path,
 				Content: resp.Body,
 			}
 
@@ -138,7 +149,7 @@ func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sou
 		}
 
 		file := &sources.File{
-			Path:    currentNode.path,
+			Path:    path,
 			Content: strings.NewReader(obj),
 		}
 
@@ -148,19 +159,30 @@ func (s *JSON) walkAndYield(ctx context.Context, currentNode jsonNode, yield sou
 	}
 }
 
-func (s *JSON) JoinPath(root, child string) string {
-	if len(s.Path) > 0 && s.Path == root {
-		return root + sources.InnerPathSeparator + child
+// FilePath returns the path reported for the value at the JSON pointer. When
+// Path is set (e.g. for JSON fetched from a URL), the pointer is added to it
+// as an inner path.
+func (s *JSON) FilePath(pointer string) string {
+	if len(s.Path) == 0 {
+		return pointer
 	}
 
-	return filepath.Join(root, child)
+	if len(pointer) == 0 {
+		return s.Path
+	}
+
+	return s.Path + sources.InnerPathSeparator + pointer
 }
 
-func (s *JSON) shouldFetchURL(path string) bool {
+// shouldFetchURL reports if the pointer matches a FetchURLPatterns pattern.
+// Patterns don't start with a "/" so it's trimmed from the pointer.
+func (s *JSON) shouldFetchURL(pointer string) bool {
 	if len(s.FetchURLPatterns) == 0 {
 		return false
 	}
 
+	path := strings.TrimPrefix(pointer, "/")
+
 	for _, pattern := range s.FetchURLPatterns {
 		if fs.Match(pattern, path) {
 			return true
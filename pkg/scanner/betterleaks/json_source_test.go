@@ -66,14 +66,14 @@ func TestJSON(t *testing.T) {
 
 	require.NoError(t, err)
 	expected := map[string]string{
-		"foo":         "bar",
-		"baz/0":       "bop",
-		"baz/5/hello": "there",
-		"url":         "hello world",
-		"nested/url" + sources.InnerPathSeparator + "hello": "world",
-		"skipped": "https://example.com",
-		"invalid": "https://raw.githubusercontent.com/leaktk/fake-leaks/main/this-url-doesnt-exist-8UaehX5b24MzZiaeJ428FK5R",
-		"jsonurl" + sources.InnerPathSeparator + "quay.io/auth": "SUPER SECRET",
+		"/foo":         "bar",
+		"/baz/0":       "bop",
+		"/baz/5/hello": "there",
+		"/url":         "hello world",
+		"/nested/url" + sources.InnerPathSeparator + "/hello": "world",
+		"/skipped": "https://example.com",
+		"/invalid": "https://raw.githubusercontent.com/leaktk/fake-leaks/main/this-url-doesnt-exist-8UaehX5b24MzZiaeJ428FK5R",
+		"/jsonurl" + sources.InnerPathSeparator + "/quay.io/auth": "SUPER SECRET",
 	}
 
 	assert.Len(t, fragments, 8)
@@ -83,3 +83,33 @@ func TestJSON(t *testing.T) {
 		assert.Equal(t, expected[fragment.FilePath], fragment.Raw, "path=%s", fragment.FilePath)
 	}
 }
+
+func TestJSONPointers(t *testing.T) {
+	jsonData := &JSON{
+		RawMessage: json.RawMessage(`{
+			"a/b": {"c~d": "escaped"},
+			"list": [["nested"], {"": "empty key"}]
+		}`),
+	}
+
+	fragments := map[string]string{}
+	err := jsonData.Fragments(context.Background(), func(fragment sources.Fragment, err error) error {
+		fragments[fragment.FilePath] = fragment.Raw
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/a~1b/c~0d": "escaped",
+		"/list/0/0":  "nested",
+		"/list/1/":   "empty key",
+	}, fragments)
+
+	t.Run("WithPath", func(t *testing.T) {
+		jsonData := &JSON{Path: "manifest"}
+
+		assert.Equal(t, "manifest", jsonData.FilePath(""))
+		assert.Equal(t, "manifest"+sources.InnerPathSeparator+"/layers/0", jsonData.FilePath("/layers/0"))
+	})
+}
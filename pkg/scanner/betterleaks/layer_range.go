@@ -0,0 +1,89 @@
+package betterleaks
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LayerRange selects the container image layers to scan by their position,
+// counting the non-empty layers from 1 for the base layer. Negative positions
+// count back from the newest layer (-1). Zero means the range is open on that
+// side.
+type LayerRange struct {
+	Start int
+	End   int
+}
+
+// ParseLayerRange parses ranges formatted like "N..M", "N..", "..M" or "N"
+// where N and M are inclusive positions (e.g. "-3.." for the last 3 layers)
+func ParseLayerRange(rawRange string) (*LayerRange, error) {
+	rawStart, rawEnd, isRange := strings.Cut(strings.TrimSpace(rawRange), "..")
+	if !isRange {
+		rawEnd = rawStart
+	}
+
+	layerRange := &LayerRange{}
+	var err error
+
+	if layerRange.Start, err = parseLayerPosition(rawStart, isRange); err != nil {
+		return nil, err
+	}
+
+	if layerRange.End, err = parseLayerPosition(rawEnd, isRange); err != nil {
+		return nil, err
+	}
+
+	if layerRange.Start == 0 && layerRange.End == 0 {
+		return nil, errors.New("layer range needs a start or end")
+	}
+
+	// Positions with the same sign can be checked before knowing the count
+	sameSign := (layerRange.Start > 0) == (layerRange.End > 0)
+	if layerRange.Start != 0 && layerRange.End != 0 && sameSign && layerRange.Start > layerRange.End {
+		return nil, fmt.Errorf("layer range start is after its end: start=%d end=%d", layerRange.Start, layerRange.End)
+	}
+
+	return layerRange, nil
+}
+
+func parseLayerPosition(rawPosition string, optional bool) (int, error) {
+	if len(rawPosition) == 0 && optional {
+		return 0, nil
+	}
+
+	position, err := strconv.Atoi(rawPosition)
+	if err != nil || position == 0 {
+		return 0, fmt.Errorf("invalid layer position: position=%q", rawPosition)
+	}
+
+	return position, nil
+}
+
+// Contains reports whether the layer at position (starting at 1) is in the
+// range for an image with count non-empty layers
+func (r *LayerRange) Contains(position, count int) bool {
+	if r == nil {
+		return true
+	}
+
+	start, end := 1, count
+	if r.Start != 0 {
+		start = resolveLayerPosition(r.Start, count)
+	}
+
+	if r.End != 0 {
+		end = resolveLayerPosition(r.End, count)
+	}
+
+	return start <= position && position <= end
+}
+
+func resolveLayerPosition(position, count int) int {
+	if position < 0 {
+		return count + position + 1
+	}
+
+	return position
+}
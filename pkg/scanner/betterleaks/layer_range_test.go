@@ -0,0 +1,64 @@
+package betterleaks
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLayerRange(t *testing.T) {
+	t.Run("Parse", func(t *testing.T) {
+		tests := map[string]LayerRange{
+			"3..5":    {Start: 3, End: 5},
+			"-3..":    {Start: -3},
+			"..2":     {End: 2},
+			"4":       {Start: 4, End: 4},
+			"2..-2":   {Start: 2, End: -2},
+			" -1..-1": {Start: -1, End: -1},
+		}
+
+		for rawRange, expected := range tests {
+			layerRange, err := ParseLayerRange(rawRange)
+			require.NoError(t, err, rawRange)
+			assert.Equal(t, expected, *layerRange, rawRange)
+		}
+	})
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, rawRange := range []string{"", "..", "0", "0..2", "a..b", "5..3", "-1..-3", "1...3"} {
+			_, err := ParseLayerRange(rawRange)
+			assert.Error(t, err, rawRange)
+		}
+	})
+
+	t.Run("Contains", func(t *testing.T) {
+		positions := func(rawRange string, count int) []int {
+			layerRange, err := ParseLayerRange(rawRange)
+			require.NoError(t, err)
+
+			var positions []int
+			for position := 1; position <= count; position++ {
+				if layerRange.Contains(position, count) {
+					positions = append(positions, position)
+				}
+			}
+
+			return positions
+		}
+
+		assert.Equal(t, []int{3, 4, 5}, positions("3..5", 6))
+		assert.Equal(t, []int{4, 5, 6}, positions("-3..", 6))
+		assert.Equal(t, []int{1, 2}, positions("..2", 6))
+		assert.Equal(t, []int{4}, positions("4", 6))
+		assert.Equal(t, []int{2, 3, 4, 5}, positions("2..-2", 6))
+		// Ranges past the layers there are only match the ones that exist
+		assert.Equal(t, []int{1, 2}, positions("-5..", 2))
+		assert.Empty(t, positions("5..", 2))
+	})
+
+	t.Run("NilContainsAll", func(t *testing.T) {
+		var layerRange *LayerRange
+		assert.True(t, layerRange.Contains(1, 1))
+	})
+}
@@ -0,0 +1,218 @@
+package betterleaks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"maps"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/betterleaks/betterleaks/config"
+	"github.com/betterleaks/betterleaks/sources"
+
+	"github.com/leaktk/leaktk/internal/git"
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// lfsPointerVersion is the first line of every Git LFS pointer file
+const lfsPointerVersion = "version https://git-lfs.github.com/spec/v1\n"
+
+// lfsPointerPattern matches a whole Git LFS pointer file or just its oid and
+// size lines since those are the only ones in the diff when a pointer changes
+var lfsPointerPattern = regexp.MustCompile(`^(?:version https://git-lfs\.github\.com/spec/v1\n)?(?:ext-[^\n]*\n)*oid sha256:([0-9a-f]{64})\nsize ([0-9]+)\n?$`)
+
+// LFSPointer is a Git LFS pointer file found in a commit
+type LFSPointer struct {
+	CommitInfo *sources.CommitInfo
+	CommitSHA  string
+	// Content is the pointer file's content as git lfs expects it
+	Content string
+	OID     string
+	Path    string
+	Size    int64
+}
+
+// ParseLFSPointer returns the pointer described by content if it is one
+func ParseLFSPointer(content string) (LFSPointer, bool) {
+	match := lfsPointerPattern.FindStringSubmatch(content)
+	if match == nil {
+		return LFSPointer{}, false
+	}
+
+	size, err := strconv.ParseInt(match[2], 10, 64)
+	if err != nil {
+		return LFSPointer{}, false
+	}
+
+	if !strings.HasPrefix(content, lfsPointerVersion) {
+		content = lfsPointerVersion + content
+	}
+
+	if !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+
+	return LFSPointer{
+		Content: content,
+		OID:     match[1],
+		Size:    size,
+	}, true
+}
+
+// LFSPointers wraps git sources and records the Git LFS pointer files found
+// in them
+type LFSPointers struct {
+	mutex    sync.Mutex
+	pointers map[string]LFSPointer
+}
+
+// NewLFSPointers returns an initialized LFSPointers
+func NewLFSPointers() *LFSPointers {
+	return &LFSPointers{
+		pointers: make(map[string]LFSPointer),
+	}
+}
+
+// Wrap returns a source that yields the source's fragments and records any
+// that are LFS pointers
+func (p *LFSPointers) Wrap(source sources.Source) sources.Source {
+	return &lfsPointerSource{pointers: p, source: source}
+}
+
+// Get returns the pointer for the path in the commit if it was an LFS pointer
+func (p *LFSPointers) Get(commitSHA, path string) (LFSPointer, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	pointer, ok := p.pointers[commitSHA+":"+path]
+
+	return pointer, ok
+}
+
+// List returns the pointers found ordered by commit and path
+func (p *LFSPointers) List() []LFSPointer {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	keys := slices.Sorted(maps.Keys(p.pointers))
+
+	pointers := make([]LFSPointer, len(keys))
+	for i, key := range keys {
+		pointers[i] = p.pointers[key]
+	}
+
+	return pointers
+}
+
+// record saves the fragment if it is an LFS pointer. Pointers are small
+// enough that they always fit in a single fragment.
+func (p *LFSPointers) record(fragment sources.Fragment) {
+	if len(fragment.FilePath) == 0 || fragment.StartLine > 2 {
+		return
+	}
+
+	pointer, ok := ParseLFSPointer(fragment.Raw)
+	if !ok {
+		return
+	}
+
+	pointer.CommitInfo = fragment.CommitInfo
+	pointer.CommitSHA = fragment.CommitSHA
+	pointer.Path = fragment.FilePath
+
+	logger.Debug("found lfs pointer: commit=%q path=%q oid=%q", pointer.CommitSHA, pointer.Path, pointer.OID)
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.pointers[pointer.CommitSHA+":"+pointer.Path] = pointer
+}
+
+type lfsPointerSource struct {
+	pointers *LFSPointers
+	source   sources.Source
+}
+
+func (s *lfsPointerSource) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	return s.source.Fragments(ctx, func(fragment sources.Fragment, err error) error {
+		if err == nil {
+			s.pointers.record(fragment)
+		}
+
+		return yield(fragment, err)
+	})
+}
+
+// LFSObjects is a source for yielding fragments from the Git LFS objects that
+// pointers refer to. The objects are downloaded with git lfs using the repo's
+// LFS settings and credentials.
+type LFSObjects struct {
+	Config          *config.Config
+	GitDir          string
+	MaxArchiveDepth int
+	Pointers        []LFSPointer
+
+	mutex   sync.Mutex
+	fetched int
+}
+
+// Fetched returns how many objects were downloaded and scanned
+func (s *LFSObjects) Fetched() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return s.fetched
+}
+
+// Fragments yields fragments from each object with the commit info of the
+// first pointer that refers to it. Objects that can't be downloaded are
+// skipped and objects that more than one pointer refers to (e.g. a file that
+// is in many commits) are only downloaded and scanned once.
+func (s *LFSObjects) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	if !git.LFSInstalled(ctx) {
+		return errors.New("git lfs is not installed")
+	}
+
+	seen := make(map[string]struct{}, len(s.Pointers))
+	for _, pointer := range s.Pointers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		if _, ok := seen[pointer.OID]; ok {
+			logger.Debug("skipping lfs object that was already scanned: commit=%q path=%q oid=%q", pointer.CommitSHA, pointer.Path, pointer.OID)
+			continue
+		}
+		seen[pointer.OID] = struct{}{}
+
+		commitInfo := sources.CommitInfo{Remote: defaultRemote, SHA: pointer.CommitSHA}
+		if pointer.CommitInfo != nil {
+			commitInfo = *pointer.CommitInfo
+		}
+
+		err := git.LFSSmudge(ctx, s.GitDir, pointer.Path, pointer.Content, func(content io.Reader) error {
+			file := sources.File{
+				Config:          s.Config,
+				Content:         content,
+				MaxArchiveDepth: s.MaxArchiveDepth,
+				Path:            pointer.Path,
+			}
+
+			return file.Fragments(ctx, yieldWithCommitInfo(commitInfo, yield))
+		})
+		if err != nil {
+			logger.Warning("skipping lfs object: %v commit=%q path=%q oid=%q", err, pointer.CommitSHA, pointer.Path, pointer.OID)
+			continue
+		}
+
+		s.mutex.Lock()
+		s.fetched++
+		s.mutex.Unlock()
+	}
+
+	return nil
+}
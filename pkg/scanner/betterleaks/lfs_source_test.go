@@ -0,0 +1,135 @@
+package betterleaks
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testLFSOID = "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+
+func TestParseLFSPointer(t *testing.T) {
+	t.Run("Pointer", func(t *testing.T) {
+		pointer, ok := ParseLFSPointer(lfsPointerVersion + "oid sha256:" + testLFSOID + "\nsize 12345\n")
+		require.True(t, ok)
+		assert.Equal(t, testLFSOID, pointer.OID)
+		assert.Equal(t, int64(12345), pointer.Size)
+	})
+
+	t.Run("ChangedLines", func(t *testing.T) {
+		pointer, ok := ParseLFSPointer("oid sha256:" + testLFSOID + "\nsize 12345")
+		require.True(t, ok)
+		// The content is filled in so git lfs can use it
+		assert.Equal(t, lfsPointerVersion+"oid sha256:"+testLFSOID+"\nsize 12345\n", pointer.Content)
+	})
+
+	t.Run("Extensions", func(t *testing.T) {
+		content := lfsPointerVersion + "ext-0-foo sha256:" + testLFSOID + "\noid sha256:" + testLFSOID + "\nsize 1\n"
+		pointer, ok := ParseLFSPointer(content)
+		require.True(t, ok)
+		assert.Equal(t, content, pointer.Content)
+	})
+
+	t.Run("NotAPointer", func(t *testing.T) {
+		_, ok := ParseLFSPointer("oid = " + testLFSOID + "\n")
+		assert.False(t, ok)
+		_, ok = ParseLFSPointer(lfsPointerVersion + "oid sha256:" + testLFSOID + "\nsize 1\nmore content\n")
+		assert.False(t, ok)
+	})
+}
+
+func TestLFSPointers(t *testing.T) {
+	cfg, err := ParseConfig(`
+[[rules]]
+id = "test-rule"
+regex = '''[0-9a-f]{64}'''
+`)
+	require.NoError(t, err)
+
+	repoDir := t.TempDir()
+	git := func(args ...string) {
+		require.NoError(t, exec.Command("git", append([]string{"-C", repoDir}, args...)...).Run()) // #nosec:G204
+	}
+
+	git("init", "--initial-branch", "main")
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "model.bin"), []byte(lfsPointerVersion+"oid sha256:"+testLFSOID+"\nsize 12345\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "hash.txt"), []byte(strings.Repeat("a", 64)+"\n"), 0600))
+	git("add", "-A")
+	git("-c", "user.name=LeakTK", "-c", "user.email=leaktk@example.com", "commit", "-m", "Add model", "--no-verify")
+
+	pointers := NewLFSPointers()
+	findings, err := ScanGit(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), filepath.Join(repoDir, ".git"), GitScanOpts{
+		LFSPointers: pointers,
+	})
+	require.NoError(t, err)
+	assert.Len(t, findings, 2)
+
+	found := pointers.List()
+	require.Len(t, found, 1)
+	assert.Equal(t, "model.bin", found[0].Path)
+	assert.Equal(t, testLFSOID, found[0].OID)
+	require.NotNil(t, found[0].CommitInfo)
+	assert.Equal(t, "LeakTK", found[0].CommitInfo.AuthorName)
+
+	for _, finding := range findings {
+		_, ok := pointers.Get(finding.Commit, finding.File)
+		assert.Equal(t, finding.File == "model.bin", ok, finding.File)
+	}
+}
+
+func TestScanLFSObjects(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a shell script as git-lfs")
+	}
+
+	cfg, err := ParseConfig(`
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue[0-9]+'''
+`)
+	require.NoError(t, err)
+
+	// Stand in for git-lfs so objects can be "downloaded" offline
+	binDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "git-lfs"), []byte(`#!/bin/sh
+case "$1" in
+  version) echo "git-lfs/3.0.0" ;;
+  smudge) cat > /dev/null; printf 'line one\ntoken = secretvalue42\n' ;;
+  *) exit 1 ;;
+esac
+`), 0700)) // #nosec:G306
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	pointer, ok := ParseLFSPointer(lfsPointerVersion + "oid sha256:" + testLFSOID + "\nsize 12345\n")
+	require.True(t, ok)
+	pointer.CommitSHA = strings.Repeat("b", 40)
+	pointer.Path = "model.bin"
+
+	findings, fetched, err := ScanLFSObjects(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), t.TempDir(), []LFSPointer{pointer})
+	require.NoError(t, err)
+	assert.Equal(t, 1, fetched)
+	require.Len(t, findings, 1)
+	assert.Equal(t, "secretvalue42", findings[0].Secret)
+	assert.Equal(t, "model.bin", findings[0].File)
+	assert.Equal(t, pointer.CommitSHA, findings[0].Commit)
+	assert.Equal(t, 2, findings[0].StartLine)
+
+	t.Run("DedupesByOID", func(t *testing.T) {
+		renamed := pointer
+		renamed.CommitSHA = strings.Repeat("c", 40)
+		renamed.Path = "renamed.bin"
+
+		findings, fetched, err := ScanLFSObjects(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), t.TempDir(), []LFSPointer{pointer, renamed})
+		require.NoError(t, err)
+		assert.Equal(t, 1, fetched)
+		require.Len(t, findings, 1)
+		assert.Equal(t, "model.bin", findings[0].File)
+	})
+}
@@ -0,0 +1,195 @@
+package betterleaks
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/betterleaks/betterleaks/sources"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+type lineLimitKey struct{}
+
+// fileChunkSize is how much of a file sources.File reads at a time. A fragment
+// smaller than it is the end of its file so no more of its last line follows.
+const fileChunkSize = 100 * 1_000
+
+// LineLimit truncates lines longer than a max number of bytes before the
+// scans run with its context detect them so huge lines (e.g. minified JS)
+// can't slow the rules down or use up memory. Only the start of a long line
+// is scanned and the line numbers stay the same.
+type LineLimit struct {
+	maxBytes  int
+	mutex     sync.Mutex
+	truncated int
+	// open has how much of a line each file has yielded so far when one of
+	// its fragments ends part way through the line
+	open map[string]int
+}
+
+// NewLineLimit returns a LineLimit for lines longer than maxBytes
+func NewLineLimit(maxBytes int) *LineLimit {
+	return &LineLimit{
+		maxBytes: maxBytes,
+		open:     make(map[string]int),
+	}
+}
+
+// Context returns a copy of ctx that the scan functions limit line lengths
+// with
+func (l *LineLimit) Context(ctx context.Context) context.Context {
+	return context.WithValue(ctx, lineLimitKey{}, l)
+}
+
+// Truncated returns how many lines were truncated
+func (l *LineLimit) Truncated() int {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.truncated
+}
+
+// Wrap returns a source that yields the source's fragments with their long
+// lines truncated
+func (l *LineLimit) Wrap(source sources.Source) sources.Source {
+	return &lineLimitSource{limit: l, source: source}
+}
+
+// lineLimitFrom returns the LineLimit set on the context, if any
+func lineLimitFrom(ctx context.Context) (*LineLimit, bool) {
+	lineLimit, ok := ctx.Value(lineLimitKey{}).(*LineLimit)
+	return lineLimit, ok
+}
+
+// truncate returns the fragment with its long lines cut down to maxBytes.
+// Sources can split a long line across fragments, so the part of the line in
+// earlier fragments counts towards its length.
+func (l *LineLimit) truncate(fragment sources.Fragment) sources.Fragment {
+	key := fragment.CommitSHA + "\x00" + fragment.FilePath
+	raw := fragment.Raw
+	continued := len(raw) >= fileChunkSize
+
+	l.mutex.Lock()
+	lineLen := l.open[key]
+	l.mutex.Unlock()
+
+	// Most fragments don't have long lines so skip building a new one
+	if !l.hasLongLine(raw, lineLen) {
+		l.setOpen(key, raw, lineLen, continued)
+		return fragment
+	}
+
+	var builder strings.Builder
+	builder.Grow(len(raw))
+	truncated := 0
+
+	for len(raw) > 0 {
+		line, rest, found := strings.Cut(raw, "\n")
+		raw = rest
+
+		if keep := l.maxBytes - lineLen; keep < len(line) {
+			if keep > 0 {
+				builder.WriteString(truncateUTF8(line, keep))
+			}
+			if lineLen <= l.maxBytes {
+				truncated++
+			}
+		} else {
+			builder.WriteString(line)
+		}
+
+		lineLen += len(line)
+		if found {
+			builder.WriteByte('\n')
+			lineLen = 0
+		}
+	}
+
+	l.mutex.Lock()
+	l.truncated += truncated
+	if lineLen > 0 && continued {
+		l.open[key] = lineLen
+	} else {
+		delete(l.open, key)
+	}
+	l.mutex.Unlock()
+
+	if truncated > 0 {
+		logger.Info("truncating long lines: lines=%d max_line_bytes=%d path=%q commit=%q", truncated, l.maxBytes, fragment.FilePath, fragment.CommitSHA)
+	}
+
+	fragment.Raw = builder.String()
+	fragment.Bytes = nil
+
+	return fragment
+}
+
+// hasLongLine reports whether any line in raw is over the limit given that
+// its first line already has lineLen bytes from earlier fragments
+func (l *LineLimit) hasLongLine(raw string, lineLen int) bool {
+	for len(raw) > 0 {
+		line, rest, found := strings.Cut(raw, "\n")
+		if lineLen+len(line) > l.maxBytes {
+			return true
+		}
+
+		lineLen = 0
+		if !found {
+			break
+		}
+
+		raw = rest
+	}
+
+	return false
+}
+
+// setOpen records how much of an unfinished line the fragment ends with if
+// more of the file could follow
+func (l *LineLimit) setOpen(key, raw string, lineLen int, continued bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if !continued {
+		delete(l.open, key)
+		return
+	}
+
+	if i := strings.LastIndexByte(raw, '\n'); i >= 0 {
+		lineLen = 0
+		raw = raw[i+1:]
+	}
+
+	if lineLen += len(raw); lineLen > 0 {
+		l.open[key] = lineLen
+	} else {
+		delete(l.open, key)
+	}
+}
+
+// truncateUTF8 cuts s down to at most n bytes without splitting a character
+func truncateUTF8(s string, n int) string {
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+
+	return s[:n]
+}
+
+type lineLimitSource struct {
+	limit  *LineLimit
+	source sources.Source
+}
+
+func (s *lineLimitSource) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	return s.source.Fragments(ctx, func(fragment sources.Fragment, err error) error {
+		if err == nil {
+			fragment = s.limit.truncate(fragment)
+		}
+
+		return yield(fragment, err)
+	})
+}
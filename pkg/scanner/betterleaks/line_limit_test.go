@@ -0,0 +1,74 @@
+package betterleaks
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLineLimit(t *testing.T) {
+	t.Run("Truncate", func(t *testing.T) {
+		lineLimit := NewLineLimit(5)
+
+		fragment := lineLimit.truncate(sources.Fragment{Raw: "short\ntoo long\n\nabcdefgh", Bytes: []byte("ignored")})
+		assert.Equal(t, "short\ntoo l\n\nabcde", fragment.Raw)
+		assert.Nil(t, fragment.Bytes)
+		assert.Equal(t, 2, lineLimit.Truncated())
+
+		// Fragments without long lines are left alone
+		fragment = lineLimit.truncate(sources.Fragment{Raw: "fine\nfine", Bytes: []byte("fine\nfine")})
+		assert.Equal(t, "fine\nfine", fragment.Raw)
+		assert.NotNil(t, fragment.Bytes)
+		assert.Empty(t, lineLimit.open)
+	})
+
+	t.Run("UTF8", func(t *testing.T) {
+		lineLimit := NewLineLimit(5)
+
+		// Don't leave half of the é
+		fragment := lineLimit.truncate(sources.Fragment{Raw: "abcdé123"})
+		assert.Equal(t, "abcd", fragment.Raw)
+	})
+
+	t.Run("SplitLines", func(t *testing.T) {
+		lineLimit := NewLineLimit(fileChunkSize + 5)
+		chunk := strings.Repeat("x", fileChunkSize)
+
+		// The line carries over into the next fragment of the same file
+		fragment := lineLimit.truncate(sources.Fragment{Raw: chunk, FilePath: "a.min.js"})
+		assert.Equal(t, chunk, fragment.Raw)
+
+		fragment = lineLimit.truncate(sources.Fragment{Raw: "1234567890\nnext", FilePath: "a.min.js"})
+		assert.Equal(t, "12345\nnext", fragment.Raw)
+		assert.Equal(t, 1, lineLimit.Truncated())
+
+		// Other files start their own lines
+		fragment = lineLimit.truncate(sources.Fragment{Raw: "1234567890", FilePath: "b.min.js"})
+		assert.Equal(t, "1234567890", fragment.Raw)
+		assert.Empty(t, lineLimit.open)
+	})
+
+	t.Run("Detect", func(t *testing.T) {
+		cfg, err := ParseConfig(`
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue[0-9]+'''
+`)
+		require.NoError(t, err)
+
+		lineLimit := NewLineLimit(32)
+		source := &fragmentsSource{fragments: []sources.Fragment{{
+			Raw:      "token = secretvalue1 " + strings.Repeat("x", 32) + " secretvalue2\ntoken = secretvalue3\n",
+			FilePath: "a.txt",
+		}}}
+
+		findings, err := detectSource(lineLimit.Context(t.Context()), detect.NewDetectorContext(t.Context(), *cfg), source)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"secretvalue1", "secretvalue3"}, findingSecrets(findings))
+		assert.Equal(t, 1, lineLimit.Truncated())
+	})
+}
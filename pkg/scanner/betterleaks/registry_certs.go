@@ -0,0 +1,94 @@
+package betterleaks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// registryCACertName is what the CA cert is saved as in a registry cert dir.
+// The registry client trusts every *.crt file in the dir.
+const registryCACertName = "leaktk-ca.crt"
+
+// registryCertDirs returns the certs.d dirs the registry client checks for a
+// registry's certs, in the order it checks them
+func registryCertDirs() []string {
+	var dirs []string
+	if home, err := os.UserHomeDir(); err == nil {
+		dirs = append(dirs, filepath.Join(home, ".config", "containers", "certs.d"))
+	}
+
+	return append(dirs, "/etc/containers/certs.d", "/etc/docker/certs.d")
+}
+
+// newRegistryCertDir creates a certs.d style dir under parentDir with a dir
+// for hostPort that has the CA cert along with the files from the registry's
+// own certs.d dir. Pointing DockerPerHostCertDirPath at it adds the CA without
+// losing the certs (e.g. client certs) already set up for the registry. The
+// caller must remove the returned dir.
+func newRegistryCertDir(parentDir, hostPort string, caCert []byte) (string, error) {
+	if err := os.MkdirAll(parentDir, 0700); err != nil {
+		return "", fmt.Errorf("could not create registry cert dir: %w path=%q", err, parentDir)
+	}
+
+	certDir, err := os.MkdirTemp(parentDir, "registry-certs-")
+	if err != nil {
+		return "", fmt.Errorf("could not create registry cert dir: %w path=%q", err, parentDir)
+	}
+
+	hostCertDir := filepath.Join(certDir, hostPort)
+	if err := os.Mkdir(hostCertDir, 0700); err != nil {
+		_ = os.RemoveAll(certDir)
+		return "", fmt.Errorf("could not create registry cert dir: %w path=%q", err, hostCertDir)
+	}
+
+	if err := copyRegistryCerts(hostPort, hostCertDir); err != nil {
+		_ = os.RemoveAll(certDir)
+		return "", err
+	}
+
+	if err := os.WriteFile(filepath.Join(hostCertDir, registryCACertName), caCert, 0600); err != nil {
+		_ = os.RemoveAll(certDir)
+		return "", fmt.Errorf("could not write registry ca cert: %w path=%q", err, hostCertDir)
+	}
+
+	return certDir, nil
+}
+
+// copyRegistryCerts copies the files from the first certs.d dir that has a
+// dir for hostPort, which is the only one the registry client would use
+func copyRegistryCerts(hostPort, dst string) error {
+	for _, dir := range registryCertDirs() {
+		src := filepath.Join(dir, hostPort)
+		entries, err := os.ReadDir(src)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			return fmt.Errorf("could not read registry cert dir: %w path=%q", err, src)
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(src, entry.Name())
+
+			// Certs are often symlinks so follow them but skip any dirs
+			if info, err := os.Stat(path); err != nil || !info.Mode().IsRegular() {
+				continue
+			}
+
+			data, err := os.ReadFile(path) // #nosec G304
+			if err != nil {
+				return fmt.Errorf("could not read registry cert: %w path=%q", err, path)
+			}
+
+			if err := os.WriteFile(filepath.Join(dst, entry.Name()), data, 0600); err != nil {
+				return fmt.Errorf("could not copy registry cert: %w path=%q", err, path)
+			}
+		}
+
+		return nil
+	}
+
+	return nil
+}
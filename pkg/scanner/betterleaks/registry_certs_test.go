@@ -0,0 +1,50 @@
+package betterleaks
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewRegistryCertDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("USERPROFILE", home)
+
+	// The registry already has a client cert set up
+	existingDir := filepath.Join(home, ".config", "containers", "certs.d", "registry.example.com:5000")
+	require.NoError(t, os.MkdirAll(existingDir, 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(existingDir, "client.cert"), []byte("client cert"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(existingDir, "client.key"), []byte("client key"), 0600))
+
+	parentDir := filepath.Join(t.TempDir(), "certs")
+	certDir, err := newRegistryCertDir(parentDir, "registry.example.com:5000", []byte("ca cert"))
+	require.NoError(t, err)
+
+	hostDir := filepath.Join(certDir, "registry.example.com:5000")
+	for name, content := range map[string]string{
+		registryCACertName: "ca cert",
+		"client.cert":      "client cert",
+		"client.key":       "client key",
+	} {
+		data, err := os.ReadFile(filepath.Join(hostDir, name))
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	}
+
+	t.Run("NoExistingCerts", func(t *testing.T) {
+		certDir, err := newRegistryCertDir(parentDir, "other.example.com", []byte("ca cert"))
+		require.NoError(t, err)
+
+		// Each scan gets its own dir so they can't step on each other
+		assert.NotEqual(t, filepath.Dir(hostDir), certDir)
+
+		entries, err := os.ReadDir(filepath.Join(certDir, "other.example.com"))
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, registryCACertName, entries[0].Name())
+	})
+}
@@ -0,0 +1,96 @@
+package betterleaks
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"go.podman.io/image/v5/docker"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+// Registry requests are retried with an exponential backoff. A 429 is only
+// returned once the registry client has already retried it a few times,
+// waiting as long as each response's Retry-After asked, so it falls back to
+// the same backoff as other transient errors.
+var (
+	registryRetryAttempts = 4
+	registryRetryDelay    = time.Second
+	registryRetryMaxDelay = 30 * time.Second
+)
+
+// withRegistryRetries calls fetch until it succeeds, fails with an error that
+// isn't transient, runs out of attempts or ctx is done
+func withRegistryRetries(ctx context.Context, operation string, fetch func() error) error {
+	delay := registryRetryDelay
+
+	for attempt := 1; ; attempt++ {
+		err := fetch()
+		if err == nil || attempt >= registryRetryAttempts || !transientRegistryError(err) {
+			return err
+		}
+
+		logger.Warning("retrying %s after transient registry error: %v attempt=%d delay=%q", operation, err, attempt, delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay = min(delay*2, registryRetryMaxDelay)
+	}
+}
+
+// transientRegistryError reports whether the error is from a rate limit,
+// server error or dropped connection that is worth retrying. Auth and not
+// found errors aren't.
+func transientRegistryError(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	if statusCode, ok := registryStatusCode(err); ok {
+		return statusCode == http.StatusTooManyRequests || statusCode >= http.StatusInternalServerError
+	}
+
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return dnsErr.IsTemporary || dnsErr.IsTimeout
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
+
+// registryStatusCode returns the HTTP status code behind a registry error.
+// Only the registry client's own error types are checked. Other 4xx errors
+// are parsed from the response body after the client has already waited out
+// any 429s, so they aren't retried, and a 5xx is always an
+// UnexpectedHTTPStatusError.
+func registryStatusCode(err error) (int, bool) {
+	if errors.Is(err, docker.ErrTooManyRequests) {
+		return http.StatusTooManyRequests, true
+	}
+
+	var unauthorizedErr docker.ErrUnauthorizedForCredentials
+	if errors.As(err, &unauthorizedErr) {
+		return http.StatusUnauthorized, true
+	}
+
+	var statusErr docker.UnexpectedHTTPStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode, true
+	}
+
+	return 0, false
+}
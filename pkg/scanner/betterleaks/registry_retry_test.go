@@ -0,0 +1,152 @@
+package betterleaks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	imagespecv1 "github.com/opencontainers/image-spec/specs-go/v1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.podman.io/image/v5/docker"
+	"go.podman.io/image/v5/types"
+)
+
+func TestRegistryRetries(t *testing.T) {
+	defaultDelay := registryRetryDelay
+	registryRetryDelay = time.Millisecond
+	defer func() { registryRetryDelay = defaultDelay }()
+
+	t.Run("TransientErrors", func(t *testing.T) {
+		transient := []error{
+			docker.ErrTooManyRequests,
+			docker.UnexpectedHTTPStatusError{StatusCode: http.StatusBadGateway},
+			fmt.Errorf("fetching blob: %w", docker.UnexpectedHTTPStatusError{StatusCode: http.StatusServiceUnavailable}),
+			fmt.Errorf("read: %w", syscall.ECONNRESET),
+			io.ErrUnexpectedEOF,
+		}
+
+		for _, err := range transient {
+			assert.True(t, transientRegistryError(err), err.Error())
+		}
+	})
+
+	t.Run("PermanentErrors", func(t *testing.T) {
+		permanent := []error{
+			docker.ErrUnauthorizedForCredentials{Err: errors.New("bad password")},
+			docker.UnexpectedHTTPStatusError{StatusCode: http.StatusForbidden},
+			docker.UnexpectedHTTPStatusError{StatusCode: http.StatusNotFound},
+			fmt.Errorf("reading manifest latest in quay.io/leaktk/fake-leaks: %w", errors.New("manifest unknown")),
+			context.Canceled,
+			errors.New("could not parse manifest"),
+		}
+
+		for _, err := range permanent {
+			assert.False(t, transientRegistryError(err), err.Error())
+		}
+	})
+
+	t.Run("RetriesUntilSuccess", func(t *testing.T) {
+		var calls int
+		err := withRegistryRetries(t.Context(), "test", func() error {
+			calls++
+			if calls < 3 {
+				return docker.UnexpectedHTTPStatusError{StatusCode: http.StatusInternalServerError}
+			}
+			return nil
+		})
+
+		require.NoError(t, err)
+		assert.Equal(t, 3, calls)
+	})
+
+	t.Run("Bounded", func(t *testing.T) {
+		var calls int
+		err := withRegistryRetries(t.Context(), "test", func() error {
+			calls++
+			return docker.ErrTooManyRequests
+		})
+
+		require.ErrorIs(t, err, docker.ErrTooManyRequests)
+		assert.Equal(t, registryRetryAttempts, calls)
+	})
+
+	t.Run("NoRetryOnNotFound", func(t *testing.T) {
+		var calls int
+		err := withRegistryRetries(t.Context(), "test", func() error {
+			calls++
+			return docker.UnexpectedHTTPStatusError{StatusCode: http.StatusNotFound}
+		})
+
+		require.Error(t, err)
+		assert.Equal(t, 1, calls)
+	})
+
+	t.Run("ContextCanceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+
+		var calls int
+		err := withRegistryRetries(ctx, "test", func() error {
+			calls++
+			return docker.ErrTooManyRequests
+		})
+
+		require.ErrorIs(t, err, context.Canceled)
+		assert.Equal(t, 1, calls)
+	})
+	t.Run("RetryAfterHeader", func(t *testing.T) {
+		var mutex sync.Mutex
+		var requestTimes []time.Time
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/v2/test/manifests/latest" {
+				return
+			}
+
+			mutex.Lock()
+			requestTimes = append(requestTimes, time.Now())
+			first := len(requestTimes) == 1
+			mutex.Unlock()
+
+			if first {
+				w.Header().Set("Retry-After", "1")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+
+			w.Header().Set("Content-Type", imagespecv1.MediaTypeImageManifest)
+			_, _ = io.WriteString(w, `{"schemaVersion":2,"mediaType":"`+imagespecv1.MediaTypeImageManifest+`"}`)
+		}))
+		defer server.Close()
+
+		imageRef, err := parseImageRef(strings.TrimPrefix(server.URL, "http://") + "/test:latest")
+		require.NoError(t, err)
+		imageSource, err := imageRef.NewImageSource(t.Context(), &types.SystemContext{DockerInsecureSkipTLSVerify: types.OptionalBoolTrue})
+		require.NoError(t, err)
+		defer func() { _ = imageSource.Close() }()
+
+		err = withRegistryRetries(t.Context(), "test", func() error {
+			_, _, err := imageSource.GetManifest(t.Context(), nil)
+			return err
+		})
+		require.NoError(t, err)
+
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		// The retry waits as long as the header asked, not the client's
+		// default of 2s or this package's backoff
+		require.Len(t, requestTimes, 2)
+		wait := requestTimes[1].Sub(requestTimes[0])
+		assert.GreaterOrEqual(t, wait, time.Second)
+		assert.Less(t, wait, 2*time.Second)
+	})
+}
@@ -3,10 +3,10 @@ package betterleaks
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"path/filepath"
+	"net/http"
 	"strconv"
 	"strings"
 	"time"
@@ -14,14 +14,26 @@ import (
 	"github.com/betterleaks/betterleaks/detect"
 	"github.com/betterleaks/betterleaks/report"
 	"github.com/betterleaks/betterleaks/sources"
+	"github.com/fatih/semgroup"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/leaktk/leaktk/internal/git"
 )
 
 var defaultRemote = &sources.RemoteInfo{}
 
+const tracerName = "github.com/leaktk/leaktk/pkg/scanner/betterleaks"
+
 // GitScanOpts configures ScanGit
 type GitScanOpts struct {
 	RevisionRange string
+	Checkpoint    Checkpoint
+	Commits       []string
 	Depth         int
+	LFSPointers   *LFSPointers
+	Paths         []string
 	Remote        *sources.RemoteInfo
 	Since         string
 	Staged        bool
@@ -30,25 +42,52 @@ type GitScanOpts struct {
 
 // ContainerImageScanOpts configures ScanContainerImage
 type ContainerImageScanOpts struct {
-	Arch       string
-	Depth      int
-	Exclusions []string
-	Since      string
+	AllowedTransports   []string
+	Arch                string
+	BinaryFilter        *BinaryFilter
+	CACert              []byte
+	CertsDir            string
+	Checkpoint          Checkpoint
+	DecompressionLimits DecompressionLimits
+	Depth               int
+	Exclusions          []string
+	LayerRange          string
+	Since               string
+	UserAgent           string
+}
+
+// FilesScanOpts configures ScanFiles
+type FilesScanOpts struct {
+	BinaryFilter *BinaryFilter
+	Concurrency  int
+	Progress     *FilesProgress
+	Since        string
 }
 
 // JSONScanOpts configures ScanJSON
 type JSONScanOpts struct {
+	Client           *http.Client
 	FetchURLPatterns []string
+	UserAgent        string
+}
+
+// GitArchiveScanOpts configures ScanGitArchive
+type GitArchiveScanOpts struct {
+	Client    *http.Client
+	UserAgent string
 }
 
 // URLScanOpts configures ScanURL
 type URLScanOpts struct {
+	Client           *http.Client
 	FetchURLPatterns []string
+	UserAgent        string
 }
 
 func ScanReader(ctx context.Context, detector *detect.Detector, reader io.Reader) ([]report.Finding, error) {
-	return detector.DetectSource(
+	return detectSource(
 		ctx,
+		detector,
 		&sources.File{
 			Config:          &detector.Config,
 			Content:         reader,
@@ -57,55 +96,124 @@ func ScanReader(ctx context.Context, detector *detect.Detector, reader io.Reader
 	)
 }
 
+// ScanGitArchive downloads and scans the tree in a git ref's tarball
+func ScanGitArchive(ctx context.Context, detector *detect.Detector, rawURL string, opts GitArchiveScanOpts) ([]report.Finding, error) {
+	return detectSource(
+		ctx,
+		detector,
+		&GitArchive{
+			Client:          opts.Client,
+			Config:          &detector.Config,
+			MaxArchiveDepth: detector.MaxArchiveDepth,
+			RawURL:          rawURL,
+			UserAgent:       opts.UserAgent,
+		},
+	)
+}
+
 func ScanURL(ctx context.Context, detector *detect.Detector, rawURL string, opts URLScanOpts) ([]report.Finding, error) {
-	return detector.DetectSource(
+	return detectSource(
 		ctx,
+		detector,
 		&URL{
+			Client:           opts.Client,
 			Config:           &detector.Config,
 			FetchURLPatterns: opts.FetchURLPatterns,
 			MaxArchiveDepth:  detector.MaxArchiveDepth,
 			RawURL:           rawURL,
+			UserAgent:        opts.UserAgent,
 		},
 	)
 }
 
 func ScanJSON(ctx context.Context, detector *detect.Detector, data string, opts JSONScanOpts) ([]report.Finding, error) {
-	return detector.DetectSource(
+	return detectSource(
 		ctx,
+		detector,
 		&JSON{
+			Client:           opts.Client,
 			Config:           &detector.Config,
 			FetchURLPatterns: opts.FetchURLPatterns,
 			MaxArchiveDepth:  detector.MaxArchiveDepth,
 			RawMessage:       json.RawMessage(data),
+			UserAgent:        opts.UserAgent,
 		},
 	)
 }
 
-func ScanFiles(ctx context.Context, detector *detect.Detector, path string) ([]report.Finding, error) {
-	return detector.DetectSource(
+func ScanXML(ctx context.Context, detector *detect.Detector, data string) ([]report.Finding, error) {
+	return detectSource(
 		ctx,
-		&sources.Files{
+		detector,
+		&XML{
 			Config:          &detector.Config,
-			FollowSymlinks:  detector.FollowSymlinks,
-			Path:            path,
-			Sema:            detector.Sema,
 			MaxArchiveDepth: detector.MaxArchiveDepth,
+			RawData:         []byte(data),
 		},
 	)
 }
 
-func ScanContainerImage(ctx context.Context, detector *detect.Detector, rawImageRef string, opts ContainerImageScanOpts) ([]report.Finding, error) {
-	source := &ContainerImage{
-		Arch:            opts.Arch,
+func ScanINI(ctx context.Context, detector *detect.Detector, data string) ([]report.Finding, error) {
+	return detectSource(
+		ctx,
+		detector,
+		&INI{
+			Config:          &detector.Config,
+			MaxArchiveDepth: detector.MaxArchiveDepth,
+			RawData:         []byte(data),
+		},
+	)
+}
+
+func ScanFiles(ctx context.Context, detector *detect.Detector, path string, opts FilesScanOpts) ([]report.Finding, error) {
+	source := &Files{
+		Concurrency:     opts.Concurrency,
 		Config:          &detector.Config,
-		Depth:           opts.Depth,
-		Exclusions:      opts.Exclusions,
+		FollowSymlinks:  detector.FollowSymlinks,
 		MaxArchiveDepth: detector.MaxArchiveDepth,
-		RawImageRef:     rawImageRef,
-		Remote:          defaultRemote,
+		Path:            path,
+		Progress:        opts.Progress,
 		Sema:            detector.Sema,
 	}
 
+	// The detector's Sema caps how many files are scanned at once
+	if opts.Concurrency > 0 {
+		source.Sema = semgroup.NewGroup(ctx, int64(opts.Concurrency))
+	}
+
+	if len(opts.Since) > 0 {
+		since, err := time.Parse(time.DateOnly, opts.Since)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse option: since=%q", opts.Since)
+		}
+
+		source.Since = &since
+	}
+
+	if opts.BinaryFilter != nil {
+		return detectSource(ctx, detector, opts.BinaryFilter.Wrap(source))
+	}
+
+	return detectSource(ctx, detector, source)
+}
+
+func ScanContainerImage(ctx context.Context, detector *detect.Detector, rawImageRef string, opts ContainerImageScanOpts) ([]report.Finding, error) {
+	source := &ContainerImage{
+		AllowedTransports:   opts.AllowedTransports,
+		Arch:                opts.Arch,
+		CACert:              opts.CACert,
+		CertsDir:            opts.CertsDir,
+		Config:              &detector.Config,
+		DecompressionLimits: opts.DecompressionLimits,
+		Depth:               opts.Depth,
+		Exclusions:          opts.Exclusions,
+		MaxArchiveDepth:     detector.MaxArchiveDepth,
+		RawImageRef:         rawImageRef,
+		Remote:              defaultRemote,
+		Sema:                detector.Sema,
+		UserAgent:           opts.UserAgent,
+	}
+
 	if len(opts.Since) > 0 {
 		since, err := time.Parse(time.DateOnly, opts.Since)
 		if err != nil {
@@ -115,10 +223,60 @@ func ScanContainerImage(ctx context.Context, detector *detect.Detector, rawImage
 		source.Since = &since
 	}
 
-	return detector.DetectSource(ctx, source)
+	if len(opts.LayerRange) > 0 {
+		layerRange, err := ParseLayerRange(opts.LayerRange)
+		if err != nil {
+			return nil, fmt.Errorf("could not parse option: %w layer_range=%q", err, opts.LayerRange)
+		}
+
+		source.LayerRange = layerRange
+	}
+
+	var wrapped sources.Source = source
+	if opts.BinaryFilter != nil {
+		wrapped = opts.BinaryFilter.Wrap(source)
+	}
+
+	if opts.Checkpoint != nil {
+		// The checkpoint source detects the fragments itself
+		if lineLimit, ok := lineLimitFrom(ctx); ok {
+			wrapped = lineLimit.Wrap(wrapped)
+		}
+
+		checkpointSource := &layerCheckpointSource{
+			checkpoint: opts.Checkpoint,
+			detector:   detector,
+			findings:   make(map[string][]report.Finding),
+			source:     wrapped,
+		}
+
+		source.Checkpoint = opts.Checkpoint
+		source.layerScanned = checkpointSource.layerScanned
+		wrapped = &resumedSource{
+			checkpoint: opts.Checkpoint,
+			detector:   detector,
+			source:     checkpointSource,
+		}
+	}
+
+	return detectSource(ctx, detector, wrapped)
 }
 
 func ScanGit(ctx context.Context, detector *detect.Detector, gitDir string, opts GitScanOpts) ([]report.Finding, error) {
+	if opts.Checkpoint != nil && !opts.Staged && !opts.Unstaged {
+		return scanGitCheckpointed(ctx, detector, gitDir, opts)
+	}
+
+	source, err := gitSource(ctx, detector, gitDir, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	return detectSource(ctx, detector, source)
+}
+
+// gitSource returns the source for the git changes the opts select
+func gitSource(ctx context.Context, detector *detect.Detector, gitDir string, opts GitScanOpts) (sources.Source, error) {
 	gitCmd, err := newGitCmd(ctx, gitDir, opts)
 	if err != nil {
 		return nil, fmt.Errorf("could not create git command: %w", err)
@@ -131,33 +289,79 @@ func ScanGit(ctx context.Context, detector *detect.Detector, gitDir string, opts
 		remote = defaultRemote
 	}
 
-	return detector.DetectSource(
-		ctx,
-		&sources.Git{
-			Cmd:             gitCmd,
-			Config:          &detector.Config,
-			Remote:          remote,
-			Sema:            detector.Sema,
-			MaxArchiveDepth: detector.MaxArchiveDepth,
-		},
-	)
+	var source sources.Source = &sources.Git{
+		Cmd:             gitCmd,
+		Config:          &detector.Config,
+		Remote:          remote,
+		Sema:            detector.Sema,
+		MaxArchiveDepth: detector.MaxArchiveDepth,
+	}
+
+	if (opts.Staged || opts.Unstaged) && len(opts.Paths) > 0 {
+		source = newDiffPathsSource(source, opts.Paths)
+	}
+
+	if opts.LFSPointers != nil {
+		source = opts.LFSPointers.Wrap(source)
+	}
+
+	return source, nil
+}
+
+// ScanLFSObjects downloads and scans the Git LFS objects the pointers refer
+// to and returns the findings along with how many objects were scanned
+func ScanLFSObjects(ctx context.Context, detector *detect.Detector, gitDir string, pointers []LFSPointer) ([]report.Finding, int, error) {
+	source := &LFSObjects{
+		Config:          &detector.Config,
+		GitDir:          gitDir,
+		MaxArchiveDepth: detector.MaxArchiveDepth,
+		Pointers:        pointers,
+	}
+
+	findings, err := detectSource(ctx, detector, source)
+
+	return findings, source.Fetched(), err
 }
 
-func shallowCommits(gitDir string) []string {
-	var shallowCommits []string
+// detectSource runs the detector on the source in a detect span
+func detectSource(ctx context.Context, detector *detect.Detector, source sources.Source) ([]report.Finding, error) {
+	// The global tracer provider is a no-op unless the caller sets up tracing
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "detect")
+	defer span.End()
 
-	data, err := os.ReadFile(filepath.Join(gitDir, "shallow")) // #nosec G304
-	if err != nil {
-		return shallowCommits
+	if lineLimit, ok := lineLimitFrom(ctx); ok {
+		source = lineLimit.Wrap(source)
 	}
 
-	for _, shallowCommit := range strings.Split(string(data), "\n") {
-		if len(shallowCommit) > 0 {
-			shallowCommits = append(shallowCommits, shallowCommit)
+	if firstFinding, ok := firstFindingFrom(ctx); ok {
+		var cancel context.CancelCauseFunc
+		ctx, cancel = context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		source = &firstFindingSource{
+			detector: detector,
+			source:   source,
+			keep:     firstFinding.keep,
+			stop: func() {
+				firstFinding.stopped.Store(true)
+				cancel(errFirstFinding)
+			},
 		}
 	}
 
-	return shallowCommits
+	findings, err := detector.DetectSource(ctx, source)
+
+	// Stopping at the first finding isn't an error
+	if errors.Is(context.Cause(ctx), errFirstFinding) {
+		err = nil
+	}
+	span.SetAttributes(attribute.Int("leaktk.findings.count", len(findings)))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	return findings, err
 }
 
 func newGitCmd(ctx context.Context, gitDir string, opts GitScanOpts) (gitCmd *sources.GitCmd, err error) {
@@ -169,6 +373,21 @@ func newGitCmd(ctx context.Context, gitDir string, opts GitScanOpts) (gitCmd *so
 		return gitCmd, nil
 	}
 
+	if gitCmd, err = sources.NewGitLogCmdContext(ctx, gitDir, strings.Join(gitLogArgs(gitDir, opts), " ")); err != nil {
+		return nil, fmt.Errorf("could not create git log cmd: %w", err)
+	}
+
+	return gitCmd, err
+}
+
+// gitLogArgs returns the git log args selecting the commits a history scan
+// covers
+func gitLogArgs(gitDir string, opts GitScanOpts) []string {
+	// The commits were already selected with the rest of the opts
+	if len(opts.Commits) > 0 {
+		return append([]string{"--no-walk=unsorted"}, opts.Commits...)
+	}
+
 	logOpts := []string{"--full-history", "--ignore-missing"}
 
 	if len(opts.Since) > 0 {
@@ -182,19 +401,61 @@ func newGitCmd(ctx context.Context, gitDir string, opts GitScanOpts) (gitCmd *so
 	}
 
 	if len(opts.RevisionRange) > 0 {
-		logOpts = append(logOpts, opts.RevisionRange)
+		logOpts = append(logOpts, strings.Fields(opts.RevisionRange)...)
 	} else {
 		logOpts = append(logOpts, "--all")
 	}
 
-	if shallowCommits := shallowCommits(gitDir); len(shallowCommits) > 0 {
+	if shallowCommits := git.ShallowCommits(gitDir); len(shallowCommits) > 0 {
 		logOpts = append(logOpts, "--not")
 		logOpts = append(logOpts, shallowCommits...)
 	}
 
-	if gitCmd, err = sources.NewGitLogCmdContext(ctx, gitDir, strings.Join(logOpts, " ")); err != nil {
-		return nil, fmt.Errorf("could not create git log cmd: %w", err)
+	return logOpts
+}
+
+// GitHistory describes how much of a repo's history a scan covered
+type GitHistory struct {
+	// CommitsScanned is how many commits the scan covered
+	CommitsScanned int
+	// Partial says why older commits weren't scanned: "depth" if the scan
+	// stopped at the depth or "shallow" if the clone doesn't have them. It's
+	// empty if everything (back to since) was scanned.
+	Partial string
+}
+
+// ScannedGitHistory works out how much history ScanGit covers with the opts.
+// Staged and unstaged scans don't cover any.
+func ScannedGitHistory(ctx context.Context, gitDir string, opts GitScanOpts) (GitHistory, error) {
+	var history GitHistory
+	if opts.Staged || opts.Unstaged {
+		return history, nil
 	}
 
-	return gitCmd, err
+	var err error
+	if history.CommitsScanned, err = git.CountCommits(ctx, gitDir, gitLogArgs(gitDir, opts)); err != nil {
+		return history, err
+	}
+
+	// The depth only cut the scan short if there's history past it. Shallow
+	// clones are missing the parents of their oldest commits so there is.
+	shallow := len(git.ShallowCommits(gitDir)) > 0
+	if opts.Depth > 0 && history.CommitsScanned == opts.Depth {
+		if !shallow {
+			opts.Depth++
+			if available, err := git.CountCommits(ctx, gitDir, gitLogArgs(gitDir, opts)); err != nil || available == history.CommitsScanned {
+				return history, err
+			}
+		}
+
+		history.Partial = "depth"
+		return history, nil
+	}
+
+	// A shallow clone from since is expected to be missing older history
+	if shallow && len(opts.Since) == 0 {
+		history.Partial = "shallow"
+	}
+
+	return history, nil
 }
@@ -0,0 +1,68 @@
+package betterleaks
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScannedGitHistory(t *testing.T) {
+	repoDir := t.TempDir()
+	require.NoError(t, exec.Command("git", "-C", repoDir, "init", "--initial-branch", "main").Run()) // #nosec:G204
+
+	for i := range 3 {
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, "config.txt"), []byte(fmt.Sprintf("version = %d\n", i)), 0600))
+		require.NoError(t, exec.Command("git", "-C", repoDir, "add", "-A").Run()) // #nosec:G204
+		require.NoError(t, exec.Command(
+			"git",
+			"-C", repoDir,
+			"-c", "user.name=Test",
+			"-c", "user.email=test@example.com",
+			"commit", "-m", "Update config", "--no-verify").Run()) // #nosec:G204
+	}
+
+	gitDir := filepath.Join(repoDir, ".git")
+
+	t.Run("FullHistory", func(t *testing.T) {
+		history, err := ScannedGitHistory(t.Context(), gitDir, GitScanOpts{RevisionRange: "main"})
+		require.NoError(t, err)
+		assert.Equal(t, GitHistory{CommitsScanned: 3}, history)
+	})
+
+	t.Run("DepthCoversHistory", func(t *testing.T) {
+		history, err := ScannedGitHistory(t.Context(), gitDir, GitScanOpts{Depth: 3})
+		require.NoError(t, err)
+		assert.Equal(t, GitHistory{CommitsScanned: 3}, history)
+	})
+
+	t.Run("DepthStopsScan", func(t *testing.T) {
+		history, err := ScannedGitHistory(t.Context(), gitDir, GitScanOpts{Depth: 2})
+		require.NoError(t, err)
+		assert.Equal(t, GitHistory{CommitsScanned: 2, Partial: "depth"}, history)
+	})
+
+	t.Run("ShallowClone", func(t *testing.T) {
+		cloneDir := filepath.Join(t.TempDir(), "clone.git")
+		require.NoError(t, exec.Command("git", "clone", "--bare", "--depth", "2", "file://"+repoDir, cloneDir).Run()) // #nosec:G204
+
+		// The oldest commit in the clone is excluded since its parent is missing
+		history, err := ScannedGitHistory(t.Context(), cloneDir, GitScanOpts{})
+		require.NoError(t, err)
+		assert.Equal(t, GitHistory{CommitsScanned: 1, Partial: "shallow"}, history)
+
+		history, err = ScannedGitHistory(t.Context(), cloneDir, GitScanOpts{Depth: 1})
+		require.NoError(t, err)
+		assert.Equal(t, GitHistory{CommitsScanned: 1, Partial: "depth"}, history)
+	})
+
+	t.Run("Staged", func(t *testing.T) {
+		history, err := ScannedGitHistory(t.Context(), gitDir, GitScanOpts{Staged: true})
+		require.NoError(t, err)
+		assert.Equal(t, GitHistory{}, history)
+	})
+}
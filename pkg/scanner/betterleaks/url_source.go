@@ -16,10 +16,14 @@ import (
 )
 
 type URL struct {
+	// Client is used for the request and defaults to the shared client
+	Client           *http.Client
 	Config           *config.Config
 	FetchURLPatterns []string
 	MaxArchiveDepth  int
 	RawURL           string
+	// UserAgent replaces the default User-Agent for requests
+	UserAgent string
 }
 
 func (s *URL) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
@@ -28,12 +32,14 @@ func (s *URL) Fragments(ctx context.Context, yield sources.FragmentsFunc) error
 		return fmt.Errorf("could not parse URL: %w", err)
 	}
 
-	client := httpclient.NewClient()
 	req, err := http.NewRequestWithContext(ctx, "GET", s.RawURL, nil)
 	if err != nil {
 		return fmt.Errorf("error creating HTTP GET request: %w", err)
 	}
-	resp, err := client.Do(req) // #nosec G704
+	if len(s.UserAgent) > 0 {
+		req.Header.Set("User-Agent", s.UserAgent)
+	}
+	resp, err := httpClient(s.Client).Do(req) // #nosec G704
 	if err != nil {
 		return fmt.Errorf("HTTP GET error: %w", err)
 	}
@@ -54,11 +60,13 @@ func (s *URL) Fragments(ctx context.Context, yield sources.FragmentsFunc) error
 		}
 
 		json := &JSON{
+			Client:           s.Client,
 			Config:           s.Config,
 			FetchURLPatterns: s.FetchURLPatterns,
 			MaxArchiveDepth:  s.MaxArchiveDepth,
 			Path:             parsedURL.Path,
 			RawMessage:       data,
+			UserAgent:        s.UserAgent,
 		}
 
 		return json.Fragments(ctx, yield)
@@ -73,3 +81,12 @@ func (s *URL) Fragments(ctx context.Context, yield sources.FragmentsFunc) error
 
 	return file.Fragments(ctx, yield)
 }
+
+// httpClient returns client or the shared client when it isn't set
+func httpClient(client *http.Client) *http.Client {
+	if client == nil {
+		return httpclient.DefaultClient()
+	}
+
+	return client
+}
@@ -11,6 +11,8 @@ import (
 	"github.com/betterleaks/betterleaks/sources"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/version"
 )
 
 func TestURL(t *testing.T) {
@@ -72,6 +74,29 @@ func TestURL(t *testing.T) {
 
 	require.NoError(t, err)
 	assert.Len(t, fragments, 1)
-	assert.Equal(t, "/data.json!data", fragments[0].FilePath)
+	assert.Equal(t, "/data.json!/data", fragments[0].FilePath)
 	assert.Equal(t, "json-data", fragments[0].Raw)
 }
+
+func TestURLUserAgent(t *testing.T) {
+	userAgents := make(chan string, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userAgents <- r.UserAgent()
+		w.Header().Add("Content-Type", "text/plain")
+		_, err := io.WriteString(w, "general-content")
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	t.Run("Default", func(t *testing.T) {
+		source := URL{RawURL: ts.URL}
+		require.NoError(t, source.Fragments(context.Background(), func(sources.Fragment, error) error { return nil }))
+		assert.Equal(t, version.GlobalUserAgent, <-userAgents)
+	})
+
+	t.Run("Override", func(t *testing.T) {
+		source := URL{RawURL: ts.URL, UserAgent: "leaktk-tenant/acme"}
+		require.NoError(t, source.Fragments(context.Background(), func(sources.Fragment, error) error { return nil }))
+		assert.Equal(t, "leaktk-tenant/acme", <-userAgents)
+	})
+}
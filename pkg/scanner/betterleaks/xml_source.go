@@ -0,0 +1,135 @@
+package betterleaks
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/betterleaks/betterleaks/config"
+	"github.com/betterleaks/betterleaks/sources"
+)
+
+// XML is a source for yielding fragments from the attributes and text in xml
+// data. Each fragment's path is the element's path from the root with a
+// 1-based index when it has siblings of the same name (e.g. /a/b[2]/c) and
+// attributes are added to it with an @ (e.g. /a/b/@c).
+type XML struct {
+	Config          *config.Config
+	MaxArchiveDepth int
+	RawData         []byte
+}
+
+type xmlNode struct {
+	attrs    []xml.Attr
+	children []*xmlNode
+	name     string
+	text     strings.Builder
+}
+
+// Fragments yields the fragments contained in this resource
+func (s *XML) Fragments(ctx context.Context, yield sources.FragmentsFunc) error {
+	root, err := parseXML(s.RawData)
+	if err != nil {
+		return fmt.Errorf("could not parse xml data: %w", err)
+	}
+
+	return s.walkAndYield(ctx, "", root, yield)
+}
+
+func (s *XML) walkAndYield(ctx context.Context, path string, node *xmlNode, yield sources.FragmentsFunc) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	for _, attr := range node.attrs {
+		if err := s.yieldValue(ctx, path+"/@"+attr.Name.Local, attr.Value, yield); err != nil {
+			return err
+		}
+	}
+
+	if text := strings.TrimSpace(node.text.String()); len(text) > 0 {
+		if err := s.yieldValue(ctx, path, text, yield); err != nil {
+			return err
+		}
+	}
+
+	counts := make(map[string]int, len(node.children))
+	for _, child := range node.children {
+		counts[child.name]++
+	}
+
+	indexes := make(map[string]int, len(counts))
+	for _, child := range node.children {
+		childPath := path + "/" + child.name
+		if counts[child.name] > 1 {
+			indexes[child.name]++
+			childPath += "[" + strconv.Itoa(indexes[child.name]) + "]"
+		}
+
+		if err := s.walkAndYield(ctx, childPath, child, yield); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *XML) yieldValue(ctx context.Context, path, value string, yield sources.FragmentsFunc) error {
+	file := &sources.File{
+		Config:          s.Config,
+		Content:         strings.NewReader(value),
+		MaxArchiveDepth: s.MaxArchiveDepth,
+		Path:            path,
+	}
+
+	return file.Fragments(ctx, yield)
+}
+
+// parseXML returns a node containing the document's root element
+func parseXML(data []byte) (*xmlNode, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	// Don't fail on entities and charsets the decoder doesn't know about
+	decoder.Strict = false
+	decoder.CharsetReader = func(_ string, input io.Reader) (io.Reader, error) {
+		return input, nil
+	}
+
+	document := &xmlNode{}
+	stack := []*xmlNode{document}
+
+	for {
+		token, err := decoder.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		current := stack[len(stack)-1]
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			child := &xmlNode{attrs: t.Attr, name: t.Name.Local}
+			current.children = append(current.children, child)
+			stack = append(stack, child)
+		case xml.EndElement:
+			if len(stack) > 1 {
+				stack = stack[:len(stack)-1]
+			}
+		case xml.CharData:
+			current.text.Write(t)
+		}
+	}
+
+	if len(document.children) == 0 {
+		return nil, errors.New("no root element")
+	}
+
+	return document, nil
+}
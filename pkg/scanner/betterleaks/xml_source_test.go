@@ -0,0 +1,53 @@
+package betterleaks
+
+import (
+	"context"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXML(t *testing.T) {
+	xmlData := &XML{
+		RawData: []byte(`<?xml version="1.0" encoding="ISO-8859-1"?>
+<config xmlns:app="https://example.com/app">
+	<database host="db.example.com">
+		<password>hunter2</password>
+	</database>
+	<servers>
+		<server app:token="one"/>
+		<server token="two">
+			<name> second </name>
+		</server>
+	</servers>
+	<empty/>
+</config>`),
+	}
+
+	fragments := map[string]string{}
+	err := xmlData.Fragments(context.Background(), func(fragment sources.Fragment, err error) error {
+		fragments[fragment.FilePath] = fragment.Raw
+
+		return nil
+	})
+
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"/config/@app":                     "https://example.com/app",
+		"/config/database/@host":           "db.example.com",
+		"/config/database/password":        "hunter2",
+		"/config/servers/server[1]/@token": "one",
+		"/config/servers/server[2]/@token": "two",
+		"/config/servers/server[2]/name":   "second",
+	}, fragments)
+
+	t.Run("Invalid", func(t *testing.T) {
+		for _, data := range []string{"", "just some text"} {
+			xmlData := &XML{RawData: []byte(data)}
+			err := xmlData.Fragments(context.Background(), func(sources.Fragment, error) error { return nil })
+			assert.ErrorContains(t, err, "could not parse xml data", "data=%q", data)
+		}
+	})
+}
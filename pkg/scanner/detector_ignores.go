@@ -0,0 +1,75 @@
+package scanner
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/report"
+)
+
+// detectorIgnores keeps a copy of the baseline and .gitleaksignore entries
+// loaded into a detector. The detector drops those findings as they're added
+// without any way to ask it about them, so this is how the scan can tell if a
+// finding will be reported before the detector's done.
+type detectorIgnores struct {
+	baseline     []report.Finding
+	fingerprints map[string]struct{}
+}
+
+// SetBaseline replaces the baseline the same way loading one into the
+// detector does
+func (i *detectorIgnores) SetBaseline(baseline []report.Finding) {
+	i.baseline = baseline
+}
+
+// AddGitleaksIgnore adds the fingerprints from a .gitleaksignore file and
+// normalizes them the way the detector does
+func (i *detectorIgnores) AddGitleaksIgnore(path string) error {
+	data, err := os.ReadFile(path) // #nosec G304
+	if err != nil {
+		return fmt.Errorf("could not read gitleaksignore: %w path=%q", err, path)
+	}
+
+	if i.fingerprints == nil {
+		i.fingerprints = make(map[string]struct{})
+	}
+
+	for line := range strings.Lines(string(data)) {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		// The file path is the first part of a global fingerprint and the
+		// second part of a commit one
+		parts := strings.Split(line, ":")
+		switch len(parts) {
+		case 3:
+			parts[0] = strings.ReplaceAll(parts[0], "\\", "/")
+		case 4:
+			parts[1] = strings.ReplaceAll(parts[1], "\\", "/")
+		}
+
+		i.fingerprints[strings.Join(parts, ":")] = struct{}{}
+	}
+
+	return nil
+}
+
+// Ignores reports whether the detector drops the finding because of its
+// baseline or .gitleaksignore
+func (i *detectorIgnores) Ignores(finding report.Finding, redact uint) bool {
+	if _, ok := i.fingerprints[fmt.Sprintf("%s:%s:%d", finding.File, finding.RuleID, finding.StartLine)]; ok {
+		return true
+	}
+
+	if len(finding.Commit) > 0 {
+		if _, ok := i.fingerprints[fmt.Sprintf("%s:%s:%s:%d", finding.Commit, finding.File, finding.RuleID, finding.StartLine)]; ok {
+			return true
+		}
+	}
+
+	return i.baseline != nil && !detect.IsNew(finding, redact, i.baseline)
+}
@@ -0,0 +1,55 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/report"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectorIgnores(t *testing.T) {
+	finding := report.Finding{
+		RuleID:    "test-rule",
+		File:      "dir/a.txt",
+		StartLine: 3,
+		Secret:    "secretvalue1",
+		Match:     "token = secretvalue1",
+	}
+
+	t.Run("Empty", func(t *testing.T) {
+		var ignores detectorIgnores
+		assert.False(t, ignores.Ignores(finding, 0))
+	})
+
+	t.Run("Baseline", func(t *testing.T) {
+		var ignores detectorIgnores
+		ignores.SetBaseline([]report.Finding{finding})
+		assert.True(t, ignores.Ignores(finding, 0))
+
+		other := finding
+		other.Secret = "secretvalue2"
+		assert.False(t, ignores.Ignores(other, 0))
+		// Redacted findings are compared without their secrets
+		assert.True(t, ignores.Ignores(other, 100))
+	})
+
+	t.Run("GitleaksIgnore", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), ".gitleaksignore")
+		require.NoError(t, os.WriteFile(path, []byte("# comment\ndir\\a.txt:test-rule:3\nabc1234:b.txt:test-rule:1\n"), 0600))
+
+		var ignores detectorIgnores
+		require.NoError(t, ignores.AddGitleaksIgnore(path))
+		assert.True(t, ignores.Ignores(finding, 0))
+
+		commitFinding := report.Finding{RuleID: "test-rule", File: "b.txt", StartLine: 1, Commit: "abc1234"}
+		assert.True(t, ignores.Ignores(commitFinding, 0))
+
+		commitFinding.Commit = "def5678"
+		assert.False(t, ignores.Ignores(commitFinding, 0))
+
+		assert.Error(t, ignores.AddGitleaksIgnore(filepath.Join(t.TempDir(), "missing")))
+	})
+}
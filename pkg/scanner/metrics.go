@@ -0,0 +1,50 @@
+package scanner
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// Scan outcomes used to label the scan duration metric
+const (
+	scanOutcomeSuccess = "success"
+	scanOutcomeError   = "error"
+	scanOutcomeTimeout = "timeout"
+)
+
+// scanDuration tracks how long each request takes from when a worker picks it
+// up until its response is queued. Scans range from a single small file to
+// large repos so the buckets go from 100ms to an hour.
+var scanDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "scan_duration_seconds",
+		Help:    "How long scans take by request kind and outcome",
+		Buckets: []float64{0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600, 1800, 3600},
+	},
+	[]string{"kind", "outcome"},
+)
+
+func init() {
+	prometheus.MustRegister(scanDuration)
+}
+
+// scanOutcome labels the response based on its error code
+func scanOutcome(response *proto.Response) string {
+	if response.Error == nil {
+		return scanOutcomeSuccess
+	}
+
+	if response.Error.Code == timeoutErrorCode {
+		return scanOutcomeTimeout
+	}
+
+	return scanOutcomeError
+}
+
+// observeScanDuration records the duration of the request's scan
+func observeScanDuration(request *proto.Request, response *proto.Response, start time.Time) {
+	scanDuration.WithLabelValues(request.Kind.String(), scanOutcome(response)).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,31 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestScanDuration(t *testing.T) {
+	t.Run("Outcome", func(t *testing.T) {
+		assert.Equal(t, scanOutcomeSuccess, scanOutcome(&proto.Response{}))
+		assert.Equal(t, scanOutcomeTimeout, scanOutcome(&proto.Response{Error: &proto.Error{Code: timeoutErrorCode}}))
+		assert.Equal(t, scanOutcomeError, scanOutcome(&proto.Response{Error: &proto.Error{Code: cloneErrorCode}}))
+	})
+
+	t.Run("Observe", func(t *testing.T) {
+		request := &proto.Request{Kind: proto.XMLDataRequestKind}
+		before := testutil.CollectAndCount(scanDuration)
+
+		observeScanDuration(request, &proto.Response{}, time.Now().Add(-time.Second))
+		observeScanDuration(request, &proto.Response{}, time.Now())
+		observeScanDuration(request, &proto.Response{Error: &proto.Error{Code: timeoutErrorCode}}, time.Now())
+
+		// One series per kind and outcome
+		assert.Equal(t, before+2, testutil.CollectAndCount(scanDuration))
+	})
+}
@@ -0,0 +1,86 @@
+package scanner
+
+import (
+	"strings"
+
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/regexp"
+
+	betterleaksconfig "github.com/betterleaks/betterleaks/config"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+)
+
+const caseInsensitiveFlag = "(?i)"
+
+// foldPathAllowlists makes the path checks in the detector's allowlists case
+// insensitive so they behave the way case-insensitive filesystems do (e.g.
+// README.md matching readme.md). Call it again after loading more config into
+// the detector; allowlists that are already folded are left as is.
+func foldPathAllowlists(detector *detect.Detector) {
+	allowlists := make([]*betterleaksconfig.Allowlist, len(detector.Config.Allowlists))
+	for i, allowlist := range detector.Config.Allowlists {
+		allowlists[i] = foldPathAllowlist(allowlist)
+	}
+	detector.Config.Allowlists = allowlists
+
+	rules := cloneRules(&detector.Config)
+	for ruleID, rule := range rules {
+		if len(rule.Allowlists) == 0 {
+			continue
+		}
+
+		ruleAllowlists := make([]*betterleaksconfig.Allowlist, len(rule.Allowlists))
+		for i, allowlist := range rule.Allowlists {
+			ruleAllowlists[i] = foldPathAllowlist(allowlist)
+		}
+		rule.Allowlists = ruleAllowlists
+		rules[ruleID] = rule
+	}
+
+	detector.Config.Rules = rules
+}
+
+// foldPathAllowlist returns a copy of the allowlist with case-insensitive
+// path patterns or the allowlist itself if there's nothing to change
+func foldPathAllowlist(allowlist *betterleaksconfig.Allowlist) *betterleaksconfig.Allowlist {
+	var paths []*regexp.Regexp
+	for i, path := range allowlist.Paths {
+		if strings.HasPrefix(path.String(), caseInsensitiveFlag) {
+			continue
+		}
+
+		folded, err := regexp.Compile(caseInsensitiveFlag + path.String())
+		if err != nil {
+			logger.Warning("could not make path allowlist case insensitive: %v path=%q", err, path)
+			continue
+		}
+
+		if paths == nil {
+			paths = append(paths, allowlist.Paths...)
+		}
+		paths[i] = folded
+	}
+
+	if paths == nil {
+		return allowlist
+	}
+
+	// Only the exported fields are copied so the path checks get recompiled
+	folded := &betterleaksconfig.Allowlist{
+		Description:    allowlist.Description,
+		MatchCondition: allowlist.MatchCondition,
+		Commits:        allowlist.Commits,
+		Paths:          paths,
+		RegexTarget:    allowlist.RegexTarget,
+		Regexes:        allowlist.Regexes,
+		StopWords:      allowlist.StopWords,
+	}
+
+	if err := folded.Validate(); err != nil {
+		logger.Warning("could not make path allowlist case insensitive: %v", err)
+		return allowlist
+	}
+
+	return folded
+}
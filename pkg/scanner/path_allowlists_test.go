@@ -0,0 +1,79 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/regexp"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	betterleaksconfig "github.com/betterleaks/betterleaks/config"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestFoldPathAllowlist(t *testing.T) {
+	allowlist := &betterleaksconfig.Allowlist{
+		Description: "docs",
+		Paths:       []*regexp.Regexp{regexp.MustCompile(`README\.md$`)},
+		StopWords:   []string{"example"},
+	}
+	require.NoError(t, allowlist.Validate())
+
+	folded := foldPathAllowlist(allowlist)
+	require.NotSame(t, allowlist, folded)
+	assert.True(t, folded.PathAllowed("docs/readme.md"))
+	assert.True(t, folded.PathAllowed("docs/README.md"))
+	assert.Equal(t, "docs", folded.Description)
+	assert.Equal(t, []string{"example"}, folded.StopWords)
+
+	t.Run("LeavesTheOriginal", func(t *testing.T) {
+		assert.False(t, allowlist.PathAllowed("docs/readme.md"))
+		assert.Equal(t, `README\.md$`, allowlist.Paths[0].String())
+	})
+
+	t.Run("AlreadyFolded", func(t *testing.T) {
+		assert.Same(t, folded, foldPathAllowlist(folded))
+	})
+
+	t.Run("NoPaths", func(t *testing.T) {
+		noPaths := &betterleaksconfig.Allowlist{StopWords: []string{"example"}}
+		assert.Same(t, noPaths, foldPathAllowlist(noPaths))
+	})
+}
+
+func TestCaseInsensitivePaths(t *testing.T) {
+	scanDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(scanDir, "readme.md"), []byte("token = secretvalue1\n"), 0600))
+
+	scan := func(caseInsensitivePaths bool) *proto.Response {
+		scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+			cfg.Scanner.CaseInsensitivePaths = caseInsensitivePaths
+			require.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte(`
+[[allowlists]]
+paths = ['''README\.md$''']
+`+testPatterns), 0600))
+		})
+
+		scanner.Send(&proto.Request{
+			ID:       "test-case-insensitive-paths",
+			Kind:     proto.FilesRequestKind,
+			Resource: scanDir,
+		})
+
+		return <-responses
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		response := scan(false)
+		require.Len(t, response.Results, 1)
+		assert.Equal(t, "secretvalue1", response.Results[0].Secret)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		assert.Empty(t, scan(true).Results)
+	})
+}
@@ -16,6 +16,7 @@ import (
 
 	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/fs"
+	httpclient "github.com/leaktk/leaktk/pkg/http"
 	"github.com/leaktk/leaktk/pkg/logger"
 	"github.com/leaktk/leaktk/pkg/scanner/betterleaks"
 )
@@ -23,6 +24,7 @@ import (
 // Patterns acts as an abstraction for fetching different scanner patterns
 // and keeping them up to date and cached
 type Patterns struct {
+	authToken          *authTokenSource
 	client             *http.Client
 	config             *config.Patterns
 	gitleaksConfigHash [32]byte
@@ -30,14 +32,45 @@ type Patterns struct {
 	mutex              sync.Mutex
 }
 
+// NewPatternsFromConfig returns Patterns using the http and pattern server
+// client settings from the leaktk config
+func NewPatternsFromConfig(cfg *config.Config) (*Patterns, error) {
+	client, err := patternServerClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewPatterns(&cfg.Scanner.Patterns, client), nil
+}
+
 // NewPatterns returns a configured instance of Patterns
 func NewPatterns(cfg *config.Patterns, client *http.Client) *Patterns {
 	return &Patterns{
-		client: client,
-		config: cfg,
+		authToken: newAuthTokenSource(&cfg.Server),
+		client:    client,
+		config:    cfg,
 	}
 }
 
+// patternServerClient returns a new http client for fetching patterns with the
+// pattern server's TLS settings added to the config's http settings
+func patternServerClient(cfg *config.Config) (*http.Client, error) {
+	server := &cfg.Scanner.Patterns.Server
+	opts := httpclient.ClientOptsFromConfig(cfg)
+	opts.ClientCert = server.ClientCert
+	opts.ClientKey = server.ClientKey
+	if len(server.CACert) > 0 {
+		opts.CACertFiles = append(opts.CACertFiles, server.CACert)
+	}
+
+	client, err := httpclient.NewClient(opts)
+	if err != nil {
+		return nil, fmt.Errorf("could not configure pattern server client: %w", err)
+	}
+
+	return client, nil
+}
+
 func (p *Patterns) fetchGitleaksConfig(ctx context.Context) (string, error) {
 	logger.Info("fetching gitleaks patterns")
 	patternURL, err := url.JoinPath(
@@ -49,20 +82,67 @@ func (p *Patterns) fetchGitleaksConfig(ctx context.Context) (string, error) {
 		return "", err
 	}
 
-	request, err := http.NewRequestWithContext(ctx, "GET", patternURL, nil)
+	authToken, err := p.authToken.Token(ctx)
+	if err != nil {
+		return "", fmt.Errorf("could not get auth token: %w", err)
+	}
+
+	return fetchConfig(ctx, p.client, patternURL, authToken)
+}
+
+// FetchGitleaksConfig fetches a gitleaks config from a URL. The pattern
+// server's auth token and TLS settings are only used when the URL is on the
+// pattern server. Otherwise the config is fetched anonymously.
+func FetchGitleaksConfig(ctx context.Context, cfg *config.Config, configURL string) (string, error) {
+	parsedConfigURL, err := url.Parse(configURL)
+	if err != nil {
+		return "", fmt.Errorf("invalid config url: %w", err)
+	}
+
+	server := &cfg.Scanner.Patterns.Server
+	if serverURL, err := url.Parse(server.URL); err == nil &&
+		serverURL.Scheme == parsedConfigURL.Scheme &&
+		serverURL.Host == parsedConfigURL.Host {
+
+		authToken, err := newAuthTokenSource(server).Token(ctx)
+		if err != nil {
+			return "", fmt.Errorf("could not get auth token: %w", err)
+		}
+
+		client, err := patternServerClient(cfg)
+		if err != nil {
+			return "", err
+		}
+
+		logger.Debug("fetching config from the pattern server: url=%q", configURL)
+		return fetchConfig(ctx, client, configURL, authToken)
+	}
+
+	client, err := httpclient.NewClient(httpclient.ClientOptsFromConfig(cfg))
+	if err != nil {
+		return "", fmt.Errorf("could not configure http client: %w", err)
+	}
+
+	return fetchConfig(ctx, client, configURL, "")
+}
+
+// fetchConfig GETs the raw config at configURL and sends the auth token as a
+// bearer token if one is provided
+func fetchConfig(ctx context.Context, client *http.Client, configURL, authToken string) (string, error) {
+	request, err := http.NewRequestWithContext(ctx, "GET", configURL, nil)
 	if err != nil {
 		return "", err
 	}
 
-	if len(p.config.Server.AuthToken) > 0 {
+	if len(authToken) > 0 {
 		logger.Debug("setting authorization header")
 		request.Header.Add(
 			"Authorization",
-			"Bearer "+p.config.Server.AuthToken,
+			"Bearer "+authToken,
 		)
 	}
 
-	response, err := p.client.Do(request) // #nosec G704
+	response, err := client.Do(request) // #nosec G704
 	if err != nil {
 		return "", err
 	}
@@ -109,64 +189,9 @@ func (p *Patterns) Gitleaks(ctx context.Context) (*betterleaksconfig.Config, err
 	defer p.mutex.Unlock()
 
 	if p.config.Autofetch && p.gitleaksConfigModTimeExceeds(p.config.RefreshAfter) {
-		rawConfig, err := p.fetchGitleaksConfig(ctx)
-		if err != nil {
+		if err := p.updateGitleaksConfig(ctx); err != nil {
 			return p.gitleaksConfig, err
 		}
-
-		p.gitleaksConfig, err = betterleaks.ParseConfig(rawConfig)
-		if err != nil {
-			logger.Debug("fetched config:\n%s", rawConfig)
-
-			return p.gitleaksConfig, fmt.Errorf("could not parse config: error=%q", err)
-		}
-
-		if err := os.MkdirAll(filepath.Dir(p.config.Gitleaks.ConfigPath), 0700); err != nil {
-			return p.gitleaksConfig, fmt.Errorf("could not create config dir: error=%q", err)
-		}
-
-		// Open the config file, creating it if it doesn't already exist, but don't truncate yet
-		configFile, err := os.OpenFile(p.config.Gitleaks.ConfigPath, os.O_RDWR|os.O_CREATE, 0600)
-		if err != nil {
-			return p.gitleaksConfig, fmt.Errorf("could not open config file: %v path=%q", err, p.config.Gitleaks.ConfigPath)
-		}
-
-		// defer the close and add logging around it since we're adding locks
-		defer func() {
-			if err := configFile.Close(); err != nil {
-				logger.Error("could not close config file: %v path=%q", err, p.config.Gitleaks.ConfigPath)
-				if err := fs.UnlockFile(configFile); err != nil {
-					logger.Error("error releasing config file lock: %v path=%q", err, p.config.Gitleaks.ConfigPath)
-				}
-			}
-		}()
-
-		// Establish a file lock to avoid different instances of the scanner writing to the config
-		if fs.FileLockSupported {
-			logger.Debug("locking config file for writes: path=%q", p.config.Gitleaks.ConfigPath)
-			if err = fs.LockFile(configFile); err != nil {
-				return p.gitleaksConfig, fmt.Errorf("could not establish a file lock: %w path=%s", err, p.config.Gitleaks.ConfigPath)
-			}
-		}
-
-		// Now that a lock's established if it's supported, seek to the beginning to be safe, truncate and write the file
-		if _, err := configFile.Seek(0, 0); err != nil {
-			return p.gitleaksConfig, fmt.Errorf("could not seek to the beginning of the config file: %w path=%s", err, p.config.Gitleaks.ConfigPath)
-		}
-		if err := configFile.Truncate(0); err != nil {
-			return p.gitleaksConfig, fmt.Errorf("could not truncate existing config file: %w path=%s", err, p.config.Gitleaks.ConfigPath)
-		}
-
-		// only write the config after parsing it, that way we don't break a good
-		// existing config if the server returns an invalid response
-		if _, err := configFile.WriteString(rawConfig); err != nil {
-			return p.gitleaksConfig, fmt.Errorf("could not write config: path=%q error=%q", p.config.Gitleaks.ConfigPath, err)
-		}
-
-		if hash := sha256.Sum256([]byte(rawConfig)); p.gitleaksConfigHash != hash {
-			p.gitleaksConfigHash = hash
-			logger.Info("updated gitleaks patterns: hash=%s", p.GitleaksConfigHash())
-		}
 	} else if p.gitleaksConfig == nil {
 		if p.gitleaksConfigModTimeExceeds(p.config.ExpiredAfter) {
 			return nil, fmt.Errorf(
@@ -180,7 +205,10 @@ func (p *Patterns) Gitleaks(ctx context.Context) (*betterleaksconfig.Config, err
 			return p.gitleaksConfig, err
 		}
 
-		p.gitleaksConfig, err = betterleaks.ParseConfig(string(rawConfig))
+		p.gitleaksConfig, err = betterleaks.ParseConfigFormat(
+			string(rawConfig),
+			betterleaks.ConfigFormatForPath(p.config.Gitleaks.ConfigPath, string(rawConfig)),
+		)
 		if err != nil {
 			logger.Debug("loaded config:\n%s\n", rawConfig)
 
@@ -195,6 +223,150 @@ func (p *Patterns) Gitleaks(ctx context.Context) (*betterleaksconfig.Config, err
 	return p.gitleaksConfig, nil
 }
 
+// Update fetches the latest patterns from the pattern server even if they
+// aren't due for a refresh yet
+func (p *Patterns) Update(ctx context.Context) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.updateGitleaksConfig(ctx)
+}
+
+// CheckServer fetches and parses the gitleaks patterns without saving them to
+// check that the pattern server is reachable and accepts the auth token
+func (p *Patterns) CheckServer(ctx context.Context) error {
+	rawConfig, err := p.fetchGitleaksConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	if _, err := betterleaks.ParseConfig(rawConfig); err != nil {
+		return fmt.Errorf("could not parse config: error=%q", err)
+	}
+
+	return nil
+}
+
+// updateGitleaksConfig fetches, parses, and saves the gitleaks config. The
+// caller must hold the mutex.
+func (p *Patterns) updateGitleaksConfig(ctx context.Context) error {
+	rawConfig, err := p.fetchGitleaksConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	gitleaksConfig, err := betterleaks.ParseConfig(rawConfig)
+	if err != nil {
+		logger.Debug("fetched config:\n%s", rawConfig)
+
+		return fmt.Errorf("could not parse config: error=%q", err)
+	}
+	p.gitleaksConfig = gitleaksConfig
+
+	if err := os.MkdirAll(filepath.Dir(p.config.Gitleaks.ConfigPath), 0700); err != nil {
+		return fmt.Errorf("could not create config dir: error=%q", err)
+	}
+
+	// Open the config file, creating it if it doesn't already exist, but don't truncate yet
+	configFile, err := os.OpenFile(p.config.Gitleaks.ConfigPath, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open config file: %v path=%q", err, p.config.Gitleaks.ConfigPath)
+	}
+
+	// defer the close and add logging around it since we're adding locks
+	defer func() {
+		if err := configFile.Close(); err != nil {
+			logger.Error("could not close config file: %v path=%q", err, p.config.Gitleaks.ConfigPath)
+			if err := fs.UnlockFile(configFile); err != nil {
+				logger.Error("error releasing config file lock: %v path=%q", err, p.config.Gitleaks.ConfigPath)
+			}
+		}
+	}()
+
+	// Establish a file lock to avoid different instances of the scanner writing to the config
+	if fs.FileLockSupported {
+		logger.Debug("locking config file for writes: path=%q", p.config.Gitleaks.ConfigPath)
+		if err = fs.LockFile(configFile); err != nil {
+			return fmt.Errorf("could not establish a file lock: %w path=%s", err, p.config.Gitleaks.ConfigPath)
+		}
+	}
+
+	// Now that a lock's established if it's supported, seek to the beginning to be safe, truncate and write the file
+	if _, err := configFile.Seek(0, 0); err != nil {
+		return fmt.Errorf("could not seek to the beginning of the config file: %w path=%s", err, p.config.Gitleaks.ConfigPath)
+	}
+	if err := configFile.Truncate(0); err != nil {
+		return fmt.Errorf("could not truncate existing config file: %w path=%s", err, p.config.Gitleaks.ConfigPath)
+	}
+
+	// only write the config after parsing it, that way we don't break a good
+	// existing config if the server returns an invalid response
+	if _, err := configFile.WriteString(rawConfig); err != nil {
+		return fmt.Errorf("could not write config: path=%q error=%q", p.config.Gitleaks.ConfigPath, err)
+	}
+
+	if hash := sha256.Sum256([]byte(rawConfig)); p.gitleaksConfigHash != hash {
+		p.gitleaksConfigHash = hash
+		logger.Info("updated gitleaks patterns: hash=%s", p.GitleaksConfigHash())
+	}
+
+	return nil
+}
+
+// PatternStatus describes the locally cached copy of a pattern config
+type PatternStatus struct {
+	ConfigPath string `json:"config_path"`
+	Exists     bool   `json:"exists"`
+	// ModTime is when the config was last updated
+	ModTime time.Time `json:"mod_time"`
+	// Age is the number of seconds since the config was last updated
+	Age          int    `json:"age"`
+	Autofetch    bool   `json:"autofetch"`
+	RefreshAfter int    `json:"refresh_after"`
+	ExpiredAfter int    `json:"expired_after"`
+	Hash         string `json:"hash"`
+	// RefreshDue is true if the config would be fetched on the next scan
+	RefreshDue bool `json:"refresh_due"`
+	// Expired is true if scans would fail without a refresh
+	Expired bool `json:"expired"`
+}
+
+// GitleaksStatus reports on the cached gitleaks config without fetching or
+// loading it
+func (p *Patterns) GitleaksStatus() (*PatternStatus, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	status := &PatternStatus{
+		ConfigPath:   p.config.Gitleaks.ConfigPath,
+		Autofetch:    p.config.Autofetch,
+		RefreshAfter: p.config.RefreshAfter,
+		ExpiredAfter: p.config.ExpiredAfter,
+	}
+
+	fileInfo, err := os.Stat(status.ConfigPath)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("could not stat config: %w path=%q", err, status.ConfigPath)
+	}
+
+	if err == nil {
+		rawConfig, err := os.ReadFile(status.ConfigPath)
+		if err != nil {
+			return nil, fmt.Errorf("could not read config: %w path=%q", err, status.ConfigPath)
+		}
+
+		status.Exists = true
+		status.ModTime = fileInfo.ModTime()
+		status.Age = int(time.Since(status.ModTime).Seconds())
+		status.Hash = fmt.Sprintf("%x", sha256.Sum256(rawConfig))
+	}
+
+	status.RefreshDue = p.config.Autofetch && p.gitleaksConfigModTimeExceeds(p.config.RefreshAfter)
+	status.Expired = !status.Exists || p.gitleaksConfigModTimeExceeds(p.config.ExpiredAfter)
+
+	return status, nil
+}
+
 // GitleaksConfigHash returns the sha256 hash for the current gitleaks config
 func (p *Patterns) GitleaksConfigHash() string {
 	return fmt.Sprintf("%x", p.gitleaksConfigHash)
@@ -2,6 +2,8 @@ package scanner
 
 import (
 	"context"
+	"crypto/sha256"
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -45,7 +47,7 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 		cfg.Scanner.Patterns.Server.URL = ts.URL
 		cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
 
-		client := httpclient.NewClient()
+		client := httpclient.DefaultClient()
 		p := NewPatterns(&cfg.Scanner.Patterns, client)
 
 		rawConfig, err := p.fetchGitleaksConfig(ctx)
@@ -58,7 +60,7 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 		cfg.Scanner.Patterns.Server.URL = "invalid-url"
 		cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
 
-		client := httpclient.NewClient()
+		client := httpclient.DefaultClient()
 		p := NewPatterns(&cfg.Scanner.Patterns, client)
 
 		_, err := p.fetchGitleaksConfig(ctx)
@@ -76,7 +78,7 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 		cfg.Scanner.Patterns.Server.URL = ts.URL
 		cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
 
-		client := httpclient.NewClient()
+		client := httpclient.DefaultClient()
 		p := NewPatterns(&cfg.Scanner.Patterns, client)
 
 		_, err := p.fetchGitleaksConfig(ctx)
@@ -100,7 +102,7 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 		cfg.Scanner.Patterns.Server.AuthToken = "test-token"
 		cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
 
-		client := httpclient.NewClient()
+		client := httpclient.DefaultClient()
 		p := NewPatterns(&cfg.Scanner.Patterns, client)
 
 		rawConfig, err := p.fetchGitleaksConfig(ctx)
@@ -109,6 +111,185 @@ func TestPatternsFetchGitleaksConfig(t *testing.T) {
 	})
 }
 
+func TestFetchGitleaksConfig(t *testing.T) {
+	ctx := context.Background()
+
+	newServer := func(expectedAuthorization string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "GET", r.Method)
+			assert.Equal(t, "/custom/gitleaks.toml", r.URL.Path)
+			assert.Equal(t, expectedAuthorization, r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusOK)
+			_, err := io.WriteString(w, mockConfig)
+			assert.NoError(t, err)
+		}))
+	}
+
+	t.Run("PatternServerURL", func(t *testing.T) {
+		ts := newServer("Bearer test-token")
+		defer ts.Close()
+
+		cfg := config.DefaultConfig()
+		cfg.Scanner.Patterns.Server.URL = ts.URL
+		cfg.Scanner.Patterns.Server.AuthToken = "test-token"
+
+		rawConfig, err := FetchGitleaksConfig(ctx, cfg, ts.URL+"/custom/gitleaks.toml")
+		require.NoError(t, err)
+		assert.Contains(t, rawConfig, "test-rule")
+	})
+
+	t.Run("AuthTokenCommand", func(t *testing.T) {
+		ts := newServer("Bearer command-token")
+		defer ts.Close()
+
+		cfg := config.DefaultConfig()
+		cfg.Scanner.Patterns.Server.URL = ts.URL
+		cfg.Scanner.Patterns.Server.AuthToken = "test-token"
+		cfg.Scanner.Patterns.Server.AuthTokenCommand = []string{"echo", "command-token"}
+
+		rawConfig, err := FetchGitleaksConfig(ctx, cfg, ts.URL+"/custom/gitleaks.toml")
+		require.NoError(t, err)
+		assert.Contains(t, rawConfig, "test-rule")
+	})
+
+	t.Run("OtherURL", func(t *testing.T) {
+		patternServer := newServer("")
+		defer patternServer.Close()
+		ts := newServer("")
+		defer ts.Close()
+
+		cfg := config.DefaultConfig()
+		cfg.Scanner.Patterns.Server.URL = patternServer.URL
+		cfg.Scanner.Patterns.Server.AuthToken = "test-token"
+
+		rawConfig, err := FetchGitleaksConfig(ctx, cfg, ts.URL+"/custom/gitleaks.toml")
+		require.NoError(t, err)
+		assert.Contains(t, rawConfig, "test-rule")
+	})
+
+	t.Run("HTTPError", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer ts.Close()
+
+		_, err := FetchGitleaksConfig(ctx, config.DefaultConfig(), ts.URL+"/custom/gitleaks.toml")
+		require.Error(t, err)
+	})
+}
+
+func TestNewPatternsFromConfig(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Patterns.Server.CACert = filepath.Join(t.TempDir(), "missing.crt")
+
+	// A bad client setting is returned for the caller to handle
+	_, err := NewPatternsFromConfig(cfg)
+	require.ErrorContains(t, err, "could not configure pattern server client")
+
+	_, err = NewScanner(cfg)
+	require.ErrorContains(t, err, "could not configure pattern server client")
+}
+
+func TestPatternsUpdate(t *testing.T) {
+	ctx := context.Background()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, err := io.WriteString(w, mockConfig)
+		assert.NoError(t, err)
+	}))
+	defer ts.Close()
+
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Patterns.Server.URL = ts.URL
+	cfg.Scanner.Patterns.Gitleaks.Version = "x.y.z"
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(t.TempDir(), "gitleaks.toml")
+	// A fresh config on disk that wouldn't be refreshed yet
+	require.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte("old"), 0600))
+
+	p := NewPatterns(&cfg.Scanner.Patterns, httpclient.DefaultClient())
+	require.NoError(t, p.Update(ctx))
+
+	rawConfig, err := os.ReadFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath)
+	require.NoError(t, err)
+	assert.Equal(t, mockConfig, string(rawConfig))
+	assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte(mockConfig))), p.GitleaksConfigHash())
+
+	gitleaksConfig, err := p.Gitleaks(ctx)
+	require.NoError(t, err)
+	assert.Contains(t, gitleaksConfig.Rules, "test-rule")
+
+	t.Run("InvalidConfig", func(t *testing.T) {
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+			_, err := io.WriteString(w, "[[rules]")
+			assert.NoError(t, err)
+		}))
+		defer ts.Close()
+
+		cfg.Scanner.Patterns.Server.URL = ts.URL
+		require.Error(t, p.Update(ctx))
+
+		// The good config is kept
+		rawConfig, err := os.ReadFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath)
+		require.NoError(t, err)
+		assert.Equal(t, mockConfig, string(rawConfig))
+	})
+}
+
+func TestPatternsGitleaksStatus(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(t.TempDir(), "gitleaks.toml")
+	cfg.Scanner.Patterns.RefreshAfter = 60
+	cfg.Scanner.Patterns.ExpiredAfter = 120
+	p := NewPatterns(&cfg.Scanner.Patterns, nil)
+
+	t.Run("Missing", func(t *testing.T) {
+		status, err := p.GitleaksStatus()
+		require.NoError(t, err)
+		assert.False(t, status.Exists)
+		assert.Empty(t, status.Hash)
+		assert.True(t, status.RefreshDue)
+		assert.True(t, status.Expired)
+	})
+
+	require.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte(mockConfig), 0600))
+
+	t.Run("Fresh", func(t *testing.T) {
+		status, err := p.GitleaksStatus()
+		require.NoError(t, err)
+		assert.True(t, status.Exists)
+		assert.Equal(t, fmt.Sprintf("%x", sha256.Sum256([]byte(mockConfig))), status.Hash)
+		assert.Less(t, status.Age, 60)
+		assert.False(t, status.RefreshDue)
+		assert.False(t, status.Expired)
+	})
+
+	t.Run("RefreshDue", func(t *testing.T) {
+		modTime := time.Now().Add(-90 * time.Second)
+		require.NoError(t, os.Chtimes(cfg.Scanner.Patterns.Gitleaks.ConfigPath, modTime, modTime))
+
+		status, err := p.GitleaksStatus()
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, status.Age, 90)
+		assert.True(t, status.RefreshDue)
+		assert.False(t, status.Expired)
+	})
+
+	t.Run("Expired", func(t *testing.T) {
+		modTime := time.Now().Add(-180 * time.Second)
+		require.NoError(t, os.Chtimes(cfg.Scanner.Patterns.Gitleaks.ConfigPath, modTime, modTime))
+
+		status, err := p.GitleaksStatus()
+		require.NoError(t, err)
+		assert.True(t, status.RefreshDue)
+		assert.True(t, status.Expired)
+	})
+
+	// Status is read-only
+	assert.Nil(t, p.gitleaksConfig)
+}
+
 func TestGitleaksConfigModTimeExceeds(t *testing.T) {
 	t.Run("FileExistsAndOlderThanLimit", func(t *testing.T) {
 		tempDir := t.TempDir()
@@ -0,0 +1,40 @@
+package scanner
+
+import (
+	"cmp"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/betterleaks/betterleaks/report"
+)
+
+// ruleProfileNotes returns notes with how long the scan took and the top
+// rules by how many findings they produced. Betterleaks doesn't expose how
+// long each rule takes so the counts stand in for it: the rule producing the
+// most matches is usually the one slowing a scan down.
+func ruleProfileNotes(findings []report.Finding, scanTime time.Duration, top int) map[string]string {
+	counts := make(map[string]int)
+	for _, finding := range findings {
+		counts[finding.RuleID]++
+	}
+
+	ruleIDs := make([]string, 0, len(counts))
+	for ruleID := range counts {
+		ruleIDs = append(ruleIDs, ruleID)
+	}
+
+	slices.SortFunc(ruleIDs, func(a, b string) int {
+		return cmp.Or(cmp.Compare(counts[b], counts[a]), cmp.Compare(a, b))
+	})
+
+	notes := map[string]string{
+		"profile.scan_time": scanTime.Round(time.Millisecond).String(),
+	}
+
+	for _, ruleID := range ruleIDs[:min(top, len(ruleIDs))] {
+		notes["profile.rule_matches."+ruleID] = strconv.Itoa(counts[ruleID])
+	}
+
+	return notes
+}
@@ -0,0 +1,42 @@
+package scanner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/betterleaks/betterleaks/report"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRuleProfileNotes(t *testing.T) {
+	findings := []report.Finding{
+		{RuleID: "rule-b"},
+		{RuleID: "rule-a"},
+		{RuleID: "rule-c"},
+		{RuleID: "rule-b"},
+		{RuleID: "rule-c"},
+		{RuleID: "rule-b"},
+		{RuleID: "rule-d"},
+	}
+
+	t.Run("TopRules", func(t *testing.T) {
+		notes := ruleProfileNotes(findings, 1234567*time.Microsecond, 2)
+		assert.Equal(t, map[string]string{
+			"profile.scan_time":           "1.235s",
+			"profile.rule_matches.rule-b": "3",
+			"profile.rule_matches.rule-c": "2",
+		}, notes)
+	})
+
+	t.Run("TiesSortByRuleID", func(t *testing.T) {
+		notes := ruleProfileNotes(findings, time.Second, 3)
+		assert.Equal(t, "1", notes["profile.rule_matches.rule-a"])
+		assert.NotContains(t, notes, "profile.rule_matches.rule-d")
+	})
+
+	t.Run("FewerRulesThanTop", func(t *testing.T) {
+		notes := ruleProfileNotes(findings[:1], time.Second, 10)
+		assert.Len(t, notes, 2)
+		assert.Equal(t, "1", notes["profile.rule_matches.rule-b"])
+	})
+}
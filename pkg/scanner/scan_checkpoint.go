@@ -0,0 +1,188 @@
+package scanner
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/betterleaks/betterleaks/report"
+
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// scanCheckpointEntry is a line in a checkpoint file
+type scanCheckpointEntry struct {
+	Units    []string                `json:"units"`
+	Findings []scanCheckpointFinding `json:"findings"`
+}
+
+// scanCheckpointFinding keeps the finding's line, which report.Finding leaves
+// out of its JSON
+type scanCheckpointFinding struct {
+	report.Finding
+	Line string `json:"line"`
+}
+
+// scanCheckpoint is a betterleaks.Checkpoint that appends the units of a
+// request to a JSONL file as they're done. Since the findings are kept with
+// them, the file is only readable by the owner and is removed once the scan
+// finishes.
+type scanCheckpoint struct {
+	mutex    sync.Mutex
+	path     string
+	scanned  map[string]struct{}
+	findings []report.Finding
+	resumed  int
+}
+
+// scanCheckpointPath returns where the checkpoint for the request is kept.
+// Requests for the same resource with different options (e.g. a different
+// depth) get different checkpoints since they cover different units.
+func scanCheckpointPath(dir string, request *proto.Request) (string, error) {
+	opts := request.Opts
+	opts.Metadata = nil
+	opts.Priority = 0
+	opts.Resume = false
+
+	data, err := json.Marshal(struct {
+		Kind     string     `json:"kind"`
+		Resource string     `json:"resource"`
+		Opts     proto.Opts `json:"opts"`
+	}{request.Kind.String(), request.Resource, opts})
+	if err != nil {
+		return "", fmt.Errorf("could not encode checkpoint key: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+
+	return filepath.Join(dir, hex.EncodeToString(sum[:])+".jsonl"), nil
+}
+
+// loadScanCheckpoint reads the checkpoint at path if there is one. A line
+// that can't be parsed (e.g. the scanner was killed while writing it) and
+// everything after it is ignored so those units are scanned again.
+func loadScanCheckpoint(path string) (*scanCheckpoint, error) {
+	checkpoint := &scanCheckpoint{
+		path:    filepath.Clean(path),
+		scanned: make(map[string]struct{}),
+	}
+
+	file, err := os.Open(checkpoint.path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return checkpoint, nil
+		}
+
+		return nil, fmt.Errorf("could not open checkpoint: %w path=%q", err, checkpoint.path)
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			logger.Debug("could not close checkpoint: %v path=%q", err, checkpoint.path)
+		}
+	}()
+
+	reader := bufio.NewReader(file)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			// A line without a newline wasn't finished
+			break
+		}
+
+		var entry scanCheckpointEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			logger.Warning("ignoring the rest of an invalid checkpoint: %v path=%q", err, checkpoint.path)
+			break
+		}
+
+		for _, unit := range entry.Units {
+			checkpoint.scanned[unit] = struct{}{}
+		}
+		for _, finding := range entry.Findings {
+			finding.Finding.Line = finding.Line
+			checkpoint.findings = append(checkpoint.findings, finding.Finding)
+		}
+	}
+
+	checkpoint.resumed = len(checkpoint.scanned)
+
+	return checkpoint, nil
+}
+
+// Scanned reports whether an earlier run finished scanning the unit
+func (c *scanCheckpoint) Scanned(unit string) bool {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	_, ok := c.scanned[unit]
+	return ok
+}
+
+// Findings returns the findings from the units earlier runs finished
+func (c *scanCheckpoint) Findings() []report.Finding {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	return c.findings
+}
+
+// Resumed returns how many units earlier runs finished
+func (c *scanCheckpoint) Resumed() int {
+	return c.resumed
+}
+
+// Record appends the units and their findings to the checkpoint
+func (c *scanCheckpoint) Record(units []string, findings []report.Finding) error {
+	entry := scanCheckpointEntry{
+		Units:    units,
+		Findings: make([]scanCheckpointFinding, len(findings)),
+	}
+	for i, finding := range findings {
+		// The fragment can be as big as the file it's from
+		finding.Fragment = nil
+		entry.Findings[i] = scanCheckpointFinding{Finding: finding, Line: finding.Line}
+	}
+
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("could not encode checkpoint entry: %w", err)
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(c.path), 0700); err != nil {
+		return fmt.Errorf("could not create checkpoint dir: %w path=%q", err, c.path)
+	}
+
+	file, err := os.OpenFile(c.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open checkpoint: %w path=%q", err, c.path)
+	}
+
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("could not write checkpoint: %w path=%q", err, c.path)
+	}
+
+	return file.Close()
+}
+
+// Remove deletes the checkpoint once the scan it's for is done
+func (c *scanCheckpoint) Remove() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if err := os.Remove(c.path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("could not remove checkpoint: %w path=%q", err, c.path)
+	}
+
+	return nil
+}
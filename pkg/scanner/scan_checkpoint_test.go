@@ -0,0 +1,145 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/betterleaks/betterleaks/report"
+	"github.com/betterleaks/betterleaks/sources"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestScanCheckpoint(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "checkpoints")
+	request := &proto.Request{
+		Kind:     proto.GitRepoRequestKind,
+		Resource: "https://github.com/leaktk/fake-leaks.git",
+		Opts:     proto.Opts{Depth: 10, Resume: true},
+	}
+
+	path, err := scanCheckpointPath(dir, request)
+	require.NoError(t, err)
+
+	t.Run("Path", func(t *testing.T) {
+		// Options that don't change what's scanned don't change the path
+		same := *request
+		same.Opts.Priority = 5
+		same.Opts.Metadata = map[string]string{"team": "security"}
+		samePath, err := scanCheckpointPath(dir, &same)
+		require.NoError(t, err)
+		assert.Equal(t, path, samePath)
+
+		different := *request
+		different.Opts.Depth = 20
+		differentPath, err := scanCheckpointPath(dir, &different)
+		require.NoError(t, err)
+		assert.NotEqual(t, path, differentPath)
+	})
+
+	t.Run("NoCheckpoint", func(t *testing.T) {
+		checkpoint, err := loadScanCheckpoint(path)
+		require.NoError(t, err)
+		assert.False(t, checkpoint.Scanned("abc123"))
+		assert.Empty(t, checkpoint.Findings())
+		assert.Zero(t, checkpoint.Resumed())
+	})
+
+	t.Run("Record", func(t *testing.T) {
+		checkpoint, err := loadScanCheckpoint(path)
+		require.NoError(t, err)
+		require.NoError(t, checkpoint.Record([]string{"abc123", "def456"}, []report.Finding{{
+			RuleID:   "test-rule",
+			Secret:   "secretvalue1",
+			Line:     "token = secretvalue1",
+			Commit:   "abc123",
+			Fragment: &sources.Fragment{Raw: "token = secretvalue1\n"},
+		}}))
+		require.NoError(t, checkpoint.Record([]string{"789abc"}, nil))
+
+		info, err := os.Stat(path)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+		resumed, err := loadScanCheckpoint(path)
+		require.NoError(t, err)
+		assert.True(t, resumed.Scanned("def456"))
+		assert.True(t, resumed.Scanned("789abc"))
+		assert.Equal(t, 3, resumed.Resumed())
+		require.Len(t, resumed.Findings(), 1)
+		assert.Equal(t, "token = secretvalue1", resumed.Findings()[0].Line)
+		assert.Nil(t, resumed.Findings()[0].Fragment)
+	})
+
+	t.Run("UnfinishedLine", func(t *testing.T) {
+		file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+		require.NoError(t, err)
+		_, err = file.WriteString(`{"units":["fed321"`)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+
+		resumed, err := loadScanCheckpoint(path)
+		require.NoError(t, err)
+		assert.False(t, resumed.Scanned("fed321"))
+		assert.Equal(t, 3, resumed.Resumed())
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		checkpoint, err := loadScanCheckpoint(path)
+		require.NoError(t, err)
+		require.NoError(t, checkpoint.Remove())
+		assert.NoFileExists(t, path)
+		require.NoError(t, checkpoint.Remove())
+	})
+}
+
+func TestResume(t *testing.T) {
+	repoDir := t.TempDir()
+	commitFiles(t, repoDir, map[string]string{"config1.txt": "token = secretvalue1\n"})
+	head := commitFiles(t, repoDir, map[string]string{"config2.txt": "token = secretvalue2\n"})
+
+	scanner, responses := newTestScanner(t, nil)
+
+	request := &proto.Request{
+		ID:       "test-resume",
+		Kind:     proto.GitRepoRequestKind,
+		Resource: repoDir,
+		Opts:     proto.Opts{Local: true, Resume: true},
+	}
+
+	// Pretend an earlier run was interrupted after the newest commit
+	path, err := scanCheckpointPath(scanner.checkpointsDir, request)
+	require.NoError(t, err)
+	checkpoint, err := loadScanCheckpoint(path)
+	require.NoError(t, err)
+	require.NoError(t, checkpoint.Record([]string{head}, []report.Finding{{
+		RuleID: "test-rule",
+		Secret: "secretvalue2",
+		Match:  "secretvalue2",
+		File:   "config2.txt",
+		Commit: head,
+	}}))
+
+	scanner.Send(request)
+	response := <-responses
+	require.Nil(t, response.Error)
+	assert.Equal(t, "1", response.Notes["resumed_units"])
+
+	var secrets []string
+	for _, result := range response.Results {
+		secrets = append(secrets, result.Secret)
+	}
+	assert.ElementsMatch(t, []string{"secretvalue1", "secretvalue2"}, secrets)
+
+	// The checkpoint is only needed until the scan finishes
+	assert.NoFileExists(t, path)
+
+	t.Run("NotResumable", func(t *testing.T) {
+		assert.True(t, resumable(&proto.Request{Kind: proto.ContainerImageRequestKind}))
+		assert.False(t, resumable(&proto.Request{Kind: proto.GitRepoRequestKind, Opts: proto.Opts{Staged: true}}))
+		assert.False(t, resumable(&proto.Request{Kind: proto.FilesRequestKind}))
+	})
+}
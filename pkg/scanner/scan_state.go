@@ -0,0 +1,151 @@
+package scanner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/leaktk/leaktk/pkg/fs"
+	"github.com/leaktk/leaktk/pkg/logger"
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+// scanState remembers when resources were last scanned successfully so
+// incremental scans only need to cover what's new
+type scanState struct {
+	mutex sync.Mutex
+	path  string
+}
+
+// lastScan is what's stored about a resource's last successful scan
+type lastScan struct {
+	// Time is when the scan started
+	Time time.Time `json:"time"`
+	// HeadCommit is the commit the scanned ref was at, if there was one
+	HeadCommit string `json:"head_commit,omitempty"`
+}
+
+func newScanState(path string) *scanState {
+	return &scanState{path: filepath.Clean(path)}
+}
+
+// scanStateKey returns what the request's scans are stored under. Git refs
+// are stored separately since each has its own history.
+func scanStateKey(request *proto.Request) string {
+	if ref := request.Opts.GitRef(); request.Kind == proto.GitRepoRequestKind && len(ref) > 0 {
+		return request.Resource + "#" + ref
+	}
+
+	return request.Resource
+}
+
+// LastScan returns the key's last successful scan
+func (s *scanState) LastScan(key string) (lastScan, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			logger.Warning("could not read scan state: %v path=%q", err, s.path)
+		}
+
+		return lastScan{}, false
+	}
+
+	var lastScans map[string]lastScan
+	if err := json.Unmarshal(data, &lastScans); err != nil {
+		logger.Warning("could not parse scan state: %v path=%q", err, s.path)
+		return lastScan{}, false
+	}
+
+	scan, ok := lastScans[key]
+
+	return scan, ok
+}
+
+// Record saves the key's last successful scan
+func (s *scanState) Record(key string, scan lastScan) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("could not create scan state dir: %w path=%q", err, s.path)
+	}
+
+	stateFile, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("could not open scan state: %w path=%q", err, s.path)
+	}
+	defer func() {
+		if err := stateFile.Close(); err != nil {
+			logger.Error("could not close scan state: %v path=%q", err, s.path)
+		}
+	}()
+
+	// Lock it so other instances of the scanner don't drop each other's changes
+	if fs.FileLockSupported {
+		if err := fs.LockFile(stateFile); err != nil {
+			return fmt.Errorf("could not establish a file lock: %w path=%q", err, s.path)
+		}
+		defer func() {
+			if err := fs.UnlockFile(stateFile); err != nil {
+				logger.Error("error releasing scan state lock: %v path=%q", err, s.path)
+			}
+		}()
+	}
+
+	data, err := io.ReadAll(stateFile)
+	if err != nil {
+		return fmt.Errorf("could not read scan state: %w path=%q", err, s.path)
+	}
+
+	lastScans := make(map[string]lastScan)
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &lastScans); err != nil {
+			logger.Warning("resetting invalid scan state: %v path=%q", err, s.path)
+			lastScans = make(map[string]lastScan)
+		}
+	}
+
+	scan.Time = scan.Time.UTC()
+	lastScans[key] = scan
+	if data, err = json.Marshal(lastScans); err != nil {
+		return fmt.Errorf("could not encode scan state: %w", err)
+	}
+
+	if _, err := stateFile.Seek(0, 0); err != nil {
+		return fmt.Errorf("could not seek to the beginning of the scan state: %w path=%q", err, s.path)
+	}
+	if err := stateFile.Truncate(0); err != nil {
+		return fmt.Errorf("could not truncate scan state: %w path=%q", err, s.path)
+	}
+	if _, err := stateFile.Write(data); err != nil {
+		return fmt.Errorf("could not write scan state: %w path=%q", err, s.path)
+	}
+
+	return nil
+}
+
+// incrementalSince returns the since option for a resource last scanned at
+// scanTime. It goes back an extra day since since is a date and may be
+// interpreted in a different time zone (e.g. git uses local time).
+func incrementalSince(scanTime time.Time) string {
+	return scanTime.UTC().AddDate(0, 0, -1).Format(time.DateOnly)
+}
+
+// incrementalCommitRange reports whether the request's incremental scans can
+// exclude the commits reachable from the last scan's head commit instead of
+// going by commit dates, which miss rebased commits and ones with old dates
+func incrementalCommitRange(request *proto.Request) bool {
+	return request.Kind == proto.GitRepoRequestKind &&
+		len(request.Opts.GitRef()) > 0 &&
+		request.Opts.DiffRefs == nil &&
+		!request.Opts.ArchiveFetch &&
+		!request.Opts.Staged &&
+		!request.Opts.Unstaged
+}
@@ -0,0 +1,64 @@
+package scanner
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/leaktk/leaktk/pkg/proto"
+)
+
+func TestScanState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "scan-state.json")
+	state := newScanState(path)
+	firstScan := time.Date(2024, 3, 2, 10, 0, 0, 0, time.UTC)
+	secondScan := firstScan.Add(time.Hour)
+
+	t.Run("NeverScanned", func(t *testing.T) {
+		_, ok := state.LastScan("https://github.com/leaktk/fake-leaks.git")
+		assert.False(t, ok)
+	})
+
+	t.Run("Record", func(t *testing.T) {
+		require.NoError(t, state.Record("https://github.com/leaktk/fake-leaks.git", lastScan{Time: firstScan}))
+		require.NoError(t, state.Record("https://github.com/leaktk/leaktk.git", lastScan{Time: firstScan, HeadCommit: "abc123"}))
+		// A later run picks up and updates the existing state
+		require.NoError(t, newScanState(path).Record("https://github.com/leaktk/fake-leaks.git", lastScan{Time: secondScan}))
+
+		scan, ok := state.LastScan("https://github.com/leaktk/fake-leaks.git")
+		require.True(t, ok)
+		assert.True(t, secondScan.Equal(scan.Time))
+		assert.Empty(t, scan.HeadCommit)
+
+		scan, ok = state.LastScan("https://github.com/leaktk/leaktk.git")
+		require.True(t, ok)
+		assert.True(t, firstScan.Equal(scan.Time))
+		assert.Equal(t, "abc123", scan.HeadCommit)
+	})
+
+	t.Run("InvalidState", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("not json"), 0600))
+
+		_, ok := state.LastScan("https://github.com/leaktk/fake-leaks.git")
+		assert.False(t, ok)
+
+		require.NoError(t, state.Record("https://github.com/leaktk/fake-leaks.git", lastScan{Time: firstScan}))
+		_, ok = state.LastScan("https://github.com/leaktk/fake-leaks.git")
+		assert.True(t, ok)
+	})
+
+	t.Run("IncrementalSince", func(t *testing.T) {
+		assert.Equal(t, "2024-03-01", incrementalSince(firstScan))
+	})
+
+	t.Run("Key", func(t *testing.T) {
+		resource := "https://github.com/leaktk/fake-leaks.git"
+		assert.Equal(t, resource+"#main", scanStateKey(&proto.Request{Kind: proto.GitRepoRequestKind, Resource: resource, Opts: proto.Opts{Branch: "main"}}))
+		assert.Equal(t, resource, scanStateKey(&proto.Request{Kind: proto.GitRepoRequestKind, Resource: resource}))
+		assert.Equal(t, "./files", scanStateKey(&proto.Request{Kind: proto.FilesRequestKind, Resource: "./files"}))
+	})
+}
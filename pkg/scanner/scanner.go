@@ -1,17 +1,33 @@
 package scanner
 
 import (
+	"cmp"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"runtime/debug"
+	"slices"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/betterleaks/betterleaks/detect"
 	"github.com/betterleaks/betterleaks/report"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	betterleaksconfig "github.com/betterleaks/betterleaks/config"
+	betterleaksregexp "github.com/betterleaks/betterleaks/regexp"
 
 	"github.com/leaktk/leaktk/internal/git"
 
@@ -29,6 +45,30 @@ import (
 // Set initial queue capacity. The queue can grow over time if needed
 const initQueueCapacity = 1024
 
+// remoteRefTimeout bounds how long checking a remote for a branch can take so
+// a hanging remote fails before the clone starts
+var remoteRefTimeout = time.Minute
+
+// Result ID strategies for scanner.result_id_strategy
+const (
+	// locationResultIDs hash where a secret was found so each occurrence gets
+	// its own ID
+	locationResultIDs = "location"
+	// secretResultIDs hash the resource, rule and secret so IDs don't change
+	// when lines move
+	secretResultIDs = "secret"
+)
+
+// Source config strategies for scanner.source_config_strategy
+const (
+	// checkoutSourceConfig restores the .gitleaks* files into a temp working
+	// tree so every kind of source config can be loaded
+	checkoutSourceConfig = "checkout"
+	// showSourceConfig reads the root .gitleaks.toml from the repo without
+	// writing anything
+	showSourceConfig = "show"
+)
+
 const (
 	noCode = iota
 	cloneErrorCode
@@ -41,37 +81,129 @@ const (
 
 // Scanner holds the config and state for the scanner processes
 type Scanner struct {
-	allowLocal      bool
-	scanTimeout     time.Duration
-	clonesDir       string
-	maxArchiveDepth int
-	maxDecodeDepth  int
-	maxScanDepth    int
-	patterns        *Patterns
-	responseQueue   *queue.PriorityQueue[*proto.Response]
-	scanQueue       *queue.PriorityQueue[*proto.Request]
-	scanWorkers     int
+	allowLocal             bool
+	allowedImageTransports []string
+	allowedSecrets         []string
+	auditLog               *auditLog
+	caseInsensitivePaths   bool
+	checkpointsDir         string
+	cloneSlots             chan struct{}
+	defaultPriorities      map[string]int
+	filesConcurrency       int
+	filesProgress          sync.Map // request ID -> *betterleaks.FilesProgress
+	heartbeatInterval      time.Duration
+	httpClient             *http.Client
+	scanTimeout            time.Duration
+	clonesDir              string
+	decompressionLimits    betterleaks.DecompressionLimits
+	maxArchiveDepth        int
+	maxArchiveDepthLimit   int
+	maxDecodeDepth         int
+	maxLineBytes           int
+	maxScanDepth           int
+	patterns               *Patterns
+	registryCACert         []byte
+	registryCertsDir       string
+	remediations           map[string]string
+	resultIDStrategy       string
+	sourceConfigStrategy   string
+	responseQueue          *queue.PriorityQueue[*proto.Response]
+	scanQueue              *queue.PriorityQueue[*proto.Request]
+	scanState              *scanState
+	scanWorkers            int
 }
 
 // NewScanner returns a initialized and listening scanner instance that should
 // be closed when it's no longer needed.
-func NewScanner(cfg *config.Config) *Scanner {
+func NewScanner(cfg *config.Config) (*Scanner, error) {
+	if err := config.ValidateWritableDir(cfg.Scanner.Workdir); err != nil {
+		return nil, fmt.Errorf("scanner.workdir must be a writable dir: %w workdir=%q", err, cfg.Scanner.Workdir)
+	}
+
+	httpClient, err := httpclient.NewClient(httpclient.ClientOptsFromConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("could not configure http client: %w", err)
+	}
+
+	if err := git.SetPath(cfg.Scanner.GitPath); err != nil {
+		return nil, fmt.Errorf("could not set git path: %w", err)
+	}
+
+	patterns, err := NewPatternsFromConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Registries take a dir of certs instead of a file so the CA is added to a
+	// copy of each registry's certs when it's scanned
+	var registryCACert []byte
+	if len(cfg.TLS.CACertFile) > 0 {
+		registryCACert, err = os.ReadFile(filepath.Clean(cfg.TLS.CACertFile))
+		if err != nil {
+			return nil, fmt.Errorf("could not read ca cert file: %w path=%q", err, cfg.TLS.CACertFile)
+		}
+	}
+
 	scanner := &Scanner{
-		allowLocal:      cfg.Scanner.AllowLocal,
-		scanTimeout:     time.Duration(cfg.Scanner.ScanTimeout) * time.Second,
-		clonesDir:       filepath.Join(cfg.Scanner.Workdir, "clones"),
-		maxArchiveDepth: cfg.Scanner.MaxArchiveDepth,
-		maxDecodeDepth:  cfg.Scanner.MaxDecodeDepth,
-		maxScanDepth:    cfg.Scanner.MaxScanDepth,
-		patterns:        NewPatterns(&cfg.Scanner.Patterns, httpclient.NewClient()),
-		responseQueue:   queue.NewPriorityQueue[*proto.Response](initQueueCapacity, cfg.Scanner.MaxResponseQueueSize),
-		scanQueue:       queue.NewPriorityQueue[*proto.Request](initQueueCapacity, cfg.Scanner.MaxScanQueueSize),
-		scanWorkers:     cfg.Scanner.ScanWorkers,
+		allowLocal:             cfg.Scanner.AllowLocal,
+		allowedImageTransports: cfg.Scanner.AllowedImageTransports,
+		allowedSecrets:         cfg.Scanner.AllowedSecrets,
+		auditLog:               newAuditLog(cfg.Scanner.AuditLogPath, cfg.Scanner.AuditLogMaxMB),
+		caseInsensitivePaths:   cfg.Scanner.CaseInsensitivePaths,
+		checkpointsDir:         filepath.Join(cfg.Scanner.Workdir, "checkpoints"),
+		defaultPriorities:      cfg.Scanner.DefaultPriorities,
+		filesConcurrency:       cfg.Scanner.FilesConcurrency,
+		remediations:           cfg.Scanner.Remediations,
+		heartbeatInterval:      time.Duration(cfg.Scanner.HeartbeatInterval) * time.Second,
+		httpClient:             httpClient,
+		scanTimeout:            time.Duration(cfg.Scanner.ScanTimeout) * time.Second,
+		clonesDir:              filepath.Join(cfg.Scanner.Workdir, "clones"),
+		decompressionLimits: betterleaks.DecompressionLimits{
+			MaxBytes: cfg.Scanner.MaxDecompressedBytes,
+			MaxRatio: cfg.Scanner.MaxDecompressionRatio,
+		},
+		maxArchiveDepth:      cfg.Scanner.MaxArchiveDepth,
+		maxArchiveDepthLimit: max(cfg.Scanner.MaxArchiveDepthLimit, cfg.Scanner.MaxArchiveDepth),
+		maxDecodeDepth:       cfg.Scanner.MaxDecodeDepth,
+		maxLineBytes:         cfg.Scanner.MaxLineBytes,
+		maxScanDepth:         cfg.Scanner.MaxScanDepth,
+		patterns:             patterns,
+		registryCACert:       registryCACert,
+		registryCertsDir:     filepath.Join(cfg.Scanner.Workdir, "certs"),
+		resultIDStrategy:     resultIDStrategy(cfg.Scanner.ResultIDStrategy),
+		sourceConfigStrategy: sourceConfigStrategy(cfg.Scanner.SourceConfigStrategy),
+		responseQueue:        queue.NewPriorityQueue[*proto.Response](initQueueCapacity, cfg.Scanner.MaxResponseQueueSize),
+		scanQueue:            queue.NewPriorityQueue[*proto.Request](initQueueCapacity, cfg.Scanner.MaxScanQueueSize),
+		scanState:            newScanState(filepath.Join(cfg.Scanner.Workdir, "scan-state.json")),
+		scanWorkers:          cfg.Scanner.ScanWorkers,
+	}
+
+	// Without any workers, requests would be queued but never scanned
+	if scanner.scanWorkers < 1 {
+		logger.Warning("scan_workers must be at least 1, using 1 instead: scan_workers=%d", scanner.scanWorkers)
+		scanner.scanWorkers = 1
+	}
+
+	// Each worker can run a clone at once unless it's limited further
+	maxConcurrentClones := cfg.Scanner.MaxConcurrentClones
+	if maxConcurrentClones < 1 {
+		maxConcurrentClones = scanner.scanWorkers
+	}
+	scanner.cloneSlots = make(chan struct{}, maxConcurrentClones)
+
+	for kind := range cfg.Scanner.DefaultPriorities {
+		if _, ok := proto.GetRequestKind(kind); !ok {
+			logger.Warning("ignoring default priority for unknown request kind: kind=%q", kind)
+		}
+	}
+
+	if cfg.Scanner.PriorityAgingRate > 0 {
+		scanner.scanQueue.SetAgingRate(cfg.Scanner.PriorityAgingRate)
 	}
 
 	scanner.start()
 
-	return scanner
+	return scanner, nil
 }
 
 // Recv sends scan responses to a callback function
@@ -83,6 +215,11 @@ func (s *Scanner) Recv(fn func(*proto.Response)) {
 
 // Send accepts a request for scanning and puts it in the queues
 func (s *Scanner) Send(request *proto.Request) {
+	// Requests without a priority get the default for their kind if one is set
+	if request.Opts.Priority == 0 {
+		request.Opts.Priority = s.defaultPriorities[request.Kind.String()]
+	}
+
 	logger.Info("queueing scan: id=%q queue_size=%d", request.ID, s.scanQueue.Size()+1)
 	s.scanQueue.Send(&queue.Message[*proto.Request]{
 		Priority: request.Opts.Priority,
@@ -103,227 +240,1314 @@ func (s *Scanner) listen() {
 	s.scanQueue.Recv(func(msg *queue.Message[*proto.Request]) {
 		request := msg.Value
 
-		// Capture panics and return them as errors
-		defer func() {
-			if r := recover(); r != nil {
-				logger.Critical("scan failed: panicked: %v id=%q", r, request.ID)
-				logger.Trace("stack trace:\n%s", debug.Stack())
-				s.respondWithError(request, &proto.Error{
-					Code:    scanErrorCode,
-					Message: fmt.Sprintf("scan failed: panicked: %v", r),
-					Data:    request,
-				})
-			}
-		}()
+		start := time.Now()
+		stopHeartbeats := s.startHeartbeats(request, msg.Priority)
+		var response *proto.Response
+		if len(request.Opts.Resources) > 0 {
+			response = s.scanResources(request)
+		} else {
+			response = s.scan(request, nil)
+		}
+		stopHeartbeats()
+		observeScanDuration(request, response, start)
 
-		logger.Info("starting scan: id=%q", request.ID)
+		// Kept separate from the notes so they can't clash with the scanner's
+		response.Metadata = request.Opts.Metadata
 
-		ctx := context.Background()
-		if s.scanTimeout > 0 {
-			var cancel context.CancelFunc
-			ctx, cancel = context.WithTimeout(ctx, s.scanTimeout)
-			defer cancel()
+		if request.Opts.Sort {
+			sortResults(response.Results)
+			sortResults(response.Allowlisted)
 		}
 
-		cfg, err := s.patterns.Gitleaks(ctx)
-		if err != nil {
-			logger.Critical("scan failed: could load scanner config: %v id=%q", err, request.ID)
-			s.respondWithError(request, &proto.Error{
-				Code:    configErrorCode,
-				Message: "could not load scanner config",
-				Data:    request,
-			})
+		if s.auditLog != nil {
+			if err := s.auditLog.Write(request.ID, response.Results); err != nil {
+				logger.Error("could not write results to audit log: %v id=%q", err, request.ID)
+			}
+		}
 
-			return
-		}
-
-		detector := detect.NewDetectorContext(ctx, *cfg)
-		detector.FollowSymlinks = false
-		detector.IgnoreGitleaksAllow = false
-		detector.MaxArchiveDepth = s.maxArchiveDepth
-		detector.MaxDecodeDepth = s.maxDecodeDepth
-		detector.MaxTargetMegaBytes = 0
-		detector.NoColor = true
-		detector.Redact = 0
-		detector.Verbose = false
-
-		var findings []report.Finding
-		switch request.Kind {
-		case proto.GitRepoRequestKind:
-			var gitRepoInfo git.RepoInfo
-
-			if request.Opts.Local {
-				// Make sure local scans are allowed before continuing
-				if !s.allowLocal {
-					logger.Critical("scan failed: local scans are not allowed: id=%q", request.ID)
-					s.respondWithError(request, &proto.Error{
-						Code:    localScanNotAllowedCode,
-						Message: "local scans not allowed",
-						Data:    request,
-					})
-
-					return
-				}
+		logger.Info("queueing response: id=%q queue_size=%d", request.ID, s.responseQueue.Size()+1)
+		s.responseQueue.Send(&queue.Message[*proto.Response]{
+			Priority: msg.Priority,
+			Value:    response,
+		})
+	})
+}
+
+// startHeartbeats queues a Heartbeat response for the request every
+// heartbeatInterval until the returned function is called. The function waits
+// for the last heartbeat to be queued so none come after the scan's response.
+func (s *Scanner) startHeartbeats(request *proto.Request, priority int) func() {
+	if s.heartbeatInterval <= 0 {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
 
-				// Load the gitRepoInfo from the repo
-				gitRepoInfo, err = git.GetRepoInfo(ctx, request.Resource)
-				if err != nil {
-					logger.Critical("scan failed: could not get git repo info: %v id=%q", err, request.ID)
-					removeTempGitFiles(request, gitRepoInfo)
-					s.respondWithError(request, &proto.Error{
-						Code:    sourceErrorCode,
-						Message: "could not get git repo info",
-						Data:    request,
-					})
-					return
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(s.heartbeatInterval)
+		defer ticker.Stop()
+		start := time.Now()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				notes := map[string]string{
+					"elapsed": time.Since(start).Round(time.Second).String(),
 				}
-			} else {
-				// Clone the repo and get its gitRepoInfo
-				gitRepoInfo, err = s.cloneGitRepo(ctx, request.Resource, request.Opts)
-				if err != nil {
-					select {
-					case <-ctx.Done():
-						removeTempGitFiles(request, gitRepoInfo)
-						s.respondWithError(request, &proto.Error{
-							Code:    cloneErrorCode,
-							Message: "clone operation timed out",
-							Data:    request,
-						})
-					default:
-						logger.Critical("scan failed: could not clone git repo: %v id=%q", err, request.ID)
-						removeTempGitFiles(request, gitRepoInfo)
-						s.respondWithError(request, &proto.Error{
-							Code:    cloneErrorCode,
-							Message: "could not clone git repo",
-							Data:    request,
-						})
+
+				if value, ok := s.filesProgress.Load(request.ID); ok {
+					progress := value.(*betterleaks.FilesProgress)
+					notes["files_scanned"] = strconv.FormatInt(progress.Scanned(), 10)
+					if total, walked := progress.Total(); walked {
+						notes["files_total"] = strconv.FormatInt(total, 10)
 					}
-					return
 				}
+
+				s.responseQueue.Send(&queue.Message[*proto.Response]{
+					Priority: priority,
+					Value: &proto.Response{
+						ID:        id.ID(),
+						Kind:      proto.HeartbeatResponseKind,
+						RequestID: request.ID,
+						Results:   []*proto.Result{},
+						Notes:     notes,
+					},
+				})
 			}
+		}
+	}()
 
-			// Handle setting up a temp worktree for accessing certain files in bare repos
-			if gitRepoInfo.IsBare {
-				gitRepoInfo.WorkingTreePath, err = tempCheckoutGitSourceConfigFiles(ctx, gitRepoInfo.GitDir, request.Opts.Branch)
-				if err != nil {
-					// Only log this as a debug item since it shouldn't result in fewer findings but
-					// may result in more false positives
-					logger.Debug("could not set up temp working tree for bare repo: %v id=%q", err, request.ID)
-				}
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// scanResources scans the request's resource and each of its additional
+// resources and combines them into a single response. The notes from the
+// additional resources are prefixed with "resources.<index>." and the first
+// error encountered is returned along with all of the results.
+func (s *Scanner) scanResources(request *proto.Request) *proto.Response {
+	response := s.scan(resourceRequest(request, request.Resource), nil)
+
+	for i, resource := range request.Opts.Resources {
+		resourceResponse := s.scan(resourceRequest(request, resource), nil)
+		mergeResponse(response, resourceResponse, fmt.Sprintf("resources.%d.", i))
+	}
+
+	// Point errors back at the original request rather than the resource
+	if response.Error != nil {
+		response.Error.Data = request
+	}
+
+	return response
+}
+
+// scanSubmodules scans each submodule as its own GitRepo request using the
+// superproject's options and adds the results to the superproject's response.
+// Results get a submodule note with the submodule's path, notes from the
+// submodule responses are prefixed with "submodules.<path>." and the first
+// error is kept. Submodules that point back at a repo further up the chain
+// are skipped to avoid cycles.
+func (s *Scanner) scanSubmodules(request *proto.Request, response *proto.Response, submodules []git.Submodule, workingTree string, superprojects []string) {
+	chain := append(slices.Clone(superprojects), request.Resource)
+
+	for _, submodule := range submodules {
+		submoduleURL := resolveSubmoduleURL(request.Resource, submodule.URL)
+
+		// Local scans use the submodule's checkout instead of cloning it
+		resource := submoduleURL
+		if request.Opts.Local {
+			resource = filepath.Join(workingTree, submodule.Path)
+		}
+
+		if slices.ContainsFunc(chain, func(repo string) bool { return sameRepo(repo, resource) || sameRepo(repo, submoduleURL) }) {
+			logger.Warning("skipping submodule cycle: path=%q resource=%q id=%q", submodule.Path, resource, request.ID)
+			continue
+		}
+
+		if request.Opts.Local {
+			if _, err := os.Stat(filepath.Join(resource, ".git")); err != nil {
+				logger.Warning("skipping submodule that isn't checked out: path=%q id=%q", submodule.Path, request.ID)
+				continue
 			}
+		}
 
-			// Load the checked out config from the working tree
-			loadSourceConfig(detector, gitRepoInfo.WorkingTreePath)
-
-			// If there are exclusions, create a revision range like:
-			// ^{exclusion1} ^{exclusion2} {branch}
-			revisionRange := request.Opts.Branch
-			exclusionsLen := len(request.Opts.Exclusions)
-			if exclusionsLen > 0 {
-				items := make([]string, len(request.Opts.Exclusions)+1)
-				for i, item := range request.Opts.Exclusions {
-					items[i] = "^" + item
-				}
-				items[exclusionsLen] = request.Opts.Branch
-				revisionRange = strings.Join(items, " ")
+		// The superproject's ref and exclusions don't apply to submodules
+		submoduleRequest := resourceRequest(request, resource)
+		submoduleRequest.Opts.Branch = ""
+		submoduleRequest.Opts.Ref = ""
+		submoduleRequest.Opts.Exclusions = nil
+
+		logger.Info("scanning submodule: path=%q resource=%q id=%q", submodule.Path, resource, request.ID)
+		submoduleResponse := s.scan(submoduleRequest, append(slices.Clone(chain), submoduleURL))
+
+		for _, result := range slices.Concat(submoduleResponse.Results, submoduleResponse.Allowlisted) {
+			if nestedPath, ok := result.Notes["submodule"]; ok {
+				result.Notes["submodule"] = path.Join(submodule.Path, nestedPath)
+			} else {
+				result.Notes["submodule"] = submodule.Path
 			}
+		}
 
-			findings, err = betterleaks.ScanGit(ctx, detector, gitRepoInfo.GitDir, betterleaks.GitScanOpts{
-				RevisionRange: revisionRange,
-				Depth:         scanDepth(request.Opts.Depth, s.maxScanDepth),
-				Since:         request.Opts.Since,
-				Staged:        request.Opts.Staged,
-				Unstaged:      request.Opts.Unstaged,
-			})
+		// Errors keep the submodule request as their data so it's clear
+		// which one failed
+		mergeResponse(response, submoduleResponse, "submodules."+submodule.Path+".")
+	}
+}
 
-			// Remove temp files as soon as they're no longer needed
-			removeTempGitFiles(request, gitRepoInfo)
-		case proto.URLRequestKind:
-			findings, err = betterleaks.ScanURL(ctx, detector, request.Resource, betterleaks.URLScanOpts{
-				FetchURLPatterns: splitFetchURLPatterns(request.Opts.FetchURLs),
-			})
-		case proto.JSONDataRequestKind:
-			findings, err = betterleaks.ScanJSON(ctx, detector, request.Resource, betterleaks.JSONScanOpts{
-				FetchURLPatterns: splitFetchURLPatterns(request.Opts.FetchURLs),
+// mergeResponse adds other's results to response along with its notes under
+// notePrefix. Only the first error is kept.
+func mergeResponse(response, other *proto.Response, notePrefix string) {
+	response.Results = append(response.Results, other.Results...)
+	response.Allowlisted = append(response.Allowlisted, other.Allowlisted...)
+
+	for key, value := range other.Notes {
+		setNote(response, notePrefix+key, value)
+	}
+
+	if other.Error != nil && response.Error == nil {
+		response.Error = other.Error
+	}
+}
+
+// resolveSubmoduleURL resolves a submodule URL relative to the superproject's
+// URL like git does when it starts with ./ or ../
+func resolveSubmoduleURL(superprojectURL, submoduleURL string) string {
+	if !strings.HasPrefix(submoduleURL, "./") && !strings.HasPrefix(submoduleURL, "../") {
+		return submoduleURL
+	}
+
+	superprojectURL = strings.TrimSuffix(superprojectURL, "/")
+
+	if parsedURL, err := url.Parse(superprojectURL); err == nil && len(parsedURL.Scheme) > 0 && len(parsedURL.Host) > 0 {
+		parsedURL.Path = path.Join(parsedURL.Path, submoduleURL)
+		return parsedURL.String()
+	}
+
+	if scpLikeRemote.MatchString(superprojectURL) {
+		host, repoPath, _ := strings.Cut(superprojectURL, ":")
+		return host + ":" + path.Join(repoPath, submoduleURL)
+	}
+
+	return filepath.Join(superprojectURL, submoduleURL)
+}
+
+// sameRepo reports whether two repo URLs or paths refer to the same repo
+// ignoring trailing slashes and .git suffixes
+func sameRepo(a, b string) bool {
+	normalize := func(repo string) string {
+		return strings.TrimSuffix(strings.TrimSuffix(repo, "/"), ".git")
+	}
+
+	return normalize(a) == normalize(b)
+}
+
+// resourceRequest copies request with its resource set to resource and no
+// additional resources so it can be scanned on its own
+func resourceRequest(request *proto.Request, resource string) *proto.Request {
+	resourceRequest := *request
+	resourceRequest.Resource = resource
+	resourceRequest.Opts.Resources = nil
+
+	return &resourceRequest
+}
+
+// scanJob holds what the steps of a request's scan share. The source steps
+// fill in the findings, error and notes.
+type scanJob struct {
+	request         *proto.Request
+	detector        *detect.Detector
+	requestBaseline []report.Finding
+	ignores         detectorIgnores
+	allowlists      *allowlistReport
+	binaryFilter    *betterleaks.BinaryFilter
+	checkpoint      *scanCheckpoint
+	firstFinding    *betterleaks.FirstFinding
+	lineLimit       *betterleaks.LineLimit
+	previousScan    lastScan
+
+	findings []report.Finding
+	err      error
+	notes    map[string]string
+
+	// Results from LFS pointer files are tagged so they aren't mistaken for
+	// the files' real content. Any LFS object findings come after the rest.
+	lfsPointers     *betterleaks.LFSPointers
+	lfsObjectsStart int
+
+	// Staged and unstaged findings get the diff hunks they're in
+	diffHunks []git.Hunk
+
+	// Incremental scans of git refs start from where this one ends
+	scannedHeadCommit string
+
+	// Submodules are scanned after the superproject is done
+	submodules  []git.Submodule
+	workingTree string
+}
+
+// scan runs a single request and returns its response. superprojects lists
+// the repos above this one when it's a submodule scan.
+func (s *Scanner) scan(request *proto.Request, superprojects []string) (response *proto.Response) {
+	ctx, span := startSpan(context.Background(), "scan", trace.WithAttributes(requestSpanAttributes(request)...))
+	defer span.End()
+
+	// Capture panics and return them as errors
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Critical("scan failed: panicked: %v id=%q", r, request.ID)
+			logger.Trace("stack trace:\n%s", debug.Stack())
+			response = s.errorResponse(ctx, request, &proto.Error{
+				Code:    scanErrorCode,
+				Message: fmt.Sprintf("scan failed: panicked: %v", r),
+				Data:    request,
 			})
-		case proto.TextRequestKind:
-			findings, err = betterleaks.ScanReader(ctx, detector, strings.NewReader(request.Resource))
-		case proto.FilesRequestKind:
-			if !s.allowLocal {
-				logger.Critical("scan failed: local scans not allowed: id=%q", request.ID)
-				s.respondWithError(request, &proto.Error{
-					Code:    localScanNotAllowedCode,
-					Message: "local scans not allowed",
-					Data:    request,
-				})
+		}
+	}()
 
-				return
+	logger.Info("starting scan: id=%q", request.ID)
+	scanStart := time.Now()
+	previousScan := s.incrementalScan(request)
+
+	if s.scanTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.scanTimeout)
+		defer cancel()
+	}
+
+	ctx, job, failure := s.newScanJob(ctx, request)
+	if failure != nil {
+		return s.errorResponse(ctx, request, failure)
+	}
+	job.previousScan = previousScan
+
+	// The profile's scan time includes fetching the resource (e.g. cloning)
+	// since detection streams from it
+	detectStart := time.Now()
+	if failure := s.scanSource(ctx, job); failure != nil {
+		return s.errorResponse(ctx, request, failure)
+	}
+	detectTime := time.Since(detectStart)
+
+	span.SetAttributes(attribute.Int("leaktk.findings.count", len(job.findings)))
+
+	_, formatSpan := startSpan(ctx, "format")
+	response = s.jobResponse(ctx, job, detectTime)
+	if len(job.submodules) > 0 {
+		s.scanSubmodules(request, response, job.submodules, job.workingTree, superprojects)
+	}
+	formatSpan.End()
+
+	if response.Error != nil {
+		span.SetStatus(codes.Error, response.Error.Message)
+	}
+
+	// A failed scan keeps its checkpoint so it can be resumed
+	if job.checkpoint != nil && response.Error == nil {
+		if err := job.checkpoint.Remove(); err != nil {
+			logger.Error("could not remove checkpoint: %v id=%q", err, request.ID)
+		}
+	}
+
+	// Record the start time so anything added during the scan is covered
+	// by the next one
+	if request.Opts.Incremental && response.Error == nil {
+		scan := lastScan{Time: scanStart, HeadCommit: job.scannedHeadCommit}
+		if err := s.scanState.Record(scanStateKey(request), scan); err != nil {
+			logger.Error("could not record scan time: %v id=%q", err, request.ID)
+		}
+	}
+
+	return response
+}
+
+// incrementalScan returns the request's last incremental scan and sets since
+// from it. An explicit since takes priority over the last scan. Git refs
+// start from the last scan's head commit when it's in the repo and only fall
+// back to since after the repo is fetched.
+func (s *Scanner) incrementalScan(request *proto.Request) lastScan {
+	if !request.Opts.Incremental || len(request.Opts.Since) > 0 {
+		return lastScan{}
+	}
+
+	previousScan, ok := s.scanState.LastScan(scanStateKey(request))
+	if !ok {
+		return lastScan{}
+	}
+
+	if len(previousScan.HeadCommit) == 0 || !incrementalCommitRange(request) {
+		request.Opts.Since = incrementalSince(previousScan.Time)
+		logger.Info("scanning incrementally: since=%q id=%q", request.Opts.Since, request.ID)
+	}
+
+	return previousScan
+}
+
+// newScanJob loads the config and sets up what the request's options need
+// before its source is scanned. The returned context is the one to scan with.
+func (s *Scanner) newScanJob(ctx context.Context, request *proto.Request) (context.Context, *scanJob, *proto.Error) {
+	configCtx, configSpan := startSpan(ctx, "config_load")
+	cfg, err := s.patterns.Gitleaks(configCtx)
+	if err != nil {
+		endSpan(configSpan, err)
+		logger.Critical("scan failed: could load scanner config: %v id=%q", err, request.ID)
+		return ctx, nil, &proto.Error{
+			Code:    configErrorCode,
+			Message: "could not load scanner config",
+			Data:    request,
+		}
+	}
+
+	job := &scanJob{
+		request:         request,
+		detector:        s.newDetector(configCtx, cfg, request),
+		notes:           make(map[string]string),
+		lfsObjectsStart: -1,
+	}
+
+	// The request's baseline is merged with any in the source's config later
+	if len(request.Opts.Baseline) > 0 {
+		if err := json.Unmarshal(request.Opts.Baseline, &job.requestBaseline); err != nil {
+			endSpan(configSpan, err)
+			logger.Critical("scan failed: could not parse baseline: %v id=%q", err, request.ID)
+			return ctx, nil, &proto.Error{
+				Code:    configErrorCode,
+				Message: "could not parse baseline",
+				Data:    request,
+			}
+		}
+
+		if err := addBaseline(job.detector, job.requestBaseline); err != nil {
+			logger.Error("could not add request baseline: %v id=%q", err, request.ID)
+		} else {
+			job.ignores.SetBaseline(job.requestBaseline)
+		}
+	}
+
+	// The detector drops allowlisted findings without saying why, so to
+	// report them it scans without allowlists and they're checked after
+	if request.Opts.ReportAllowlisted {
+		job.allowlists = newAllowlistReport()
+		job.allowlists.Disable(job.detector)
+	}
+	configSpan.End()
+
+	// Only the Files and ContainerImage sources support skipping binary files
+	if request.Opts.SkipBinary && (request.Kind == proto.FilesRequestKind || request.Kind == proto.ContainerImageRequestKind) {
+		job.binaryFilter = betterleaks.NewBinaryFilter()
+	}
+
+	// Requests that only need to know if there are any findings can stop at
+	// the first one that will be reported
+	if request.Opts.StopOnFirst {
+		job.firstFinding = betterleaks.NewFirstFinding(s.reportedFinding(job))
+		ctx = job.firstFinding.Context(ctx)
+	}
+
+	// Huge lines are cut short before detection so they can't stall the rules
+	if s.maxLineBytes > 0 {
+		job.lineLimit = betterleaks.NewLineLimit(s.maxLineBytes)
+		ctx = job.lineLimit.Context(ctx)
+	}
+
+	// Long history and container image scans can skip what an interrupted run
+	// already finished. Scans that stop at the first finding are short enough
+	// not to need it.
+	if request.Opts.Resume && !request.Opts.StopOnFirst && resumable(request) {
+		job.checkpoint = s.loadCheckpoint(request)
+	}
+
+	return ctx, job, nil
+}
+
+// scanSource scans the request's resource with the source for its kind
+func (s *Scanner) scanSource(ctx context.Context, job *scanJob) *proto.Error {
+	request := job.request
+
+	switch request.Kind {
+	case proto.GitRepoRequestKind:
+		return s.scanGitRepo(ctx, job)
+	case proto.URLRequestKind:
+		job.findings, job.err = betterleaks.ScanURL(ctx, job.detector, request.Resource, betterleaks.URLScanOpts{
+			Client:           s.httpClient,
+			FetchURLPatterns: splitFetchURLPatterns(request.Opts.FetchURLs),
+			UserAgent:        request.Opts.UserAgent,
+		})
+	case proto.JSONDataRequestKind:
+		job.findings, job.err = betterleaks.ScanJSON(ctx, job.detector, request.Resource, betterleaks.JSONScanOpts{
+			Client:           s.httpClient,
+			FetchURLPatterns: splitFetchURLPatterns(request.Opts.FetchURLs),
+			UserAgent:        request.Opts.UserAgent,
+		})
+	case proto.XMLDataRequestKind:
+		job.findings, job.err = betterleaks.ScanXML(ctx, job.detector, request.Resource)
+	case proto.INIDataRequestKind:
+		job.findings, job.err = betterleaks.ScanINI(ctx, job.detector, request.Resource)
+	case proto.TextRequestKind:
+		job.findings, job.err = betterleaks.ScanReader(ctx, job.detector, strings.NewReader(request.Resource))
+	case proto.FilesRequestKind:
+		return s.scanFiles(ctx, job)
+	case proto.ContainerImageRequestKind:
+		s.scanContainerImage(ctx, job)
+	default:
+		logger.Warning("unexpected request kind: %s", request.Kind)
+	}
+
+	return nil
+}
+
+// jobResponse builds the response from the job's findings and notes and
+// applies the request's result options to it
+func (s *Scanner) jobResponse(ctx context.Context, job *scanJob, detectTime time.Duration) *proto.Response {
+	request := job.request
+
+	if job.checkpoint != nil && job.checkpoint.Resumed() > 0 {
+		job.notes["resumed_units"] = strconv.Itoa(job.checkpoint.Resumed())
+	}
+
+	if stoppedEarly(job.firstFinding) {
+		job.notes["stopped_on_first"] = "true"
+	}
+
+	if job.binaryFilter != nil {
+		job.notes["skipped_binary_files"] = strconv.Itoa(job.binaryFilter.Skipped())
+	}
+
+	if job.lineLimit != nil && job.lineLimit.Truncated() > 0 {
+		job.notes["truncated_lines"] = strconv.Itoa(job.lineLimit.Truncated())
+	}
+
+	response := scanResponse(ctx, request, job.findings, job.err)
+	for key, value := range job.notes {
+		setNote(response, key, value)
+	}
+	if s.resultIDStrategy == secretResultIDs {
+		setSecretResultIDs(request, response.Results, job.findings)
+	}
+	setDecodeParentIDs(response.Results, job.findings)
+	if job.lfsPointers != nil {
+		tagLFSResults(response.Results, job.findings, job.lfsPointers, job.lfsObjectsStart)
+	}
+	if len(job.diffHunks) > 0 {
+		setDiffHunkNotes(response.Results, job.findings, job.diffHunks)
+	}
+	setRemediations(response.Results, s.remediations)
+
+	// These have to come after everything that relies on the results being
+	// in the same order as the findings
+	if job.allowlists != nil {
+		response.Results, response.Allowlisted = job.allowlists.Split(response.Results, job.findings)
+	}
+
+	var allowed int
+	response.Results, allowed = newAllowedSecrets(s.allowedSecrets, request.Opts.AllowedSecrets).Filter(response.Results)
+	if allowed > 0 {
+		setNote(response, "allowed_secrets", strconv.Itoa(allowed))
+	}
+
+	if request.Opts.ProfileRules > 0 {
+		for key, value := range ruleProfileNotes(job.findings, detectTime, request.Opts.ProfileRules) {
+			setNote(response, key, value)
+		}
+	}
+
+	return response
+}
+
+// reportedFinding returns a func that reports whether a finding from the
+// job's detector makes it into the response's results, which is everything
+// the detector and jobResponse filter out after it's found
+func (s *Scanner) reportedFinding(job *scanJob) func(report.Finding) bool {
+	allowed := newAllowedSecrets(s.allowedSecrets, job.request.Opts.AllowedSecrets)
+
+	return func(finding report.Finding) bool {
+		if job.ignores.Ignores(finding, job.detector.Redact) || allowed.Allows(finding.Secret) {
+			return false
+		}
+
+		if job.allowlists != nil {
+			if _, ok := job.allowlists.allowlistedBy(&finding); ok {
+				return false
+			}
+		}
+
+		return true
+	}
+}
+
+// setNote sets a note on the response, creating its notes if needed
+func setNote(response *proto.Response, key, value string) {
+	if response.Notes == nil {
+		response.Notes = make(map[string]string)
+	}
+
+	response.Notes[key] = value
+}
+
+// scanGitRepo scans a GitRepo request's history, or its staged or unstaged
+// changes, from a clone or the local repo
+func (s *Scanner) scanGitRepo(ctx context.Context, job *scanJob) *proto.Error {
+	request := job.request
+
+	// Scans the ref's tree from a tarball instead of cloning its history
+	if request.Opts.ArchiveFetch && !request.Opts.Local {
+		return s.scanGitArchive(ctx, job)
+	}
+
+	diffRefs := request.Opts.DiffRefs
+	if diffRefs != nil && (len(diffRefs.Base) == 0 || len(diffRefs.Head) == 0) {
+		logger.Critical("scan failed: diff_refs needs a base and head: id=%q", request.ID)
+		return &proto.Error{
+			Code:    sourceErrorCode,
+			Message: "diff_refs needs a base and head",
+			Data:    request,
+		}
+	}
+
+	gitRepoInfo, failure := s.openGitRepo(ctx, request)
+	if failure != nil {
+		return failure
+	}
+
+	// Remove temp files as soon as they're no longer needed
+	defer func() {
+		removeTempGitFiles(request, gitRepoInfo)
+	}()
+
+	diffRange, failure := gitDiffRange(ctx, job, gitRepoInfo.GitDir)
+	if failure != nil {
+		return failure
+	}
+
+	incrementalExclusion := incrementalGitExclusion(ctx, job, gitRepoInfo.GitDir)
+
+	// The diff source always diffs the whole working tree so find the
+	// files the pathspecs match to limit the scan to
+	var diffPaths []string
+	diffScan := request.Opts.Staged || request.Opts.Unstaged
+	if diffScan && len(request.Opts.Pathspecs) > 0 {
+		var err error
+		diffPaths, err = git.DiffPaths(ctx, gitRepoInfo.WorkingTreePath, request.Opts.Staged, request.Opts.Pathspecs)
+		if err != nil {
+			logger.Critical("scan failed: %v id=%q", err, request.ID)
+			return &proto.Error{
+				Code:    sourceErrorCode,
+				Message: "could not match pathspecs",
+				Data:    request,
 			}
-			loadSourceConfig(detector, request.Resource)
-			findings, err = betterleaks.ScanFiles(ctx, detector, request.Resource)
-		case proto.ContainerImageRequestKind:
-			findings, err = betterleaks.ScanContainerImage(ctx, detector, request.Resource, betterleaks.ContainerImageScanOpts{
-				Arch:  request.Opts.Arch,
-				Depth: scanDepth(request.Opts.Depth, s.maxScanDepth),
-				Since: request.Opts.Since,
-			})
-		default:
-			logger.Warning("unexpected request kind: %s", request.Kind)
 		}
+	}
+
+	if len(gitRepoInfo.HeadCommit) > 0 {
+		job.notes["branch_head_commit"] = gitRepoInfo.HeadCommit
+		job.scannedHeadCommit = gitRepoInfo.HeadCommit
+	}
+
+	// Clones already fetch everything back to since with --shallow-since
+	// but local repos may have been cloned with less history
+	if request.Opts.Local && len(request.Opts.Since) > 0 && !diffScan {
+		if boundaryDate, truncated := historyTruncated(ctx, gitRepoInfo.GitDir, request.Opts.Since); truncated {
+			logger.Warning(
+				"shallow repo history starts after since; older commits won't be scanned: since=%q history_start=%q id=%q",
+				request.Opts.Since,
+				boundaryDate,
+				request.ID,
+			)
+
+			job.notes["history_truncated"] = boundaryDate
+		}
+	}
+
+	s.loadGitSourceConfig(ctx, job, &gitRepoInfo)
+
+	job.lfsPointers = betterleaks.NewLFSPointers()
+	gitScanOpts := betterleaks.GitScanOpts{
+		RevisionRange: gitRevisionRange(request, diffRange, incrementalExclusion),
+		Depth:         scanDepth(request.Opts.Depth, s.maxScanDepth),
+		LFSPointers:   job.lfsPointers,
+		Paths:         diffPaths,
+		Since:         request.Opts.Since,
+		Staged:        request.Opts.Staged,
+		Unstaged:      request.Opts.Unstaged,
+	}
+	if job.checkpoint != nil {
+		gitScanOpts.Checkpoint = job.checkpoint
+	}
+	if diffScan && len(request.Opts.Pathspecs) > 0 && len(diffPaths) == 0 {
+		logger.Info("no changes match the pathspecs: id=%q", request.ID)
+	} else {
+		job.findings, job.err = betterleaks.ScanGit(ctx, job.detector, gitRepoInfo.GitDir, gitScanOpts)
+	}
+
+	// No findings from a partial history doesn't mean the repo is clean
+	// so say how much of it was covered
+	if !diffScan && job.err == nil && !stoppedEarly(job.firstFinding) {
+		history, historyErr := betterleaks.ScannedGitHistory(ctx, gitRepoInfo.GitDir, gitScanOpts)
+		if historyErr != nil {
+			logger.Warning("could not count scanned commits: %v id=%q", historyErr, request.ID)
+		} else {
+			job.notes["commits_scanned"] = strconv.Itoa(history.CommitsScanned)
+			if len(history.Partial) > 0 {
+				job.notes["history_partial"] = history.Partial
+			}
+		}
+	}
+
+	scanGitLFSObjects(ctx, job, gitRepoInfo.GitDir)
+
+	// The scan diffs without context so diff again to show what's around
+	// each finding
+	if diffScan && len(job.findings) > 0 {
+		var hunksErr error
+		job.diffHunks, hunksErr = git.DiffHunks(ctx, gitRepoInfo.WorkingTreePath, request.Opts.Staged)
+		if hunksErr != nil {
+			logger.Warning("could not load diff hunks: %v id=%q", hunksErr, request.ID)
+		}
+	}
+
+	if request.Opts.BlameContact {
+		setIntroducedByContacts(ctx, gitRepoInfo.GitDir, job.findings)
+	}
+
+	if request.Opts.Submodules {
+		listGitSubmodules(ctx, job, gitRepoInfo)
+	}
+
+	return nil
+}
+
+// gitDiffRange resolves the diff refs up front so a typo fails the request
+// instead of scanning nothing. It returns the range between them or nothing
+// if the request doesn't have any.
+func gitDiffRange(ctx context.Context, job *scanJob, gitDir string) (string, *proto.Error) {
+	request := job.request
+	diffRefs := request.Opts.DiffRefs
+	if diffRefs == nil {
+		return "", nil
+	}
+
+	baseCommit, baseErr := git.RevParse(ctx, gitDir, diffRefs.Base)
+	headCommit, headErr := git.RevParse(ctx, gitDir, diffRefs.Head)
+	if err := cmp.Or(baseErr, headErr); err != nil {
+		logger.Critical("scan failed: %v id=%q", err, request.ID)
+		return "", &proto.Error{
+			Code:    sourceErrorCode,
+			Message: "could not resolve diff refs",
+			Data:    request,
+		}
+	}
+
+	job.notes["diff_base_commit"] = baseCommit
+	job.notes["diff_head_commit"] = headCommit
+
+	return "^" + baseCommit + " " + headCommit, nil
+}
+
+// listGitSubmodules sets the submodules to scan once the superproject is done
+func listGitSubmodules(ctx context.Context, job *scanJob, gitRepoInfo git.RepoInfo) {
+	request := job.request
 
-		var scanErr *proto.Error
+	if request.Opts.Local && len(gitRepoInfo.WorkingTreePath) == 0 {
+		logger.Warning("skipping submodules since the local repo has no working tree: id=%q", request.ID)
+		return
+	}
+
+	if stoppedEarly(job.firstFinding) {
+		return
+	}
 
+	var err error
+	job.submodules, err = git.Submodules(ctx, gitRepoInfo.GitDir, "HEAD")
+	if err != nil {
+		logger.Error("could not list submodules: %v id=%q", err, request.ID)
+	}
+	job.workingTree = gitRepoInfo.WorkingTreePath
+}
+
+// scanGitArchive scans a GitRepo request's ref from the forge's archive
+// endpoint
+func (s *Scanner) scanGitArchive(ctx context.Context, job *scanJob) *proto.Error {
+	request := job.request
+
+	archiveURL, ok := gitArchiveURL(request.Resource, request.Opts.GitRef())
+	if !ok {
+		logger.Critical("scan failed: archive_fetch isn't supported for the remote: id=%q", request.ID)
+		return &proto.Error{
+			Code:    sourceErrorCode,
+			Message: "archive_fetch isn't supported for the remote",
+			Data:    request,
+		}
+	}
+
+	job.notes["archive_url"] = archiveURL
+	job.findings, job.err = betterleaks.ScanGitArchive(ctx, job.detector, archiveURL, betterleaks.GitArchiveScanOpts{
+		Client:    s.httpClient,
+		UserAgent: request.Opts.UserAgent,
+	})
+
+	return nil
+}
+
+// openGitRepo returns the info for the local repo or clones the remote one.
+// Any temp files are removed when it fails.
+func (s *Scanner) openGitRepo(ctx context.Context, request *proto.Request) (git.RepoInfo, *proto.Error) {
+	if !request.Opts.Local {
+		// Both diff refs have to be in the clone so it can't be limited to
+		// a single ref
+		cloneOpts := request.Opts
+		if request.Opts.DiffRefs != nil {
+			cloneOpts.Ref, cloneOpts.Branch = "", ""
+		}
+
+		// Clone the repo and get its gitRepoInfo
+		gitRepoInfo, err := s.cloneGitRepo(ctx, request.Resource, cloneOpts)
 		if err != nil {
+			removeTempGitFiles(request, gitRepoInfo)
+
 			select {
 			case <-ctx.Done():
-				s.respondWithError(request, &proto.Error{
-					Code:    timeoutErrorCode,
-					Message: "operation timed out",
+				return gitRepoInfo, &proto.Error{
+					Code:    cloneErrorCode,
+					Message: "clone operation timed out",
 					Data:    request,
-				})
-				return
+				}
 			default:
-				scanErr = &proto.Error{
-					Code:    scanErrorCode,
-					Message: err.Error(),
+				logger.Critical("scan failed: could not clone git repo: %v id=%q", err, request.ID)
+
+				message := "could not clone git repo"
+				if errors.Is(err, git.ErrRemoteUnreachable) {
+					message = "remote unreachable"
+				}
+
+				return gitRepoInfo, &proto.Error{
+					Code:    cloneErrorCode,
+					Message: message,
 					Data:    request,
 				}
-				logger.Error("scan error: %v id=%q", scanErr, request.ID)
 			}
 		}
 
-		results := make([]*proto.Result, len(findings))
-		for i, finding := range findings {
-			results[i] = findingToResult(request, &finding)
+		return gitRepoInfo, nil
+	}
+
+	if !s.allowLocal {
+		logger.Critical("scan failed: local scans are not allowed: id=%q", request.ID)
+		return git.RepoInfo{}, &proto.Error{
+			Code:    localScanNotAllowedCode,
+			Message: "local scans not allowed",
+			Data:    request,
+		}
+	}
+
+	// Load the gitRepoInfo from the repo
+	gitRepoInfo, err := git.GetRepoInfo(ctx, request.Resource)
+	if err != nil {
+		logger.Critical("scan failed: could not get git repo info: %v id=%q", err, request.ID)
+		removeTempGitFiles(request, gitRepoInfo)
+		return gitRepoInfo, &proto.Error{
+			Code:    sourceErrorCode,
+			Message: "could not get git repo info",
+			Data:    request,
+		}
+	}
+
+	if gitRepoInfo.IsBare && (request.Opts.Staged || request.Opts.Unstaged) {
+		logger.Critical("scan failed: staged and unstaged scans need a working tree: id=%q", request.ID)
+		return gitRepoInfo, &proto.Error{
+			Code:    sourceErrorCode,
+			Message: "staged and unstaged scans need a working tree",
+			Data:    request,
+		}
+	}
+
+	// Record where the ref was at like clones do so it's clear what was
+	// scanned
+	if ref := request.Opts.GitRef(); len(ref) > 0 {
+		if gitRepoInfo.HeadCommit, err = git.RevParse(ctx, gitRepoInfo.GitDir, ref); err != nil {
+			logger.Critical("scan failed: %v id=%q", err, request.ID)
+			removeTempGitFiles(request, gitRepoInfo)
+			return gitRepoInfo, &proto.Error{
+				Code:    sourceErrorCode,
+				Message: "could not resolve ref",
+				Data:    request,
+			}
+		}
+	}
+
+	return gitRepoInfo, nil
+}
+
+// incrementalGitExclusion returns the exclusion that skips the history the
+// last incremental scan covered. Since is set instead when the last scan's
+// head commit isn't in the repo (e.g. a force push dropped it).
+func incrementalGitExclusion(ctx context.Context, job *scanJob, gitDir string) string {
+	request := job.request
+	headCommit := job.previousScan.HeadCommit
+	if len(headCommit) == 0 || len(request.Opts.Since) > 0 || !incrementalCommitRange(request) {
+		return ""
+	}
+
+	if _, err := git.RevParse(ctx, gitDir, headCommit); err != nil {
+		request.Opts.Since = incrementalSince(job.previousScan.Time)
+		logger.Info("last scanned commit not found; scanning incrementally: since=%q id=%q", request.Opts.Since, request.ID)
+		return ""
+	}
+
+	logger.Info("scanning incrementally: commit_range=%q id=%q", headCommit+"..", request.ID)
+
+	return "^" + headCommit
+}
+
+// loadGitSourceConfig loads the .gitleaks* files from the ref being scanned.
+// Bare clones get a temp worktree with just those files that's removed with
+// the rest of the temp git files. Local bare repos are read as is so nothing
+// is written to them.
+func (s *Scanner) loadGitSourceConfig(ctx context.Context, job *scanJob, gitRepoInfo *git.RepoInfo) {
+	request := job.request
+
+	// The source config comes from what's being scanned
+	configRef := request.Opts.GitRef()
+	if request.Opts.DiffRefs != nil {
+		configRef = request.Opts.DiffRefs.Head
+	}
+
+	showConfig := gitRepoInfo.IsBare && (request.Opts.Local || s.sourceConfigStrategy == showSourceConfig)
+	if gitRepoInfo.IsBare && !showConfig {
+		var err error
+		gitRepoInfo.WorkingTreePath, err = tempCheckoutGitSourceConfigFiles(ctx, gitRepoInfo.GitDir, configRef)
+		if err != nil {
+			// This also fails when the ref doesn't have any .gitleaks*
+			// files so it's only a problem if git show finds some
+			logger.Debug("could not set up temp working tree for bare repo: %v id=%q", err, request.ID)
+			showConfig = true
+		}
+	}
+
+	// Bare repos have no working tree to load from so the config is shown
+	// from the ref instead
+	if showConfig {
+		showGitSourceConfig(ctx, job.detector, gitRepoInfo.GitDir, configRef, request.ID)
+	}
+
+	// Load the checked out config from the working tree
+	s.loadSourceConfig(job, gitRepoInfo.WorkingTreePath, "")
+}
+
+// gitRevisionRange returns the revisions to scan with the exclusions in front
+// of them, e.g. "^exclusion1 ^exclusion2 ref"
+func gitRevisionRange(request *proto.Request, diffRange, incrementalExclusion string) string {
+	revisionRange := request.Opts.GitRef()
+	if len(diffRange) > 0 {
+		revisionRange = diffRange
+	}
+	if len(incrementalExclusion) > 0 {
+		revisionRange = incrementalExclusion + " " + revisionRange
+	}
+
+	exclusionsLen := len(request.Opts.Exclusions)
+	if exclusionsLen > 0 {
+		items := make([]string, len(request.Opts.Exclusions)+1)
+		for i, item := range request.Opts.Exclusions {
+			items[i] = "^" + item
+		}
+		items[exclusionsLen] = revisionRange
+		revisionRange = strings.Join(items, " ")
+	}
+
+	return revisionRange
+}
+
+// scanGitLFSObjects notes the LFS pointers the git scan found and scans the
+// objects they point to when the request asks for it
+func scanGitLFSObjects(ctx context.Context, job *scanJob, gitDir string) {
+	pointers := job.lfsPointers.List()
+	if len(pointers) == 0 {
+		return
+	}
+
+	job.notes["lfs_pointers"] = strconv.Itoa(len(pointers))
+
+	if job.request.Opts.FetchLFS && job.err == nil && !stoppedEarly(job.firstFinding) {
+		var fetched int
+
+		// The detector keeps its findings between scans so this returns the
+		// git findings followed by the LFS object ones
+		job.lfsObjectsStart = len(job.findings)
+		job.findings, fetched, job.err = betterleaks.ScanLFSObjects(ctx, job.detector, gitDir, pointers)
+		job.notes["lfs_objects_scanned"] = strconv.Itoa(fetched)
+	}
+}
+
+// scanFiles scans a Files request's local path
+func (s *Scanner) scanFiles(ctx context.Context, job *scanJob) *proto.Error {
+	request := job.request
+
+	if !s.allowLocal {
+		logger.Critical("scan failed: local scans not allowed: id=%q", request.ID)
+		return &proto.Error{
+			Code:    localScanNotAllowedCode,
+			Message: "local scans not allowed",
+			Data:    request,
+		}
+	}
+
+	s.loadSourceConfig(job, request.Resource, request.Resource)
+
+	progress := &betterleaks.FilesProgress{}
+	s.filesProgress.Store(request.ID, progress)
+	defer s.filesProgress.Delete(request.ID)
+
+	job.findings, job.err = betterleaks.ScanFiles(ctx, job.detector, request.Resource, betterleaks.FilesScanOpts{
+		BinaryFilter: job.binaryFilter,
+		Concurrency:  s.filesConcurrency,
+		Progress:     progress,
+		Since:        request.Opts.Since,
+	})
+
+	return nil
+}
+
+// scanContainerImage scans a ContainerImage request's image
+func (s *Scanner) scanContainerImage(ctx context.Context, job *scanJob) {
+	request := job.request
+
+	containerImageScanOpts := betterleaks.ContainerImageScanOpts{
+		AllowedTransports:   s.allowedImageTransports,
+		Arch:                request.Opts.Arch,
+		BinaryFilter:        job.binaryFilter,
+		CACert:              s.registryCACert,
+		CertsDir:            s.registryCertsDir,
+		DecompressionLimits: s.decompressionLimits,
+		Depth:               scanDepth(request.Opts.Depth, s.maxScanDepth),
+		Exclusions:          request.Opts.Exclusions,
+		LayerRange:          request.Opts.LayerRange,
+		Since:               request.Opts.Since,
+		UserAgent:           request.Opts.UserAgent,
+	}
+	if job.checkpoint != nil {
+		containerImageScanOpts.Checkpoint = job.checkpoint
+	}
+
+	job.findings, job.err = betterleaks.ScanContainerImage(ctx, job.detector, request.Resource, containerImageScanOpts)
+}
+
+// resumable reports whether the request's scan can be checkpointed
+func resumable(request *proto.Request) bool {
+	switch request.Kind {
+	case proto.GitRepoRequestKind:
+		return !request.Opts.Staged && !request.Opts.Unstaged
+	case proto.ContainerImageRequestKind:
+		return true
+	default:
+		return false
+	}
+}
+
+// loadCheckpoint returns the request's checkpoint or nil if it can't be
+// loaded, in which case the scan starts over
+func (s *Scanner) loadCheckpoint(request *proto.Request) *scanCheckpoint {
+	path, err := scanCheckpointPath(s.checkpointsDir, request)
+	if err == nil {
+		var checkpoint *scanCheckpoint
+		if checkpoint, err = loadScanCheckpoint(path); err == nil {
+			return checkpoint
+		}
+	}
+
+	logger.Warning("could not load checkpoint, scanning from the start: %v id=%q", err, request.ID)
+
+	return nil
+}
+
+// stoppedEarly reports whether the scan stopped at its first finding
+func stoppedEarly(firstFinding *betterleaks.FirstFinding) bool {
+	return firstFinding != nil && firstFinding.Stopped()
+}
+
+// scanResponse builds the response for a completed scan. Any findings are
+// included even if the scan failed or timed out since partial results are
+// better than none.
+func scanResponse(ctx context.Context, request *proto.Request, findings []report.Finding, err error) *proto.Response {
+	var scanErr *proto.Error
+
+	// Sources can stop reading at the deadline without returning an error so
+	// check it too, otherwise a scan that ran out of time looks complete
+	if err == nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		select {
+		case <-ctx.Done():
+			scanErr = &proto.Error{
+				Code:    timeoutErrorCode,
+				Message: "operation timed out",
+				Data:    request,
+			}
+		default:
+			scanErr = &proto.Error{
+				Code:    scanErrorCode,
+				Message: err.Error(),
+				Data:    request,
+			}
+		}
+		logger.Error("scan error: %v id=%q partial_results=%d", scanErr, request.ID, len(findings))
+	}
+
+	results := make([]*proto.Result, len(findings))
+	for i, finding := range findings {
+		results[i] = findingToResult(request, &finding)
+	}
+
+	return &proto.Response{
+		ID:        id.ID(),
+		Kind:      proto.ScanResultsResponseKind,
+		RequestID: request.ID,
+		Error:     scanErr,
+		Results:   results,
+		Resource:  request.Resource,
+	}
+}
+
+func (s *Scanner) errorResponse(ctx context.Context, request *proto.Request, err *proto.Error) *proto.Response {
+	trace.SpanFromContext(ctx).SetStatus(codes.Error, err.Message)
+	logger.Error("scan error: %v id=%q", err, request.ID)
+
+	return &proto.Response{
+		ID:        id.ID(),
+		Kind:      proto.ScanResultsResponseKind,
+		RequestID: request.ID,
+		Error:     err,
+	}
+}
+
+// resultIDStrategy returns the strategy or the default one if it isn't known
+func resultIDStrategy(strategy string) string {
+	switch strategy {
+	case locationResultIDs, secretResultIDs:
+		return strategy
+	case "":
+		return locationResultIDs
+	default:
+		logger.Warning("unknown result id strategy, using the default: result_id_strategy=%q default=%q", strategy, locationResultIDs)
+		return locationResultIDs
+	}
+}
+
+// sourceConfigStrategy returns the strategy or the default one if it isn't
+// known
+func sourceConfigStrategy(strategy string) string {
+	switch strategy {
+	case checkoutSourceConfig, showSourceConfig:
+		return strategy
+	case "":
+		return checkoutSourceConfig
+	default:
+		logger.Warning("unknown source config strategy, using the default: source_config_strategy=%q default=%q", strategy, checkoutSourceConfig)
+		return checkoutSourceConfig
+	}
+}
+
+// setRemediations adds the configured remediation for each result's rule
+func setRemediations(results []*proto.Result, remediations map[string]string) {
+	if len(remediations) == 0 {
+		return
+	}
+
+	for _, result := range results {
+		result.Rule.Remediation = remediations[result.Rule.ID]
+	}
+}
+
+// sortResults orders the results by path, line and rule. The rest of the
+// fields break ties so the order doesn't depend on how detection went.
+func sortResults(results []*proto.Result) {
+	slices.SortFunc(results, func(a, b *proto.Result) int {
+		return cmp.Or(
+			cmp.Compare(a.Location.Path, b.Location.Path),
+			cmp.Compare(a.Location.Start.Line, b.Location.Start.Line),
+			cmp.Compare(a.Rule.ID, b.Rule.ID),
+			cmp.Compare(a.Location.Start.Column, b.Location.Start.Column),
+			cmp.Compare(a.Location.Version, b.Location.Version),
+			cmp.Compare(a.Secret, b.Secret),
+			cmp.Compare(a.ID, b.ID),
+		)
+	})
+}
+
+// setSecretResultIDs replaces the result IDs with ones that only depend on
+// the resource, rule and secret. Results must be in the same order as the
+// findings.
+func setSecretResultIDs(request *proto.Request, results []*proto.Result, findings []report.Finding) {
+	for i, finding := range findings {
+		results[i].ID = id.ID(request.Resource, finding.RuleID, finding.Secret)
+	}
+}
+
+// setDecodeParentIDs links results found in decoded text back to the result
+// for the encoded text they were decoded from so consumers can group the
+// decode chain of a single secret. A result's parent is the one with the next
+// lowest decode depth whose location contains its location. Results must be
+// in the same order as the findings.
+func setDecodeParentIDs(results []*proto.Result, findings []report.Finding) {
+	depths := make([]int, len(findings))
+	for i := range findings {
+		depths[i] = decodeDepth(&findings[i])
+	}
+
+	for i, finding := range findings {
+		if depths[i] == 0 {
+			continue
+		}
+
+		parent := -1
+		for j, candidate := range findings {
+			if depths[j] >= depths[i] || candidate.Commit != finding.Commit || candidate.File != finding.File {
+				continue
+			}
+
+			if !findingContains(&candidate, &finding) {
+				continue
+			}
+
+			// Prefer the closest decode depth and then the tightest location
+			if parent < 0 || depths[j] > depths[parent] || (depths[j] == depths[parent] && findingContains(&findings[parent], &candidate)) {
+				parent = j
+			}
+		}
+
+		if parent >= 0 {
+			results[i].ParentID = results[parent].ID
+		}
+	}
+}
+
+// decodeDepth returns how many decoding passes it took to find the secret
+// based on the "decode-depth:" tag gitleaks adds to the finding
+func decodeDepth(finding *report.Finding) int {
+	for _, tag := range finding.Tags {
+		if rawDepth, ok := strings.CutPrefix(tag, "decode-depth:"); ok {
+			if depth, err := strconv.Atoi(rawDepth); err == nil {
+				return depth
+			}
+		}
+	}
+
+	return 0
+}
+
+// findingContains checks if the inner finding's location is within the outer
+// finding's location
+func findingContains(outer, inner *report.Finding) bool {
+	startsBefore := outer.StartLine < inner.StartLine ||
+		(outer.StartLine == inner.StartLine && outer.StartColumn <= inner.StartColumn)
+	endsAfter := outer.EndLine > inner.EndLine ||
+		(outer.EndLine == inner.EndLine && outer.EndColumn >= inner.EndColumn)
+
+	return startsBefore && endsAfter
+}
+
+// tagLFSResults adds an lfs_pointer note with the object ID to results found
+// in LFS pointer files and an lfs_object note to results found in the objects
+// themselves. Results must be in the same order as the findings and those
+// from objectsStart on are from LFS objects (-1 if none were scanned).
+func tagLFSResults(results []*proto.Result, findings []report.Finding, pointers *betterleaks.LFSPointers, objectsStart int) {
+	for i, finding := range findings {
+		pointer, ok := pointers.Get(finding.Commit, finding.File)
+		if !ok {
+			continue
+		}
+
+		if objectsStart >= 0 && i >= objectsStart {
+			results[i].Notes["lfs_object"] = pointer.OID
+		} else {
+			results[i].Notes["lfs_pointer"] = pointer.OID
+		}
+	}
+}
+
+// historyTruncated checks if a shallow repo is missing commits newer than
+// since and returns the date its available history starts at if it is
+func historyTruncated(ctx context.Context, gitDir, since string) (string, bool) {
+	sinceDate, err := time.Parse(time.DateOnly, since)
+	if err != nil {
+		logger.Debug("could not parse since date: %v since=%q", err, since)
+		return "", false
+	}
+
+	boundaryDate, shallow, err := git.ShallowBoundaryDate(ctx, gitDir)
+	if err != nil {
+		logger.Warning("could not check for truncated history: %v git_dir=%q", err, gitDir)
+		return "", false
+	}
+
+	if !shallow || !boundaryDate.After(sinceDate) {
+		return "", false
+	}
+
+	return boundaryDate.Format(time.RFC3339), true
+}
+
+// setIntroducedByContacts replaces the findings' authors with the authors of
+// the commits that first added their secrets to the file. The secret may have
+// been added before the commit the finding is in (e.g. when the line was
+// changed later). Findings keep their authors if that can't be worked out.
+func setIntroducedByContacts(ctx context.Context, gitDir string, findings []report.Finding) {
+	type secretInFile struct {
+		commit string
+		path   string
+		secret string
+	}
+
+	authors := make(map[secretInFile]git.Author)
+
+	for i := range findings {
+		finding := &findings[i]
+		if len(finding.Commit) == 0 || len(finding.File) == 0 || len(finding.Secret) == 0 || ctx.Err() != nil {
+			continue
+		}
+
+		key := secretInFile{commit: finding.Commit, path: finding.File, secret: finding.Secret}
+		author, ok := authors[key]
+		if !ok {
+			var found bool
+			var err error
+
+			author, found, err = git.IntroducedBy(ctx, gitDir, finding.Commit, finding.File, finding.Secret)
+			if err != nil {
+				logger.Warning("could not find who introduced the secret: %v commit=%q path=%q", err, finding.Commit, finding.File)
+			}
+
+			if !found {
+				author = git.Author{Name: finding.Author, Email: finding.Email}
+			}
+
+			authors[key] = author
 		}
 
-		logger.Info("queueing response: id=%q queue_size=%d", request.ID, s.responseQueue.Size()+1)
-		s.responseQueue.Send(&queue.Message[*proto.Response]{
-			Priority: msg.Priority,
-			Value: &proto.Response{
-				ID:        id.ID(),
-				Kind:      proto.ScanResultsResponseKind,
-				RequestID: request.ID,
-				Error:     scanErr,
-				Results:   results,
-				Resource:  request.Resource,
-			},
-		})
-	})
+		finding.Author = author.Name
+		finding.Email = author.Email
+	}
 }
 
-func (s *Scanner) respondWithError(request *proto.Request, err *proto.Error) {
-	logger.Info("queueing response: id=%q queue_size=%d", request.ID, s.responseQueue.Size()+1)
-	logger.Error("scan error: %v id=%q", err, request.ID)
-	s.responseQueue.Send(&queue.Message[*proto.Response]{
-		Priority: request.Opts.Priority,
-		Value: &proto.Response{
-			ID:        id.ID(),
-			Kind:      proto.ScanResultsResponseKind,
-			RequestID: request.ID,
-			Error:     err,
-		},
-	})
+// setDiffHunkNotes adds a diff_hunk note to each result with the hunk its
+// finding is in so the surrounding changes can be seen. Results must be in
+// the same order as the findings.
+func setDiffHunkNotes(results []*proto.Result, findings []report.Finding, hunks []git.Hunk) {
+	for i, finding := range findings {
+		for _, hunk := range hunks {
+			if hunk.Path == finding.File && hunk.Contains(finding.StartLine) {
+				results[i].Notes["diff_hunk"] = hunk.Text
+				break
+			}
+		}
+	}
 }
 
 // removeTempGitFiles clears out any temp files or directories that were created for the scan
@@ -338,13 +1562,102 @@ func removeTempGitFiles(request *proto.Request, gitRepoInfo git.RepoInfo) {
 	}
 
 	// Remove temp git working tree created for accessing certain files from bare repos
-	if gitRepoInfo.IsBare && fs.PathExists(gitRepoInfo.WorkingTreePath) {
+	if !request.Opts.Local && gitRepoInfo.IsBare && len(gitRepoInfo.WorkingTreePath) > 0 && fs.PathExists(gitRepoInfo.WorkingTreePath) {
 		if err := os.RemoveAll(gitRepoInfo.WorkingTreePath); err != nil {
 			logger.Error("error removing temp working tree: %v path=%q id=%q", err, gitRepoInfo.WorkingTreePath, request.ID)
 		}
 	}
 }
 
+// findingEncodings returns the encodings gitleaks decoded to find the secret
+// based on the "decoded:" tags it adds to the finding
+func findingEncodings(finding *report.Finding) []string {
+	encodings := []string{}
+
+	for _, tag := range finding.Tags {
+		if encoding, ok := strings.CutPrefix(tag, "decoded:"); ok {
+			encodings = append(encodings, encoding)
+		}
+	}
+
+	return encodings
+}
+
+// scpLikeRemote matches remotes like git@github.com:org/repo.git
+var scpLikeRemote = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):(.+)$`)
+
+// gitPermalink builds a link to the line in the forge's web UI or returns an
+// empty string if the remote isn't on a known forge
+func gitPermalink(remote, commit, path string, line int) string {
+	if len(commit) == 0 || len(path) == 0 {
+		return ""
+	}
+
+	host, repoPath, ok := forgeRepo(remote)
+	if !ok {
+		return ""
+	}
+
+	segments := strings.Split(filepath.ToSlash(path), "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	escapedPath := strings.Join(segments, "/")
+
+	switch host {
+	case "github.com":
+		return fmt.Sprintf("https://github.com/%s/blob/%s/%s#L%d", repoPath, commit, escapedPath, line)
+	case "gitlab.com":
+		return fmt.Sprintf("https://gitlab.com/%s/-/blob/%s/%s#L%d", repoPath, commit, escapedPath, line)
+	default:
+		return ""
+	}
+}
+
+// gitArchiveURL returns the URL of a tarball of the ref's tree for remotes
+// on forges that serve them. An empty ref means the default branch.
+func gitArchiveURL(remote, ref string) (string, bool) {
+	host, repoPath, ok := forgeRepo(remote)
+	if !ok {
+		return "", false
+	}
+
+	switch host {
+	case "github.com":
+		return fmt.Sprintf("https://codeload.github.com/%s/tar.gz/%s", repoPath, cmp.Or(ref, "HEAD")), true
+	case "gitlab.com":
+		archiveURL := fmt.Sprintf("https://gitlab.com/api/v4/projects/%s/repository/archive.tar.gz", url.PathEscape(repoPath))
+		if len(ref) > 0 {
+			archiveURL += "?sha=" + url.QueryEscape(ref)
+		}
+		return archiveURL, true
+	default:
+		return "", false
+	}
+}
+
+// forgeRepo splits a remote into its lowercased host and its "owner/repo"
+// path without the .git suffix
+func forgeRepo(remote string) (host, repoPath string, ok bool) {
+	if strings.Contains(remote, "://") {
+		remoteURL, err := url.Parse(remote)
+		if err != nil {
+			return "", "", false
+		}
+
+		host, repoPath = remoteURL.Hostname(), remoteURL.Path
+	} else if match := scpLikeRemote.FindStringSubmatch(remote); match != nil {
+		host, repoPath = match[1], match[2]
+	}
+
+	repoPath = strings.TrimSuffix(strings.Trim(repoPath, "/"), ".git")
+	if !strings.Contains(repoPath, "/") {
+		return "", "", false
+	}
+
+	return strings.ToLower(host), repoPath, true
+}
+
 func findingToResult(request *proto.Request, finding *report.Finding) *proto.Result {
 	result := &proto.Result{
 		ID: id.ID(
@@ -357,12 +1670,13 @@ func findingToResult(request *proto.Request, finding *report.Finding) *proto.Res
 			strconv.Itoa(finding.EndColumn),
 			finding.RuleID,
 		),
-		Secret:  finding.Secret,
-		Match:   finding.Match,
-		Context: finding.Line,
-		Entropy: finding.Entropy,
-		Date:    finding.Date,
-		Notes:   map[string]string{},
+		Secret:    finding.Secret,
+		Match:     finding.Match,
+		Context:   finding.Line,
+		Entropy:   finding.Entropy,
+		Date:      finding.Date,
+		Encodings: findingEncodings(finding),
+		Notes:     map[string]string{},
 		Contact: proto.Contact{
 			Name:  finding.Author,
 			Email: finding.Email,
@@ -393,6 +1707,9 @@ func findingToResult(request *proto.Request, finding *report.Finding) *proto.Res
 		result.Notes["gitleaks_fingerprint"] = finding.Fingerprint
 		result.Notes["commit_message"] = finding.Message
 		result.Notes["repository"] = request.Resource
+		if permalink := gitPermalink(request.Resource, finding.Commit, finding.File, finding.StartLine); len(permalink) > 0 {
+			result.Notes["permalink"] = permalink
+		}
 		result.Kind = proto.GitCommitResultKind
 	case proto.ContainerImageRequestKind:
 		manifest := ""
@@ -423,7 +1740,107 @@ func findingToResult(request *proto.Request, finding *report.Finding) *proto.Res
 	return result
 }
 
-func loadSourceConfig(detector *detect.Detector, sourcePath string) {
+// newDetector creates a detector for the request with the scanner's settings
+// and any request specific overrides applied
+func (s *Scanner) newDetector(ctx context.Context, cfg *betterleaksconfig.Config, request *proto.Request) *detect.Detector {
+	detector := detect.NewDetectorContext(ctx, *cfg)
+	// Symlinks to directories are never followed and symlink loops fail to
+	// resolve so they're skipped, which prevents loops when this is enabled
+	detector.FollowSymlinks = request.Opts.FollowSymlinks
+	detector.IgnoreGitleaksAllow = false
+	detector.MaxArchiveDepth = s.requestMaxArchiveDepth(request)
+	detector.MaxDecodeDepth = s.maxDecodeDepth
+	detector.MaxTargetMegaBytes = 0
+	detector.NoColor = true
+	detector.Redact = 0
+	detector.Verbose = false
+	applyRuleEntropyOverrides(detector, request)
+
+	if s.caseInsensitivePaths {
+		foldPathAllowlists(detector)
+	}
+
+	if request.Opts.NoDecode {
+		detector.MaxDecodeDepth = 0
+	}
+
+	return detector
+}
+
+// requestMaxArchiveDepth returns the request's max_archive_depth clamped to
+// the configured limit or the config's max_archive_depth when it's unset
+func (s *Scanner) requestMaxArchiveDepth(request *proto.Request) int {
+	depth := request.Opts.MaxArchiveDepth
+	if depth <= 0 {
+		return s.maxArchiveDepth
+	}
+
+	if depth > s.maxArchiveDepthLimit {
+		logger.Warning("max_archive_depth exceeds the limit: max_archive_depth=%d limit=%d id=%q", depth, s.maxArchiveDepthLimit, request.ID)
+		return s.maxArchiveDepthLimit
+	}
+
+	return depth
+}
+
+// applyRuleEntropyOverrides raises the min entropy of the rules listed in the
+// request's RuleEntropyOverrides for this detector only
+func applyRuleEntropyOverrides(detector *detect.Detector, request *proto.Request) {
+	if len(request.Opts.RuleEntropyOverrides) == 0 {
+		return
+	}
+
+	rules := cloneRules(&detector.Config)
+	for ruleID, entropy := range request.Opts.RuleEntropyOverrides {
+		rule, ok := rules[ruleID]
+		if !ok {
+			logger.Warning("skipping entropy override: rule not found: rule_id=%q id=%q", ruleID, request.ID)
+			continue
+		}
+
+		if entropy <= rule.Entropy {
+			logger.Warning(
+				"skipping entropy override: not above the rule's entropy: rule_id=%q entropy=%f rule_entropy=%f id=%q",
+				ruleID, entropy, rule.Entropy, request.ID,
+			)
+			continue
+		}
+
+		logger.Info("applying entropy override: rule_id=%q entropy=%f rule_entropy=%f id=%q", ruleID, entropy, rule.Entropy, request.ID)
+		rule.Entropy = entropy
+		rules[ruleID] = rule
+	}
+
+	detector.Config.Rules = rules
+}
+
+// cloneRules returns a copy of the config's rules to update. The rules map is
+// shared with the cached config so it must not be updated in place.
+func cloneRules(cfg *betterleaksconfig.Config) map[string]betterleaksconfig.Rule {
+	return maps.Clone(cfg.Rules)
+}
+
+// loadSourceConfig applies the gitleaks config files found in the source to
+// the job's detector and then folds its path allowlists and moves them into
+// the job's allowlist report like newScanJob does for the patterns' config.
+// pathPrefix is what the paths in the findings will start with for files
+// under sourcePath (e.g. "" for git repos since their paths are relative)
+func (s *Scanner) loadSourceConfig(job *scanJob, sourcePath, pathPrefix string) {
+	loadSourceConfigFiles(job, sourcePath, pathPrefix)
+
+	if s.caseInsensitivePaths {
+		foldPathAllowlists(job.detector)
+	}
+
+	if job.allowlists != nil {
+		job.allowlists.Disable(job.detector)
+	}
+}
+
+// loadSourceConfigFiles adds the allowlists, baseline and ignores from the
+// gitleaks config files in sourcePath to the job's detector
+func loadSourceConfigFiles(job *scanJob, sourcePath, pathPrefix string) {
+	detector := job.detector
 	if !fs.DirExists(sourcePath) {
 		logger.Debug("skipping additional config: source path does not exist: path=%q", sourcePath)
 		return
@@ -443,11 +1860,23 @@ func loadSourceConfig(detector *detect.Detector, sourcePath string) {
 		logger.Debug("no additional config")
 	}
 
+	loadNestedSourceConfigs(detector, sourcePath, pathPrefix)
+
 	baselinePath := filepath.Join(sourcePath, ".gitleaksbaseline")
 	if fs.FileExists(baselinePath) {
 		logger.Debug("applying .gitleaksbaseline: path=%q", baselinePath)
-		if err := detector.AddBaseline(baselinePath, sourcePath); err != nil {
+		baseline, err := detect.LoadBaseline(baselinePath)
+		if err == nil && len(job.requestBaseline) == 0 {
+			err = detector.AddBaseline(baselinePath, sourcePath)
+		} else if err == nil {
+			baseline = append(baseline, job.requestBaseline...)
+			err = addBaseline(detector, baseline)
+		}
+
+		if err != nil {
 			logger.Error("could not add baseline: %v", err)
+		} else {
+			job.ignores.SetBaseline(baseline)
 		}
 	}
 
@@ -456,39 +1885,272 @@ func loadSourceConfig(detector *detect.Detector, sourcePath string) {
 		logger.Debug("applying .gitleaksignore: path=%q", ignorePath)
 		if err := detector.AddGitleaksIgnore(ignorePath); err != nil {
 			logger.Error("could not add gitleaksignore: %v", err)
+		} else if err := job.ignores.AddGitleaksIgnore(ignorePath); err != nil {
+			logger.Error("could not add gitleaksignore: %v", err)
 		}
 	}
 }
 
-func (s *Scanner) cloneGitRepo(ctx context.Context, cloneURL string, opts proto.Opts) (git.RepoInfo, error) {
-	cloneArgs := []string{"clone"}
-	gitRepoInfo := git.RepoInfo{}
+// addBaseline replaces the detector's baseline with these findings. The
+// detector can only load baselines from files so they're written to a temp
+// .gitleaksbaseline first, which also keeps the source's .gitleaksbaseline
+// from being scanned like it is when it's loaded directly.
+func addBaseline(detector *detect.Detector, baseline []report.Finding) error {
+	data, err := json.Marshal(baseline)
+	if err != nil {
+		return fmt.Errorf("could not encode baseline: %w", err)
+	}
 
-	if len(opts.Proxy) > 0 {
-		cloneArgs = append(cloneArgs, "--config")
-		cloneArgs = append(cloneArgs, "http.proxy="+opts.Proxy)
+	tempDir, err := os.MkdirTemp("", "leaktk-baseline-")
+	if err != nil {
+		return fmt.Errorf("could not create baseline dir: %w", err)
+	}
+	defer func() {
+		if err := os.RemoveAll(tempDir); err != nil {
+			logger.Debug("could not remove baseline dir: %v path=%q", err, tempDir)
+		}
+	}()
+
+	baselinePath := filepath.Join(tempDir, ".gitleaksbaseline")
+	if err := os.WriteFile(baselinePath, data, 0600); err != nil {
+		return fmt.Errorf("could not write baseline: %w", err)
 	}
 
-	// The --[no-]single-branch flags are still needed with mirror due to how
-	// things like --depth and --shallow-since behave
-	if len(opts.Branch) > 0 {
-		if !git.RemoteRefExists(ctx, cloneURL, opts.Branch) {
-			return gitRepoInfo, fmt.Errorf("remote ref does not exist: ref=%q", opts.Branch)
+	return detector.AddBaseline(baselinePath, tempDir)
+}
+
+// loadNestedSourceConfigs merges the allowlists from .gitleaks.toml files
+// below the source root. Like .gitignore files, each one only applies to the
+// directory it's in, so its allowlists are scoped to that subtree. Rules in
+// these configs are ignored so they can't change the global pattern set.
+func loadNestedSourceConfigs(detector *detect.Detector, sourcePath, pathPrefix string) {
+	var ruleAllowlists []*betterleaksconfig.Allowlist
+	root := filepath.Clean(sourcePath)
+
+	err := filepath.WalkDir(root, func(path string, d os.DirEntry, err error) error {
+		if err != nil {
+			logger.Debug("skipping path while looking for nested configs: %v path=%q", err, path)
+			return nil
 		}
-		gitRepoInfo.IsBare = true
-		cloneArgs = append(cloneArgs, "--bare")
-		cloneArgs = append(cloneArgs, "--single-branch")
-		cloneArgs = append(cloneArgs, "--branch")
-		cloneArgs = append(cloneArgs, opts.Branch)
+
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+
+			return nil
+		}
+
+		dir := filepath.Dir(path)
+		if d.Name() != ".gitleaks.toml" || dir == root {
+			return nil
+		}
+
+		rawNestedConfig, err := os.ReadFile(path) // #nosec G304
+		if err != nil {
+			logger.Error("could not read nested config: %v path=%q", err, path)
+			return nil
+		}
+
+		nestedConfig, err := betterleaks.ParseConfig(string(rawNestedConfig))
+		if err != nil {
+			logger.Error("could not parse nested config: %v path=%q", err, path)
+			return nil
+		}
+
+		relDir, err := filepath.Rel(root, dir)
+		if err != nil {
+			logger.Error("could not determine nested config scope: %v path=%q", err, path)
+			return nil
+		}
+
+		scope := filepath.ToSlash(filepath.Join(pathPrefix, relDir))
+		logger.Debug("applying nested config: path=%q scope=%q", path, scope)
+		for _, allowlist := range nestedConfig.Allowlists {
+			for _, scoped := range scopeAllowlist(allowlist, scope) {
+				// Global allowlist paths are also used to skip files without
+				// checking the match condition, so AND allowlists are added to
+				// the rules instead where the condition is always respected
+				if scoped.MatchCondition == betterleaksconfig.AllowlistMatchAnd {
+					ruleAllowlists = append(ruleAllowlists, scoped)
+				} else {
+					detector.Config.Allowlists = append(detector.Config.Allowlists, scoped)
+				}
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		logger.Error("could not load nested configs: %v path=%q", err, sourcePath)
+	}
+
+	if len(ruleAllowlists) > 0 {
+		rules := cloneRules(&detector.Config)
+		for ruleID, rule := range rules {
+			rule.Allowlists = slices.Concat(rule.Allowlists, ruleAllowlists)
+			rules[ruleID] = rule
+		}
+
+		detector.Config.Rules = rules
+	}
+}
+
+// scopeAllowlist returns allowlists equivalent to the one provided but that
+// only match findings with paths under scope. Paths in the allowlist are
+// treated as relative to scope.
+func scopeAllowlist(allowlist *betterleaksconfig.Allowlist, scope string) []*betterleaksconfig.Allowlist {
+	scopePattern := "^" + regexp.QuoteMeta(scope) + "/"
+	scopePath := betterleaksregexp.MustCompile(scopePattern)
+
+	scopedPaths := make([]*betterleaksregexp.Regexp, 0, len(allowlist.Paths))
+	for _, path := range allowlist.Paths {
+		pattern := path.String()
+		if relPattern, ok := strings.CutPrefix(pattern, "^"); ok {
+			pattern = scopePattern + "(?:" + relPattern + ")"
+		} else {
+			pattern = scopePattern + ".*(?:" + pattern + ")"
+		}
+
+		scopedPath, err := betterleaksregexp.Compile(pattern)
+		if err != nil {
+			logger.Error("skipping nested allowlist: could not scope path: %v path=%q scope=%q", err, path, scope)
+			return nil
+		}
+
+		scopedPaths = append(scopedPaths, scopedPath)
+	}
+
+	var allowlists []*betterleaksconfig.Allowlist
+	if allowlist.MatchCondition == betterleaksconfig.AllowlistMatchAnd {
+		scoped := &betterleaksconfig.Allowlist{
+			Description:    allowlist.Description,
+			MatchCondition: betterleaksconfig.AllowlistMatchAnd,
+			Commits:        allowlist.Commits,
+			Paths:          scopedPaths,
+			RegexTarget:    allowlist.RegexTarget,
+			Regexes:        allowlist.Regexes,
+			StopWords:      allowlist.StopWords,
+		}
+
+		if len(scoped.Paths) == 0 {
+			scoped.Paths = []*betterleaksregexp.Regexp{scopePath}
+		}
+
+		allowlists = append(allowlists, scoped)
 	} else {
-		gitRepoInfo.IsBare = true
-		cloneArgs = append(cloneArgs, "--mirror")
-		cloneArgs = append(cloneArgs, "--no-single-branch")
+		// Any check matching is enough for an OR allowlist, so split it into
+		// an AND allowlist per check that also requires the scope to match
+		if len(scopedPaths) > 0 {
+			allowlists = append(allowlists, &betterleaksconfig.Allowlist{
+				Description: allowlist.Description,
+				Paths:       scopedPaths,
+			})
+		}
+
+		if len(allowlist.Commits) > 0 {
+			allowlists = append(allowlists, &betterleaksconfig.Allowlist{
+				Description:    allowlist.Description,
+				MatchCondition: betterleaksconfig.AllowlistMatchAnd,
+				Commits:        allowlist.Commits,
+				Paths:          []*betterleaksregexp.Regexp{scopePath},
+			})
+		}
+
+		if len(allowlist.Regexes) > 0 {
+			allowlists = append(allowlists, &betterleaksconfig.Allowlist{
+				Description:    allowlist.Description,
+				MatchCondition: betterleaksconfig.AllowlistMatchAnd,
+				Paths:          []*betterleaksregexp.Regexp{scopePath},
+				RegexTarget:    allowlist.RegexTarget,
+				Regexes:        allowlist.Regexes,
+			})
+		}
+
+		if len(allowlist.StopWords) > 0 {
+			allowlists = append(allowlists, &betterleaksconfig.Allowlist{
+				Description:    allowlist.Description,
+				MatchCondition: betterleaksconfig.AllowlistMatchAnd,
+				Paths:          []*betterleaksregexp.Regexp{scopePath},
+				StopWords:      allowlist.StopWords,
+			})
+		}
+	}
+
+	for _, scoped := range allowlists {
+		if err := scoped.Validate(); err != nil {
+			logger.Error("skipping nested allowlist: %v scope=%q", err, scope)
+			return nil
+		}
+	}
+
+	return allowlists
+}
+
+// Git ref types for the ref option
+const (
+	branchRef = "branch"
+	tagRef    = "tag"
+	commitRef = "commit"
+)
+
+// commitSHAPattern matches full SHA-1 and SHA-256 commit IDs
+var commitSHAPattern = regexp.MustCompile(`^(?:[0-9a-f]{40}|[0-9a-f]{64})$`)
+
+// remoteRefType returns whether ref is a branch, tag or commit based on the
+// refs on the remote that matched it. Commits can't be matched by ls-remote
+// so only a full SHA with no matching refs is treated as one.
+func remoteRefType(ref string, remoteRefs []string) (string, error) {
+	name := strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "refs/tags/")
+
+	// Prefer branches since that's what git clone --branch does
+	if slices.Contains(remoteRefs, "refs/heads/"+name) && !strings.HasPrefix(ref, "refs/tags/") {
+		return branchRef, nil
+	}
+
+	if slices.Contains(remoteRefs, "refs/tags/"+name) && !strings.HasPrefix(ref, "refs/heads/") {
+		return tagRef, nil
+	}
+
+	if len(remoteRefs) > 0 {
+		return "", fmt.Errorf("could not determine ref type; only branches, tags and full commit SHAs are supported: ref=%q remote_refs=%q", ref, remoteRefs)
+	}
+
+	if commitSHAPattern.MatchString(ref) {
+		return commitRef, nil
+	}
+
+	return "", fmt.Errorf("remote ref does not exist: ref=%q", ref)
+}
+
+func (s *Scanner) cloneGitRepo(ctx context.Context, cloneURL string, opts proto.Opts) (gitRepoInfo git.RepoInfo, err error) {
+	ctx, span := startSpan(ctx, "clone")
+	defer func() { endSpan(span, err) }()
+
+	release, err := s.acquireCloneSlot(ctx)
+	if err != nil {
+		return gitRepoInfo, err
+	}
+	defer release()
+
+	ref := opts.GitRef()
+	refType := ""
+	if len(ref) > 0 {
+		remoteRefs, err := git.RemoteRefs(ctx, cloneURL, ref, remoteRefTimeout)
+		if err != nil {
+			return gitRepoInfo, fmt.Errorf("could not check remote ref: %w ref=%q", err, ref)
+		}
+
+		if refType, err = remoteRefType(ref, remoteRefs); err != nil {
+			return gitRepoInfo, err
+		}
 	}
 
+	var historyArgs []string
 	if len(opts.Since) > 0 {
-		cloneArgs = append(cloneArgs, "--shallow-since")
-		cloneArgs = append(cloneArgs, opts.Since)
+		historyArgs = append(historyArgs, "--shallow-since")
+		historyArgs = append(historyArgs, opts.Since)
 
 		if opts.Depth > 0 {
 			logger.Warning(
@@ -501,15 +2163,49 @@ func (s *Scanner) cloneGitRepo(ctx context.Context, cloneURL string, opts proto.
 			)
 		}
 	} else if depth := cloneDepth(opts.Depth, s.maxScanDepth); depth > 0 {
-		cloneArgs = append(cloneArgs, "--depth")
-		cloneArgs = append(cloneArgs, strconv.Itoa(depth))
+		historyArgs = append(historyArgs, "--depth")
+		historyArgs = append(historyArgs, strconv.Itoa(depth))
 	}
 
-	// Include the clone URL
 	gitDir := filepath.Join(s.clonesDir, id.ID())
+	gitRepoInfo.GitDir = gitDir
+	gitRepoInfo.IsBare = true
+
+	if refType == commitRef {
+		// Commits can't be cloned directly so they're fetched into an empty repo
+		if err := fetchGitCommit(ctx, cloneURL, gitDir, ref, opts.Proxy, historyArgs); err != nil {
+			return gitRepoInfo, err
+		}
+
+		gitRepoInfo.HeadCommit = ref
+
+		return gitRepoInfo, nil
+	}
+
+	cloneArgs := []string{"clone"}
+
+	if len(opts.Proxy) > 0 {
+		cloneArgs = append(cloneArgs, "--config")
+		cloneArgs = append(cloneArgs, "http.proxy="+opts.Proxy)
+	}
+
+	// The --[no-]single-branch flags are still needed with mirror due to how
+	// things like --depth and --shallow-since behave
+	if len(ref) > 0 {
+		// --branch takes the short name of either a branch or a tag
+		cloneArgs = append(cloneArgs, "--bare")
+		cloneArgs = append(cloneArgs, "--single-branch")
+		cloneArgs = append(cloneArgs, "--branch")
+		cloneArgs = append(cloneArgs, strings.TrimPrefix(strings.TrimPrefix(ref, "refs/heads/"), "refs/tags/"))
+	} else {
+		cloneArgs = append(cloneArgs, "--mirror")
+		cloneArgs = append(cloneArgs, "--no-single-branch")
+	}
+
+	// Include the history limits and the clone URL
+	cloneArgs = append(cloneArgs, historyArgs...)
 	cloneArgs = append(cloneArgs, cloneURL, gitDir)
 	gitClone := git.CommandContext(ctx, cloneArgs...)
-	gitRepoInfo.GitDir = gitDir
 
 	logger.Debug("executing: %s", gitClone)
 	if output, err := gitClone.CombinedOutput(); err != nil {
@@ -520,9 +2216,74 @@ func (s *Scanner) cloneGitRepo(ctx context.Context, cloneURL string, opts proto.
 		return gitRepoInfo, fmt.Errorf("clone timeout exceeded: %w", ctx.Err())
 	}
 
+	// Record where the ref was at so it's clear what was scanned
+	if len(ref) > 0 {
+		headCommit, err := git.RevParse(ctx, gitDir, "HEAD")
+		if err != nil {
+			logger.Warning("could not resolve ref head commit: %v ref=%q ref_type=%q clone_url=%q", err, ref, refType, cloneURL)
+		}
+
+		gitRepoInfo.HeadCommit = headCommit
+	}
+
 	return gitRepoInfo, nil
 }
 
+// acquireCloneSlot waits until fewer than scanner.max_concurrent_clones clones
+// are running so bulk scans don't start more git processes than the host can
+// handle. The returned func must be called once the clone is done.
+func (s *Scanner) acquireCloneSlot(ctx context.Context) (func(), error) {
+	if s.cloneSlots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case s.cloneSlots <- struct{}{}:
+	default:
+		logger.Debug("waiting for a clone slot: max_concurrent_clones=%d", cap(s.cloneSlots))
+
+		select {
+		case s.cloneSlots <- struct{}{}:
+		case <-ctx.Done():
+			return nil, fmt.Errorf("timed out waiting for a clone slot: %w", ctx.Err())
+		}
+	}
+
+	return func() { <-s.cloneSlots }, nil
+}
+
+// fetchGitCommit fetches a single commit and its history into a new bare repo
+// at gitDir. The remote has to allow fetching commits by SHA, which most
+// hosts do for reachable commits.
+func fetchGitCommit(ctx context.Context, cloneURL, gitDir, commit, proxy string, historyArgs []string) error {
+	gitInit := git.CommandContext(ctx, "init", "--bare", "--quiet", gitDir) // #nosec G204
+	logger.Debug("executing: %s", gitInit)
+	if output, err := gitInit.CombinedOutput(); err != nil {
+		return fmt.Errorf("git init failed: %w cmd=%q output=%q", err, gitInit, output)
+	}
+
+	fetchArgs := []string{"-C", gitDir}
+	if len(proxy) > 0 {
+		fetchArgs = append(fetchArgs, "-c", "http.proxy="+proxy)
+	}
+
+	fetchArgs = append(fetchArgs, "fetch", "--quiet", "--no-tags")
+	fetchArgs = append(fetchArgs, historyArgs...)
+	fetchArgs = append(fetchArgs, cloneURL, commit)
+	gitFetch := git.CommandContext(ctx, fetchArgs...)
+
+	logger.Debug("executing: %s", gitFetch)
+	if output, err := gitFetch.CombinedOutput(); err != nil {
+		return fmt.Errorf("git fetch failed: %w cmd=%q output=%q", err, gitFetch, output)
+	}
+
+	if ctx != nil && ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("clone timeout exceeded: %w", ctx.Err())
+	}
+
+	return nil
+}
+
 // tempCheckoutGitSourceConfigFiles is used for bare clones that don't already
 // have working trees. The scanner currently expects certain files to exist
 // on the file system for loading additional repo configuration. This creates
@@ -537,7 +2298,7 @@ func tempCheckoutGitSourceConfigFiles(ctx context.Context, gitDir, gitRef string
 	if len(gitRef) == 0 {
 		gitRef = "HEAD"
 	}
-	cmd := git.CommandContext(ctx, "-C", gitDir, "--work-tree", worktreePath, "restore", "--source", gitRef, ".gitleaks*")
+	cmd := git.CommandContext(ctx, "-C", gitDir, "--work-tree", worktreePath, "restore", "--source", gitRef, ":(glob)**/.gitleaks*")
 	logger.Debug("executing: %s", cmd)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return worktreePath, fmt.Errorf("could not checkout scanner config files: %w cmd=%q (%s)", err, cmd, string(out))
@@ -545,6 +2306,31 @@ func tempCheckoutGitSourceConfigFiles(ctx context.Context, gitDir, gitRef string
 	return worktreePath, nil
 }
 
+// showGitSourceConfig loads the ref's root .gitleaks.toml with git show for
+// bare repos without a working tree. The other source config files can only
+// be loaded from disk so it warns about any in the ref that are skipped.
+func showGitSourceConfig(ctx context.Context, detector *detect.Detector, gitDir, gitRef, requestID string) {
+	gitRef = cmp.Or(gitRef, "HEAD")
+
+	rawConfig, exists, err := git.ShowFile(ctx, gitDir, gitRef, ".gitleaks.toml")
+	if err != nil {
+		logger.Warning("could not load the repo's .gitleaks.toml: %v id=%q", err, requestID)
+	} else if exists {
+		logger.Debug("applying additional config from git: ref=%q", gitRef)
+		if additionalConfig, err := betterleaks.ParseConfig(string(rawConfig)); err != nil {
+			logger.Error("could not parse additional config: %s", err)
+		} else {
+			detector.Config.Allowlists = append(detector.Config.Allowlists, additionalConfig.Allowlists...)
+		}
+	}
+
+	for _, name := range []string{".gitleaksignore", ".gitleaksbaseline"} {
+		if git.RunContext(ctx, "--git-dir", gitDir, "cat-file", "-e", gitRef+":"+name) == nil {
+			logger.Warning("repo config file not loaded since it couldn't be checked out: path=%q id=%q", name, requestID)
+		}
+	}
+}
+
 func splitFetchURLPatterns(patterns string) []string {
 	if len(patterns) == 0 {
 		return []string{}
@@ -1,17 +1,36 @@
 package scanner
 
 import (
+	"context"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/betterleaks/betterleaks/detect"
+	"github.com/betterleaks/betterleaks/report"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
+	betterleaksconfig "github.com/betterleaks/betterleaks/config"
+
+	"github.com/leaktk/leaktk/internal/git"
 	"github.com/leaktk/leaktk/pkg/config"
 	"github.com/leaktk/leaktk/pkg/proto"
+	"github.com/leaktk/leaktk/pkg/queue"
+	"github.com/leaktk/leaktk/pkg/scanner/betterleaks"
 )
 
 func TestScanner(t *testing.T) {
@@ -24,7 +43,8 @@ func TestScanner(t *testing.T) {
 	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(tempDir, "gitleaks.toml")
 
 	t.Run("RemoteScanSuccess", func(t *testing.T) {
-		scanner := NewScanner(cfg)
+		scanner, err := NewScanner(cfg)
+		require.NoError(t, err)
 		request := &proto.Request{
 			ID:       "test-remote-request",
 			Kind:     proto.GitRepoRequestKind,
@@ -88,7 +108,8 @@ func TestScanner(t *testing.T) {
 
 		var wg sync.WaitGroup
 
-		scanner := NewScanner(cfg)
+		scanner, err := NewScanner(cfg)
+		require.NoError(t, err)
 		scanner.Send(request)
 		wg.Add(1)
 
@@ -107,7 +128,8 @@ func TestScanner(t *testing.T) {
 	})
 
 	t.Run("GitleaksDecode", func(t *testing.T) {
-		scanner := NewScanner(cfg)
+		scanner, err := NewScanner(cfg)
+		require.NoError(t, err)
 		request := &proto.Request{
 			ID:       "test-request",
 			Kind:     proto.JSONDataRequestKind,
@@ -123,7 +145,7 @@ func TestScanner(t *testing.T) {
 			assert.Nil(t, response.Error)
 			assert.NotEmpty(t, response.Results)
 			assert.Equal(t, "I6gHcCmvOcbOMsLahRnrpTVk7-DUhzqOq9IzS1M7YoDWYkZ8pO9A7jc3Sky2cBEAYBLUpG6YPH7QgjmNry79Jg", response.Results[0].Secret)
-			assert.Equal(t, "value", response.Results[0].Location.Path)
+			assert.Equal(t, "/value", response.Results[0].Location.Path)
 			wg.Done()
 		})
 
@@ -141,7 +163,8 @@ func TestScanner(t *testing.T) {
 		}
 		var wg sync.WaitGroup
 
-		scanner := NewScanner(cfg)
+		scanner, err := NewScanner(cfg)
+		require.NoError(t, err)
 		scanner.Send(request)
 		wg.Add(1)
 
@@ -183,3 +206,1582 @@ func TestScanner(t *testing.T) {
 		}
 	})
 }
+
+func TestNewScannerCACertFile(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Workdir = t.TempDir()
+	cfg.TLS.CACertFile = filepath.Join(t.TempDir(), "missing.crt")
+
+	_, err := NewScanner(cfg)
+	require.ErrorContains(t, err, "ca cert file")
+}
+
+func TestNewScannerWorkdir(t *testing.T) {
+	cfg := config.DefaultConfig()
+	cfg.Scanner.Workdir = filepath.Join(t.TempDir(), "file", "scanner")
+	require.NoError(t, os.WriteFile(filepath.Dir(cfg.Scanner.Workdir), []byte{}, 0600))
+
+	_, err := NewScanner(cfg)
+	require.ErrorContains(t, err, "scanner.workdir must be a writable dir")
+}
+
+func TestScannerHTTPClient(t *testing.T) {
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, "token = secretvalue1\n")
+	}))
+	defer ts.Close()
+
+	caCertFile := filepath.Join(t.TempDir(), "ca.crt")
+	require.NoError(t, os.WriteFile(caCertFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ts.Certificate().Raw}), 0600))
+
+	// The scanner's client trusts the CA without changing any shared client
+	scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+		cfg.TLS.CACertFile = caCertFile
+	})
+
+	scanner.Send(&proto.Request{ID: "test-http-client", Kind: proto.URLRequestKind, Resource: ts.URL})
+	response := <-responses
+	require.Nil(t, response.Error)
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, "secretvalue1", response.Results[0].Secret)
+
+	_, err := betterleaks.ScanURL(t.Context(), detect.NewDetector(betterleaksconfig.Config{}), ts.URL, betterleaks.URLScanOpts{})
+	require.Error(t, err)
+}
+
+func TestScanResponse(t *testing.T) {
+	request := &proto.Request{
+		ID:       "test-request",
+		Kind:     proto.TextRequestKind,
+		Resource: "secret=foo",
+	}
+	findings := []report.Finding{
+		{RuleID: "test-rule", Secret: "foo", StartLine: 1, EndLine: 1},
+	}
+
+	t.Run("PartialResultsOnTimeout", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(t.Context(), time.Millisecond)
+		defer cancel()
+		<-ctx.Done()
+
+		response := scanResponse(ctx, request, findings, ctx.Err())
+		require.NotNil(t, response.Error)
+		assert.Equal(t, timeoutErrorCode, response.Error.Code)
+		require.Len(t, response.Results, 1)
+		assert.Equal(t, "foo", response.Results[0].Secret)
+	})
+
+	t.Run("ScanTimesOut", func(t *testing.T) {
+		// The server sends a secret and then stalls until the scan gives up
+		ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, err := io.WriteString(w, "token = secretvalue1\n"+strings.Repeat("x\n", 100_000))
+			assert.NoError(t, err)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		}))
+		defer ts.Close()
+
+		scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+			cfg.Scanner.ScanTimeout = 1
+		})
+
+		scanner.Send(&proto.Request{ID: "test-timeout", Kind: proto.URLRequestKind, Resource: ts.URL})
+
+		select {
+		case response := <-responses:
+			require.NotNil(t, response.Error)
+			assert.Equal(t, timeoutErrorCode, response.Error.Code)
+			require.Len(t, response.Results, 1)
+			assert.Equal(t, "secretvalue1", response.Results[0].Secret)
+		case <-time.After(10 * time.Second):
+			assert.FailNow(t, "scan never timed out")
+		}
+	})
+
+	t.Run("PartialResultsOnError", func(t *testing.T) {
+		response := scanResponse(t.Context(), request, findings, errors.New("oops"))
+		require.NotNil(t, response.Error)
+		assert.Equal(t, scanErrorCode, response.Error.Code)
+		assert.Len(t, response.Results, 1)
+	})
+
+	t.Run("NoError", func(t *testing.T) {
+		response := scanResponse(t.Context(), request, findings, nil)
+		assert.Nil(t, response.Error)
+		assert.Len(t, response.Results, 1)
+		assert.Equal(t, request.ID, response.RequestID)
+	})
+}
+
+func TestApplyRuleEntropyOverrides(t *testing.T) {
+	cfg, err := betterleaks.ParseConfig(`
+[[rules]]
+id = "noisy"
+regex = '''secret=[a-z]+'''
+entropy = 1.0
+
+[[rules]]
+id = "other"
+regex = '''token=[a-z]+'''
+entropy = 3.0
+`)
+	require.NoError(t, err)
+
+	detector := detect.NewDetectorContext(t.Context(), *cfg)
+	applyRuleEntropyOverrides(detector, &proto.Request{
+		ID: "test-request",
+		Opts: proto.Opts{
+			RuleEntropyOverrides: map[string]float64{
+				"noisy":   5.0,
+				"other":   2.0, // lower overrides are ignored
+				"missing": 5.0,
+			},
+		},
+	})
+
+	assert.InDelta(t, 5.0, detector.Config.Rules["noisy"].Entropy, 0)
+	assert.InDelta(t, 3.0, detector.Config.Rules["other"].Entropy, 0)
+	assert.NotContains(t, detector.Config.Rules, "missing")
+
+	// The shared config must not change
+	assert.InDelta(t, 1.0, cfg.Rules["noisy"].Entropy, 0)
+
+	findings, err := betterleaks.ScanReader(t.Context(), detector, strings.NewReader("secret=abcdefg"))
+	require.NoError(t, err)
+	assert.Empty(t, findings)
+
+	findings, err = betterleaks.ScanReader(t.Context(), detect.NewDetectorContext(t.Context(), *cfg), strings.NewReader("secret=abcdefg"))
+	require.NoError(t, err)
+	assert.Len(t, findings, 1)
+}
+
+func TestFindingToResult(t *testing.T) {
+	t.Run("Encodings", func(t *testing.T) {
+		result := findingToResult(
+			&proto.Request{Kind: proto.TextRequestKind},
+			&report.Finding{Tags: []string{"type:secret", "decoded:base64", "decoded:hex"}},
+		)
+
+		assert.Equal(t, []string{"base64", "hex"}, result.Encodings)
+		// Tags are kept for backwards compatibility
+		assert.Equal(t, []string{"type:secret", "decoded:base64", "decoded:hex"}, result.Rule.Tags)
+	})
+
+	t.Run("NoEncodings", func(t *testing.T) {
+		result := findingToResult(
+			&proto.Request{Kind: proto.TextRequestKind},
+			&report.Finding{Tags: []string{"type:secret"}},
+		)
+
+		assert.Empty(t, result.Encodings)
+	})
+
+	t.Run("Permalink", func(t *testing.T) {
+		result := findingToResult(
+			&proto.Request{Kind: proto.GitRepoRequestKind, Resource: "https://github.com/leaktk/fake-leaks.git"},
+			&report.Finding{Commit: "abc123", File: "dir/config file.json", StartLine: 3},
+		)
+
+		assert.Equal(t, "https://github.com/leaktk/fake-leaks/blob/abc123/dir/config%20file.json#L3", result.Notes["permalink"])
+	})
+}
+
+func TestResultIDStrategy(t *testing.T) {
+	request := &proto.Request{Kind: proto.FilesRequestKind, Resource: "/tmp/files"}
+	findings := []report.Finding{
+		{RuleID: "test-rule", Secret: "secretvalue1", File: "a.txt", StartLine: 1},
+		{RuleID: "test-rule", Secret: "secretvalue1", File: "a.txt", StartLine: 5},
+		{RuleID: "test-rule", Secret: "secretvalue2", File: "a.txt", StartLine: 5},
+	}
+
+	results := func() []*proto.Result {
+		results := make([]*proto.Result, len(findings))
+		for i, finding := range findings {
+			results[i] = findingToResult(request, &finding)
+		}
+		return results
+	}
+
+	t.Run("Location", func(t *testing.T) {
+		results := results()
+		assert.NotEqual(t, results[0].ID, results[1].ID)
+	})
+
+	t.Run("Secret", func(t *testing.T) {
+		results := results()
+		locationID := results[0].ID
+		setSecretResultIDs(request, results, findings)
+
+		assert.NotEqual(t, locationID, results[0].ID)
+		assert.Equal(t, results[0].ID, results[1].ID)
+		assert.NotEqual(t, results[1].ID, results[2].ID)
+	})
+
+	t.Run("Names", func(t *testing.T) {
+		assert.Equal(t, locationResultIDs, resultIDStrategy(""))
+		assert.Equal(t, locationResultIDs, resultIDStrategy("unknown"))
+		assert.Equal(t, secretResultIDs, resultIDStrategy("secret"))
+	})
+}
+
+func TestDecodeParentIDs(t *testing.T) {
+	request := &proto.Request{Kind: proto.FilesRequestKind, Resource: "/tmp/files"}
+	findings := []report.Finding{
+		{RuleID: "plain", Secret: "secretvalue1", File: "a.txt", StartLine: 1, EndLine: 1, StartColumn: 1, EndColumn: 60},
+		{RuleID: "base64", Secret: "secretvalue2", File: "a.txt", StartLine: 1, EndLine: 1, StartColumn: 10, EndColumn: 50, Tags: []string{"decoded:base64", "decode-depth:1"}},
+		{RuleID: "hex", Secret: "secretvalue3", File: "a.txt", StartLine: 1, EndLine: 1, StartColumn: 20, EndColumn: 40, Tags: []string{"decoded:base64", "decoded:hex", "decode-depth:2"}},
+		{RuleID: "base64", Secret: "secretvalue4", File: "a.txt", StartLine: 5, EndLine: 5, StartColumn: 1, EndColumn: 20, Tags: []string{"decoded:base64", "decode-depth:1"}},
+		{RuleID: "hex", Secret: "secretvalue5", File: "b.txt", StartLine: 1, EndLine: 1, StartColumn: 20, EndColumn: 40, Tags: []string{"decoded:base64", "decoded:hex", "decode-depth:2"}},
+	}
+
+	results := make([]*proto.Result, len(findings))
+	for i, finding := range findings {
+		results[i] = findingToResult(request, &finding)
+	}
+
+	setDecodeParentIDs(results, findings)
+
+	assert.Empty(t, results[0].ParentID)
+	assert.Equal(t, results[0].ID, results[1].ParentID)
+	assert.Equal(t, results[1].ID, results[2].ParentID)
+	// Decoded secrets without an encoded result around them have no parent
+	assert.Empty(t, results[3].ParentID)
+	assert.Empty(t, results[4].ParentID)
+
+	t.Run("DecodeDepth", func(t *testing.T) {
+		assert.Equal(t, 0, decodeDepth(&findings[0]))
+		assert.Equal(t, 2, decodeDepth(&findings[2]))
+	})
+}
+
+func TestGitPermalink(t *testing.T) {
+	tests := []struct {
+		name     string
+		remote   string
+		expected string
+	}{
+		{"GitHubHTTPS", "https://github.com/leaktk/fake-leaks.git", "https://github.com/leaktk/fake-leaks/blob/abc123/a/b.txt#L7"},
+		{"GitHubSCP", "git@github.com:leaktk/fake-leaks.git", "https://github.com/leaktk/fake-leaks/blob/abc123/a/b.txt#L7"},
+		{"GitHubSSH", "ssh://git@github.com/leaktk/fake-leaks", "https://github.com/leaktk/fake-leaks/blob/abc123/a/b.txt#L7"},
+		{"GitLabSubgroup", "https://gitlab.com/group/subgroup/repo.git", "https://gitlab.com/group/subgroup/repo/-/blob/abc123/a/b.txt#L7"},
+		{"UnknownHost", "https://git.example.com/org/repo.git", ""},
+		{"LocalPath", "/tmp/repo", ""},
+		{"NoRepoPath", "https://github.com/leaktk", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, gitPermalink(tt.remote, "abc123", "a/b.txt", 7))
+		})
+	}
+
+	t.Run("NoCommit", func(t *testing.T) {
+		assert.Empty(t, gitPermalink("https://github.com/leaktk/fake-leaks.git", "", "a/b.txt", 7))
+	})
+}
+
+func TestGitArchiveURL(t *testing.T) {
+	tests := []struct {
+		name     string
+		remote   string
+		ref      string
+		expected string
+	}{
+		{"GitHubRef", "https://github.com/leaktk/fake-leaks.git", "main", "https://codeload.github.com/leaktk/fake-leaks/tar.gz/main"},
+		{"GitHubDefaultBranch", "git@github.com:leaktk/fake-leaks.git", "", "https://codeload.github.com/leaktk/fake-leaks/tar.gz/HEAD"},
+		{"GitLabRef", "https://gitlab.com/group/subgroup/repo.git", "feature/x", "https://gitlab.com/api/v4/projects/group%2Fsubgroup%2Frepo/repository/archive.tar.gz?sha=feature%2Fx"},
+		{"GitLabDefaultBranch", "https://gitlab.com/group/repo", "", "https://gitlab.com/api/v4/projects/group%2Frepo/repository/archive.tar.gz"},
+		{"UnknownHost", "https://git.example.com/org/repo.git", "main", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			archiveURL, ok := gitArchiveURL(tt.remote, tt.ref)
+			assert.Equal(t, tt.expected, archiveURL)
+			assert.Equal(t, len(tt.expected) > 0, ok)
+		})
+	}
+}
+
+func TestNewDetector(t *testing.T) {
+	cfg, err := betterleaks.ParseConfig(`
+[[rules]]
+id = "secret"
+regex = '''secret=[a-z]+'''
+
+[[rules]]
+id = "base64"
+regex = '''c2VjcmV0[A-Za-z0-9+/]+={0,2}'''
+`)
+	require.NoError(t, err)
+
+	// base64 of "secret=abcdefgh"
+	text := "data: c2VjcmV0PWFiY2RlZmdo\n"
+	scanner := &Scanner{maxDecodeDepth: 8}
+
+	t.Run("Decode", func(t *testing.T) {
+		detector := scanner.newDetector(t.Context(), cfg, &proto.Request{ID: "test-request"})
+		assert.Equal(t, 8, detector.MaxDecodeDepth)
+
+		findings, err := betterleaks.ScanReader(t.Context(), detector, strings.NewReader(text))
+		require.NoError(t, err)
+
+		var ruleIDs []string
+		for _, finding := range findings {
+			ruleIDs = append(ruleIDs, finding.RuleID)
+		}
+		assert.ElementsMatch(t, []string{"secret", "base64"}, ruleIDs)
+	})
+
+	t.Run("MaxArchiveDepth", func(t *testing.T) {
+		scanner := &Scanner{maxArchiveDepth: 8, maxArchiveDepthLimit: 16}
+
+		for depth, expected := range map[int]int{0: 8, 2: 2, 12: 12, 100: 16} {
+			detector := scanner.newDetector(t.Context(), cfg, &proto.Request{
+				ID:   "test-request",
+				Opts: proto.Opts{MaxArchiveDepth: depth},
+			})
+			assert.Equal(t, expected, detector.MaxArchiveDepth, "max_archive_depth=%d", depth)
+		}
+	})
+
+	t.Run("NoDecode", func(t *testing.T) {
+		detector := scanner.newDetector(t.Context(), cfg, &proto.Request{
+			ID:   "test-request",
+			Opts: proto.Opts{NoDecode: true},
+		})
+		assert.Equal(t, 0, detector.MaxDecodeDepth)
+
+		findings, err := betterleaks.ScanReader(t.Context(), detector, strings.NewReader(text))
+		require.NoError(t, err)
+		require.Len(t, findings, 1)
+		assert.Equal(t, "base64", findings[0].RuleID)
+		assert.Equal(t, "c2VjcmV0PWFiY2RlZmdo", findings[0].Secret)
+	})
+}
+
+func TestLoadSourceConfig(t *testing.T) {
+	cfg, err := betterleaks.ParseConfig(`
+[[rules]]
+id = "secret"
+regex = '''secret=[a-z]+'''
+`)
+	require.NoError(t, err)
+
+	t.Run("NestedConfigs", func(t *testing.T) {
+		sourcePath := t.TempDir()
+		files := map[string]string{
+			"root.txt":                "secret=rootsecret\n",
+			"team/.gitleaks.toml":     "[[allowlists]]\nregexes = ['''teamsecret''']\npaths = ['''^ignored\\.txt$''']\n\n[[rules]]\nid = \"team\"\nregex = '''token=[a-z]+'''\n",
+			"team/found.txt":          "secret=othersecret\ntoken=abcdefgh\n",
+			"team/allowed.txt":        "secret=teamsecret\n",
+			"team/ignored.txt":        "secret=ignoredsecret\n",
+			"team/nested/allowed.txt": "secret=teamsecret\n",
+			"other/allowed.txt":       "secret=teamsecret\n",
+			"other/ignored.txt":       "secret=ignoredsecret\n",
+		}
+		for path, content := range files {
+			path = filepath.Join(sourcePath, path)
+			require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+			require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+		}
+
+		detector := detect.NewDetectorContext(t.Context(), *cfg)
+		(&Scanner{}).loadSourceConfig(&scanJob{detector: detector}, sourcePath, sourcePath)
+
+		// Rules from nested configs are ignored
+		assert.NotContains(t, detector.Config.Rules, "team")
+		// The shared config must not change
+		assert.Empty(t, cfg.Rules["secret"].Allowlists)
+
+		findings, err := betterleaks.ScanFiles(t.Context(), detector, sourcePath, betterleaks.FilesScanOpts{})
+		require.NoError(t, err)
+
+		var paths []string
+		for _, finding := range findings {
+			rel, err := filepath.Rel(sourcePath, finding.File)
+			require.NoError(t, err)
+			paths = append(paths, filepath.ToSlash(rel))
+		}
+
+		assert.ElementsMatch(t, []string{
+			"root.txt",
+			"team/found.txt",
+			"other/allowed.txt",
+			"other/ignored.txt",
+		}, paths)
+	})
+
+	t.Run("RequestBaseline", func(t *testing.T) {
+		sourcePath := t.TempDir()
+		for _, name := range []string{"alpha", "bravo", "charlie"} {
+			require.NoError(t, os.WriteFile(filepath.Join(sourcePath, name+".txt"), []byte("secret="+name+"\n"), 0600))
+		}
+
+		baselineFindings := func(detector *detect.Detector) map[string]report.Finding {
+			findings, err := betterleaks.ScanFiles(t.Context(), detector, sourcePath, betterleaks.FilesScanOpts{})
+			require.NoError(t, err)
+
+			byPath := make(map[string]report.Finding)
+			for _, finding := range findings {
+				byPath[filepath.Base(finding.File)] = finding
+			}
+			return byPath
+		}
+
+		findings := baselineFindings(detect.NewDetectorContext(t.Context(), *cfg))
+		require.Len(t, findings, 3)
+
+		sourceBaseline, err := json.Marshal([]report.Finding{findings["alpha.txt"]})
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(filepath.Join(sourcePath, ".gitleaksbaseline"), sourceBaseline, 0600))
+
+		detector := detect.NewDetectorContext(t.Context(), *cfg)
+		job := &scanJob{detector: detector, requestBaseline: []report.Finding{findings["bravo.txt"]}}
+		(&Scanner{}).loadSourceConfig(job, sourcePath, sourcePath)
+
+		// Both the source's and the request's baselines apply
+		remaining := baselineFindings(detector)
+		assert.NotContains(t, remaining, "alpha.txt")
+		assert.NotContains(t, remaining, "bravo.txt")
+		assert.Contains(t, remaining, "charlie.txt")
+
+		t.Run("WithoutSourceBaseline", func(t *testing.T) {
+			detector := detect.NewDetectorContext(t.Context(), *cfg)
+			require.NoError(t, addBaseline(detector, []report.Finding{findings["charlie.txt"]}))
+
+			remaining := baselineFindings(detector)
+			assert.Contains(t, remaining, "alpha.txt")
+			assert.NotContains(t, remaining, "charlie.txt")
+		})
+	})
+
+	t.Run("FoldsAndDisablesAllowlists", func(t *testing.T) {
+		sourcePath := t.TempDir()
+		config := "[[allowlists]]\npaths = ['''^README\\.md$''']\n"
+		require.NoError(t, os.WriteFile(filepath.Join(sourcePath, ".gitleaks.toml"), []byte(config), 0600))
+
+		job := &scanJob{detector: detect.NewDetectorContext(t.Context(), *cfg), allowlists: newAllowlistReport()}
+		(&Scanner{caseInsensitivePaths: true}).loadSourceConfig(job, sourcePath, sourcePath)
+
+		// The source's allowlists end up in the report with folded paths
+		assert.Empty(t, job.detector.Config.Allowlists)
+		require.Len(t, job.allowlists.global, 1)
+		require.Len(t, job.allowlists.global[0].Paths, 1)
+		assert.Equal(t, "(?i)^README\\.md$", job.allowlists.global[0].Paths[0].String())
+	})
+}
+
+func TestScopeAllowlist(t *testing.T) {
+	cfg, err := betterleaks.ParseConfig(`
+[[allowlists]]
+commits = ["abc123"]
+paths = ['''^docs/''', '''\.md$''']
+regexes = ['''example''']
+stopwords = ["test"]
+
+[[allowlists]]
+condition = "AND"
+regexes = ['''example''']
+`)
+	require.NoError(t, err)
+	require.Len(t, cfg.Allowlists, 2)
+
+	t.Run("OR", func(t *testing.T) {
+		allowlists := scopeAllowlist(cfg.Allowlists[0], "team/app")
+		require.Len(t, allowlists, 4)
+
+		paths := allowlists[0]
+		assert.True(t, paths.PathAllowed("team/app/docs/usage.txt"))
+		assert.True(t, paths.PathAllowed("team/app/README.md"))
+		assert.False(t, paths.PathAllowed("docs/usage.txt"))
+		assert.False(t, paths.PathAllowed("team/app/src/docs/usage.txt"))
+		assert.False(t, paths.PathAllowed("README.md"))
+
+		for _, allowlist := range allowlists[1:] {
+			assert.Equal(t, betterleaksconfig.AllowlistMatchAnd, allowlist.MatchCondition)
+			assert.True(t, allowlist.PathAllowed("team/app/main.go"))
+			assert.False(t, allowlist.PathAllowed("team/application/main.go"))
+		}
+	})
+
+	t.Run("AND", func(t *testing.T) {
+		allowlists := scopeAllowlist(cfg.Allowlists[1], "team")
+		require.Len(t, allowlists, 1)
+		assert.Equal(t, betterleaksconfig.AllowlistMatchAnd, allowlists[0].MatchCondition)
+		assert.True(t, allowlists[0].PathAllowed("team/main.go"))
+		assert.False(t, allowlists[0].PathAllowed("main.go"))
+		assert.True(t, allowlists[0].RegexAllowed("example"))
+	})
+}
+
+func TestFollowSymlinks(t *testing.T) {
+	cfg, err := betterleaks.ParseConfig(`
+[[rules]]
+id = "secret"
+regex = '''secret=[a-z]+'''
+`)
+	require.NoError(t, err)
+
+	targetPath := filepath.Join(t.TempDir(), "target.txt")
+	require.NoError(t, os.WriteFile(targetPath, []byte("secret=abcdefgh\n"), 0600))
+
+	sourcePath := t.TempDir()
+	require.NoError(t, os.Symlink(targetPath, filepath.Join(sourcePath, "link.txt")))
+	// Loops must not break the scan
+	require.NoError(t, os.Symlink(filepath.Join(sourcePath, "loop-b"), filepath.Join(sourcePath, "loop-a")))
+	require.NoError(t, os.Symlink(filepath.Join(sourcePath, "loop-a"), filepath.Join(sourcePath, "loop-b")))
+	require.NoError(t, os.Symlink(sourcePath, filepath.Join(sourcePath, "self")))
+
+	scanner := &Scanner{}
+
+	t.Run("Disabled", func(t *testing.T) {
+		detector := scanner.newDetector(t.Context(), cfg, &proto.Request{ID: "test-request"})
+		findings, err := betterleaks.ScanFiles(t.Context(), detector, sourcePath, betterleaks.FilesScanOpts{})
+		require.NoError(t, err)
+		assert.Empty(t, findings)
+	})
+
+	t.Run("Enabled", func(t *testing.T) {
+		detector := scanner.newDetector(t.Context(), cfg, &proto.Request{
+			ID:   "test-request",
+			Opts: proto.Opts{FollowSymlinks: true},
+		})
+		findings, err := betterleaks.ScanFiles(t.Context(), detector, sourcePath, betterleaks.FilesScanOpts{})
+		require.NoError(t, err)
+		require.Len(t, findings, 1)
+		assert.Equal(t, filepath.Join(sourcePath, "link.txt"), findings[0].SymlinkFile)
+	})
+}
+
+func TestCloneGitRepo(t *testing.T) {
+	repoDir := t.TempDir()
+	commit := commitFiles(t, repoDir, map[string]string{"README.md": "hello\n"})
+	runGit(t, repoDir, "tag", "v1.0.0")
+
+	scanner := &Scanner{clonesDir: t.TempDir()}
+
+	t.Run("BranchHeadCommit", func(t *testing.T) {
+		gitRepoInfo, err := scanner.cloneGitRepo(t.Context(), repoDir, proto.Opts{Branch: "main"})
+		require.NoError(t, err)
+		assert.Equal(t, commit, gitRepoInfo.HeadCommit)
+	})
+
+	t.Run("NoBranch", func(t *testing.T) {
+		gitRepoInfo, err := scanner.cloneGitRepo(t.Context(), repoDir, proto.Opts{})
+		require.NoError(t, err)
+		assert.Empty(t, gitRepoInfo.HeadCommit)
+	})
+
+	t.Run("Tag", func(t *testing.T) {
+		gitRepoInfo, err := scanner.cloneGitRepo(t.Context(), repoDir, proto.Opts{Ref: "v1.0.0"})
+		require.NoError(t, err)
+		assert.Equal(t, commit, gitRepoInfo.HeadCommit)
+
+		tagCommit, err := git.RevParse(t.Context(), gitRepoInfo.GitDir, "v1.0.0")
+		require.NoError(t, err)
+		assert.Equal(t, commit, tagCommit)
+	})
+
+	t.Run("Commit", func(t *testing.T) {
+		gitRepoInfo, err := scanner.cloneGitRepo(t.Context(), repoDir, proto.Opts{Ref: commit})
+		require.NoError(t, err)
+		assert.Equal(t, commit, gitRepoInfo.HeadCommit)
+
+		_, err = git.RevParse(t.Context(), gitRepoInfo.GitDir, commit)
+		require.NoError(t, err)
+	})
+
+	t.Run("AbbreviatedCommit", func(t *testing.T) {
+		_, err := scanner.cloneGitRepo(t.Context(), repoDir, proto.Opts{Ref: commit[:7]})
+		require.Error(t, err)
+		assert.Contains(t, err.Error(), "remote ref does not exist")
+	})
+
+	t.Run("MissingBranch", func(t *testing.T) {
+		_, err := scanner.cloneGitRepo(t.Context(), repoDir, proto.Opts{Branch: "missing"})
+		require.Error(t, err)
+		assert.NotErrorIs(t, err, git.ErrRemoteUnreachable)
+		assert.Contains(t, err.Error(), "remote ref does not exist")
+	})
+
+	t.Run("UnreachableRemote", func(t *testing.T) {
+		// Accept connections but never respond so ls-remote hangs
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		defer listener.Close()
+
+		go func() {
+			for {
+				conn, err := listener.Accept()
+				if err != nil {
+					return
+				}
+				defer conn.Close()
+			}
+		}()
+
+		defaultTimeout := remoteRefTimeout
+		remoteRefTimeout = time.Second
+		defer func() { remoteRefTimeout = defaultTimeout }()
+
+		start := time.Now()
+		_, err = scanner.cloneGitRepo(t.Context(), "http://"+listener.Addr().String()+"/repo.git", proto.Opts{Branch: "main"})
+		require.ErrorIs(t, err, git.ErrRemoteUnreachable)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+		assert.Less(t, time.Since(start), 30*time.Second)
+	})
+
+	t.Run("WaitsForCloneSlot", func(t *testing.T) {
+		limited := &Scanner{clonesDir: t.TempDir(), cloneSlots: make(chan struct{}, 1)}
+		release, err := limited.acquireCloneSlot(t.Context())
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(t.Context(), 100*time.Millisecond)
+		defer cancel()
+		_, err = limited.cloneGitRepo(ctx, repoDir, proto.Opts{})
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// Once the slot is free the clone can run
+		release()
+		_, err = limited.cloneGitRepo(t.Context(), repoDir, proto.Opts{})
+		assert.NoError(t, err)
+		assert.Empty(t, limited.cloneSlots)
+	})
+}
+
+func TestIntroducedByContacts(t *testing.T) {
+	repoDir := t.TempDir()
+	commit := func(name, content string) string {
+		return commitFiles(
+			t, repoDir, map[string]string{"config.txt": content},
+			"GIT_AUTHOR_NAME="+name, "GIT_AUTHOR_EMAIL="+strings.ToLower(name)+"@example.com",
+		)
+	}
+
+	commit("Alice", "token = secretvalue1\n")
+	changedCommit := commit("Bob", "token = secretvalue1 # still needed\ntoken = secretvalue2\n")
+
+	findings := []report.Finding{
+		{Commit: changedCommit, File: "config.txt", Secret: "secretvalue1", Author: "Bob", Email: "bob@example.com"},
+		{Commit: changedCommit, File: "config.txt", Secret: "secretvalue2", Author: "Bob", Email: "bob@example.com"},
+		// Decoded secrets aren't in the file as is so they keep their author
+		{Commit: changedCommit, File: "config.txt", Secret: "decodedvalue", Author: "Bob", Email: "bob@example.com"},
+		{File: "config.txt", Secret: "secretvalue1", Author: "Bob", Email: "bob@example.com"},
+	}
+
+	setIntroducedByContacts(t.Context(), filepath.Join(repoDir, ".git"), findings)
+
+	assert.Equal(t, "Alice", findings[0].Author)
+	assert.Equal(t, "alice@example.com", findings[0].Email)
+	assert.Equal(t, "Bob", findings[1].Author)
+	assert.Equal(t, "Bob", findings[2].Author)
+	assert.Equal(t, "Bob", findings[3].Author)
+}
+
+func TestDiffHunkNotes(t *testing.T) {
+	repoDir := t.TempDir()
+	commitFiles(t, repoDir, map[string]string{"config.txt": "one\ntwo\nthree\n-- four\nfive\nsix\nseven\neight\nnine\nten\n"})
+
+	writeFile := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(repoDir, name), []byte(content), 0600))
+	}
+
+	// Staged: removes "-- four" and adds a token, unstaged: adds another one
+	writeFile("config.txt", "one\ntwo\nthree\ntoken = secretvalue1\nfive\nsix\nseven\neight\nnine\nten\n")
+	runGit(t, repoDir, "add", "-A")
+	writeFile("config.txt", "one\ntwo\nthree\ntoken = secretvalue1\nfive\nsix\nseven\neight\nnine\nten\ntoken = secretvalue2\n")
+
+	t.Run("Staged", func(t *testing.T) {
+		hunks, err := git.DiffHunks(t.Context(), repoDir, true)
+		require.NoError(t, err)
+		require.Len(t, hunks, 1)
+		assert.Equal(t, "config.txt", hunks[0].Path)
+		assert.Equal(t, 1, hunks[0].NewStart)
+		assert.Equal(t, 7, hunks[0].NewLines)
+
+		findings := []report.Finding{
+			{File: "config.txt", StartLine: 4},
+			{File: "other.txt", StartLine: 4},
+		}
+		results := []*proto.Result{{Notes: map[string]string{}}, {Notes: map[string]string{}}}
+		setDiffHunkNotes(results, findings, hunks)
+
+		assert.Equal(t, "@@ -1,7 +1,7 @@\n one\n two\n three\n--- four\n+token = secretvalue1\n five\n six\n seven\n", results[0].Notes["diff_hunk"])
+		assert.NotContains(t, results[1].Notes, "diff_hunk")
+	})
+
+	t.Run("Unstaged", func(t *testing.T) {
+		hunks, err := git.DiffHunks(t.Context(), repoDir, false)
+		require.NoError(t, err)
+		require.Len(t, hunks, 1)
+		assert.True(t, hunks[0].Contains(11))
+		assert.False(t, hunks[0].Contains(7))
+		assert.Contains(t, hunks[0].Text, "+token = secretvalue2\n")
+	})
+}
+
+func TestRemediations(t *testing.T) {
+	results := []*proto.Result{
+		{Rule: proto.Rule{ID: "aws-access-token"}},
+		{Rule: proto.Rule{ID: "generic-api-key"}},
+	}
+
+	setRemediations(results, map[string]string{"aws-access-token": "Deactivate the key in IAM"})
+	assert.Equal(t, "Deactivate the key in IAM", results[0].Rule.Remediation)
+	assert.Empty(t, results[1].Rule.Remediation)
+
+	// Rules without one are left out of the JSON
+	data, err := json.Marshal(results[1].Rule)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "remediation")
+}
+
+func TestSortResults(t *testing.T) {
+	results := []*proto.Result{
+		{ID: "4", Rule: proto.Rule{ID: "rule-a"}, Location: proto.Location{Path: "b.txt", Start: proto.Point{Line: 1}}},
+		{ID: "3", Rule: proto.Rule{ID: "rule-b"}, Location: proto.Location{Path: "a.txt", Start: proto.Point{Line: 2}}},
+		{ID: "2", Rule: proto.Rule{ID: "rule-a"}, Location: proto.Location{Path: "a.txt", Start: proto.Point{Line: 2}}},
+		{ID: "1", Rule: proto.Rule{ID: "rule-b"}, Location: proto.Location{Path: "a.txt", Start: proto.Point{Line: 1}}},
+	}
+
+	sortResults(results)
+
+	var ids []string
+	for _, result := range results {
+		ids = append(ids, result.ID)
+	}
+	assert.Equal(t, []string{"1", "2", "3", "4"}, ids)
+}
+
+func TestRemoteRefType(t *testing.T) {
+	sha := strings.Repeat("a", 40)
+
+	tests := []struct {
+		ref        string
+		remoteRefs []string
+		expected   string
+		err        string
+	}{
+		{ref: "main", remoteRefs: []string{"refs/heads/main"}, expected: branchRef},
+		{ref: "refs/heads/main", remoteRefs: []string{"refs/heads/main"}, expected: branchRef},
+		{ref: "v1.2.3", remoteRefs: []string{"refs/tags/v1.2.3"}, expected: tagRef},
+		{ref: "main", remoteRefs: []string{"refs/heads/main", "refs/tags/main"}, expected: branchRef},
+		{ref: "refs/tags/main", remoteRefs: []string{"refs/heads/main", "refs/tags/main"}, expected: tagRef},
+		{ref: sha, expected: commitRef},
+		{ref: strings.Repeat("b", 64), expected: commitRef},
+		{ref: "main", remoteRefs: []string{"refs/heads/feature/main"}, err: "could not determine ref type"},
+		{ref: "refs/pull/1/head", remoteRefs: []string{"refs/pull/1/head"}, err: "could not determine ref type"},
+		{ref: sha[:7], err: "remote ref does not exist"},
+		{ref: "missing", err: "remote ref does not exist"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.ref, func(t *testing.T) {
+			refType, err := remoteRefType(test.ref, test.remoteRefs)
+			if len(test.err) > 0 {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, refType)
+		})
+	}
+}
+
+func TestHistoryTruncated(t *testing.T) {
+	repoDir := t.TempDir()
+	for _, date := range []string{"2020-01-01T00:00:00Z", "2022-01-01T00:00:00Z"} {
+		commitFiles(t, repoDir, map[string]string{"README.md": date + "\n"}, "GIT_COMMITTER_DATE="+date, "GIT_AUTHOR_DATE="+date)
+	}
+
+	shallowDir := filepath.Join(t.TempDir(), "shallow")
+	require.NoError(t, exec.Command("git", "clone", "--depth", "1", "file://"+repoDir, shallowDir).Run()) // #nosec:G204
+	shallowGitDir := filepath.Join(shallowDir, ".git")
+
+	t.Run("SinceBeforeShallowHistory", func(t *testing.T) {
+		boundaryDate, truncated := historyTruncated(t.Context(), shallowGitDir, "2021-01-01")
+		assert.True(t, truncated)
+		assert.Equal(t, "2022-01-01T00:00:00Z", boundaryDate)
+	})
+
+	t.Run("SinceAfterShallowHistory", func(t *testing.T) {
+		_, truncated := historyTruncated(t.Context(), shallowGitDir, "2023-01-01")
+		assert.False(t, truncated)
+	})
+
+	t.Run("FullHistory", func(t *testing.T) {
+		_, truncated := historyTruncated(t.Context(), filepath.Join(repoDir, ".git"), "2019-01-01")
+		assert.False(t, truncated)
+	})
+}
+
+func TestSendDefaultPriorities(t *testing.T) {
+	scanner := &Scanner{
+		defaultPriorities: map[string]int{"ContainerImage": -10, "Text": 10},
+		scanQueue:         queue.NewPriorityQueue[*proto.Request](1, 0),
+	}
+
+	t.Run("KindDefault", func(t *testing.T) {
+		request := &proto.Request{Kind: proto.ContainerImageRequestKind}
+		scanner.Send(request)
+		assert.Equal(t, -10, request.Opts.Priority)
+	})
+
+	t.Run("ExplicitPriorityWins", func(t *testing.T) {
+		request := &proto.Request{Kind: proto.TextRequestKind, Opts: proto.Opts{Priority: 3}}
+		scanner.Send(request)
+		assert.Equal(t, 3, request.Opts.Priority)
+	})
+
+	t.Run("NoDefault", func(t *testing.T) {
+		request := &proto.Request{Kind: proto.GitRepoRequestKind}
+		scanner.Send(request)
+		assert.Equal(t, 0, request.Opts.Priority)
+	})
+}
+
+func TestHeartbeats(t *testing.T) {
+	t.Run("SentUntilStopped", func(t *testing.T) {
+		scanner := &Scanner{
+			heartbeatInterval: 10 * time.Millisecond,
+			responseQueue:     queue.NewPriorityQueue[*proto.Response](1, 0),
+		}
+
+		request := &proto.Request{ID: "test-heartbeat"}
+		stop := scanner.startHeartbeats(request, 0)
+		time.Sleep(55 * time.Millisecond)
+		stop()
+
+		sent := scanner.responseQueue.Size()
+		assert.Positive(t, sent)
+
+		// Nothing else should be queued after stopping
+		time.Sleep(30 * time.Millisecond)
+		assert.Equal(t, sent, scanner.responseQueue.Size())
+
+		responses := make(chan *proto.Response, sent)
+		go scanner.Recv(func(response *proto.Response) {
+			responses <- response
+		})
+
+		response := <-responses
+		assert.Equal(t, proto.HeartbeatResponseKind, response.Kind)
+		assert.Equal(t, "test-heartbeat", response.RequestID)
+		assert.NotEmpty(t, response.ID)
+		assert.Contains(t, response.Notes, "elapsed")
+		assert.NotContains(t, response.Notes, "files_scanned")
+	})
+
+	t.Run("FilesProgress", func(t *testing.T) {
+		scanner := &Scanner{
+			heartbeatInterval: 10 * time.Millisecond,
+			responseQueue:     queue.NewPriorityQueue[*proto.Response](1, 0),
+		}
+
+		// The total is left out until the walk is done
+		scanner.filesProgress.Store("test-files-heartbeat", &betterleaks.FilesProgress{})
+		stop := scanner.startHeartbeats(&proto.Request{ID: "test-files-heartbeat"}, 0)
+		time.Sleep(15 * time.Millisecond)
+		stop()
+
+		responses := make(chan *proto.Response, scanner.responseQueue.Size())
+		go scanner.Recv(func(response *proto.Response) {
+			responses <- response
+		})
+
+		response := <-responses
+		assert.Equal(t, "0", response.Notes["files_scanned"])
+		assert.NotContains(t, response.Notes, "files_total")
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		scanner := &Scanner{
+			responseQueue: queue.NewPriorityQueue[*proto.Response](1, 0),
+		}
+
+		stop := scanner.startHeartbeats(&proto.Request{ID: "test-no-heartbeat"}, 0)
+		time.Sleep(20 * time.Millisecond)
+		stop()
+
+		assert.Equal(t, 0, scanner.responseQueue.Size())
+	})
+}
+
+func TestScanWorkers(t *testing.T) {
+	scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+		cfg.Scanner.ScanWorkers = 0
+	})
+
+	scanner.Send(&proto.Request{
+		ID:       "test-no-workers",
+		Kind:     proto.TextRequestKind,
+		Resource: "token = secretvalue1",
+	})
+
+	select {
+	case response := <-responses:
+		assert.Equal(t, "test-no-workers", response.RequestID)
+		assert.Len(t, response.Results, 1)
+	case <-time.After(10 * time.Second):
+		assert.FailNow(t, "request was never scanned")
+	}
+}
+
+func TestResponseMetadata(t *testing.T) {
+	scanner, responses := newTestScanner(t, nil)
+
+	// Keys matching the scanner's notes are kept apart from them
+	metadata := map[string]string{"pipeline_id": "1234", "allowed_secrets": "passed through"}
+	scanner.Send(&proto.Request{
+		ID:       "test-metadata",
+		Kind:     proto.TextRequestKind,
+		Resource: "token = secretvalue1",
+		Opts:     proto.Opts{AllowedSecrets: []string{"secretvalue1"}, Metadata: metadata},
+	})
+
+	select {
+	case response := <-responses:
+		assert.Equal(t, metadata, response.Metadata)
+		assert.Equal(t, "1", response.Notes["allowed_secrets"])
+	case <-time.After(10 * time.Second):
+		assert.FailNow(t, "request was never scanned")
+	}
+}
+
+func TestMaxLineBytes(t *testing.T) {
+	scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+		cfg.Scanner.MaxLineBytes = 64
+	})
+
+	// The secret past the limit is cut off but the one on the next line is
+	// still found on the right line
+	scanner.Send(&proto.Request{
+		ID:       "test-max-line-bytes",
+		Kind:     proto.TextRequestKind,
+		Resource: "token = secretvalue1 " + strings.Repeat("x", 100) + " secretvalue2\ntoken = secretvalue3\n",
+	})
+
+	select {
+	case response := <-responses:
+		require.Nil(t, response.Error)
+		var found []string
+		for _, result := range response.Results {
+			found = append(found, fmt.Sprintf("%s:%d", result.Secret, result.Location.Start.Line))
+		}
+		assert.ElementsMatch(t, []string{"secretvalue1:1", "secretvalue3:2"}, found)
+		assert.Equal(t, "1", response.Notes["truncated_lines"])
+	case <-time.After(10 * time.Second):
+		assert.FailNow(t, "request was never scanned")
+	}
+}
+
+func TestStopOnFirst(t *testing.T) {
+	// The first file's finding is filtered out so the scan has to keep going
+	// to the second file's
+	sourcePath := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(sourcePath, "a.txt"), []byte("token = secretvalue1\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(sourcePath, "b.txt"), []byte("token = secretvalue2\n"), 0600))
+
+	patterns, err := betterleaks.ParseConfig(testPatterns)
+	require.NoError(t, err)
+	findings, err := betterleaks.ScanFiles(t.Context(), detect.NewDetectorContext(t.Context(), *patterns), sourcePath, betterleaks.FilesScanOpts{})
+	require.NoError(t, err)
+	require.Len(t, findings, 2)
+	idx := slices.IndexFunc(findings, func(finding report.Finding) bool { return finding.Secret == "secretvalue1" })
+	baseline, err := json.Marshal(findings[idx : idx+1])
+	require.NoError(t, err)
+
+	scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+		cfg.Scanner.AllowLocal = true
+		cfg.Scanner.FilesConcurrency = 1
+	})
+
+	for name, opts := range map[string]proto.Opts{
+		"Baselined":     {StopOnFirst: true, Baseline: baseline},
+		"AllowedSecret": {StopOnFirst: true, AllowedSecrets: []string{"secretvalue1"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			scanner.Send(&proto.Request{
+				ID:       "test-stop-on-first",
+				Kind:     proto.FilesRequestKind,
+				Resource: sourcePath,
+				Opts:     opts,
+			})
+
+			select {
+			case response := <-responses:
+				require.Nil(t, response.Error)
+				require.Len(t, response.Results, 1)
+				assert.Equal(t, "secretvalue2", response.Results[0].Secret)
+				assert.Equal(t, "true", response.Notes["stopped_on_first"])
+			case <-time.After(10 * time.Second):
+				assert.FailNow(t, "request was never scanned")
+			}
+		})
+	}
+}
+
+func TestScanResources(t *testing.T) {
+	scanner, responses := newTestScanner(t, nil)
+
+	t.Run("Aggregated", func(t *testing.T) {
+		scanner.Send(&proto.Request{
+			ID:       "test-resources",
+			Kind:     proto.TextRequestKind,
+			Resource: "token = secretvalue1",
+			Opts: proto.Opts{
+				Resources: []string{"nothing here", "token = secretvalue2\ntoken = secretvalue3"},
+			},
+		})
+
+		response := <-responses
+		assert.Equal(t, "test-resources", response.RequestID)
+		assert.Nil(t, response.Error)
+
+		secrets := make([]string, len(response.Results))
+		for i, result := range response.Results {
+			secrets[i] = result.Secret
+		}
+		assert.ElementsMatch(t, []string{"secretvalue1", "secretvalue2", "secretvalue3"}, secrets)
+	})
+
+	t.Run("ErrorKeepsResults", func(t *testing.T) {
+		repoDir := t.TempDir()
+		commitFiles(t, repoDir, map[string]string{"config.txt": "token = secretvalue4\n"})
+
+		request := &proto.Request{
+			ID:       "test-resources-error",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: repoDir,
+			Opts: proto.Opts{
+				Local:     true,
+				Resources: []string{filepath.Join(t.TempDir(), "missing")},
+			},
+		}
+		scanner.Send(request)
+
+		response := <-responses
+		require.NotNil(t, response.Error)
+		assert.Equal(t, sourceErrorCode, response.Error.Code)
+		assert.Equal(t, request, response.Error.Data)
+		require.Len(t, response.Results, 1)
+		assert.Equal(t, "secretvalue4", response.Results[0].Secret)
+	})
+}
+
+func TestResourceRequest(t *testing.T) {
+	request := &proto.Request{
+		ID:       "test",
+		Kind:     proto.URLRequestKind,
+		Resource: "https://example.com/a",
+		Opts: proto.Opts{
+			Priority:  5,
+			Resources: []string{"https://example.com/b"},
+		},
+	}
+
+	resource := resourceRequest(request, "https://example.com/b")
+	assert.Equal(t, "https://example.com/b", resource.Resource)
+	assert.Equal(t, 5, resource.Opts.Priority)
+	assert.Empty(t, resource.Opts.Resources)
+	// The original request is left alone
+	assert.Equal(t, []string{"https://example.com/b"}, request.Opts.Resources)
+}
+
+func TestMergeResponse(t *testing.T) {
+	response := &proto.Response{Results: []*proto.Result{{ID: "a"}}}
+	firstErr := &proto.Error{Code: scanErrorCode, Message: "first"}
+
+	mergeResponse(response, &proto.Response{
+		Results:     []*proto.Result{{ID: "b"}},
+		Allowlisted: []*proto.Result{{ID: "c"}},
+		Notes:       map[string]string{"commits_scanned": "2"},
+		Error:       firstErr,
+	}, "resources.0.")
+	mergeResponse(response, &proto.Response{
+		Error: &proto.Error{Code: scanErrorCode, Message: "second"},
+	}, "resources.1.")
+
+	assert.Len(t, response.Results, 2)
+	assert.Len(t, response.Allowlisted, 1)
+	assert.Equal(t, map[string]string{"resources.0.commits_scanned": "2"}, response.Notes)
+	assert.Same(t, firstErr, response.Error)
+}
+
+func TestLFSPointerResults(t *testing.T) {
+	oid := "4d7a214614ab2935c943f9e0ff69d22eadbb8f32b1258daaa5e2ca24d17e2393"
+	repoDir := t.TempDir()
+	commitFiles(t, repoDir, map[string]string{
+		"model.bin": "version https://git-lfs.github.com/spec/v1\noid sha256:" + oid + "\nsize 12345\n",
+	})
+
+	scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+		require.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte(`
+[[rules]]
+id = "test-rule"
+regex = '''[0-9a-f]{64}'''
+`), 0600))
+	})
+
+	t.Run("PointerTagged", func(t *testing.T) {
+		scanner.Send(&proto.Request{
+			ID:       "test-lfs",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: repoDir,
+			Opts:     proto.Opts{Local: true},
+		})
+
+		response := <-responses
+		assert.Nil(t, response.Error)
+		assert.Equal(t, "1", response.Notes["lfs_pointers"])
+		require.Len(t, response.Results, 1)
+		assert.Equal(t, oid, response.Results[0].Notes["lfs_pointer"])
+	})
+
+	t.Run("FetchWithoutGitLFS", func(t *testing.T) {
+		if exec.Command("git", "lfs", "version").Run() == nil {
+			t.Skip("git lfs is installed")
+		}
+
+		scanner.Send(&proto.Request{
+			ID:       "test-lfs-fetch",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: repoDir,
+			Opts:     proto.Opts{Local: true, FetchLFS: true},
+		})
+
+		// The pointer results are still returned with the error
+		response := <-responses
+		require.NotNil(t, response.Error)
+		assert.Contains(t, response.Error.Message, "git lfs is not installed")
+		require.Len(t, response.Results, 1)
+		assert.Equal(t, oid, response.Results[0].Notes["lfs_pointer"])
+	})
+}
+
+func TestScanSubmodules(t *testing.T) {
+	libDir := filepath.Join(t.TempDir(), "lib")
+	require.NoError(t, os.MkdirAll(libDir, 0700))
+	commitFiles(t, libDir, map[string]string{"config.txt": "token = secretvalue2\n"})
+
+	superDir := filepath.Join(t.TempDir(), "super")
+	require.NoError(t, os.MkdirAll(superDir, 0700))
+	commitFiles(t, superDir, map[string]string{"config.txt": "token = secretvalue1\n"})
+	runGit(t, superDir, "submodule", "add", libDir, "vendor/lib")
+	// A submodule pointing back at the superproject makes a cycle
+	runGit(t, superDir, "submodule", "add", superDir, "self")
+	runGit(t, superDir, "commit", "-m", "Add submodules", "--no-verify")
+
+	scanner, responses := newTestScanner(t, nil)
+
+	submodulePaths := func(response *proto.Response) map[string]string {
+		paths := make(map[string]string)
+		for _, result := range response.Results {
+			paths[result.Secret] = result.Notes["submodule"]
+		}
+		return paths
+	}
+
+	t.Run("Remote", func(t *testing.T) {
+		scanner.Send(&proto.Request{
+			ID:       "test-submodules",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: superDir,
+			Opts:     proto.Opts{Branch: "main", Submodules: true},
+		})
+
+		response := <-responses
+		assert.Nil(t, response.Error)
+		assert.Equal(t, map[string]string{"secretvalue1": "", "secretvalue2": "vendor/lib"}, submodulePaths(response))
+	})
+
+	t.Run("Local", func(t *testing.T) {
+		scanner.Send(&proto.Request{
+			ID:       "test-submodules-local",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: superDir,
+			Opts:     proto.Opts{Local: true, Submodules: true},
+		})
+
+		response := <-responses
+		assert.Nil(t, response.Error)
+		assert.Equal(t, map[string]string{"secretvalue1": "", "secretvalue2": "vendor/lib"}, submodulePaths(response))
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		scanner.Send(&proto.Request{
+			ID:       "test-no-submodules",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: superDir,
+			Opts:     proto.Opts{Local: true},
+		})
+
+		response := <-responses
+		assert.Equal(t, map[string]string{"secretvalue1": ""}, submodulePaths(response))
+	})
+}
+
+func TestDiffRefs(t *testing.T) {
+	repoDir := t.TempDir()
+	for i, tag := range []string{"v1", "v2", ""} {
+		commitFiles(t, repoDir, map[string]string{fmt.Sprintf("config%d.txt", i+1): fmt.Sprintf("token = secretvalue%d\n", i+1)})
+		if len(tag) > 0 {
+			runGit(t, repoDir, "tag", tag)
+		}
+	}
+	v1Commit := runGit(t, repoDir, "rev-parse", "v1")
+	v2Commit := runGit(t, repoDir, "rev-parse", "v2")
+
+	scanner, responses := newTestScanner(t, nil)
+
+	scan := func(opts proto.Opts) *proto.Response {
+		scanner.Send(&proto.Request{
+			ID:       "test-diff-refs",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: repoDir,
+			Opts:     opts,
+		})
+
+		return <-responses
+	}
+
+	for name, local := range map[string]bool{"Remote": false, "Local": true} {
+		t.Run(name, func(t *testing.T) {
+			// Ref is ignored so the clone has both tags
+			response := scan(proto.Opts{Local: local, Ref: "main", DiffRefs: &proto.GitDiffRefs{Base: "v1", Head: "v2"}})
+			require.Nil(t, response.Error)
+			require.Len(t, response.Results, 1)
+			assert.Equal(t, "secretvalue2", response.Results[0].Secret)
+			assert.Equal(t, v2Commit, response.Results[0].Location.Version)
+			assert.Equal(t, v1Commit, response.Notes["diff_base_commit"])
+			assert.Equal(t, v2Commit, response.Notes["diff_head_commit"])
+			assert.Equal(t, "1", response.Notes["commits_scanned"])
+		})
+	}
+
+	t.Run("MissingRef", func(t *testing.T) {
+		response := scan(proto.Opts{Local: true, DiffRefs: &proto.GitDiffRefs{Base: "v0", Head: "v2"}})
+		require.NotNil(t, response.Error)
+		assert.Equal(t, "could not resolve diff refs", response.Error.Message)
+		assert.Empty(t, response.Results)
+	})
+
+	t.Run("MissingHead", func(t *testing.T) {
+		response := scan(proto.Opts{Local: true, DiffRefs: &proto.GitDiffRefs{Base: "v1"}})
+		require.NotNil(t, response.Error)
+		assert.Equal(t, "diff_refs needs a base and head", response.Error.Message)
+	})
+}
+
+func TestIncrementalGitRef(t *testing.T) {
+	repoDir := t.TempDir()
+	commitFiles(t, repoDir, map[string]string{"config1.txt": "token = secretvalue1\n"})
+
+	scanner, responses := newTestScanner(t, nil)
+
+	scan := func() *proto.Response {
+		scanner.Send(&proto.Request{
+			ID:       "test-incremental",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: repoDir,
+			Opts:     proto.Opts{Local: true, Ref: "main", Incremental: true},
+		})
+
+		return <-responses
+	}
+
+	response := scan()
+	require.Nil(t, response.Error)
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, "secretvalue1", response.Results[0].Secret)
+
+	// A commit date from before the last scan would be missed by since
+	headCommit := commitFiles(
+		t, repoDir, map[string]string{"config2.txt": "token = secretvalue2\n"},
+		"GIT_AUTHOR_DATE=2001-01-01T00:00:00Z", "GIT_COMMITTER_DATE=2001-01-01T00:00:00Z",
+	)
+
+	response = scan()
+	require.Nil(t, response.Error)
+	require.Len(t, response.Results, 1)
+	assert.Equal(t, "secretvalue2", response.Results[0].Secret)
+	assert.Equal(t, headCommit, response.Notes["branch_head_commit"])
+
+	response = scan()
+	require.Nil(t, response.Error)
+	assert.Empty(t, response.Results)
+}
+
+func TestLocalBareRepo(t *testing.T) {
+	repoDir := t.TempDir()
+	for i := range 2 {
+		commitFiles(t, repoDir, map[string]string{fmt.Sprintf("config%d.txt", i+1): fmt.Sprintf("token = secretvalue%d\n", i+1)})
+	}
+
+	bareDir := filepath.Join(t.TempDir(), "repo.git")
+	runGit(t, repoDir, "clone", "--bare", "--quiet", repoDir, bareDir)
+	bareEntries, err := os.ReadDir(bareDir)
+	require.NoError(t, err)
+
+	info, err := git.GetRepoInfo(t.Context(), bareDir)
+	require.NoError(t, err)
+	assert.True(t, info.IsBare)
+	assert.Empty(t, info.WorkingTreePath)
+
+	scanner, responses := newTestScanner(t, nil)
+
+	scan := func(resource string, opts proto.Opts) *proto.Response {
+		opts.Local = true
+		scanner.Send(&proto.Request{
+			ID:       "test-local-bare-repo",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: resource,
+			Opts:     opts,
+		})
+
+		return <-responses
+	}
+
+	secrets := func(response *proto.Response) []string {
+		var secrets []string
+		for _, result := range response.Results {
+			secrets = append(secrets, result.Secret)
+		}
+		slices.Sort(secrets)
+		return secrets
+	}
+
+	t.Run("History", func(t *testing.T) {
+		response := scan(bareDir, proto.Opts{Submodules: true})
+		require.Nil(t, response.Error)
+		assert.Equal(t, []string{"secretvalue1", "secretvalue2"}, secrets(response))
+
+		// Nothing is written to or removed from the repo
+		entries, err := os.ReadDir(bareDir)
+		require.NoError(t, err)
+		assert.Equal(t, bareEntries, entries)
+	})
+
+	t.Run("Staged", func(t *testing.T) {
+		response := scan(bareDir, proto.Opts{Staged: true})
+		require.NotNil(t, response.Error)
+		assert.Equal(t, "staged and unstaged scans need a working tree", response.Error.Message)
+	})
+
+	t.Run("BranchHeadCommit", func(t *testing.T) {
+		headCommit, err := git.RevParse(t.Context(), bareDir, "main")
+		require.NoError(t, err)
+
+		response := scan(bareDir, proto.Opts{Branch: "main"})
+		require.Nil(t, response.Error)
+		assert.Equal(t, headCommit, response.Notes["branch_head_commit"])
+	})
+
+	t.Run("MissingRef", func(t *testing.T) {
+		response := scan(bareDir, proto.Opts{Ref: "missing"})
+		require.NotNil(t, response.Error)
+		assert.DirExists(t, bareDir)
+	})
+
+	t.Run("DetachedHead", func(t *testing.T) {
+		runGit(t, repoDir, "checkout", "--quiet", "--detach", "HEAD~1")
+		response := scan(repoDir, proto.Opts{})
+		require.Nil(t, response.Error)
+		assert.Equal(t, []string{"secretvalue1", "secretvalue2"}, secrets(response))
+	})
+}
+
+func TestSourceConfigStrategy(t *testing.T) {
+	repoDir := t.TempDir()
+	commitFiles(t, repoDir, map[string]string{
+		"config1.txt":    "token = secretvalue1\n",
+		"config2.txt":    "token = secretvalue2\n",
+		".gitleaks.toml": "[[allowlists]]\npaths = ['''config1\\.txt''']\n",
+	})
+
+	bareDir := filepath.Join(t.TempDir(), "repo.git")
+	runGit(t, repoDir, "clone", "--bare", "--quiet", repoDir, bareDir)
+
+	scan := func(strategy string, opts proto.Opts) *proto.Response {
+		scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+			cfg.Scanner.SourceConfigStrategy = strategy
+		})
+
+		scanner.Send(&proto.Request{
+			ID:       "test-source-config-strategy",
+			Kind:     proto.GitRepoRequestKind,
+			Resource: bareDir,
+			Opts:     opts,
+		})
+
+		response := <-responses
+		require.Nil(t, response.Error)
+		return response
+	}
+
+	tests := []struct {
+		name     string
+		strategy string
+		opts     proto.Opts
+	}{
+		{"Checkout", "checkout", proto.Opts{}},
+		{"Show", "show", proto.Opts{}},
+		{"LocalBareRepo", "checkout", proto.Opts{Local: true}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := scan(tt.strategy, tt.opts)
+			require.Len(t, response.Results, 1)
+			assert.Equal(t, "secretvalue2", response.Results[0].Secret)
+		})
+	}
+
+	assert.Equal(t, checkoutSourceConfig, sourceConfigStrategy(""))
+	assert.Equal(t, checkoutSourceConfig, sourceConfigStrategy("worktree"))
+}
+
+func TestResolveSubmoduleURL(t *testing.T) {
+	tests := []struct {
+		superproject string
+		submodule    string
+		expected     string
+	}{
+		{"https://github.com/org/super.git", "https://github.com/org/lib.git", "https://github.com/org/lib.git"},
+		{"https://github.com/org/super.git", "../lib.git", "https://github.com/org/lib.git"},
+		{"https://github.com/org/super/", "./lib", "https://github.com/org/super/lib"},
+		{"git@github.com:org/super.git", "../lib.git", "git@github.com:org/lib.git"},
+		{"/srv/repos/super", "../lib", "/srv/repos/lib"},
+	}
+
+	for _, test := range tests {
+		assert.Equal(t, test.expected, resolveSubmoduleURL(test.superproject, test.submodule), test.submodule)
+	}
+}
+
+func TestGitPath(t *testing.T) {
+	realGit, err := exec.LookPath("git")
+	require.NoError(t, err)
+
+	// A wrapper that logs each git command before running it
+	tempDir := t.TempDir()
+	gitPath := filepath.Join(tempDir, "git")
+	logPath := filepath.Join(tempDir, "git.log")
+	require.NoError(t, os.WriteFile(gitPath, []byte("#!/bin/sh\necho \"$@\" >> '"+logPath+"'\nexec '"+realGit+"' \"$@\"\n"), 0700)) // #nosec G306
+
+	// Restore PATH and the git path after the test
+	t.Setenv("PATH", os.Getenv("PATH"))
+	t.Cleanup(func() { _ = git.SetPath("") })
+
+	repoDir := t.TempDir()
+	commitFiles(t, repoDir, map[string]string{"config.txt": "token = secretvalue1\n"})
+
+	scanner, responses := newTestScanner(t, func(cfg *config.Config) {
+		cfg.Scanner.GitPath = gitPath
+	})
+	assert.Equal(t, gitPath, git.Path())
+
+	scanner.Send(&proto.Request{
+		ID:       "test-git-path",
+		Kind:     proto.GitRepoRequestKind,
+		Resource: repoDir,
+		Opts:     proto.Opts{Local: true},
+	})
+
+	response := <-responses
+	require.Nil(t, response.Error)
+	require.Len(t, response.Results, 1)
+
+	gitLog, err := os.ReadFile(logPath)
+	require.NoError(t, err)
+	// rev-parse is run by leaktk and log by betterleaks
+	assert.Contains(t, string(gitLog), "rev-parse")
+	assert.Contains(t, string(gitLog), " log ")
+}
+
+// testPatterns are the rules the scanners from newTestScanner have by default
+const testPatterns = `
+[[rules]]
+id = "test-rule"
+regex = '''secretvalue[0-9]+'''
+`
+
+// newTestScanner creates a scanner with one scan worker and testPatterns and
+// returns it with a channel of its responses. configure can change the config
+// before the scanner is created (e.g. to write different patterns).
+func newTestScanner(t *testing.T, configure func(cfg *config.Config)) (*Scanner, <-chan *proto.Response) {
+	t.Helper()
+
+	tempDir := t.TempDir()
+	cfg := config.DefaultConfig()
+	cfg.Scanner.ScanWorkers = 1
+	cfg.Scanner.Workdir = tempDir
+	cfg.Scanner.Patterns.Autofetch = false
+	cfg.Scanner.Patterns.Gitleaks.ConfigPath = filepath.Join(tempDir, "gitleaks.toml")
+	require.NoError(t, os.WriteFile(cfg.Scanner.Patterns.Gitleaks.ConfigPath, []byte(testPatterns), 0600))
+
+	if configure != nil {
+		configure(cfg)
+	}
+
+	scanner, err := NewScanner(cfg)
+	require.NoError(t, err)
+
+	responses := make(chan *proto.Response)
+	go scanner.Recv(func(response *proto.Response) {
+		responses <- response
+	})
+
+	return scanner, responses
+}
+
+// testGitCommand returns a git command that runs in dir as the test user
+func testGitCommand(dir string, args ...string) *exec.Cmd {
+	args = append([]string{
+		"-C", dir,
+		"-c", "user.name=LeakTK",
+		"-c", "user.email=leaktk@example.com",
+		"-c", "protocol.file.allow=always",
+	}, args...)
+
+	return exec.Command("git", args...) // #nosec G204
+}
+
+// runGit runs git in dir as the test user and returns its trimmed output
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+
+	output, err := testGitCommand(dir, args...).CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	return strings.TrimSpace(string(output))
+}
+
+// commitFiles writes the files to the repo in dir and commits them with env
+// added to the commit's environment (e.g. to set its date). The repo is
+// created on main if it doesn't exist yet. It returns the new commit.
+func commitFiles(t *testing.T, dir string, files map[string]string, env ...string) string {
+	t.Helper()
+
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		runGit(t, dir, "init", "--initial-branch", "main")
+	}
+
+	for path, content := range files {
+		path = filepath.Join(dir, path)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	}
+
+	runGit(t, dir, "add", "-A")
+
+	commit := testGitCommand(dir, "commit", "-m", "Update files", "--no-verify")
+	commit.Env = append(os.Environ(), env...)
+	output, err := commit.CombinedOutput()
+	require.NoError(t, err, string(output))
+
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
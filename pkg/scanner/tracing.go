@@ -0,0 +1,103 @@
+package scanner
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	"go.opentelemetry.io/otel/trace"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+
+	"github.com/leaktk/leaktk/pkg/config"
+	"github.com/leaktk/leaktk/pkg/proto"
+	"github.com/leaktk/leaktk/pkg/version"
+
+	httpclient "github.com/leaktk/leaktk/pkg/http"
+)
+
+const tracerName = "github.com/leaktk/leaktk/pkg/scanner"
+
+// SetupTracing exports scan spans to the configured OTLP endpoint. The
+// returned func flushes any pending spans and should be called before the
+// process exits. It does nothing when no endpoint is configured.
+func SetupTracing(ctx context.Context, cfg *config.Config) (func(context.Context) error, error) {
+	if len(cfg.Tracing.OTLPEndpoint) == 0 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	// Use the config's http settings so the exporter trusts the same CA certs
+	client, err := httpclient.NewClient(httpclient.ClientOptsFromConfig(cfg))
+	if err != nil {
+		return nil, fmt.Errorf("could not configure http client: %w", err)
+	}
+
+	exporter, err := otlptracehttp.New(
+		ctx,
+		otlptracehttp.WithEndpointURL(cfg.Tracing.OTLPEndpoint),
+		otlptracehttp.WithHTTPClient(client),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not create otlp exporter: %w endpoint=%q", err, cfg.Tracing.OTLPEndpoint)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceName("leaktk"),
+			semconv.ServiceVersion(version.Version),
+		)),
+	)
+	otel.SetTracerProvider(provider)
+
+	return provider.Shutdown, nil
+}
+
+// requestSpanAttributes describes a request without including anything that
+// could contain a secret
+func requestSpanAttributes(request *proto.Request) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{
+		attribute.String("leaktk.request.id", request.ID),
+		attribute.String("leaktk.request.kind", request.Kind.String()),
+	}
+
+	switch request.Kind {
+	case proto.TextRequestKind, proto.JSONDataRequestKind, proto.XMLDataRequestKind, proto.INIDataRequestKind:
+		// The resource is the content being scanned
+	case proto.GitRepoRequestKind, proto.URLRequestKind:
+		// Clone and fetch URLs may have credentials in them
+		if resourceURL, err := url.Parse(request.Resource); err == nil && resourceURL.User != nil {
+			resourceURL.User = nil
+			attrs = append(attrs, attribute.String("leaktk.request.resource", resourceURL.String()))
+		} else {
+			attrs = append(attrs, attribute.String("leaktk.request.resource", request.Resource))
+		}
+	default:
+		attrs = append(attrs, attribute.String("leaktk.request.resource", request.Resource))
+	}
+
+	return attrs
+}
+
+// startSpan starts a span from the global tracer provider which is a no-op
+// until SetupTracing installs an exporter
+func startSpan(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, name, opts...)
+}
+
+// endSpan records err on the span if set and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}